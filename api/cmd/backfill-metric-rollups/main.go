@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"purl/api/internal/app"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("Usage: backfill-metric-rollups <org-slug>")
+	}
+	slug := os.Args[1]
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("DATABASE_URL environment variable is required")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("ping db: %v", err)
+	}
+
+	var orgID string
+	err = db.QueryRowContext(context.Background(),
+		`SELECT id FROM organizations WHERE slug = $1`,
+		slug,
+	).Scan(&orgID)
+	if err == sql.ErrNoRows {
+		log.Fatalf("no organization found with slug %q", slug)
+	}
+	if err != nil {
+		log.Fatalf("query org: %v", err)
+	}
+
+	n, err := app.RebuildMetricRollups(context.Background(), db, orgID)
+	if err != nil {
+		log.Fatalf("backfill: %v", err)
+	}
+	log.Printf("rebuilt %d day(s) of metric rollups", n)
+}
@@ -11,6 +11,7 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/redis/go-redis/v9"
 	"purl/api/internal/app"
+	"purl/api/internal/events"
 	"purl/api/internal/ratelimit"
 )
 
@@ -72,7 +73,7 @@ func main() {
 		log.Fatalf("query org: %v", err)
 	}
 
-	if err := app.CatchUpZendeskTickets(context.Background(), db, limiter, orgID); err != nil {
+	if err := app.CatchUpZendeskTickets(context.Background(), db, limiter, events.NewBus(rdb), orgID); err != nil {
 		log.Fatalf("catch-up: %v", err)
 	}
 }
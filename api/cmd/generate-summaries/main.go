@@ -5,9 +5,14 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/redis/go-redis/v9"
 	"purl/api/internal/app"
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
 )
 
 func main() {
@@ -16,6 +21,12 @@ func main() {
 		log.Fatal("DATABASE_URL environment variable is required")
 	}
 
+	// Redis is needed by the actions of temperature_crossed automation rules.
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		log.Fatal("REDIS_URL environment variable is required")
+	}
+
 	ollamaURL := os.Getenv("OLLAMA_URL")
 	if ollamaURL == "" {
 		ollamaURL = "http://ollama:11434"
@@ -36,7 +47,26 @@ func main() {
 		log.Fatalf("ping db: %v", err)
 	}
 
-	n, err := app.GenerateSummaries(context.Background(), db, ollamaURL, ollamaModel)
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		log.Fatalf("parse redis url: %v", err)
+	}
+	rdb := redis.NewClient(opts)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		log.Fatalf("ping redis: %v", err)
+	}
+
+	maxReqs := int64(100)
+	if s := os.Getenv("ZENDESK_RATE_LIMIT"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid ZENDESK_RATE_LIMIT: %v", err)
+		}
+		maxReqs = n
+	}
+	limiter := ratelimit.New(rdb, "zendesk", maxReqs, time.Minute)
+
+	n, err := app.GenerateSummaries(context.Background(), db, ollamaURL, ollamaModel, limiter, events.NewBus(rdb))
 	if err != nil {
 		log.Fatalf("generate summaries: %v", err)
 	}
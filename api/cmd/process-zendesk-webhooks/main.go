@@ -11,6 +11,7 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/redis/go-redis/v9"
 	"purl/api/internal/app"
+	"purl/api/internal/events"
 	"purl/api/internal/ratelimit"
 )
 
@@ -54,7 +55,7 @@ func main() {
 	}
 	limiter := ratelimit.New(rdb, "zendesk", maxReqs, time.Minute)
 
-	n, err := app.ProcessPendingWebhooks(context.Background(), db, limiter)
+	n, err := app.ProcessPendingWebhooks(context.Background(), db, limiter, events.NewBus(rdb))
 	if err != nil {
 		log.Fatalf("process webhooks: %v", err)
 	}
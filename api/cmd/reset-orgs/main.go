@@ -50,14 +50,49 @@ func generateHex() string {
 	return hex.EncodeToString(b)
 }
 
+// purgeAuditEvents deletes the org's audit trail. audit_events is append-only,
+// so the delete must run in a transaction that explicitly opts in.
+func purgeAuditEvents(db *sql.DB, slug string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT set_config('purl.allow_audit_purge', 'on', true)`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM audit_events WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`, slug); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func resetOrg(db *sql.DB, limiter *ratelimit.Limiter, c client) {
+	if err := purgeAuditEvents(db, c.Slug); err != nil {
+		log.Fatalf("[%s] purge audit events: %v", c.Slug, err)
+	}
+
 	// Wipe all org data in FK-safe order. Using a subquery for org_id means
 	// each statement is a no-op if the org doesn't exist yet.
-	// Cascades: tickets→ticket_comments,board_tickets; customers→customer_emails,customer_phones; boards→board_columns
+	// Cascades: tickets→ticket_comments,board_tickets,ticket_notes,notifications,automation_runs; customers→customer_emails,customer_phones; boards→board_columns; bulk_jobs→bulk_job_items; tags→ticket_tags; automation_rules→automation_runs; routing_policies→routing_policy_agents; agents→agent_routing; tickets→sla_breaches; export_jobs→export_job_chunks
 	wipes := []string{
+		`DELETE FROM bulk_jobs     WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM zendesk_webhook_events WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM tickets       WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM tags          WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM customers     WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM macros        WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM automation_rules WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM routing_policies WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM sla_policies  WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM org_business_hours WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM org_holidays  WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM daily_ticket_metrics WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM daily_agent_metrics WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM metric_rollup_state WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM metric_rollup_dirty WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM export_jobs   WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
+		`DELETE FROM saved_views   WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM agents        WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM boards        WHERE org_id = (SELECT id FROM organizations WHERE slug = $1)`,
 		`DELETE FROM organizations WHERE slug = $1`,
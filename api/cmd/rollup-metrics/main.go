@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"purl/api/internal/app"
+)
+
+func main() {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		log.Fatal("DATABASE_URL environment variable is required")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		log.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		log.Fatalf("ping db: %v", err)
+	}
+
+	n, err := app.RollupMetrics(context.Background(), db)
+	if err != nil {
+		log.Fatalf("roll up metrics: %v", err)
+	}
+	if n > 0 {
+		log.Printf("rolled up %d day(s)", n)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
@@ -62,7 +63,7 @@ func main() {
 	creds := base64.StdEncoding.EncodeToString([]byte(email + "/token:" + apiKey))
 
 	// Fetch full ticket
-	ticketBody, err := app.ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d.json", ticketNumber))
+	ticketBody, err := app.ZendeskGet(context.Background(), nil, subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d.json", ticketNumber))
 	if err != nil {
 		log.Fatalf("fetch ticket: %v", err)
 	}
@@ -76,7 +77,7 @@ func main() {
 
 	if rawJSON {
 		// Also fetch comments and output everything as JSON
-		commentsBody, err := app.ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticketNumber))
+		commentsBody, err := app.ZendeskGet(context.Background(), nil, subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticketNumber))
 		if err != nil {
 			log.Fatalf("fetch comments: %v", err)
 		}
@@ -116,7 +117,7 @@ func main() {
 	}
 
 	// Fetch requester
-	requesterBody, err := app.ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/users/%d.json", ticket.RequesterID))
+	requesterBody, err := app.ZendeskGet(context.Background(), nil, subdomain, creds, fmt.Sprintf("/api/v2/users/%d.json", ticket.RequesterID))
 	if err != nil {
 		log.Fatalf("fetch requester: %v", err)
 	}
@@ -125,7 +126,7 @@ func main() {
 	// Fetch assignee
 	var assignee *zdUser
 	if ticket.AssigneeID != nil {
-		assigneeBody, err := app.ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/users/%d.json", *ticket.AssigneeID))
+		assigneeBody, err := app.ZendeskGet(context.Background(), nil, subdomain, creds, fmt.Sprintf("/api/v2/users/%d.json", *ticket.AssigneeID))
 		if err != nil {
 			log.Fatalf("fetch assignee: %v", err)
 		}
@@ -134,7 +135,7 @@ func main() {
 	}
 
 	// Fetch comments
-	commentsBody, err := app.ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticketNumber))
+	commentsBody, err := app.ZendeskGet(context.Background(), nil, subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticketNumber))
 	if err != nil {
 		log.Fatalf("fetch comments: %v", err)
 	}
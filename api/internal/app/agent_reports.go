@@ -0,0 +1,215 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"purl/api/internal/businesstime"
+)
+
+// agentPerformance is one agent's activity over a report's date range.
+type agentPerformance struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	// Replies counts the agent's public replies sent in the range.
+	Replies int `json:"replies"`
+	// Solved counts tickets assigned to the agent last solved in the range;
+	// a reopened ticket moves to the day it is solved again.
+	Solved int `json:"solved"`
+	// FirstResponse is the time to first reply on tickets whose first public
+	// agent reply was this agent's and was sent in the range.
+	FirstResponse durationStats `json:"first_response"`
+	// Handle is the time from received to solved of the tickets counted in
+	// Solved.
+	Handle durationStats `json:"handle"`
+	// AverageTemperature is the mean AI temperature (1-10) of the tickets
+	// counted in Solved that have one; null if none do.
+	AverageTemperature *float64 `json:"average_temperature"`
+	// Calls counts the voice calls the agent took in the range, and
+	// CallSeconds their total duration.
+	Calls       int `json:"calls"`
+	CallSeconds int `json:"call_seconds"`
+}
+
+type agentReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// AsOf is how fresh the report is: it reflects every change made before
+	// this. Null if the org's metrics haven't been rolled up yet.
+	AsOf   *time.Time         `json:"as_of"`
+	Agents []agentPerformance `json:"agents"`
+}
+
+// agentStats accumulates an agentPerformance.
+type agentStats struct {
+	perf                         agentPerformance
+	firstResponse, handle        durationSample
+	temperatureSum, temperatures int
+}
+
+// @Summary     Per-agent performance
+// @Tags        Reports
+// @Description Replies, solved tickets, first-response and handle times, average temperature of solved
+// @Description tickets and voice calls for each agent. Replies and calls are attributed to the comment
+// @Description author, solved tickets to the assignee. The Zendesk Automation system agent is left out.
+// @Produce     json
+// @Param       from  query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to    query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Success     200   {object}  agentReport
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/agents [get]
+func (a *App) getAgentReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	conn := a.conn(ctx)
+	orgID := orgFromContext(ctx).ID
+
+	rows, err := conn.QueryContext(ctx, `
+		SELECT id, name, email FROM agents
+		WHERE org_id = $1 AND zendesk_user_id IS DISTINCT FROM -1
+		ORDER BY name, id`, orgID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getAgentReport agents: %v", err)
+		return
+	}
+	var order []string
+	stats := map[string]*agentStats{}
+	for rows.Next() {
+		s := &agentStats{}
+		if err := rows.Scan(&s.perf.AgentID, &s.perf.Name, &s.perf.Email); err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("getAgentReport agents scan: %v", err)
+			return
+		}
+		order = append(order, s.perf.AgentID)
+		stats[s.perf.AgentID] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getAgentReport agents rows: %v", err)
+		return
+	}
+
+	// Ticket metrics are credited to the assignee, comment metrics to the
+	// author.
+	dayRange := `m.org_id = $1 AND m.day >= $2 AND m.day < $3`
+	args := []any{orgID, f.From.Format(businesstime.DateLayout), f.To.Format(businesstime.DateLayout)}
+	steps := []struct {
+		name  string
+		query string
+		scan  func(scan func(...any) error) error
+	}{
+		{"solved", `
+			SELECT m.assignee_id, SUM(m.solved), SUM(m.temperature_sum), SUM(m.temperature_count)
+			FROM daily_ticket_metrics m
+			WHERE ` + dayRange + ` AND m.assignee_id IS NOT NULL
+			GROUP BY 1`,
+			func(scan func(...any) error) error {
+				var agentID string
+				var solved, temperatureSum, temperatures int
+				if err := scan(&agentID, &solved, &temperatureSum, &temperatures); err != nil {
+					return err
+				}
+				if s := stats[agentID]; s != nil {
+					s.perf.Solved = solved
+					s.temperatureSum, s.temperatures = temperatureSum, temperatures
+				}
+				return nil
+			}},
+		{"handle", `
+			SELECT m.assignee_id, u.raw, u.business
+			FROM daily_ticket_metrics m
+			CROSS JOIN LATERAL unnest(m.resolution_seconds, m.resolution_business_seconds) AS u(raw, business)
+			WHERE ` + dayRange + ` AND m.assignee_id IS NOT NULL`,
+			func(scan func(...any) error) error {
+				var agentID string
+				var raw, business int64
+				if err := scan(&agentID, &raw, &business); err != nil {
+					return err
+				}
+				if s := stats[agentID]; s != nil {
+					s.handle.add(raw, business)
+				}
+				return nil
+			}},
+		{"activity", `
+			SELECT m.agent_id, SUM(m.replies), SUM(m.calls), SUM(m.call_seconds)
+			FROM daily_agent_metrics m
+			WHERE ` + dayRange + `
+			GROUP BY 1`,
+			func(scan func(...any) error) error {
+				var agentID string
+				var replies, calls, callSeconds int
+				if err := scan(&agentID, &replies, &calls, &callSeconds); err != nil {
+					return err
+				}
+				if s := stats[agentID]; s != nil {
+					s.perf.Replies, s.perf.Calls, s.perf.CallSeconds = replies, calls, callSeconds
+				}
+				return nil
+			}},
+		{"first response", `
+			SELECT m.agent_id, u.raw, u.business
+			FROM daily_agent_metrics m
+			CROSS JOIN LATERAL unnest(m.first_response_seconds, m.first_response_business_seconds) AS u(raw, business)
+			WHERE ` + dayRange,
+			func(scan func(...any) error) error {
+				var agentID string
+				var raw, business int64
+				if err := scan(&agentID, &raw, &business); err != nil {
+					return err
+				}
+				if s := stats[agentID]; s != nil {
+					s.firstResponse.add(raw, business)
+				}
+				return nil
+			}},
+	}
+	for _, step := range steps {
+		if err := queryEach(ctx, conn, step.query, args, step.scan); err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("getAgentReport %s: %v", step.name, err)
+			return
+		}
+	}
+
+	report := agentReport{From: f.From, To: f.To, AsOf: f.asOf, Agents: make([]agentPerformance, 0, len(order))}
+	for _, id := range order {
+		s := stats[id]
+		s.perf.FirstResponse = s.firstResponse.stats()
+		s.perf.Handle = s.handle.stats()
+		if s.temperatures > 0 {
+			avg := float64(s.temperatureSum) / float64(s.temperatures)
+			s.perf.AverageTemperature = &avg
+		}
+		report.Agents = append(report.Agents, s.perf)
+	}
+	writeReport(w, report)
+}
+
+// queryEach runs query and calls fn with each row's Scan.
+func queryEach(ctx context.Context, q queryer, query string, args []any, fn func(scan func(...any) error) error) error {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows.Scan); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+	}
+	return rows.Err()
+}
@@ -9,6 +9,9 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
 )
 
 // aiAnalysis is the JSON structure returned by the LLM for each ticket.
@@ -20,8 +23,10 @@ type aiAnalysis struct {
 
 // GenerateSummaries finds tickets where ai_summary IS NULL, ai_summary_stale = TRUE,
 // or ai_title IS NULL, generates an AI analysis via Ollama for each, and updates the DB.
+// A temperature that rises past a temperature_crossed rule's threshold runs
+// that rule; limiter and bus are used by its actions and may be nil.
 // Returns count of successfully updated tickets.
-func GenerateSummaries(ctx context.Context, db *sql.DB, ollamaURL, ollamaModel string) (int, error) {
+func GenerateSummaries(ctx context.Context, db *sql.DB, ollamaURL, ollamaModel string, limiter *ratelimit.Limiter, bus *events.Bus) (int, error) {
 	client := newOllamaClient(ollamaURL, ollamaModel)
 
 	if err := client.pullModel(ctx); err != nil {
@@ -147,21 +152,32 @@ func GenerateSummaries(ctx context.Context, db *sql.DB, ollamaURL, ollamaModel s
 			}
 
 			// ai_title uses COALESCE so it is only set on first generation and never overwritten.
-			if _, err := db.ExecContext(ctx, `
-				UPDATE tickets
-				SET ai_title = COALESCE(ai_title, $1),
+			var orgID string
+			var oldTemperature *int
+			if err := db.QueryRowContext(ctx, `
+				UPDATE tickets t
+				SET ai_title = COALESCE(t.ai_title, $1),
 				    ai_summary = $2,
 				    ai_temperature = $3,
 				    ai_summary_stale = FALSE,
 				    ai_summary_error_count = 0,
 				    ai_summary_last_error = NULL
-				WHERE id = $4`,
+				FROM (SELECT id, ai_temperature FROM tickets WHERE id = $4 FOR UPDATE) old
+				WHERE t.id = old.id
+				RETURNING t.org_id, old.ai_temperature`,
 				analysis.Title, analysis.Summary, analysis.Temperature, t.id,
-			); err != nil {
+			).Scan(&orgID, &oldTemperature); err != nil {
 				log.Printf("generate-summaries: ticket %s: update: %v", t.id, err)
 				return
 			}
 			updated.Add(1)
+
+			if oldTemperature == nil || analysis.Temperature > *oldTemperature {
+				ev := automationEvent{Trigger: triggerTemperatureCrossed, FromTemperature: oldTemperature, ToTemperature: analysis.Temperature}
+				if err := runAutomations(ctx, db, orgID, t.id, ev, limiter, bus); err != nil {
+					log.Printf("generate-summaries: ticket %s: automations: %v", t.id, err)
+				}
+			}
 		}()
 	}
 	wg.Wait()
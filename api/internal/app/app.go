@@ -3,22 +3,68 @@ package app
 import (
 	"database/sql"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/redis/go-redis/v9"
 	httpSwagger "github.com/swaggo/http-swagger"
+	"purl/api/internal/diskcache"
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
 )
 
 // App holds shared dependencies for all handlers.
 type App struct {
 	db    *sql.DB
 	redis *redis.Client
+	// bus publishes per-org change events to SSE subscribers.
+	bus *events.Bus
+
+	// recordings caches proxied call recordings on local disk; nil disables caching.
+	recordings *diskcache.Cache
+	// recordingFills tracks cache keys with a background download in flight.
+	recordingFillsMu sync.Mutex
+	recordingFills   map[string]bool
+
+	// zendeskLimiter throttles write-back calls to Zendesk. It shares its Redis
+	// budget with the background commands' limiter.
+	zendeskLimiter *ratelimit.Limiter
+
+	// Inbound request budgets; nil disables the corresponding limit.
+	orgLimiter     *ratelimit.Limiter
+	keyLimiter     *ratelimit.Limiter
+	webhookLimiter *ratelimit.Limiter
+}
+
+// Config holds optional dependencies for App. The zero value is valid.
+type Config struct {
+	// RecordingCache stores call recordings fetched from Zendesk. Nil disables caching.
+	RecordingCache *diskcache.Cache
+	// RateLimits sets inbound request budgets. The zero value disables them.
+	RateLimits RateLimits
+	// ZendeskRateLimit caps outbound Zendesk API requests per minute per account.
+	// Zero disables throttling.
+	ZendeskRateLimit int64
 }
 
-// New constructs an App with the given database and Redis client.
-func New(db *sql.DB, rdb *redis.Client) *App {
-	return &App{db: db, redis: rdb}
+// New constructs an App with the given database, Redis client and config.
+func New(db *sql.DB, rdb *redis.Client, cfg Config) *App {
+	a := &App{
+		db:             db,
+		redis:          rdb,
+		bus:            events.NewBus(rdb),
+		recordings:     cfg.RecordingCache,
+		recordingFills: map[string]bool{},
+	}
+	if cfg.ZendeskRateLimit > 0 && rdb != nil {
+		a.zendeskLimiter = ratelimit.New(rdb, "zendesk", cfg.ZendeskRateLimit, time.Minute)
+	}
+	a.orgLimiter = newLimiter(a, "api-org", cfg.RateLimits.OrgPerMinute)
+	a.keyLimiter = newLimiter(a, "api-key", cfg.RateLimits.KeyPerMinute)
+	a.webhookLimiter = newLimiter(a, "webhook", cfg.RateLimits.WebhookPerMinute)
+	return a
 }
 
 // Handler builds and returns the chi router with all middleware and routes registered.
@@ -33,16 +79,23 @@ func (a *App) Handler() http.Handler {
 	})
 	r.Get("/docs/*", httpSwagger.Handler())
 	r.Get("/health", a.health)
-	r.Post("/webhooks/zendesk/{orgSlug}", a.handleZendeskWebhook)
+	r.With(rateLimit(a.webhookLimiter, webhookBudget)).Post("/webhooks/zendesk/{orgSlug}", a.handleZendeskWebhook)
 	r.Options("/*", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
 	// Recording proxy uses query-param auth so <audio> elements can reference it directly
-	r.Get("/tickets/{ticketID}/comments/{commentID}/recording", a.proxyRecording)
+	r.With(rateLimit(a.keyLimiter, apiKeyBudget)).Get("/tickets/{ticketID}/comments/{commentID}/recording", a.proxyRecording)
+	// EventSource can't send headers either, so the event stream also takes ?api_key=
+	r.With(rateLimit(a.keyLimiter, apiKeyBudget)).Get("/events", a.streamEvents)
+	// Export downloads are authenticated by the token in the path, so links can be opened directly
+	r.Get("/exports/download/{token}", a.downloadExport)
 
 	r.Group(func(r chi.Router) {
+		r.Use(rateLimit(a.keyLimiter, apiKeyBudget))
 		r.Use(a.requireAPIKey)
+		r.Use(rateLimit(a.orgLimiter, orgBudget))
+		r.Use(a.scopeToOrg)
 		r.Get("/kanbans", a.listKanbans)
 		r.Post("/kanbans", a.createKanban)
 		r.Delete("/kanbans/{boardID}", a.deleteKanban)
@@ -50,9 +103,89 @@ func (a *App) Handler() http.Handler {
 		r.Get("/kanbans/{boardID}/tickets", a.listKanbanTickets)
 		r.Put("/kanbans/{boardID}/columns", a.putKanbanColumns)
 		r.Put("/kanbans/{boardID}/columns/{columnID}/tickets", a.putColumnTickets)
+		r.Get("/audit-events", a.listAuditEvents)
+		r.Get("/notifications", a.listNotifications)
+		r.Get("/notifications/unread-count", a.getUnreadNotificationCount)
+		r.Put("/notifications/read", a.markAllNotificationsRead)
+		r.Put("/notifications/{notificationID}/read", a.markNotificationRead)
 		r.Get("/org", a.getOrg)
+		r.Get("/search", a.searchTickets)
+		r.Get("/tags", a.listTags)
 		r.Get("/tickets", a.listTickets)
+		r.Post("/tickets/bulk", a.createBulkJob)
+		r.Get("/tickets/bulk/{jobID}", a.getBulkJob)
+		r.Get("/tickets/{ticketID}", a.getTicket)
 		r.Get("/tickets/{ticketID}/comments", a.listTicketComments)
+		r.Post("/tickets/{ticketID}/replies", a.postTicketReply)
+		r.Put("/tickets/{ticketID}/presence", a.putTicketPresence)
+		r.Delete("/tickets/{ticketID}/presence", a.deleteTicketPresence)
+		r.Put("/tickets/{ticketID}/read", a.markTicketRead)
+		r.Delete("/tickets/{ticketID}/read", a.markTicketUnread)
+		r.Put("/tickets/{ticketID}/star", a.starTicket)
+		r.Delete("/tickets/{ticketID}/star", a.unstarTicket)
+		r.Put("/tickets/{ticketID}/follow", a.followTicket)
+		r.Delete("/tickets/{ticketID}/follow", a.unfollowTicket)
+		r.Put("/tickets/{ticketID}/snooze", a.snoozeTicket)
+		r.Delete("/tickets/{ticketID}/snooze", a.unsnoozeTicket)
+		r.Get("/tickets/{ticketID}/notes", a.listTicketNotes)
+		r.Post("/tickets/{ticketID}/notes", a.createTicketNote)
+		r.Patch("/tickets/{ticketID}/notes/{noteID}", a.updateTicketNote)
+		r.Delete("/tickets/{ticketID}/notes/{noteID}", a.deleteTicketNote)
+		r.Get("/tickets/{ticketID}/notes/{noteID}/versions", a.listTicketNoteVersions)
+		r.Post("/tickets/{ticketID}/tags", a.addTagsToTicket)
+		r.Delete("/tickets/{ticketID}/tags", a.removeTagsFromTicket)
+		r.Get("/tickets/{ticketID}/macros/{macroID}/preview", a.previewMacro)
+		r.Post("/tickets/{ticketID}/macros/{macroID}/apply", a.applyMacro)
+		r.Get("/tickets/{ticketID}/automation-runs", a.listTicketAutomationRuns)
+		r.Get("/automations", a.listAutomationRules)
+		r.Post("/automations", a.createAutomationRule)
+		r.Get("/automations/{ruleID}", a.getAutomationRule)
+		r.Patch("/automations/{ruleID}", a.updateAutomationRule)
+		r.Delete("/automations/{ruleID}", a.deleteAutomationRule)
+		r.Get("/automations/{ruleID}/runs", a.listAutomationRuleRuns)
+		r.Get("/queue/next", a.queueNext)
+		r.Get("/sla-policies", a.listSLAPolicies)
+		r.Post("/sla-policies", a.createSLAPolicy)
+		r.Get("/sla-policies/{policyID}", a.getSLAPolicy)
+		r.Patch("/sla-policies/{policyID}", a.updateSLAPolicy)
+		r.Delete("/sla-policies/{policyID}", a.deleteSLAPolicy)
+		r.Get("/reports/sla", a.getSLAReport)
+		r.Get("/reports/volume", a.getVolumeReport)
+		r.Get("/reports/first-response", a.getFirstResponseReport)
+		r.Get("/reports/resolution", a.getResolutionReport)
+		r.Get("/reports/one-touch", a.getOneTouchReport)
+		r.Get("/reports/backlog", a.getBacklogReport)
+		r.Get("/reports/channels", a.getChannelReport)
+		r.Get("/reports/agents", a.getAgentReport)
+		r.Post("/exports", a.createExport)
+		r.Get("/exports", a.listExports)
+		r.Get("/exports/{exportID}", a.getExport)
+		r.Get("/business-hours", a.getBusinessHours)
+		r.Put("/business-hours", a.putBusinessHours)
+		r.Delete("/business-hours", a.deleteBusinessHours)
+		r.Post("/business-hours/holidays", a.createHoliday)
+		r.Delete("/business-hours/holidays/{holidayID}", a.deleteHoliday)
+		r.Get("/routing-policies", a.listRoutingPolicies)
+		r.Post("/routing-policies", a.createRoutingPolicy)
+		r.Get("/routing-policies/{policyID}", a.getRoutingPolicy)
+		r.Patch("/routing-policies/{policyID}", a.updateRoutingPolicy)
+		r.Delete("/routing-policies/{policyID}", a.deleteRoutingPolicy)
+		r.Get("/agents/routing", a.listAgentRouting)
+		r.Put("/agents/{agentID}/routing", a.putAgentRouting)
+		r.Put("/agents/{agentID}/pause", a.pauseAgent)
+		r.Delete("/agents/{agentID}/pause", a.resumeAgent)
+		r.Get("/macros", a.listMacros)
+		r.Post("/macros", a.createMacro)
+		r.Get("/macros/{macroID}", a.getMacro)
+		r.Patch("/macros/{macroID}", a.updateMacro)
+		r.Delete("/macros/{macroID}", a.deleteMacro)
+		r.Get("/views", a.listViews)
+		r.Post("/views", a.createView)
+		r.Get("/views/counts", a.listViewCounts)
+		r.Get("/views/{viewID}", a.getView)
+		r.Patch("/views/{viewID}", a.updateView)
+		r.Delete("/views/{viewID}", a.deleteView)
+		r.Get("/views/{viewID}/tickets", a.listViewTickets)
 	})
 
 	return r
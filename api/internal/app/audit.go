@@ -0,0 +1,341 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execer is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// queryer is satisfied by *sql.DB, *sql.Conn and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// auditEntry describes one mutating action. Before and After are marshalled to
+// JSON as-is; either may be nil (creates have no before, deletes no after).
+type auditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     any
+	After      any
+}
+
+// recordAudit appends an audit event attributed to the caller in ctx. It should
+// be called with the same transaction as the change itself so the event is
+// written if and only if the change commits. The actor is the agent named by
+// x-agent-id when present, otherwise the org API key.
+func recordAudit(ctx context.Context, ex execer, e auditEntry) error {
+	o := orgFromContext(ctx)
+	info := requestInfoFromContext(ctx)
+
+	actorType := "api_key"
+	var actorID *string
+	actorName := "API key …" + o.APIKey[max(len(o.APIKey)-4, 0):]
+	if ag, ok := agentFromContext(ctx); ok {
+		actorType = "agent"
+		actorID = &ag.ID
+		actorName = ag.Name
+	}
+
+	before, err := marshalAuditValue(e.Before)
+	if err != nil {
+		return fmt.Errorf("marshal before: %w", err)
+	}
+	after, err := marshalAuditValue(e.After)
+	if err != nil {
+		return fmt.Errorf("marshal after: %w", err)
+	}
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return fmt.Errorf("compute diff: %w", err)
+	}
+
+	_, err = ex.ExecContext(ctx, `
+		INSERT INTO audit_events (org_id, actor_type, actor_id, actor_name, action,
+		                          target_type, target_id, before, after, diff, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, ''))`,
+		o.ID, actorType, actorID, actorName, e.Action,
+		e.TargetType, e.TargetID, before, after, diff, info.IP, info.UserAgent,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit event: %w", err)
+	}
+	return nil
+}
+
+// actorContext rebuilds the request context of a past caller for work done on
+// their behalf later, e.g. by a background worker, so recordAudit attributes it
+// to them. agentID may be nil for API-key callers; an agent that has since been
+// deleted is attributed to the API key instead.
+func actorContext(ctx context.Context, q queryer, orgID string, agentID *string, info requestInfo) (context.Context, error) {
+	var o org
+	err := q.QueryRowContext(ctx,
+		`SELECT id, name, api_key, COALESCE(zendesk_subdomain, '') FROM organizations WHERE id = $1`, orgID,
+	).Scan(&o.ID, &o.Name, &o.APIKey, &o.ZendeskSubdomain)
+	if err != nil {
+		return nil, fmt.Errorf("load org: %w", err)
+	}
+	ctx = context.WithValue(ctx, orgContextKey, o)
+	ctx = context.WithValue(ctx, requestContextKey, info)
+
+	if agentID != nil {
+		var ag agent
+		err := q.QueryRowContext(ctx,
+			`SELECT id, name, email FROM agents WHERE id = $1 AND org_id = $2`, *agentID, orgID,
+		).Scan(&ag.ID, &ag.Name, &ag.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("load agent: %w", err)
+		}
+		if err == nil {
+			ctx = context.WithValue(ctx, agentContextKey, ag)
+		}
+	}
+	return ctx, nil
+}
+
+// marshalAuditValue returns nil for a nil value so the column is stored as SQL NULL.
+func marshalAuditValue(v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
+
+// auditDiff compares two JSON documents and returns {"field": {"from": x, "to": y}}
+// for every top-level field whose value changed. Non-object documents (e.g. the
+// ordered ticket list of a column) are compared as a whole under the "value" key.
+// Returns nil when nothing changed.
+func auditDiff(before, after []byte) ([]byte, error) {
+	type change struct {
+		From any `json:"from"`
+		To   any `json:"to"`
+	}
+
+	var b, a any
+	if before != nil {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := map[string]change{}
+	bm, bIsObj := b.(map[string]any)
+	am, aIsObj := a.(map[string]any)
+	if (bIsObj || b == nil) && (aIsObj || a == nil) {
+		for k, bv := range bm {
+			if av, ok := am[k]; !ok || !reflect.DeepEqual(av, bv) {
+				diff[k] = change{From: bv, To: am[k]}
+			}
+		}
+		for k, av := range am {
+			if _, ok := bm[k]; !ok {
+				diff[k] = change{From: nil, To: av}
+			}
+		}
+	} else if !reflect.DeepEqual(a, b) {
+		diff["value"] = change{From: b, To: a}
+	}
+
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(diff)
+}
+
+type auditEventRow struct {
+	ID         string          `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ActorType  string          `json:"actor_type"`
+	ActorID    *string         `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before" swaggertype:"object"`
+	After      json.RawMessage `json:"after" swaggertype:"object"`
+	Diff       json.RawMessage `json:"diff" swaggertype:"object"`
+	IP         *string         `json:"ip"`
+	UserAgent  *string         `json:"user_agent"`
+}
+
+type auditEventsResponse struct {
+	Events []auditEventRow `json:"events"`
+	// NextCursor is passed back as ?cursor= to fetch the next (older) page. Null on the last page.
+	NextCursor *string `json:"next_cursor"`
+}
+
+// @Summary     List audit events
+// @Tags        Audit
+// @Description Returns audit events for the org, newest first, paginated with an opaque cursor.
+// @Description All filters are optional and combined with AND.
+// @Produce     json
+// @Param       action       query     string  false  "Exact action name, e.g. kanban.update"
+// @Param       actor_id     query     string  false  "Agent ID"
+// @Param       target_type  query     string  false  "Target type, e.g. board"
+// @Param       target_id    query     string  false  "Target ID"
+// @Param       since        query     string  false  "Only events at or after this RFC 3339 time"
+// @Param       until        query     string  false  "Only events before this RFC 3339 time"
+// @Param       limit        query     int     false  "Page size (default 50, max 200)"
+// @Param       cursor       query     string  false  "Cursor from a previous page"
+// @Success     200  {object}  auditEventsResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /audit-events [get]
+func (a *App) listAuditEvents(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	q := r.URL.Query()
+
+	where := []string{"org_id = $1"}
+	args := []any{o.ID}
+	addFilter := func(clause string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if v := q.Get("action"); v != "" {
+		addFilter("action = $%d", v)
+	}
+	if v := q.Get("actor_id"); v != "" {
+		if !reUUID.MatchString(v) {
+			http.Error(w, "invalid actor_id", http.StatusBadRequest)
+			return
+		}
+		addFilter("actor_id = $%d", v)
+	}
+	if v := q.Get("target_type"); v != "" {
+		addFilter("target_type = $%d", v)
+	}
+	if v := q.Get("target_id"); v != "" {
+		addFilter("target_id = $%d", v)
+	}
+	for _, p := range []struct{ name, clause string }{
+		{"since", "created_at >= $%d"},
+		{"until", "created_at < $%d"},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid "+p.name+": expected RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		addFilter(p.clause, t)
+	}
+
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 200)
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		createdAt, id, err := decodeAuditCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		args = append(args, createdAt, id)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	args = append(args, limit+1)
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT id, created_at, actor_type, actor_id, actor_name, action, target_type, target_id,
+		       before, after, diff, ip, user_agent
+		FROM audit_events
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listAuditEvents query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	resp := auditEventsResponse{Events: []auditEventRow{}}
+	for rows.Next() {
+		var e auditEventRow
+		var before, after, diff []byte
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorType, &e.ActorID, &e.ActorName, &e.Action,
+			&e.TargetType, &e.TargetID, &before, &after, &diff, &e.IP, &e.UserAgent); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listAuditEvents scan: %v", err)
+			return
+		}
+		e.Before, e.After, e.Diff = nullableJSON(before), nullableJSON(after), nullableJSON(diff)
+		resp.Events = append(resp.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listAuditEvents iterate: %v", err)
+		return
+	}
+
+	if len(resp.Events) > limit {
+		resp.Events = resp.Events[:limit]
+		last := resp.Events[limit-1]
+		cursor := encodeAuditCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// nullableJSON maps a NULL JSONB column to a JSON null rather than an empty RawMessage,
+// which would otherwise produce invalid output.
+func nullableJSON(b []byte) json.RawMessage {
+	if b == nil {
+		return json.RawMessage("null")
+	}
+	return b
+}
+
+func encodeAuditCursor(createdAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeAuditCursor(s string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok || !reUUID.MatchString(id) {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return t, id, nil
+}
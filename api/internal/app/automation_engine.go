@@ -0,0 +1,410 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
+)
+
+// automationEvent is a change to a ticket that rules may act on.
+type automationEvent struct {
+	// Trigger is one of the trigger* constants.
+	Trigger string
+	// CommentChannel is the new comment's channel, for comment_added.
+	CommentChannel string
+	// FromTemperature (null if unrated) and ToTemperature are the AI
+	// temperature before and after, for temperature_crossed.
+	FromTemperature *int
+	ToTemperature   int
+}
+
+// automationTicket is the state of a ticket that conditions are tested against.
+type automationTicket struct {
+	zendeskTicketID *int64
+	status          string
+	assigneeID      *string
+	temperature     *int
+	tags            []string
+	reporterEmails  []string
+	// firstChannel is the channel of the ticket's first comment; empty if it has none.
+	firstChannel string
+}
+
+func loadAutomationTicket(ctx context.Context, q queryer, ticketID string) (automationTicket, error) {
+	var t automationTicket
+	var tags, emails []byte
+	var firstChannel *string
+	err := q.QueryRowContext(ctx, `
+		SELECT t.zendesk_ticket_id, COALESCE(t.zendesk_status::text, ''), t.assignee_id, t.ai_temperature,
+		       COALESCE((SELECT json_agg(tg.name ORDER BY tg.name)
+		                 FROM ticket_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		                 WHERE tt.ticket_id = t.id), '[]'),
+		       COALESCE((SELECT json_agg(ce.email) FROM customer_emails ce WHERE ce.customer_id = t.reporter_id), '[]'),
+		       (SELECT tc.channel::text FROM ticket_comments tc
+		        WHERE tc.ticket_id = t.id
+		        ORDER BY COALESCE(tc.received_at, tc.created_at), tc.zendesk_sub_index
+		        LIMIT 1)
+		FROM tickets t
+		WHERE t.id = $1`,
+		ticketID,
+	).Scan(&t.zendeskTicketID, &t.status, &t.assigneeID, &t.temperature, &tags, &emails, &firstChannel)
+	if err != nil {
+		return t, err
+	}
+	if firstChannel != nil {
+		t.firstChannel = *firstChannel
+	}
+	if err := json.Unmarshal(tags, &t.tags); err != nil {
+		return t, err
+	}
+	return t, json.Unmarshal(emails, &t.reporterEmails)
+}
+
+// evaluate tests each set condition against t, reporting every outcome and
+// whether all held.
+func (c automationConditions) evaluate(t automationTicket, ev automationEvent) ([]conditionResult, bool) {
+	results := []conditionResult{}
+	add := func(name string, matched bool, actual any) {
+		results = append(results, conditionResult{Condition: name, Matched: matched, Actual: actual})
+	}
+
+	if len(c.Channels) > 0 {
+		channel := t.firstChannel
+		if ev.Trigger == triggerCommentAdded {
+			channel = ev.CommentChannel
+		}
+		add("channels", slices.Contains(c.Channels, channel), channel)
+	}
+	if len(c.Statuses) > 0 {
+		add("statuses", slices.Contains(c.Statuses, t.status), t.status)
+	}
+	if len(c.TagsAny) > 0 {
+		add("tags_any", slices.ContainsFunc(c.TagsAny, func(tag string) bool { return slices.Contains(t.tags, tag) }), t.tags)
+	}
+	if len(c.TagsNone) > 0 {
+		add("tags_none", !slices.ContainsFunc(c.TagsNone, func(tag string) bool { return slices.Contains(t.tags, tag) }), t.tags)
+	}
+	if len(c.ReporterEmailDomains) > 0 {
+		domains := []string{}
+		for _, email := range t.reporterEmails {
+			if i := strings.LastIndex(email, "@"); i >= 0 {
+				domains = append(domains, strings.ToLower(email[i+1:]))
+			}
+		}
+		add("reporter_email_domains",
+			slices.ContainsFunc(c.ReporterEmailDomains, func(d string) bool { return slices.Contains(domains, d) }), domains)
+	}
+	if c.MinTemperature != nil {
+		add("min_temperature", t.temperature != nil && *t.temperature >= *c.MinTemperature, t.temperature)
+	}
+	if c.MaxTemperature != nil {
+		add("max_temperature", t.temperature != nil && *t.temperature <= *c.MaxTemperature, t.temperature)
+	}
+
+	for _, r := range results {
+		if !r.Matched {
+			return results, false
+		}
+	}
+	return results, true
+}
+
+// runAutomations runs orgID's enabled rules for ev's trigger against the
+// ticket, in position order, and records each run. It must be called after the
+// change that caused ev has committed. A rule that fails is recorded as such
+// and doesn't stop the rest; the returned error joins their failures.
+//
+// db is the owner connection for workers, or the request's org-scoped
+// connection for handlers; limiter may be nil to skip rate limiting and bus
+// may be nil to skip publishing change events.
+func runAutomations(ctx context.Context, db dbConn, orgID, ticketID string, ev automationEvent, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+automationRuleColumns+`
+		FROM automation_rules
+		WHERE org_id = $1 AND trigger = $2::automation_trigger AND enabled
+		ORDER BY position, created_at, id`,
+		orgID, ev.Trigger,
+	)
+	if err != nil {
+		return fmt.Errorf("load rules: %w", err)
+	}
+	var rules []automationRule
+	for rows.Next() {
+		ar, err := scanAutomationRule(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan rule: %w", err)
+		}
+		// temperature_crossed rules fire only when the temperature rises from
+		// below their threshold to at least it.
+		if ev.Trigger == triggerTemperatureCrossed {
+			th := *ar.TemperatureThreshold
+			if ev.ToTemperature < th || (ev.FromTemperature != nil && *ev.FromTemperature >= th) {
+				continue
+			}
+		}
+		rules = append(rules, ar)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate rules: %w", err)
+	}
+
+	var errs []error
+	for _, ar := range rules {
+		if err := runAutomationRule(ctx, db, orgID, ticketID, ar, ev, limiter, bus); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("rule %s: %w", ar.ID, err))
+			if recErr := recordAutomationRun(ctx, db, orgID, ar.ID, ticketID, ev.Trigger, true, nil, nil, err.Error()); recErr != nil {
+				errs = append(errs, fmt.Errorf("record failed run of rule %s: %w", ar.ID, recErr))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runAutomationRule evaluates one rule and, if it matches, performs its
+// actions. Zendesk-backed actions are written back first, in one update; the
+// local changes and the run record then commit together. Actions that can't
+// be performed (e.g. their column was deleted) are recorded as failed without
+// failing the run; an error return means nothing local was kept.
+func runAutomationRule(ctx context.Context, db dbConn, orgID, ticketID string, ar automationRule, ev automationEvent, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	t, err := loadAutomationTicket(ctx, db, ticketID)
+	if err == sql.ErrNoRows {
+		return nil // deleted since the event
+	}
+	if err != nil {
+		return fmt.Errorf("load ticket: %w", err)
+	}
+	conditions, matched := ar.Conditions.evaluate(t, ev)
+	if !matched {
+		return recordAutomationRun(ctx, db, orgID, ar.ID, ticketID, ev.Trigger, false, conditions, nil, "")
+	}
+
+	results := make([]actionResult, len(ar.Actions))
+	update := map[string]any{}
+	var zendeskActions []int
+	for i, act := range ar.Actions {
+		results[i].Type = act.Type
+		switch act.Type {
+		case actionAssign:
+			var zendeskUserID *int64
+			err := db.QueryRowContext(ctx,
+				`SELECT zendesk_user_id FROM agents WHERE id = $1 AND org_id = $2`, act.AgentID, orgID,
+			).Scan(&zendeskUserID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("load agent: %w", err)
+			}
+			if zendeskUserID == nil || *zendeskUserID <= 0 {
+				results[i].Error = "agent no longer exists in Zendesk"
+				continue
+			}
+			update["assignee_id"] = *zendeskUserID
+		case actionAddTags:
+			tags, _ := update["additional_tags"].([]string)
+			update["additional_tags"] = append(tags, act.Tags...)
+		default:
+			continue
+		}
+		zendeskActions = append(zendeskActions, i)
+	}
+
+	var resp *zendeskTicketUpdateResponse
+	if len(zendeskActions) > 0 {
+		msg := ""
+		if t.zendeskTicketID == nil {
+			msg = "ticket is not linked to Zendesk"
+		} else {
+			resp, err = zendeskTicketUpdate(ctx, db, orgID, *t.zendeskTicketID, update, limiter)
+			if errors.Is(err, errZendeskNotConfigured) {
+				msg = "zendesk not configured"
+			} else if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				msg = "zendesk update failed: " + err.Error()
+			}
+		}
+		if msg != "" {
+			for _, i := range zendeskActions {
+				results[i].Error = msg
+			}
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ticketChanged, tagsStored := false, false
+	assigneeID := t.assigneeID
+	var boardIDs, noteIDs []string
+	var sent []sentNotification
+	for i, act := range ar.Actions {
+		if results[i].Error != "" {
+			continue
+		}
+		switch act.Type {
+		case actionAssign:
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE tickets SET assignee_id = $1 WHERE id = $2`, act.AgentID, ticketID,
+			); err != nil {
+				return fmt.Errorf("assign: %w", err)
+			}
+			assigneeID = &act.AgentID
+			ticketChanged = true
+		case actionAddTags:
+			// Zendesk returns the ticket's full tag list, covering every
+			// add_tags action at once.
+			if tagsStored {
+				continue
+			}
+			if resp.Ticket.Tags != nil {
+				err = setTicketTags(ctx, tx, orgID, ticketID, resp.Ticket.Tags)
+				tagsStored = true
+			} else {
+				err = addTicketTags(ctx, tx, orgID, ticketID, act.Tags)
+			}
+			if err != nil {
+				return fmt.Errorf("add tags: %w", err)
+			}
+			ticketChanged = true
+		case actionMoveToColumn:
+			var isDefault bool
+			err := tx.QueryRowContext(ctx, `
+				SELECT b.is_default FROM boards b
+				JOIN board_columns bc ON bc.board_id = b.id
+				WHERE b.id = $1 AND bc.id = $2 AND b.org_id = $3`,
+				act.BoardID, act.ColumnID, orgID,
+			).Scan(&isDefault)
+			if err == sql.ErrNoRows {
+				results[i].Error = "column no longer exists"
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("check column: %w", err)
+			}
+			if isDefault {
+				results[i].Error = "default board is read-only"
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				`DELETE FROM board_tickets WHERE board_id = $1 AND ticket_id = $2`, act.BoardID, ticketID,
+			); err != nil {
+				return fmt.Errorf("remove from board: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO board_tickets (board_id, column_id, ticket_id, position)
+				VALUES ($1, $2, $3,
+					(SELECT COALESCE(MAX(position) + 1, 0) FROM board_tickets WHERE column_id = $2))`,
+				act.BoardID, act.ColumnID, ticketID,
+			); err != nil {
+				return fmt.Errorf("insert into column: %w", err)
+			}
+			boardIDs = append(boardIDs, act.BoardID)
+		case actionNotify:
+			ids := slices.Clone(act.AgentIDs)
+			if act.Assignee && assigneeID != nil && !slices.Contains(ids, *assigneeID) {
+				ids = append(ids, *assigneeID)
+			}
+			// Agents removed since the rule was saved are skipped.
+			var current []string
+			rows, err := tx.QueryContext(ctx,
+				`SELECT id FROM agents WHERE id = ANY($1) AND org_id = $2`, ids, orgID)
+			if err != nil {
+				return fmt.Errorf("load notify agents: %w", err)
+			}
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return fmt.Errorf("scan notify agent: %w", err)
+				}
+				current = append(current, id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("load notify agents: %w", err)
+			}
+			if len(current) == 0 {
+				results[i].Error = "no agents to notify"
+				continue
+			}
+			s, err := notify(ctx, tx, orgID, notifyAutomation, ticketID, nil, nil,
+				map[string]string{"rule_id": ar.ID, "rule_name": ar.Name}, current)
+			if err != nil {
+				return fmt.Errorf("notify: %w", err)
+			}
+			sent = append(sent, s...)
+		case actionAddNote:
+			var noteID string
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO ticket_notes (ticket_id, automation_rule_id, body)
+				VALUES ($1, $2, $3)
+				RETURNING id`,
+				ticketID, ar.ID, act.Body,
+			).Scan(&noteID); err != nil {
+				return fmt.Errorf("insert note: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO ticket_note_versions (note_id, version, body)
+				VALUES ($1, 1, $2)`,
+				noteID, act.Body,
+			); err != nil {
+				return fmt.Errorf("insert note version: %w", err)
+			}
+			noteIDs = append(noteIDs, noteID)
+		}
+	}
+
+	if err := recordAutomationRun(ctx, tx, orgID, ar.ID, ticketID, ev.Trigger, true, conditions, results, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	if ticketChanged {
+		bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+	}
+	for _, boardID := range boardIDs {
+		bus.Publish(ctx, orgID, events.BoardTicketsChanged, map[string]string{"board_id": boardID, "ticket_id": ticketID})
+	}
+	for _, noteID := range noteIDs {
+		bus.Publish(ctx, orgID, events.NoteChanged, map[string]string{"ticket_id": ticketID, "note_id": noteID})
+	}
+	publishNotifications(ctx, bus, orgID, sent)
+	return nil
+}
+
+// recordAutomationRun stores one evaluation of a rule. errMsg, if set, marks
+// the whole run failed.
+func recordAutomationRun(ctx context.Context, ex execer, orgID, ruleID, ticketID, trigger string, matched bool, conditions []conditionResult, actions []actionResult, errMsg string) error {
+	if conditions == nil {
+		conditions = []conditionResult{}
+	}
+	if actions == nil {
+		actions = []actionResult{}
+	}
+	c, _ := json.Marshal(conditions)
+	a, _ := json.Marshal(actions)
+	if _, err := ex.ExecContext(ctx, `
+		INSERT INTO automation_runs (org_id, rule_id, ticket_id, trigger, matched, conditions, actions, error)
+		VALUES ($1, $2, $3, $4::automation_trigger, $5, $6, $7, NULLIF($8, ''))`,
+		orgID, ruleID, ticketID, trigger, matched, c, a, errMsg,
+	); err != nil {
+		return fmt.Errorf("record run: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,771 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// Automation triggers. Rules run when the webhook processor stores the
+// corresponding change from Zendesk (see automation_engine.go); changes made
+// through Purl itself are applied locally first, so their webhooks don't
+// trigger rules again.
+const (
+	// triggerTicketCreated: a ticket was seen for the first time.
+	triggerTicketCreated = "ticket_created"
+	// triggerCommentAdded: a new comment was stored, including a ticket's first.
+	triggerCommentAdded = "comment_added"
+	// triggerStatusChanged: the ticket's status changed.
+	triggerStatusChanged = "status_changed"
+	// triggerTemperatureCrossed: the AI temperature rose to or past the rule's
+	// temperature_threshold.
+	triggerTemperatureCrossed = "temperature_crossed"
+)
+
+var automationTriggers = []string{triggerTicketCreated, triggerCommentAdded, triggerStatusChanged, triggerTemperatureCrossed}
+
+// Automation action types. assign and add_tags are written back to Zendesk;
+// the rest are Purl-only.
+const (
+	actionAssign       = "assign"
+	actionAddTags      = "add_tags"
+	actionMoveToColumn = "move_to_column"
+	actionNotify       = "notify"
+	actionAddNote      = "add_note"
+)
+
+var automationActionTypes = []string{actionAssign, actionAddTags, actionMoveToColumn, actionNotify, actionAddNote}
+
+// maxAutomationActions caps how many actions one rule may have.
+const maxAutomationActions = 20
+
+// automationConditions must all hold for a rule to act. Omitted conditions
+// always hold.
+type automationConditions struct {
+	// Channels matches the new comment's channel for comment_added, and the
+	// channel of the ticket's first comment otherwise: email, sms, voice, web,
+	// chat or internal.
+	Channels []string `json:"channels,omitempty"`
+	// Statuses matches the ticket's current status.
+	Statuses []string `json:"statuses,omitempty"`
+	// TagsAny requires at least one of the tags; TagsNone requires none of them.
+	TagsAny  []string `json:"tags_any,omitempty"`
+	TagsNone []string `json:"tags_none,omitempty"`
+	// ReporterEmailDomains matches if any of the reporter's email addresses is
+	// at one of the domains, e.g. "example.com". Subdomains don't match.
+	ReporterEmailDomains []string `json:"reporter_email_domains,omitempty"`
+	// MinTemperature and MaxTemperature bound the AI temperature (1-10),
+	// inclusive. A ticket not yet rated matches neither.
+	MinTemperature *int `json:"min_temperature,omitempty"`
+	MaxTemperature *int `json:"max_temperature,omitempty"`
+}
+
+// automationAction is one step of a rule; only the fields its type uses are set.
+type automationAction struct {
+	// Type is assign, add_tags, move_to_column, notify or add_note.
+	Type string `json:"type"`
+	// AgentID for assign. The agent must have a Zendesk user.
+	AgentID string `json:"agent_id,omitempty"`
+	// Tags for add_tags.
+	Tags []string `json:"tags,omitempty"`
+	// BoardID and ColumnID for move_to_column. The default board can't be targeted.
+	BoardID  string `json:"board_id,omitempty"`
+	ColumnID string `json:"column_id,omitempty"`
+	// AgentIDs for notify, plus the ticket's assignee if Assignee is set.
+	AgentIDs []string `json:"agent_ids,omitempty"`
+	Assignee bool     `json:"assignee,omitempty"`
+	// Body for add_note: the text of the internal note to post.
+	Body string `json:"body,omitempty"`
+}
+
+type automationRule struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	// Position orders rules sharing a trigger, ascending. Each rule sees the
+	// changes made by the ones before it.
+	Position int `json:"position"`
+	// Trigger is ticket_created, comment_added, status_changed or temperature_crossed.
+	Trigger string `json:"trigger"`
+	// TemperatureThreshold (1-10) is required for, and only allowed on,
+	// temperature_crossed rules.
+	TemperatureThreshold *int                 `json:"temperature_threshold"`
+	Conditions           automationConditions `json:"conditions"`
+	Actions              []automationAction   `json:"actions"`
+}
+
+type createAutomationRequest struct {
+	Name string `json:"name"`
+	// Enabled defaults to true.
+	Enabled              *bool                `json:"enabled"`
+	Position             int                  `json:"position"`
+	Trigger              string               `json:"trigger"`
+	TemperatureThreshold *int                 `json:"temperature_threshold"`
+	Conditions           automationConditions `json:"conditions"`
+	Actions              []automationAction   `json:"actions"`
+}
+
+// updateAutomationRequest replaces only the fields that are present.
+// conditions and actions, if present, are replaced as a whole.
+type updateAutomationRequest struct {
+	Name                 *string               `json:"name"`
+	Enabled              *bool                 `json:"enabled"`
+	Position             *int                  `json:"position"`
+	Trigger              *string               `json:"trigger"`
+	TemperatureThreshold *int                  `json:"temperature_threshold"`
+	Conditions           *automationConditions `json:"conditions"`
+	Actions              *[]automationAction   `json:"actions"`
+}
+
+// automationRun is one evaluation of a rule against a ticket.
+type automationRun struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	RuleID    string    `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	TicketID  string    `json:"ticket_id"`
+	Trigger   string    `json:"trigger"`
+	// Matched is whether every condition held, so the actions were attempted.
+	Matched    bool              `json:"matched"`
+	Conditions []conditionResult `json:"conditions"`
+	// Actions is empty when the rule didn't match.
+	Actions []actionResult `json:"actions"`
+	// Error is set when the run failed as a whole and none of its changes were kept.
+	Error *string `json:"error"`
+}
+
+// conditionResult is the outcome of one condition in a run.
+type conditionResult struct {
+	// Condition is the condition's field name, e.g. "channels".
+	Condition string `json:"condition"`
+	Matched   bool   `json:"matched"`
+	// Actual is the ticket's value that was tested.
+	Actual any `json:"actual"`
+}
+
+// actionResult is the outcome of one action in a run.
+type actionResult struct {
+	Type string `json:"type"`
+	// Error is why the action wasn't performed; empty on success.
+	Error string `json:"error,omitempty"`
+}
+
+type automationRunsResponse struct {
+	Runs []automationRun `json:"runs"`
+	// NextCursor is passed back as ?cursor= to fetch the next (older) page. Null on the last page.
+	NextCursor *string `json:"next_cursor"`
+}
+
+const automationRuleColumns = `id, created_at, updated_at, name, enabled, position, trigger::text,
+	temperature_threshold, conditions, actions`
+
+func scanAutomationRule(row rowScanner) (automationRule, error) {
+	var ar automationRule
+	var conditions, actions []byte
+	if err := row.Scan(&ar.ID, &ar.CreatedAt, &ar.UpdatedAt, &ar.Name, &ar.Enabled, &ar.Position, &ar.Trigger,
+		&ar.TemperatureThreshold, &conditions, &actions); err != nil {
+		return ar, err
+	}
+	if err := json.Unmarshal(conditions, &ar.Conditions); err != nil {
+		return ar, err
+	}
+	return ar, json.Unmarshal(actions, &ar.Actions)
+}
+
+// auditSnapshot returns the audited view of a rule.
+func (ar automationRule) auditSnapshot() map[string]any {
+	return map[string]any{
+		"name": ar.Name, "enabled": ar.Enabled, "position": ar.Position, "trigger": ar.Trigger,
+		"temperature_threshold": ar.TemperatureThreshold, "conditions": ar.Conditions, "actions": ar.Actions,
+	}
+}
+
+// validateAutomationRule checks and normalizes ar, returning a client-facing
+// message if it is invalid.
+func validateAutomationRule(ctx context.Context, q queryer, ar *automationRule) string {
+	if strings.TrimSpace(ar.Name) == "" {
+		return "name is required"
+	}
+	if ar.Position < 0 {
+		return "position must not be negative"
+	}
+	if !slices.Contains(automationTriggers, ar.Trigger) {
+		return "trigger must be one of " + strings.Join(automationTriggers, ", ")
+	}
+	if ar.Trigger == triggerTemperatureCrossed {
+		if ar.TemperatureThreshold == nil || *ar.TemperatureThreshold < 1 || *ar.TemperatureThreshold > 10 {
+			return "temperature_threshold must be between 1 and 10"
+		}
+	} else if ar.TemperatureThreshold != nil {
+		return "temperature_threshold is only allowed on temperature_crossed rules"
+	}
+	if msg := validateAutomationConditions(&ar.Conditions); msg != "" {
+		return "conditions." + msg
+	}
+
+	if len(ar.Actions) == 0 {
+		return "at least one action is required"
+	}
+	if len(ar.Actions) > maxAutomationActions {
+		return fmt.Sprintf("a rule may have at most %d actions", maxAutomationActions)
+	}
+	for i := range ar.Actions {
+		if msg := validateAutomationAction(ctx, q, &ar.Actions[i]); msg != "" {
+			return fmt.Sprintf("actions[%d]: %s", i, msg)
+		}
+	}
+	return ""
+}
+
+func validateAutomationConditions(c *automationConditions) string {
+	for _, ch := range c.Channels {
+		if !slices.Contains([]string{"email", "sms", "voice", "web", "chat", "internal"}, ch) {
+			return "channels: must be email, sms, voice, web, chat or internal"
+		}
+	}
+	for _, s := range c.Statuses {
+		if !validStatuses[s] {
+			return "statuses: must be new, open, pending, solved or closed"
+		}
+	}
+	var err error
+	if c.TagsAny, err = normalizeTags(c.TagsAny); err != nil {
+		return "tags_any: " + err.Error()
+	}
+	if c.TagsNone, err = normalizeTags(c.TagsNone); err != nil {
+		return "tags_none: " + err.Error()
+	}
+	for i, d := range c.ReporterEmailDomains {
+		d = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@"))
+		if d == "" || strings.ContainsAny(d, "@ ") {
+			return fmt.Sprintf("reporter_email_domains: invalid domain %q", c.ReporterEmailDomains[i])
+		}
+		c.ReporterEmailDomains[i] = d
+	}
+	for _, t := range []*int{c.MinTemperature, c.MaxTemperature} {
+		if t != nil && (*t < 1 || *t > 10) {
+			return "min_temperature and max_temperature must be between 1 and 10"
+		}
+	}
+	if c.MinTemperature != nil && c.MaxTemperature != nil && *c.MinTemperature > *c.MaxTemperature {
+		return "min_temperature must not exceed max_temperature"
+	}
+	return ""
+}
+
+func validateAutomationAction(ctx context.Context, q queryer, act *automationAction) string {
+	switch act.Type {
+	case actionAssign:
+		if !reUUID.MatchString(act.AgentID) {
+			return "agent not found"
+		}
+		var zendeskUserID *int64
+		err := q.QueryRowContext(ctx,
+			`SELECT zendesk_user_id FROM agents WHERE id = $1`, act.AgentID,
+		).Scan(&zendeskUserID)
+		if err == sql.ErrNoRows {
+			return "agent not found"
+		}
+		if err != nil {
+			log.Printf("validateAutomationAction agent: %v", err)
+			return "agent lookup failed"
+		}
+		if zendeskUserID == nil || *zendeskUserID <= 0 {
+			return "agent has no Zendesk user"
+		}
+	case actionAddTags:
+		if len(act.Tags) == 0 {
+			return "tags are required"
+		}
+		tags, err := normalizeTags(act.Tags)
+		if err != nil {
+			return err.Error()
+		}
+		act.Tags = tags
+	case actionMoveToColumn:
+		if !reUUID.MatchString(act.BoardID) || !reUUID.MatchString(act.ColumnID) {
+			return "board_id and column_id are required"
+		}
+		var isDefault bool
+		err := q.QueryRowContext(ctx, `
+			SELECT b.is_default FROM boards b
+			JOIN board_columns bc ON bc.board_id = b.id
+			WHERE b.id = $1 AND bc.id = $2`,
+			act.BoardID, act.ColumnID,
+		).Scan(&isDefault)
+		if err == sql.ErrNoRows {
+			return "column not found"
+		}
+		if err != nil {
+			log.Printf("validateAutomationAction column: %v", err)
+			return "column lookup failed"
+		}
+		if isDefault {
+			return "default board is read-only"
+		}
+	case actionNotify:
+		if len(act.AgentIDs) == 0 && !act.Assignee {
+			return "agent_ids or assignee is required"
+		}
+		ids, err := validateMentions(ctx, q, act.AgentIDs)
+		if err != nil {
+			return strings.Replace(err.Error(), "mentions:", "agent_ids:", 1)
+		}
+		act.AgentIDs = ids
+	case actionAddNote:
+		if strings.TrimSpace(act.Body) == "" {
+			return "body is required"
+		}
+	default:
+		return "type must be one of " + strings.Join(automationActionTypes, ", ")
+	}
+	return ""
+}
+
+// loadAutomationRule loads the ruleID URL param. Writes a 404 (or 500) and
+// returns false if it doesn't exist.
+func loadAutomationRule(w http.ResponseWriter, r *http.Request, q queryer, forUpdate bool) (automationRule, bool) {
+	ruleID := chi.URLParam(r, "ruleID")
+	if !reUUID.MatchString(ruleID) {
+		http.Error(w, "automation rule not found", http.StatusNotFound)
+		return automationRule{}, false
+	}
+	query := `SELECT ` + automationRuleColumns + ` FROM automation_rules WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	ar, err := scanAutomationRule(q.QueryRowContext(r.Context(), query, ruleID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "automation rule not found", http.StatusNotFound)
+		return ar, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadAutomationRule: %v", err)
+		return ar, false
+	}
+	return ar, true
+}
+
+// @Summary     List automation rules
+// @Tags        Automations
+// @Description Returns the org's automation rules, grouped by trigger and in run order
+// @Produce     json
+// @Success     200  {array}   automationRule
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /automations [get]
+func (a *App) listAutomationRules(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT `+automationRuleColumns+`
+		FROM automation_rules
+		ORDER BY trigger, position, created_at, id`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listAutomationRules query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	rules := []automationRule{}
+	for rows.Next() {
+		ar, err := scanAutomationRule(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listAutomationRules scan: %v", err)
+			return
+		}
+		rules = append(rules, ar)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// @Summary     Create an automation rule
+// @Tags        Automations
+// @Description Creates a "when trigger, if conditions, then actions" rule. Rules run as Zendesk webhooks
+// @Description are processed; assign and add_tags are written back to Zendesk. Each evaluation is recorded
+// @Description and listed by GET /automations/{ruleID}/runs.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createAutomationRequest  true  "Rule to create"
+// @Success     201   {object}  automationRule
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /automations [post]
+func (a *App) createAutomationRule(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createAutomationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	ar := automationRule{
+		Name: req.Name, Enabled: req.Enabled == nil || *req.Enabled, Position: req.Position,
+		Trigger: req.Trigger, TemperatureThreshold: req.TemperatureThreshold,
+		Conditions: req.Conditions, Actions: req.Actions,
+	}
+	conn := a.conn(r.Context())
+	if msg := validateAutomationRule(r.Context(), conn, &ar); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	conditions, _ := json.Marshal(ar.Conditions)
+	actions, _ := json.Marshal(ar.Actions)
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createAutomationRule begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	ar, err = scanAutomationRule(tx.QueryRowContext(r.Context(), `
+		INSERT INTO automation_rules (org_id, name, enabled, position, trigger, temperature_threshold, conditions, actions)
+		VALUES ($1, $2, $3, $4, $5::automation_trigger, $6, $7, $8)
+		RETURNING `+automationRuleColumns,
+		o.ID, ar.Name, ar.Enabled, ar.Position, ar.Trigger, ar.TemperatureThreshold, conditions, actions))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createAutomationRule insert: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "automation.create",
+		TargetType: "automation_rule",
+		TargetID:   ar.ID,
+		After:      ar.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createAutomationRule audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createAutomationRule commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.AutomationUpdated, map[string]string{"rule_id": ar.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ar)
+}
+
+// @Summary     Get an automation rule
+// @Tags        Automations
+// @Produce     json
+// @Param       ruleID  path      string  true  "Rule ID"
+// @Success     200     {object}  automationRule
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /automations/{ruleID} [get]
+func (a *App) getAutomationRule(w http.ResponseWriter, r *http.Request) {
+	ar, ok := loadAutomationRule(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ar)
+}
+
+// @Summary     Update an automation rule
+// @Tags        Automations
+// @Description Updates the fields present in the body. conditions and actions, if present, are replaced
+// @Description as a whole. Send "enabled": false to pause a rule.
+// @Accept      json
+// @Produce     json
+// @Param       ruleID  path      string                   true  "Rule ID"
+// @Param       body    body      updateAutomationRequest  true  "Fields to update"
+// @Success     200     {object}  automationRule
+// @Failure     400     {string}  string  "Bad Request"
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /automations/{ruleID} [patch]
+func (a *App) updateAutomationRule(w http.ResponseWriter, r *http.Request) {
+	var req updateAutomationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateAutomationRule begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := loadAutomationRule(w, r, tx, true)
+	if !ok {
+		return
+	}
+	next := old
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	if req.Position != nil {
+		next.Position = *req.Position
+	}
+	if req.Trigger != nil {
+		next.Trigger = *req.Trigger
+		// The threshold belongs to the trigger; moving off temperature_crossed drops it.
+		if next.Trigger != triggerTemperatureCrossed {
+			next.TemperatureThreshold = nil
+		}
+	}
+	if req.TemperatureThreshold != nil {
+		next.TemperatureThreshold = req.TemperatureThreshold
+	}
+	if req.Conditions != nil {
+		next.Conditions = *req.Conditions
+	}
+	if req.Actions != nil {
+		next.Actions = *req.Actions
+	}
+	if msg := validateAutomationRule(r.Context(), tx, &next); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	conditions, _ := json.Marshal(next.Conditions)
+	actions, _ := json.Marshal(next.Actions)
+
+	ar, err := scanAutomationRule(tx.QueryRowContext(r.Context(), `
+		UPDATE automation_rules
+		SET name = $2, enabled = $3, position = $4, trigger = $5::automation_trigger,
+		    temperature_threshold = $6, conditions = $7, actions = $8
+		WHERE id = $1
+		RETURNING `+automationRuleColumns,
+		old.ID, next.Name, next.Enabled, next.Position, next.Trigger, next.TemperatureThreshold, conditions, actions))
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateAutomationRule update: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "automation.update",
+		TargetType: "automation_rule",
+		TargetID:   ar.ID,
+		Before:     old.auditSnapshot(),
+		After:      ar.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateAutomationRule audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateAutomationRule commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.AutomationUpdated, map[string]string{"rule_id": ar.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ar)
+}
+
+// @Summary     Delete an automation rule
+// @Tags        Automations
+// @Description Deletes the rule and its run history. Notes it posted are kept.
+// @Param       ruleID  path      string  true  "Rule ID"
+// @Success     204
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /automations/{ruleID} [delete]
+func (a *App) deleteAutomationRule(w http.ResponseWriter, r *http.Request) {
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteAutomationRule begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	ar, ok := loadAutomationRule(w, r, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM automation_rules WHERE id = $1`, ar.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteAutomationRule delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "automation.delete",
+		TargetType: "automation_rule",
+		TargetID:   ar.ID,
+		Before:     ar.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteAutomationRule audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteAutomationRule commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.AutomationUpdated, map[string]string{"rule_id": ar.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary     List a rule's runs
+// @Tags        Automations
+// @Description Returns the rule's execution trace, newest first: every evaluation against a ticket, with
+// @Description each condition's outcome and, when it matched, each action's.
+// @Produce     json
+// @Param       ruleID   path      string  true   "Rule ID"
+// @Param       matched  query     bool    false  "Only runs that did (true) or didn't (false) match"
+// @Param       limit    query     int     false  "Page size (default 50, max 200)"
+// @Param       cursor   query     string  false  "Cursor from a previous page"
+// @Success     200  {object}  automationRunsResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /automations/{ruleID}/runs [get]
+func (a *App) listAutomationRuleRuns(w http.ResponseWriter, r *http.Request) {
+	ar, ok := loadAutomationRule(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	a.writeAutomationRuns(w, r, "ar.rule_id = $1", ar.ID)
+}
+
+// @Summary     List a ticket's automation runs
+// @Tags        Automations
+// @Description Returns every rule evaluation against the ticket, newest first, to explain what
+// @Description automations did (or didn't do) to it.
+// @Produce     json
+// @Param       ticketID  path      string  true   "Ticket ID"
+// @Param       matched   query     bool    false  "Only runs that did (true) or didn't (false) match"
+// @Param       limit     query     int     false  "Page size (default 50, max 200)"
+// @Param       cursor    query     string  false  "Cursor from a previous page"
+// @Success     200  {object}  automationRunsResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/automation-runs [get]
+func (a *App) listTicketAutomationRuns(w http.ResponseWriter, r *http.Request) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	a.writeAutomationRuns(w, r, "ar.ticket_id = $1", ticketID)
+}
+
+// writeAutomationRuns writes the page of runs matching where (which uses $1
+// = id) selected by the matched, limit and cursor query params.
+func (a *App) writeAutomationRuns(w http.ResponseWriter, r *http.Request, where, id string) {
+	q := r.URL.Query()
+	args := []any{id}
+	if v := q.Get("matched"); v != "" {
+		matched, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "matched: must be true or false", http.StatusBadRequest)
+			return
+		}
+		args = append(args, matched)
+		where += fmt.Sprintf(" AND ar.matched = $%d", len(args))
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 200)
+	}
+	if v := q.Get("cursor"); v != "" {
+		createdAt, runID, err := decodeAuditCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		args = append(args, createdAt, runID)
+		where += fmt.Sprintf(" AND (ar.created_at, ar.id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	// Fetch one extra row to learn whether another page exists.
+	args = append(args, limit+1)
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT ar.id, ar.created_at, ar.rule_id, rule.name, ar.ticket_id, ar.trigger::text,
+		       ar.matched, ar.conditions, ar.actions, ar.error
+		FROM automation_runs ar
+		JOIN automation_rules rule ON rule.id = ar.rule_id
+		WHERE `+where+`
+		ORDER BY ar.created_at DESC, ar.id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("writeAutomationRuns query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	resp := automationRunsResponse{Runs: []automationRun{}}
+	for rows.Next() {
+		var run automationRun
+		var conditions, actions []byte
+		if err := rows.Scan(&run.ID, &run.CreatedAt, &run.RuleID, &run.RuleName, &run.TicketID, &run.Trigger,
+			&run.Matched, &conditions, &actions, &run.Error); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("writeAutomationRuns scan: %v", err)
+			return
+		}
+		if err := json.Unmarshal(conditions, &run.Conditions); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("writeAutomationRuns conditions: %v", err)
+			return
+		}
+		if err := json.Unmarshal(actions, &run.Actions); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("writeAutomationRuns actions: %v", err)
+			return
+		}
+		resp.Runs = append(resp.Runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("writeAutomationRuns iterate: %v", err)
+		return
+	}
+
+	if len(resp.Runs) > limit {
+		resp.Runs = resp.Runs[:limit]
+		last := resp.Runs[limit-1]
+		cursor := encodeAuditCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
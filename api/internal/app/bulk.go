@@ -0,0 +1,875 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
+)
+
+// maxBulkTickets caps how many tickets one bulk job may touch.
+const maxBulkTickets = 1000
+
+// Bulk actions. The Zendesk-backed ones are written back with update_many
+// before being applied locally; move_to_column and mark_read are Purl-only.
+const (
+	bulkSetStatus    = "set_status"
+	bulkAssign       = "assign"
+	bulkAddTags      = "add_tags"
+	bulkRemoveTags   = "remove_tags"
+	bulkMoveToColumn = "move_to_column"
+	bulkMarkRead     = "mark_read"
+)
+
+var bulkActions = []string{bulkSetStatus, bulkAssign, bulkAddTags, bulkRemoveTags, bulkMoveToColumn, bulkMarkRead}
+
+// bulkParams are the arguments of a bulk action; only those the action uses are set.
+type bulkParams struct {
+	// Status for set_status: open, pending, solved or closed.
+	Status string `json:"status,omitempty"`
+	// AssigneeID for assign; null unassigns.
+	AssigneeID *string `json:"assignee_id,omitempty"`
+	// Tags for add_tags and remove_tags.
+	Tags []string `json:"tags,omitempty"`
+	// BoardID and ColumnID for move_to_column. The default board can't be targeted.
+	BoardID  string `json:"board_id,omitempty"`
+	ColumnID string `json:"column_id,omitempty"`
+}
+
+type bulkTicketsRequest struct {
+	// TicketIDs or Filter (exactly one) selects the tickets. A filter is
+	// evaluated once, when the job is submitted.
+	TicketIDs []string      `json:"ticket_ids"`
+	Filter    *ticketFilter `json:"filter"`
+	// Action is set_status, assign, add_tags, remove_tags, move_to_column or mark_read.
+	Action string `json:"action"`
+	bulkParams
+}
+
+type bulkJobItem struct {
+	TicketID string `json:"ticket_id"`
+	// Status is pending, succeeded or failed.
+	Status string  `json:"status"`
+	Error  *string `json:"error"`
+}
+
+type bulkJob struct {
+	ID     string     `json:"id"`
+	Action string     `json:"action"`
+	Params bulkParams `json:"params"`
+	// Status is pending, running, completed or failed. A completed job may
+	// still have failed items; a failed job gave up with Error, failing the
+	// items it hadn't reached.
+	Status     string     `json:"status"`
+	Error      *string    `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Total      int        `json:"total"`
+	// Processed is Succeeded + Failed.
+	Processed int           `json:"processed"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Items     []bulkJobItem `json:"items"`
+}
+
+// @Summary     Bulk update tickets
+// @Tags        Tickets
+// @Description Queues one action against many tickets, chosen by ID or by a ticket filter (as GET /tickets).
+// @Description Actions: set_status (status), assign (assignee_id, null to unassign), add_tags / remove_tags (tags),
+// @Description move_to_column (board_id, column_id), mark_read (for the calling agent; requires x-agent-id).
+// @Description Status, assignee and tag changes are written back to Zendesk
+// @Description in batches through its update_many endpoint. Poll GET /tickets/bulk/{jobID} for progress.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      bulkTicketsRequest  true  "Tickets and action"
+// @Success     202   {object}  bulkJob
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /tickets/bulk [post]
+func (a *App) createBulkJob(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	var req bulkTicketsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := a.validateBulkParams(r, conn, req.Action, &req.bulkParams); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var ticketIDs []string
+	switch {
+	case (req.TicketIDs == nil) == (req.Filter == nil):
+		http.Error(w, "exactly one of ticket_ids and filter is required", http.StatusBadRequest)
+		return
+	case req.Filter != nil:
+		if err := req.Filter.validate(); err != nil {
+			http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		cond, args, err := req.Filter.where(r.Context(), o.ID, nil)
+		if errors.Is(err, errFilterNeedsAgent) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ticketIDs, err = selectTicketIDs(r.Context(), conn, cond, args); err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("createBulkJob filter: %v", err)
+			return
+		}
+	default:
+		for _, id := range req.TicketIDs {
+			if !reUUID.MatchString(id) {
+				http.Error(w, "ticket not found: "+id, http.StatusBadRequest)
+				return
+			}
+		}
+		slices.Sort(req.TicketIDs)
+		req.TicketIDs = slices.Compact(req.TicketIDs)
+		found, err := selectTicketIDs(r.Context(), conn, "t.org_id = $1 AND t.id = ANY($2)", []any{o.ID, req.TicketIDs})
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("createBulkJob validate tickets: %v", err)
+			return
+		}
+		for _, id := range req.TicketIDs {
+			if !slices.Contains(found, id) {
+				http.Error(w, "ticket not found: "+id, http.StatusBadRequest)
+				return
+			}
+		}
+		ticketIDs = req.TicketIDs
+	}
+	if len(ticketIDs) == 0 {
+		http.Error(w, "no tickets selected", http.StatusBadRequest)
+		return
+	}
+	if len(ticketIDs) > maxBulkTickets {
+		http.Error(w, fmt.Sprintf("too many tickets (%d); the limit is %d", len(ticketIDs), maxBulkTickets), http.StatusBadRequest)
+		return
+	}
+
+	params, _ := json.Marshal(req.bulkParams)
+	info := requestInfoFromContext(r.Context())
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var jobID string
+	err = tx.QueryRowContext(r.Context(), `
+		INSERT INTO bulk_jobs (org_id, actor_agent_id, ip, user_agent, action, params)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		RETURNING id`,
+		o.ID, callerAgentID(r.Context()), info.IP, info.UserAgent, req.Action, params,
+	).Scan(&jobID)
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob insert job: %v", err)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO bulk_job_items (job_id, ticket_id)
+		SELECT $1, unnest($2::uuid[])`,
+		jobID, ticketIDs,
+	); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob insert items: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.bulk",
+		TargetType: "bulk_job",
+		TargetID:   jobID,
+		After:      map[string]any{"action": req.Action, "params": req.bulkParams, "ticket_ids": ticketIDs},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob commit: %v", err)
+		return
+	}
+
+	job, err := loadBulkJob(r.Context(), conn, jobID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("createBulkJob load: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// validateBulkParams checks and normalizes the arguments of action, returning
+// a client-facing message if they are invalid.
+func (a *App) validateBulkParams(r *http.Request, q queryer, action string, p *bulkParams) string {
+	switch action {
+	case bulkSetStatus:
+		if !slices.Contains([]string{"open", "pending", "solved", "closed"}, p.Status) {
+			return "status must be open, pending, solved or closed"
+		}
+	case bulkAssign:
+		if p.AssigneeID == nil {
+			return ""
+		}
+		if !reUUID.MatchString(*p.AssigneeID) {
+			return "assignee not found"
+		}
+		var zendeskUserID *int64
+		err := q.QueryRowContext(r.Context(),
+			`SELECT zendesk_user_id FROM agents WHERE id = $1 AND org_id = $2`,
+			*p.AssigneeID, orgFromContext(r.Context()).ID,
+		).Scan(&zendeskUserID)
+		if err == sql.ErrNoRows {
+			return "assignee not found"
+		}
+		if err != nil {
+			log.Printf("validateBulkParams assignee: %v", err)
+			return "assignee lookup failed"
+		}
+		if zendeskUserID == nil || *zendeskUserID <= 0 {
+			return "assignee has no Zendesk user"
+		}
+	case bulkAddTags, bulkRemoveTags:
+		if len(p.Tags) == 0 {
+			return "tags are required"
+		}
+		tags, err := normalizeTags(p.Tags)
+		if err != nil {
+			return err.Error()
+		}
+		p.Tags = tags
+	case bulkMoveToColumn:
+		if !reUUID.MatchString(p.BoardID) || !reUUID.MatchString(p.ColumnID) {
+			return "board_id and column_id are required"
+		}
+		var isDefault bool
+		err := q.QueryRowContext(r.Context(), `
+			SELECT b.is_default FROM boards b
+			JOIN board_columns bc ON bc.board_id = b.id
+			WHERE b.id = $1 AND bc.id = $2 AND b.org_id = $3`,
+			p.BoardID, p.ColumnID, orgFromContext(r.Context()).ID,
+		).Scan(&isDefault)
+		if err == sql.ErrNoRows {
+			return "column not found"
+		}
+		if err != nil {
+			log.Printf("validateBulkParams column: %v", err)
+			return "column lookup failed"
+		}
+		if isDefault {
+			return "default board is read-only"
+		}
+	case bulkMarkRead:
+		if _, ok := agentFromContext(r.Context()); !ok {
+			return "mark_read requires the x-agent-id header"
+		}
+	default:
+		return "action must be one of " + strings.Join(bulkActions, ", ")
+	}
+	return ""
+}
+
+// selectTicketIDs returns the IDs of tickets t matching cond, capped at one
+// more than maxBulkTickets so callers can detect oversized selections.
+func selectTicketIDs(ctx context.Context, q queryer, cond string, args []any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`
+		SELECT t.id FROM tickets t
+		WHERE %s
+		ORDER BY t.created_at, t.id
+		LIMIT %d`, cond, maxBulkTickets+1), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// @Summary     Get bulk job progress
+// @Tags        Tickets
+// @Description Returns a bulk job's status, progress counts and per-ticket results
+// @Produce     json
+// @Param       jobID  path      string  true  "Bulk job ID"
+// @Success     200    {object}  bulkJob
+// @Failure     401    {string}  string  "Unauthorized"
+// @Failure     404    {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/bulk/{jobID} [get]
+func (a *App) getBulkJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobID")
+	if !reUUID.MatchString(jobID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := loadBulkJob(r.Context(), a.conn(r.Context()), jobID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBulkJob: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// loadBulkJob returns a job with its items and progress counts. Returns
+// sql.ErrNoRows if the job doesn't exist (or belongs to another org).
+func loadBulkJob(ctx context.Context, q queryer, jobID string) (bulkJob, error) {
+	var j bulkJob
+	var params []byte
+	err := q.QueryRowContext(ctx, `
+		SELECT id, action, params, status::text, error, created_at, started_at, finished_at
+		FROM bulk_jobs WHERE id = $1`, jobID,
+	).Scan(&j.ID, &j.Action, &params, &j.Status, &j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt)
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(params, &j.Params); err != nil {
+		return j, fmt.Errorf("parse params: %w", err)
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT ticket_id, status::text, error
+		FROM bulk_job_items WHERE job_id = $1
+		ORDER BY ticket_id`, jobID)
+	if err != nil {
+		return j, err
+	}
+	defer rows.Close()
+
+	j.Items = []bulkJobItem{}
+	for rows.Next() {
+		var it bulkJobItem
+		if err := rows.Scan(&it.TicketID, &it.Status, &it.Error); err != nil {
+			return j, err
+		}
+		switch it.Status {
+		case "succeeded":
+			j.Succeeded++
+		case "failed":
+			j.Failed++
+		}
+		j.Items = append(j.Items, it)
+	}
+	j.Total = len(j.Items)
+	j.Processed = j.Succeeded + j.Failed
+	return j, rows.Err()
+}
+
+// ── Worker ───────────────────────────────────────────────────────────────────
+
+const (
+	// bulkJobLease is how long a worker's claim on a job lasts. It is renewed
+	// before each Zendesk batch and each ticket, either of which may wait on
+	// the rate limit.
+	bulkJobLease = 15 * time.Minute
+	// maxBulkJobAttempts is how many times a job is claimed before it fails.
+	maxBulkJobAttempts = 5
+	// bulkJobsPerRun caps how many jobs one worker run claims.
+	bulkJobsPerRun = 10
+)
+
+// pendingBulkJob is an unfinished job as seen by the worker.
+type pendingBulkJob struct {
+	id      string
+	orgID   string
+	agentID *string
+	info    requestInfo
+	action  string
+	params  bulkParams
+	// attempt is the job's attempts when claimed; the claim is only held
+	// while it is unchanged.
+	attempt int
+}
+
+// pendingBulkItem is a ticket the worker has yet to process.
+type pendingBulkItem struct {
+	ticketID        string
+	zendeskTicketID *int64
+}
+
+// errBulkClaimLost means another worker claimed the job after this one's
+// claim lapsed.
+var errBulkClaimLost = errors.New("claim on job lost")
+
+// ProcessBulkJobs claims unfinished bulk jobs, oldest first, runs them to
+// completion and returns how many it completed. Jobs interrupted part-way
+// resume with their remaining items once their claim lapses, as do jobs that
+// failed; a job is failed for good after maxBulkJobAttempts.
+func ProcessBulkJobs(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, bus *events.Bus) (int, error) {
+	completed := 0
+	for range bulkJobsPerRun {
+		j, params, ok, err := claimBulkJob(ctx, db)
+		if err != nil {
+			return completed, err
+		}
+		if !ok {
+			break
+		}
+		if err = json.Unmarshal(params, &j.params); err != nil {
+			err = fmt.Errorf("parse params: %w", err)
+		} else {
+			err = runBulkJob(ctx, db, j, limiter, bus)
+		}
+		if err == nil {
+			completed++
+			continue
+		}
+		log.Printf("process-bulk-jobs: job %s (attempt %d): %v", j.id, j.attempt, err)
+		if ctx.Err() != nil {
+			return completed, ctx.Err()
+		}
+		if j.attempt >= maxBulkJobAttempts && !errors.Is(err, errBulkClaimLost) {
+			if err := failBulkJob(ctx, db, j, err.Error()); err != nil {
+				return completed, err
+			}
+		}
+		// Otherwise the job is retried once its claim lapses.
+	}
+	return completed, nil
+}
+
+// claimBulkJob claims the oldest job that is pending or whose claim has
+// lapsed, marking it running. ok is false if there is none. Jobs claimed by
+// other workers are skipped rather than waited on.
+func claimBulkJob(ctx context.Context, db *sql.DB) (j pendingBulkJob, params []byte, ok bool, err error) {
+	err = db.QueryRowContext(ctx, `
+		UPDATE bulk_jobs SET
+			status = 'running', started_at = COALESCE(started_at, now()),
+			attempts = attempts + 1, claimed_until = now() + $1 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM bulk_jobs
+			WHERE status = 'pending' OR (status = 'running' AND COALESCE(claimed_until, '-infinity') < now())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, org_id, actor_agent_id, COALESCE(ip, ''), COALESCE(user_agent, ''), action, params, attempts`,
+		int(bulkJobLease.Seconds()),
+	).Scan(&j.id, &j.orgID, &j.agentID, &j.info.IP, &j.info.UserAgent, &j.action, &params, &j.attempt)
+	if err == sql.ErrNoRows {
+		return j, nil, false, nil
+	}
+	if err != nil {
+		return j, nil, false, fmt.Errorf("claim job: %w", err)
+	}
+	return j, params, true, nil
+}
+
+// renewBulkClaim extends the worker's claim on j, or returns errBulkClaimLost
+// if it no longer holds it.
+func renewBulkClaim(ctx context.Context, db *sql.DB, j pendingBulkJob) error {
+	res, err := db.ExecContext(ctx, `
+		UPDATE bulk_jobs SET claimed_until = now() + $3 * interval '1 second'
+		WHERE id = $1 AND attempts = $2 AND status = 'running'`,
+		j.id, j.attempt, int(bulkJobLease.Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("renew claim: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errBulkClaimLost
+	}
+	return nil
+}
+
+// failBulkJob gives up on j, failing the items it hadn't reached with msg.
+func failBulkJob(ctx context.Context, db *sql.DB, j pendingBulkJob, msg string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE bulk_jobs SET status = 'failed', error = $3, finished_at = now(), claimed_until = NULL
+		WHERE id = $1 AND attempts = $2`,
+		j.id, j.attempt, msg,
+	); err != nil {
+		return fmt.Errorf("mark job %s failed: %w", j.id, err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE bulk_job_items SET status = 'failed', error = $2
+		WHERE job_id = $1 AND status = 'pending'`,
+		j.id, "job failed: "+msg,
+	); err != nil {
+		return fmt.Errorf("fail items of job %s: %w", j.id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func runBulkJob(ctx context.Context, db *sql.DB, j pendingBulkJob, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	actx, err := actorContext(ctx, db, j.orgID, j.agentID, j.info)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT i.ticket_id, t.zendesk_ticket_id
+		FROM bulk_job_items i
+		JOIN tickets t ON t.id = i.ticket_id
+		WHERE i.job_id = $1 AND i.status = 'pending'
+		ORDER BY t.zendesk_ticket_id NULLS FIRST, i.ticket_id`, j.id)
+	if err != nil {
+		return fmt.Errorf("query items: %w", err)
+	}
+	var items []pendingBulkItem
+	for rows.Next() {
+		var it pendingBulkItem
+		if err := rows.Scan(&it.ticketID, &it.zendeskTicketID); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan item: %w", err)
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate items: %w", err)
+	}
+
+	if j.action == bulkMoveToColumn || j.action == bulkMarkRead {
+		for _, it := range items {
+			if err := renewBulkClaim(ctx, db, j); err != nil {
+				return err
+			}
+			if err := applyBulkItem(actx, db, j, it.ticketID, limiter, bus); err != nil {
+				return err
+			}
+		}
+	} else if err := runZendeskBulk(actx, db, j, items, limiter, bus); err != nil {
+		return err
+	}
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE bulk_jobs SET status = 'completed', finished_at = now(), claimed_until = NULL
+		WHERE id = $1 AND attempts = $2`,
+		j.id, j.attempt,
+	)
+	if err != nil {
+		return fmt.Errorf("mark completed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errBulkClaimLost
+	}
+	return nil
+}
+
+// runZendeskBulk writes the job's change back to Zendesk in update_many batches
+// and applies it locally to each ticket Zendesk accepted.
+func runZendeskBulk(ctx context.Context, db *sql.DB, j pendingBulkJob, items []pendingBulkItem, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	update := map[string]any{}
+	switch j.action {
+	case bulkSetStatus:
+		update["status"] = j.params.Status
+	case bulkAssign:
+		update["assignee_id"] = nil
+		if j.params.AssigneeID != nil {
+			var zendeskUserID *int64
+			err := db.QueryRowContext(ctx,
+				`SELECT zendesk_user_id FROM agents WHERE id = $1`, *j.params.AssigneeID,
+			).Scan(&zendeskUserID)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("load assignee: %w", err)
+			}
+			if zendeskUserID == nil || *zendeskUserID <= 0 {
+				return failBulkItems(ctx, db, j.id, items, "assignee no longer exists in Zendesk")
+			}
+			update["assignee_id"] = *zendeskUserID
+		}
+	case bulkAddTags:
+		update["additional_tags"] = j.params.Tags
+	case bulkRemoveTags:
+		update["remove_tags"] = j.params.Tags
+	default:
+		return failBulkItems(ctx, db, j.id, items, "unknown action "+j.action)
+	}
+
+	var linked []pendingBulkItem
+	for _, it := range items {
+		if it.zendeskTicketID == nil {
+			if err := markBulkItem(ctx, db, j.id, it.ticketID, "ticket is not linked to Zendesk"); err != nil {
+				return err
+			}
+			continue
+		}
+		linked = append(linked, it)
+	}
+
+	for batch := range slices.Chunk(linked, zendeskUpdateManyLimit) {
+		if err := renewBulkClaim(ctx, db, j); err != nil {
+			return err
+		}
+		ids := make([]int64, len(batch))
+		for i, it := range batch {
+			ids[i] = *it.zendeskTicketID
+		}
+		status, err := zendeskUpdateMany(ctx, db, j.orgID, ids, update, limiter)
+		if errors.Is(err, errZendeskNotConfigured) {
+			return failBulkItems(ctx, db, j.id, linked, "zendesk not configured")
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			if err := failBulkItems(ctx, db, j.id, batch, "zendesk update failed: "+err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// results maps Zendesk ticket ID to "" on success, else the error.
+		results := map[int64]string{}
+		for _, res := range status.Results {
+			if res.Success || res.Status == "Updated" {
+				results[int64(res.ID)] = ""
+				continue
+			}
+			msg := strings.Join(strings.Fields(res.Status+" "+res.Error+" "+res.Details), " ")
+			if msg == "" {
+				msg = "rejected"
+			}
+			results[int64(res.ID)] = "zendesk: " + msg
+		}
+		for _, it := range batch {
+			msg, ok := results[*it.zendeskTicketID]
+			if !ok {
+				msg = "zendesk job " + status.Status + " without a result for this ticket"
+				if status.Message != "" {
+					msg += ": " + status.Message
+				}
+			}
+			if msg != "" {
+				if err := markBulkItem(ctx, db, j.id, it.ticketID, msg); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := renewBulkClaim(ctx, db, j); err != nil {
+				return err
+			}
+			if err := applyBulkItem(ctx, db, j, it.ticketID, limiter, bus); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// applyBulkItem makes the job's change to one ticket locally, audits it as the
+// job's submitter and marks the item succeeded, in one transaction. It then
+// does what the Zendesk webhooks would for the change, which will find it
+// already stored: refreshing the SLA targets and running automations.
+func applyBulkItem(ctx context.Context, db *sql.DB, j pendingBulkJob, ticketID string, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var boardID string
+	var before, after map[string]any
+	var sent []sentNotification
+	statusChanged := false
+	switch j.action {
+	case bulkSetStatus:
+		var old string
+		if err := tx.QueryRowContext(ctx,
+			`SELECT zendesk_status::text FROM tickets WHERE id = $1 FOR UPDATE`, ticketID,
+		).Scan(&old); err != nil {
+			return fmt.Errorf("lock ticket %s: %w", ticketID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE tickets SET
+				zendesk_status = $1::zendesk_status_category,
+				resolved_at    = CASE
+					WHEN $1::zendesk_status_category IN ('solved', 'closed') THEN COALESCE(resolved_at, now())
+					ELSE NULL
+				END
+			WHERE id = $2`,
+			j.params.Status, ticketID,
+		); err != nil {
+			return fmt.Errorf("update status of %s: %w", ticketID, err)
+		}
+		if old != j.params.Status {
+			statusChanged = true
+			if boardID, err = syncTicketToDefaultKanban(ctx, tx, j.orgID, ticketID, j.params.Status); err != nil {
+				return fmt.Errorf("sync kanban for %s: %w", ticketID, err)
+			}
+			if sent, err = notifyFollowersOfStatus(ctx, tx, j.orgID, ticketID, old, j.params.Status, j.agentID); err != nil {
+				return fmt.Errorf("notify followers of %s: %w", ticketID, err)
+			}
+		}
+		before, after = map[string]any{"status": old}, map[string]any{"status": j.params.Status}
+	case bulkAssign:
+		var old *string
+		if err := tx.QueryRowContext(ctx,
+			`SELECT assignee_id FROM tickets WHERE id = $1 FOR UPDATE`, ticketID,
+		).Scan(&old); err != nil {
+			return fmt.Errorf("lock ticket %s: %w", ticketID, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE tickets SET assignee_id = $1 WHERE id = $2`, j.params.AssigneeID, ticketID,
+		); err != nil {
+			return fmt.Errorf("update assignee of %s: %w", ticketID, err)
+		}
+		before, after = map[string]any{"assignee_id": old}, map[string]any{"assignee_id": j.params.AssigneeID}
+	case bulkAddTags:
+		if err := addTicketTags(ctx, tx, j.orgID, ticketID, j.params.Tags); err != nil {
+			return fmt.Errorf("add tags to %s: %w", ticketID, err)
+		}
+		after = map[string]any{"tags_added": j.params.Tags}
+	case bulkRemoveTags:
+		if err := removeTicketTags(ctx, tx, ticketID, j.params.Tags); err != nil {
+			return fmt.Errorf("remove tags from %s: %w", ticketID, err)
+		}
+		after = map[string]any{"tags_removed": j.params.Tags}
+	case bulkMoveToColumn:
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM board_columns WHERE id = $1 AND board_id = $2)`,
+			j.params.ColumnID, j.params.BoardID,
+		).Scan(&exists); err != nil {
+			return fmt.Errorf("check column: %w", err)
+		}
+		if !exists {
+			return markBulkItem(ctx, db, j.id, ticketID, "column no longer exists")
+		}
+		var oldColumn *string
+		err := tx.QueryRowContext(ctx,
+			`DELETE FROM board_tickets WHERE board_id = $1 AND ticket_id = $2 RETURNING column_id`,
+			j.params.BoardID, ticketID,
+		).Scan(&oldColumn)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("remove %s from board: %w", ticketID, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO board_tickets (board_id, column_id, ticket_id, position)
+			VALUES ($1, $2, $3,
+				(SELECT COALESCE(MAX(position) + 1, 0) FROM board_tickets WHERE column_id = $2))`,
+			j.params.BoardID, j.params.ColumnID, ticketID,
+		); err != nil {
+			return fmt.Errorf("insert %s into column: %w", ticketID, err)
+		}
+		boardID = j.params.BoardID
+		before = map[string]any{"board_id": j.params.BoardID, "column_id": oldColumn}
+		after = map[string]any{"board_id": j.params.BoardID, "column_id": j.params.ColumnID}
+	case bulkMarkRead:
+		if j.agentID == nil {
+			return markBulkItem(ctx, db, j.id, ticketID, "job has no agent")
+		}
+		// Read state is per-agent view state and, as for the single-ticket
+		// endpoint, isn't audited.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ticket_agent_state (ticket_id, agent_id, last_read_at)
+			SELECT $1, id, now() FROM agents WHERE id = $2
+			ON CONFLICT (ticket_id, agent_id) DO UPDATE SET last_read_at = EXCLUDED.last_read_at`,
+			ticketID, *j.agentID,
+		); err != nil {
+			return fmt.Errorf("mark %s read: %w", ticketID, err)
+		}
+	}
+
+	if after != nil {
+		after["bulk_job_id"] = j.id
+		if err := recordAudit(ctx, tx, auditEntry{
+			Action:     "ticket.bulk." + j.action,
+			TargetType: "ticket",
+			TargetID:   ticketID,
+			Before:     before,
+			After:      after,
+		}); err != nil {
+			return fmt.Errorf("audit %s: %w", ticketID, err)
+		}
+	}
+	if err := markBulkItem(ctx, tx, j.id, ticketID, ""); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit %s: %w", ticketID, err)
+	}
+
+	switch j.action {
+	case bulkMarkRead:
+	case bulkMoveToColumn:
+		bus.Publish(ctx, j.orgID, events.BoardTicketsChanged, map[string]string{"board_id": boardID, "ticket_id": ticketID})
+	default:
+		publishTicketChange(ctx, bus, j.orgID, ticketID, boardID)
+	}
+	publishNotifications(ctx, bus, j.orgID, sent)
+	switch j.action {
+	case bulkSetStatus, bulkAddTags, bulkRemoveTags:
+		// Status and tags decide the ticket's SLA targets, and the webhooks
+		// will find the change already stored.
+		logSLA(refreshTicketSLA(ctx, db, j.orgID, ticketID, bus), ticketID)
+	}
+	if statusChanged {
+		logAutomations(runAutomations(ctx, db, j.orgID, ticketID, automationEvent{Trigger: triggerStatusChanged}, limiter, bus), ticketID)
+	}
+	return nil
+}
+
+// markBulkItem records an item's outcome: succeeded if errMsg is empty,
+// otherwise failed with errMsg.
+func markBulkItem(ctx context.Context, ex execer, jobID, ticketID, errMsg string) error {
+	status := "succeeded"
+	if errMsg != "" {
+		status = "failed"
+	}
+	if _, err := ex.ExecContext(ctx, `
+		UPDATE bulk_job_items SET status = $3::bulk_item_status, error = NULLIF($4, '')
+		WHERE job_id = $1 AND ticket_id = $2`,
+		jobID, ticketID, status, errMsg,
+	); err != nil {
+		return fmt.Errorf("mark item %s: %w", ticketID, err)
+	}
+	return nil
+}
+
+func failBulkItems(ctx context.Context, ex execer, jobID string, items []pendingBulkItem, errMsg string) error {
+	for _, it := range items {
+		if err := markBulkItem(ctx, ex, jobID, it.ticketID, errMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
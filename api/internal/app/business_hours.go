@@ -0,0 +1,439 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/businesstime"
+	"purl/api/internal/events"
+)
+
+// orgHoliday is a day the org is closed.
+type orgHoliday struct {
+	ID string `json:"id"`
+	// Date is YYYY-MM-DD in the business-hours time zone.
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+type businessHoursResponse struct {
+	// Hours are the org's weekly opening hours; null when the org is open
+	// around the clock.
+	Hours    *businesstime.Hours `json:"hours"`
+	Holidays []orgHoliday        `json:"holidays"`
+}
+
+type putBusinessHoursRequest struct {
+	TimeZone string                         `json:"time_zone"`
+	Weekly   map[string][]businesstime.Span `json:"weekly"`
+}
+
+type createHolidayRequest struct {
+	// Date is YYYY-MM-DD.
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// loadOrgHours returns the org's business hours with its holidays, or nil if
+// it is open around the clock.
+func loadOrgHours(ctx context.Context, q queryer, orgID string) (*businesstime.Hours, error) {
+	var h businesstime.Hours
+	var weekly []byte
+	err := q.QueryRowContext(ctx,
+		`SELECT time_zone, weekly FROM org_business_hours WHERE org_id = $1`, orgID,
+	).Scan(&h.TimeZone, &weekly)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(weekly, &h.Weekly); err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx,
+		`SELECT to_char(date, 'YYYY-MM-DD') FROM org_holidays WHERE org_id = $1 ORDER BY date`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d string
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		h.Holidays = append(h.Holidays, d)
+	}
+	return &h, rows.Err()
+}
+
+// loadOrgSchedule returns the org's business-hours schedule, or nil (open
+// around the clock) if it has none.
+func loadOrgSchedule(ctx context.Context, q queryer, orgID string) (*businesstime.Schedule, error) {
+	h, err := loadOrgHours(ctx, q, orgID)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	return h.Schedule()
+}
+
+// setWaitingTimes fills in the waiting times of tickets in orgID, as of now.
+func setWaitingTimes(ctx context.Context, q queryer, orgID string, tickets []ticketRow) error {
+	schedule, err := loadOrgSchedule(ctx, q, orgID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range tickets {
+		t := &tickets[i]
+		if t.CustomerWaitingSince == nil {
+			continue
+		}
+		raw := int64(now.Sub(*t.CustomerWaitingSince) / time.Second)
+		business := int64(schedule.Between(*t.CustomerWaitingSince, now) / time.Second)
+		t.WaitingSeconds, t.BusinessWaitingSeconds = &raw, &business
+	}
+	return nil
+}
+
+// @Summary     Get business hours
+// @Tags        Business hours
+// @Description Returns the org's weekly opening hours and holidays. Business-hours waiting times on tickets, and
+// @Description SLA policies with use_org_hours, are measured in them. Changing the hours or holidays recomputes
+// @Description unresolved tickets' SLA targets shortly after.
+// @Produce     json
+// @Success     200  {object}  businessHoursResponse
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /business-hours [get]
+func (a *App) getBusinessHours(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	hours, err := loadOrgHours(r.Context(), conn, o.ID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBusinessHours hours: %v", err)
+		return
+	}
+	if hours != nil {
+		// Holidays are listed with their names below.
+		hours.Holidays = nil
+	}
+	holidays, err := listOrgHolidays(r.Context(), conn)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBusinessHours holidays: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(businessHoursResponse{Hours: hours, Holidays: holidays})
+}
+
+func listOrgHolidays(ctx context.Context, q queryer) ([]orgHoliday, error) {
+	rows, err := q.QueryContext(ctx, `SELECT id, to_char(date, 'YYYY-MM-DD'), name FROM org_holidays ORDER BY date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := []orgHoliday{}
+	for rows.Next() {
+		var h orgHoliday
+		if err := rows.Scan(&h.ID, &h.Date, &h.Name); err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// @Summary     Set business hours
+// @Tags        Business hours
+// @Description Replaces the org's weekly opening hours. Holidays are kept.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      putBusinessHoursRequest  true  "Time zone and weekly hours"
+// @Success     200   {object}  businesstime.Hours
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /business-hours [put]
+func (a *App) putBusinessHours(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req putBusinessHoursRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	hours := businesstime.Hours{TimeZone: req.TimeZone, Weekly: req.Weekly}
+	if _, err := hours.Schedule(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weekly, _ := json.Marshal(hours.Weekly)
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := loadOrgHours(r.Context(), tx, o.ID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours load: %v", err)
+		return
+	}
+	if old != nil {
+		old.Holidays = nil
+	}
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO org_business_hours (org_id, time_zone, weekly)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id) DO UPDATE SET time_zone = EXCLUDED.time_zone, weekly = EXCLUDED.weekly`,
+		o.ID, hours.TimeZone, weekly,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours upsert: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "business_hours.update",
+		TargetType: "organization",
+		TargetID:   o.ID,
+		Before:     old,
+		After:      hours,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, o.ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours request SLA refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("putBusinessHours commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.BusinessHoursUpdated, map[string]string{})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hours)
+}
+
+// @Summary     Clear business hours
+// @Tags        Business hours
+// @Description Makes the org open around the clock. Holidays are kept but have no effect until hours are set again.
+// @Success     204
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /business-hours [delete]
+func (a *App) deleteBusinessHours(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := loadOrgHours(r.Context(), tx, o.ID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours load: %v", err)
+		return
+	}
+	if old == nil {
+		http.Error(w, "business hours not set", http.StatusNotFound)
+		return
+	}
+	old.Holidays = nil
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM org_business_hours WHERE org_id = $1`, o.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "business_hours.delete",
+		TargetType: "organization",
+		TargetID:   o.ID,
+		Before:     old,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, o.ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours request SLA refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteBusinessHours commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.BusinessHoursUpdated, map[string]string{})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary     Add a holiday
+// @Tags        Business hours
+// @Description Closes the org for the day, in its business-hours time zone
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createHolidayRequest  true  "Holiday"
+// @Success     201   {object}  orgHoliday
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Failure     409   {string}  string  "Conflict"
+// @Security    ApiKeyAuth
+// @Router      /business-hours/holidays [post]
+func (a *App) createHoliday(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createHolidayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(businesstime.DateLayout, req.Date); err != nil {
+		http.Error(w, "date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createHoliday begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	h := orgHoliday{Date: req.Date, Name: req.Name}
+	err = tx.QueryRowContext(r.Context(), `
+		INSERT INTO org_holidays (org_id, date, name)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, date) DO NOTHING
+		RETURNING id`,
+		o.ID, req.Date, req.Name,
+	).Scan(&h.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "a holiday already exists on that date", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createHoliday insert: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "holiday.create",
+		TargetType: "holiday",
+		TargetID:   h.ID,
+		After:      h,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createHoliday audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, o.ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("createHoliday request SLA refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createHoliday commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.BusinessHoursUpdated, map[string]string{})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h)
+}
+
+// @Summary     Delete a holiday
+// @Tags        Business hours
+// @Param       holidayID  path  string  true  "Holiday ID"
+// @Success     204
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /business-hours/holidays/{holidayID} [delete]
+func (a *App) deleteHoliday(w http.ResponseWriter, r *http.Request) {
+	holidayID := chi.URLParam(r, "holidayID")
+	if !reUUID.MatchString(holidayID) {
+		http.Error(w, "holiday not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteHoliday begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	h := orgHoliday{ID: holidayID}
+	err = tx.QueryRowContext(r.Context(),
+		`DELETE FROM org_holidays WHERE id = $1 RETURNING to_char(date, 'YYYY-MM-DD'), name`, holidayID,
+	).Scan(&h.Date, &h.Name)
+	if err == sql.ErrNoRows {
+		http.Error(w, "holiday not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteHoliday delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "holiday.delete",
+		TargetType: "holiday",
+		TargetID:   h.ID,
+		Before:     h,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteHoliday audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, orgFromContext(r.Context()).ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteHoliday request SLA refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteHoliday commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.BusinessHoursUpdated, map[string]string{})
+
+	w.WriteHeader(http.StatusNoContent)
+}
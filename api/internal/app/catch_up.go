@@ -7,6 +7,7 @@ import (
 	"log"
 	"sync"
 
+	"purl/api/internal/events"
 	"purl/api/internal/ratelimit"
 )
 
@@ -15,8 +16,9 @@ import (
 // after deploying new webhook handlers to backfill missed events.
 //
 // Tickets are processed with 3 concurrent workers. Failures are logged and
-// skipped so one bad ticket doesn't abort the whole run.
-func CatchUpZendeskTickets(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, orgID string) error {
+// skipped so one bad ticket doesn't abort the whole run. bus may be nil to skip
+// publishing change events.
+func CatchUpZendeskTickets(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, bus *events.Bus, orgID string) error {
 	rows, err := db.QueryContext(ctx,
 		`SELECT zendesk_ticket_id FROM tickets WHERE org_id = $1 AND zendesk_ticket_id IS NOT NULL ORDER BY zendesk_ticket_id`,
 		orgID,
@@ -60,7 +62,7 @@ func CatchUpZendeskTickets(ctx context.Context, db *sql.DB, limiter *ratelimit.L
 		go func() {
 			defer wg.Done()
 			for zendeskID := range work {
-				if err := catchUpTicket(ctx, db, limiter, orgID, zendeskID); err != nil {
+				if err := catchUpTicket(ctx, db, limiter, bus, orgID, zendeskID); err != nil {
 					log.Printf("catch-up: ticket %d failed: %v", int64(zendeskID), err)
 					mu.Lock()
 					failures++
@@ -85,11 +87,11 @@ func CatchUpZendeskTickets(ctx context.Context, db *sql.DB, limiter *ratelimit.L
 	return nil
 }
 
-func catchUpTicket(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, orgID string, zendeskID flexInt64) error {
+func catchUpTicket(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, bus *events.Bus, orgID string, zendeskID flexInt64) error {
 	ticket, err := fetchZendeskTicket(ctx, db, orgID, zendeskID, limiter)
 	if errors.Is(err, errZendeskNotFound) {
 		// Ticket was deleted in Zendesk — remove it from our DB.
-		return handleTicketDeleted(ctx, db, orgID, zendeskID)
+		return handleTicketDeleted(ctx, db, orgID, zendeskID, bus)
 	}
 	if err != nil {
 		return err
@@ -97,5 +99,5 @@ func catchUpTicket(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter,
 	if ticket == nil {
 		return nil // no credentials configured; skip silently
 	}
-	return handleTicketUpsert(ctx, db, orgID, ticket, limiter)
+	return handleTicketUpsert(ctx, db, orgID, ticket, limiter, bus)
 }
@@ -0,0 +1,807 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// Export formats:
+//
+//	csv     one row per comment, with its ticket's columns; a ticket without
+//	        comments gets one row with the comment columns empty
+//	ndjson  one ticket per line, as GET /tickets/{ticketID} with its comments
+//	        (as GET /tickets/{ticketID}/comments) under "comments"
+//	zip     tickets.csv (one row per ticket) and comments.csv (one row per
+//	        comment, keyed by ticket_id)
+var exportFormats = []string{"csv", "ndjson", "zip"}
+
+// exportLinkTTL is how long a finished export can be downloaded.
+const exportLinkTTL = 24 * time.Hour
+
+// exportChunkSize is the size of the export_job_chunks the file is stored in.
+const exportChunkSize = 1 << 20
+
+// exportBatchSize is how many tickets the worker reads at a time.
+const exportBatchSize = 500
+
+const (
+	// exportJobLease is how long a worker's claim on an export lasts. It is
+	// renewed with each chunk written.
+	exportJobLease = 10 * time.Minute
+	// maxExportAttempts is how many times an export whose worker died is
+	// started before it fails.
+	maxExportAttempts = 3
+	// exportJobsPerRun caps how many exports one worker run claims.
+	exportJobsPerRun = 5
+)
+
+type createExportRequest struct {
+	// Format is csv, ndjson or zip.
+	Format string `json:"format"`
+	// Filter selects the tickets, as GET /tickets and saved views. It is
+	// evaluated when the export runs; omitted exports every ticket,
+	// snoozed ones included.
+	Filter ticketFilter `json:"filter"`
+}
+
+type exportJob struct {
+	ID     string       `json:"id"`
+	Format string       `json:"format"`
+	Filter ticketFilter `json:"filter"`
+	// Status is pending, running, completed, failed or expired.
+	Status     string     `json:"status"`
+	Error      *string    `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// TicketCount and SizeBytes describe the finished file.
+	TicketCount *int   `json:"ticket_count"`
+	SizeBytes   *int64 `json:"size_bytes"`
+	// DownloadURL, relative to the API, serves the file without further
+	// authentication until ExpiresAt. Null unless completed.
+	DownloadURL *string    `json:"download_url"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+const exportJobSelect = `
+	SELECT id, format, filter, status::text, error, created_at, started_at, finished_at,
+	       ticket_count, size_bytes, download_token, expires_at
+	FROM export_jobs`
+
+func scanExportJob(row rowScanner) (exportJob, error) {
+	var j exportJob
+	var filter []byte
+	var token *string
+	err := row.Scan(&j.ID, &j.Format, &filter, &j.Status, &j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt,
+		&j.TicketCount, &j.SizeBytes, &token, &j.ExpiresAt)
+	if err != nil {
+		return j, err
+	}
+	if err := json.Unmarshal(filter, &j.Filter); err != nil {
+		return j, fmt.Errorf("parse filter: %w", err)
+	}
+	if token != nil && j.Status == "completed" {
+		url := "/exports/download/" + *token
+		j.DownloadURL = &url
+	}
+	return j, nil
+}
+
+// @Summary     Export tickets
+// @Tags        Exports
+// @Description Queues an export of the tickets matching filter (as GET /tickets) with their comments, reporter,
+// @Description assignee, AI fields and call metadata. Formats: csv (one row per comment), ndjson (one ticket per
+// @Description line) or zip (tickets.csv and comments.csv). Poll GET /exports/{exportID}, or wait for an
+// @Description export.updated event, for the download link, which expires 24 hours after the export finishes.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createExportRequest  true  "Format and filter"
+// @Success     202   {object}  exportJob
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /exports [post]
+func (a *App) createExport(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	var req createExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !slices.Contains(exportFormats, req.Format) {
+		http.Error(w, "format must be one of "+strings.Join(exportFormats, ", "), http.StatusBadRequest)
+		return
+	}
+	if err := req.Filter.validate(); err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, _, err := req.Filter.where(r.Context(), o.ID, nil); errors.Is(err, errFilterNeedsAgent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, _ := json.Marshal(req.Filter)
+	info := requestInfoFromContext(r.Context())
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createExport begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	job, err := scanExportJob(tx.QueryRowContext(r.Context(), `
+		INSERT INTO export_jobs (org_id, actor_agent_id, ip, user_agent, format, filter)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		RETURNING id, format, filter, status::text, error, created_at, started_at, finished_at,
+		          ticket_count, size_bytes, download_token, expires_at`,
+		o.ID, callerAgentID(r.Context()), info.IP, info.UserAgent, req.Format, filter,
+	))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createExport insert: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "export.create",
+		TargetType: "export_job",
+		TargetID:   job.ID,
+		After:      map[string]any{"format": req.Format, "filter": req.Filter},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createExport audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createExport commit: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// @Summary     List exports
+// @Tags        Exports
+// @Description Returns the org's 50 most recent exports, newest first
+// @Produce     json
+// @Success     200  {array}   exportJob
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /exports [get]
+func (a *App) listExports(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(),
+		exportJobSelect+` ORDER BY created_at DESC, id LIMIT 50`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listExports query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	jobs := []exportJob{}
+	for rows.Next() {
+		j, err := scanExportJob(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listExports scan: %v", err)
+			return
+		}
+		jobs = append(jobs, j)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// @Summary     Get export
+// @Tags        Exports
+// @Description Returns an export's status and, once completed, its download link
+// @Produce     json
+// @Param       exportID  path      string  true  "Export ID"
+// @Success     200       {object}  exportJob
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /exports/{exportID} [get]
+func (a *App) getExport(w http.ResponseWriter, r *http.Request) {
+	exportID := chi.URLParam(r, "exportID")
+	if !reUUID.MatchString(exportID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	j, err := scanExportJob(a.conn(r.Context()).QueryRowContext(r.Context(),
+		exportJobSelect+` WHERE id = $1`, exportID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getExport: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j)
+}
+
+// exportContentTypes maps formats to the Content-Type they are served with.
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"zip":    "application/zip",
+}
+
+// @Summary     Download export
+// @Tags        Exports
+// @Description Serves a completed export's file. The token in the path is the authentication, so the link
+// @Description can be opened directly; it stops working when the export expires.
+// @Produce     octet-stream
+// @Param       token  path      string  true  "Download token from the export's download_url"
+// @Success     200    {file}    file
+// @Failure     404    {string}  string  "Not Found"
+// @Router      /exports/download/{token} [get]
+func (a *App) downloadExport(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	// No org is known until the token is looked up, so this reads through
+	// the owner connection, matching on the token alone.
+	var jobID, format string
+	var createdAt time.Time
+	var size int64
+	err := a.db.QueryRowContext(r.Context(), `
+		SELECT id, format, created_at, size_bytes FROM export_jobs
+		WHERE download_token = $1 AND status = 'completed' AND expires_at > now()`, token,
+	).Scan(&jobID, &format, &createdAt, &size)
+	if err == sql.ErrNoRows {
+		http.Error(w, "export not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("downloadExport lookup: %v", err)
+		return
+	}
+
+	rows, err := a.db.QueryContext(r.Context(),
+		`SELECT data FROM export_job_chunks WHERE job_id = $1 ORDER BY seq`, jobID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("downloadExport chunks: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="tickets-%s.%s"`, createdAt.UTC().Format("20060102-150405"), format))
+	w.Header().Set("Cache-Control", "private, no-store")
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			log.Printf("downloadExport scan: %v", err)
+			return
+		}
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("downloadExport rows: %v", err)
+	}
+}
+
+// ── Worker ───────────────────────────────────────────────────────────────────
+
+// pendingExportJob is an unfinished export as seen by the worker.
+type pendingExportJob struct {
+	id      string
+	orgID   string
+	agentID *string
+	info    requestInfo
+	format  string
+	filter  ticketFilter
+	// attempt is the job's attempts when claimed; the claim is only held
+	// while it is unchanged.
+	attempt int
+}
+
+// errExportClaimLost means another worker claimed the export after this
+// one's claim lapsed.
+var errExportClaimLost = errors.New("claim on export lost")
+
+// ProcessExportJobs expires finished exports past their link's lifetime, then
+// claims unfinished exports, oldest first, runs them and returns how many it
+// completed. Exports whose worker died part-way start again from scratch once
+// their claim lapses.
+func ProcessExportJobs(ctx context.Context, db *sql.DB, bus *events.Bus) (int, error) {
+	if _, err := db.ExecContext(ctx, `
+		WITH expired AS (
+			UPDATE export_jobs SET status = 'expired', download_token = NULL
+			WHERE status = 'completed' AND expires_at <= now()
+			RETURNING id
+		)
+		DELETE FROM export_job_chunks WHERE job_id IN (SELECT id FROM expired)`,
+	); err != nil {
+		return 0, fmt.Errorf("expire exports: %w", err)
+	}
+
+	completed := 0
+	for range exportJobsPerRun {
+		j, filter, ok, err := claimExportJob(ctx, db)
+		if err != nil {
+			return completed, err
+		}
+		if !ok {
+			break
+		}
+		if j.attempt > maxExportAttempts {
+			err = fmt.Errorf("gave up after %d attempts", maxExportAttempts)
+		} else if err = json.Unmarshal(filter, &j.filter); err != nil {
+			err = fmt.Errorf("parse filter: %w", err)
+		} else {
+			err = runExportJob(ctx, db, j)
+		}
+		if err == nil {
+			completed++
+		} else {
+			log.Printf("process-export-jobs: export %s: %v", j.id, err)
+			if ctx.Err() != nil {
+				return completed, ctx.Err()
+			}
+			if errors.Is(err, errExportClaimLost) {
+				continue
+			}
+			if err := failExportJob(ctx, db, j, err.Error()); err != nil {
+				return completed, err
+			}
+		}
+		bus.Publish(ctx, j.orgID, events.ExportUpdated, map[string]string{"export_id": j.id})
+	}
+	return completed, nil
+}
+
+// claimExportJob claims the oldest export that is pending or whose claim has
+// lapsed, marking it running. ok is false if there is none. Exports claimed
+// by other workers are skipped rather than waited on.
+func claimExportJob(ctx context.Context, db *sql.DB) (j pendingExportJob, filter []byte, ok bool, err error) {
+	err = db.QueryRowContext(ctx, `
+		UPDATE export_jobs SET
+			status = 'running', started_at = now(),
+			attempts = attempts + 1, claimed_until = now() + $1 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = 'pending' OR (status = 'running' AND COALESCE(claimed_until, '-infinity') < now())
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING id, org_id, actor_agent_id, COALESCE(ip, ''), COALESCE(user_agent, ''), format, filter, attempts`,
+		int(exportJobLease.Seconds()),
+	).Scan(&j.id, &j.orgID, &j.agentID, &j.info.IP, &j.info.UserAgent, &j.format, &filter, &j.attempt)
+	if err == sql.ErrNoRows {
+		return j, nil, false, nil
+	}
+	if err != nil {
+		return j, nil, false, fmt.Errorf("claim export: %w", err)
+	}
+	return j, filter, true, nil
+}
+
+// failExportJob marks j failed with msg and drops what it had written, if
+// the worker still holds its claim.
+func failExportJob(ctx context.Context, db *sql.DB, j pendingExportJob, msg string) error {
+	if _, err := db.ExecContext(ctx, `
+		WITH failed AS (
+			UPDATE export_jobs SET status = 'failed', error = $3, finished_at = now(), claimed_until = NULL
+			WHERE id = $1 AND attempts = $2
+			RETURNING id
+		)
+		DELETE FROM export_job_chunks WHERE job_id IN (SELECT id FROM failed)`,
+		j.id, j.attempt, msg,
+	); err != nil {
+		return fmt.Errorf("mark export %s failed: %w", j.id, err)
+	}
+	return nil
+}
+
+func runExportJob(ctx context.Context, db *sql.DB, j pendingExportJob) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM export_job_chunks WHERE job_id = $1`, j.id); err != nil {
+		return fmt.Errorf("clear chunks: %w", err)
+	}
+
+	// The filter's "me", read and starred refer to the submitting agent.
+	actx, err := actorContext(ctx, db, j.orgID, j.agentID, j.info)
+	if err != nil {
+		return err
+	}
+	cond, args, err := j.filter.where(actx, j.orgID, nil)
+	if err != nil {
+		return err
+	}
+
+	// Tickets are read as the submitting agent, as GET /tickets would, so that
+	// their read, starred and following fields are the agent's.
+	conn, release, err := openOrgConn(ctx, db, j.orgID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if j.agentID != nil {
+		if _, err := conn.ExecContext(ctx, `SELECT set_config('app.current_agent_id', $1, false)`, *j.agentID); err != nil {
+			return fmt.Errorf("set agent: %w", err)
+		}
+	}
+
+	out := &exportChunkWriter{ctx: ctx, db: db, job: j}
+	var n int
+	switch j.format {
+	case "csv":
+		n, err = writeExportCSV(actx, conn, j.orgID, cond, args, out)
+	case "ndjson":
+		n, err = writeExportNDJSON(actx, conn, j.orgID, cond, args, out)
+	case "zip":
+		n, err = writeExportZip(actx, conn, j.orgID, cond, args, out)
+	default:
+		err = fmt.Errorf("unknown format %q", j.format)
+	}
+	if err == nil {
+		err = out.flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return fmt.Errorf("generate token: %w", err)
+	}
+	res, err := db.ExecContext(ctx, `
+		UPDATE export_jobs
+		SET status = 'completed', finished_at = now(), error = NULL, ticket_count = $2, size_bytes = $3,
+		    download_token = $4, expires_at = now() + $5 * interval '1 second', claimed_until = NULL
+		WHERE id = $1 AND attempts = $6`,
+		j.id, n, out.size, hex.EncodeToString(tokenBytes), int64(exportLinkTTL/time.Second), j.attempt,
+	)
+	if err != nil {
+		return fmt.Errorf("mark completed: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return errExportClaimLost
+	}
+	return nil
+}
+
+// exportChunkWriter stores what is written to it in export_job_chunks,
+// renewing the worker's claim on the job with each chunk.
+type exportChunkWriter struct {
+	ctx  context.Context
+	db   *sql.DB
+	job  pendingExportJob
+	buf  bytes.Buffer
+	seq  int
+	size int64
+}
+
+func (w *exportChunkWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	w.size += int64(n)
+	for w.buf.Len() >= exportChunkSize {
+		if err := w.insert(w.buf.Next(exportChunkSize)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// flush stores whatever is left in the buffer.
+func (w *exportChunkWriter) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	return w.insert(w.buf.Next(w.buf.Len()))
+}
+
+func (w *exportChunkWriter) insert(data []byte) error {
+	res, err := w.db.ExecContext(w.ctx, `
+		WITH claim AS (
+			UPDATE export_jobs SET claimed_until = now() + $5 * interval '1 second'
+			WHERE id = $1 AND attempts = $4 AND status = 'running'
+			RETURNING id
+		)
+		INSERT INTO export_job_chunks (job_id, seq, data) SELECT id, $2, $3 FROM claim`,
+		w.job.id, w.seq, data, w.job.attempt, int(exportJobLease.Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("insert chunk %d: %w", w.seq, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errExportClaimLost
+	}
+	w.seq++
+	return nil
+}
+
+// exportTicket is a ticket with its comments, as an ndjson line.
+type exportTicket struct {
+	ticketRow
+	Comments []ticketCommentRow `json:"comments"`
+}
+
+// eachExportTicket calls fn with each of the org's tickets matching cond, in
+// received order, with its comments. It returns how many tickets it read.
+func eachExportTicket(ctx context.Context, q queryer, orgID, cond string, args []any, fn func(exportTicket) error) (int, error) {
+	n := len(args)
+	afterAt, afterID := time.Time{}, "00000000-0000-0000-0000-000000000000"
+	total := 0
+	for {
+		rows, err := q.QueryContext(ctx, ticketSelect+fmt.Sprintf(`
+			WHERE %s AND (COALESCE(t.received_at, t.created_at), t.id) > ($%d, $%d)
+			ORDER BY COALESCE(t.received_at, t.created_at), t.id
+			LIMIT %d`, cond, n+1, n+2, exportBatchSize), append(args, afterAt, afterID)...)
+		if err != nil {
+			return total, fmt.Errorf("query tickets: %w", err)
+		}
+		var batch []ticketRow
+		for rows.Next() {
+			t, err := scanTicket(rows)
+			if err != nil {
+				rows.Close()
+				return total, fmt.Errorf("scan ticket: %w", err)
+			}
+			batch = append(batch, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, fmt.Errorf("query tickets: %w", err)
+		}
+		if len(batch) == 0 {
+			return total, nil
+		}
+		if err := setWaitingTimes(ctx, q, orgID, batch); err != nil {
+			return total, fmt.Errorf("waiting times: %w", err)
+		}
+
+		ids := make([]string, len(batch))
+		for i, t := range batch {
+			ids[i] = t.ID
+		}
+		comments := map[string][]ticketCommentRow{}
+		err = queryEach(ctx, q, `SELECT tc.ticket_id, `+ticketCommentColumns+ticketCommentFrom+`
+			WHERE tc.ticket_id = ANY($1)
+			ORDER BY tc.created_at ASC, tc.zendesk_sub_index ASC`, []any{ids},
+			func(scan func(...any) error) error {
+				var ticketID string
+				c, err := scanTicketComment(scanFunc(func(dest ...any) error {
+					return scan(append([]any{&ticketID}, dest...)...)
+				}))
+				if err != nil {
+					return err
+				}
+				comments[ticketID] = append(comments[ticketID], c)
+				return nil
+			})
+		if err != nil {
+			return total, fmt.Errorf("query comments: %w", err)
+		}
+
+		for _, t := range batch {
+			et := exportTicket{ticketRow: t, Comments: comments[t.ID]}
+			if et.Comments == nil {
+				et.Comments = []ticketCommentRow{}
+			}
+			if err := fn(et); err != nil {
+				return total, err
+			}
+			total++
+		}
+		last := batch[len(batch)-1]
+		afterAt, afterID = last.ReceivedAt, last.ID
+	}
+}
+
+// scanFunc adapts a Scan method value to rowScanner.
+type scanFunc func(...any) error
+
+func (f scanFunc) Scan(dest ...any) error { return f(dest...) }
+
+func writeExportNDJSON(ctx context.Context, q queryer, orgID, cond string, args []any, w io.Writer) (int, error) {
+	enc := json.NewEncoder(w)
+	return eachExportTicket(ctx, q, orgID, cond, args, func(t exportTicket) error {
+		return enc.Encode(t)
+	})
+}
+
+func writeExportCSV(ctx context.Context, q queryer, orgID, cond string, args []any, w io.Writer) (int, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(slices.Clone(exportTicketColumns), exportCommentColumns[1:]...)); err != nil {
+		return 0, err
+	}
+	emptyComment := make([]string, len(exportCommentColumns)-1)
+	n, err := eachExportTicket(ctx, q, orgID, cond, args, func(t exportTicket) error {
+		ticket, err := exportTicketRecord(t.ticketRow)
+		if err != nil {
+			return fmt.Errorf("ticket %s: %w", t.ID, err)
+		}
+		if len(t.Comments) == 0 {
+			return cw.Write(append(ticket, emptyComment...))
+		}
+		for _, c := range t.Comments {
+			comment, err := exportCommentRecord(t.ID, c)
+			if err != nil {
+				return fmt.Errorf("comment %s: %w", c.ID, err)
+			}
+			if err := cw.Write(append(slices.Clone(ticket), comment[1:]...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// writeExportZip writes tickets.csv, then comments.csv, which is spooled to a
+// temporary file meanwhile since a zip entry must be written in one go.
+func writeExportZip(ctx context.Context, q queryer, orgID, cond string, args []any, w io.Writer) (int, error) {
+	spool, err := os.CreateTemp("", "purl-export-comments-*.csv")
+	if err != nil {
+		return 0, fmt.Errorf("create spool: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	zw := zip.NewWriter(w)
+	tickets, err := zw.Create("tickets.csv")
+	if err != nil {
+		return 0, err
+	}
+	tw, cw := csv.NewWriter(tickets), csv.NewWriter(spool)
+	if err := tw.Write(exportTicketColumns); err != nil {
+		return 0, err
+	}
+	if err := cw.Write(exportCommentColumns); err != nil {
+		return 0, err
+	}
+	n, err := eachExportTicket(ctx, q, orgID, cond, args, func(t exportTicket) error {
+		ticket, err := exportTicketRecord(t.ticketRow)
+		if err != nil {
+			return fmt.Errorf("ticket %s: %w", t.ID, err)
+		}
+		if err := tw.Write(ticket); err != nil {
+			return err
+		}
+		for _, c := range t.Comments {
+			comment, err := exportCommentRecord(t.ID, c)
+			if err != nil {
+				return fmt.Errorf("comment %s: %w", c.ID, err)
+			}
+			if err := cw.Write(comment); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	tw.Flush()
+	cw.Flush()
+	if err := errors.Join(tw.Error(), cw.Error()); err != nil {
+		return n, err
+	}
+
+	comments, err := zw.Create("comments.csv")
+	if err != nil {
+		return n, err
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return n, fmt.Errorf("rewind spool: %w", err)
+	}
+	if _, err := io.Copy(comments, spool); err != nil {
+		return n, fmt.Errorf("copy comments: %w", err)
+	}
+	return n, zw.Close()
+}
+
+var exportTicketColumns = []string{
+	"ticket_id", "zendesk_ticket_id", "title", "description", "status", "priority",
+	"reporter_name", "reporter_email", "assignee_name", "tags", "received_at", "first_responded_at", "resolved_at",
+	"ai_title", "ai_summary", "ai_temperature", "sla_breached",
+}
+
+func exportTicketRecord(t ticketRow) ([]string, error) {
+	return csvRecord(
+		t.ID, t.ZendeskTicketID, t.Title, t.Description, t.ZendeskStatus, t.ZendeskPriority,
+		t.ReporterName, t.ReporterEmail, t.AssigneeName, strings.Join(t.Tags, " "),
+		&t.ReceivedAt, t.FirstRespondedAt, t.ResolvedAt,
+		t.AiTitle, t.AiSummary, t.AiTemperature, t.SLABreached,
+	)
+}
+
+// exportCommentColumns starts with ticket_id, which the csv format leaves out
+// since its rows carry all the ticket's columns.
+var exportCommentColumns = []string{
+	"ticket_id", "comment_id", "comment_received_at", "role", "channel", "author_name", "body",
+	"call_id", "call_from", "call_to", "call_started_at", "call_duration", "answered_by_name", "call_location",
+	"transcription_status", "transcription_text",
+}
+
+func exportCommentRecord(ticketID string, c ticketCommentRow) ([]string, error) {
+	author := c.AuthorName
+	if c.AuthorDisplayName != nil {
+		author = *c.AuthorDisplayName
+	}
+	return csvRecord(
+		ticketID, c.ID, &c.ReceivedAt, c.Role, c.Channel, author, c.Body,
+		c.CallID, c.CallFrom, c.CallTo, c.CallStartedAt, c.CallDuration,
+		c.AnsweredByName, c.CallLocation, c.TranscriptionStatus, c.TranscriptionText,
+	)
+}
+
+// csvRecord formats columns for CSV, with null as the empty string and times
+// in RFC 3339.
+func csvRecord(values ...any) ([]string, error) {
+	record := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case string:
+			record[i] = v
+		case *string:
+			if v != nil {
+				record[i] = *v
+			}
+		case *int:
+			if v != nil {
+				record[i] = strconv.Itoa(*v)
+			}
+		case *int64:
+			if v != nil {
+				record[i] = strconv.FormatInt(*v, 10)
+			}
+		case *bool:
+			if v != nil {
+				record[i] = strconv.FormatBool(*v)
+			}
+		case *time.Time:
+			if v != nil {
+				record[i] = v.UTC().Format(time.RFC3339)
+			}
+		default:
+			return nil, fmt.Errorf("column %d: unsupported type %T", i, v)
+		}
+	}
+	return record, nil
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"log"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
 )
 
 type kanbanColumn struct {
@@ -29,6 +31,30 @@ type kanbanBoard struct {
 	Columns   []kanbanColumn `json:"columns"`
 }
 
+// boardAuditSnapshot is the audited view of a board. Timestamps are omitted so
+// diffs only show meaningful changes.
+type boardAuditSnapshot struct {
+	Name string `json:"name"`
+}
+
+// columnAuditSnapshot is the audited view of one board column.
+type columnAuditSnapshot struct {
+	Name          string  `json:"name"`
+	Position      int     `json:"position"`
+	ZendeskStatus *string `json:"zendesk_status"`
+	Color         string  `json:"color"`
+}
+
+// columnsAuditSnapshot keys columns by ID so the audit diff reports each
+// added, removed or changed column individually.
+func columnsAuditSnapshot(columns []kanbanColumn) map[string]columnAuditSnapshot {
+	snap := make(map[string]columnAuditSnapshot, len(columns))
+	for _, c := range columns {
+		snap[c.ID] = columnAuditSnapshot{Name: c.Name, Position: c.Position, ZendeskStatus: c.ZendeskStatus, Color: c.Color}
+	}
+	return snap
+}
+
 type createKanbanRequest struct {
 	Name string `json:"name"`
 }
@@ -67,8 +93,25 @@ func (a *App) updateKanban(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateKanban begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT name FROM boards WHERE id = $1 FOR UPDATE`, boardID,
+	).Scan(&oldName); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("updateKanban lock: %v", err)
+		return
+	}
+
 	var b kanbanBoard
-	err := a.db.QueryRowContext(r.Context(), `
+	err = tx.QueryRowContext(r.Context(), `
 		UPDATE boards SET name = $2
 		WHERE id = $1
 		RETURNING id, created_at, updated_at, name, is_default
@@ -80,6 +123,25 @@ func (a *App) updateKanban(w http.ResponseWriter, r *http.Request) {
 	}
 	b.Columns = []kanbanColumn{}
 
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "kanban.update",
+		TargetType: "board",
+		TargetID:   boardID,
+		Before:     boardAuditSnapshot{Name: oldName},
+		After:      boardAuditSnapshot{Name: b.Name},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateKanban audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateKanban commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.BoardUpdated, map[string]string{"board_id": boardID})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(b)
 }
@@ -108,8 +170,16 @@ func (a *App) createKanban(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createKanban begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
 	var b kanbanBoard
-	err := a.db.QueryRowContext(r.Context(), `
+	err = tx.QueryRowContext(r.Context(), `
 		INSERT INTO boards (org_id, name, is_default)
 		VALUES ($1, $2, false)
 		RETURNING id, created_at, updated_at, name, is_default
@@ -121,6 +191,24 @@ func (a *App) createKanban(w http.ResponseWriter, r *http.Request) {
 	}
 	b.Columns = []kanbanColumn{}
 
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "kanban.create",
+		TargetType: "board",
+		TargetID:   b.ID,
+		After:      boardAuditSnapshot{Name: b.Name},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createKanban audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createKanban commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.BoardUpdated, map[string]string{"board_id": b.ID})
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(b)
@@ -137,7 +225,7 @@ func (a *App) createKanban(w http.ResponseWriter, r *http.Request) {
 func (a *App) listKanbans(w http.ResponseWriter, r *http.Request) {
 	o := orgFromContext(r.Context())
 
-	boardRows, err := a.db.QueryContext(r.Context(), `
+	boardRows, err := a.conn(r.Context()).QueryContext(r.Context(), `
 		SELECT id, created_at, updated_at, name, is_default
 		FROM boards
 		WHERE org_id = $1
@@ -172,7 +260,7 @@ func (a *App) listKanbans(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch all columns for this org's boards in one query
-	colRows, err := a.db.QueryContext(r.Context(), `
+	colRows, err := a.conn(r.Context()).QueryContext(r.Context(), `
 		SELECT bc.id, bc.created_at, bc.updated_at, bc.board_id, bc.name, bc.position, bc.zendesk_status, bc.color
 		FROM board_columns bc
 		JOIN boards b ON b.id = bc.board_id
@@ -218,13 +306,56 @@ func (a *App) deleteKanban(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := a.db.ExecContext(r.Context(), `DELETE FROM boards WHERE id = $1`, boardID)
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
 	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteKanban begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT name FROM boards WHERE id = $1 FOR UPDATE`, boardID,
+	).Scan(&name); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteKanban lock: %v", err)
+		return
+	}
+	columns, err := loadBoardColumns(r.Context(), tx, boardID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteKanban columns: %v", err)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM boards WHERE id = $1`, boardID); err != nil {
 		http.Error(w, "delete failed", http.StatusInternalServerError)
 		log.Printf("deleteKanban delete: %v", err)
 		return
 	}
 
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "kanban.delete",
+		TargetType: "board",
+		TargetID:   boardID,
+		Before: map[string]any{
+			"name":    name,
+			"columns": columnsAuditSnapshot(columns),
+		},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteKanban audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteKanban commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.BoardUpdated, map[string]string{"board_id": boardID})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -236,7 +367,7 @@ func (a *App) requireBoardInOrg(w http.ResponseWriter, r *http.Request) string {
 	o := orgFromContext(r.Context())
 
 	var isDefault bool
-	err := a.db.QueryRowContext(r.Context(),
+	err := a.conn(r.Context()).QueryRowContext(r.Context(),
 		`SELECT is_default FROM boards WHERE id = $1 AND org_id = $2`,
 		boardID, o.ID,
 	).Scan(&isDefault)
@@ -301,7 +432,7 @@ func (a *App) putKanbanColumns(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch existing column IDs for this board upfront so we can validate
 	// that any provided IDs actually belong here before opening a transaction.
-	existRows, err := a.db.QueryContext(r.Context(),
+	existRows, err := a.conn(r.Context()).QueryContext(r.Context(),
 		`SELECT id FROM board_columns WHERE board_id = $1`, boardID)
 	if err != nil {
 		http.Error(w, "query failed", http.StatusInternalServerError)
@@ -333,7 +464,7 @@ func (a *App) putKanbanColumns(w http.ResponseWriter, r *http.Request) {
 		keepIDs[*item.ID] = true
 	}
 
-	tx, err := a.db.BeginTx(r.Context(), nil)
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
 	if err != nil {
 		http.Error(w, "transaction failed", http.StatusInternalServerError)
 		log.Printf("putKanbanColumns begin tx: %v", err)
@@ -341,6 +472,13 @@ func (a *App) putKanbanColumns(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	beforeColumns, err := loadBoardColumns(r.Context(), tx, boardID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("putKanbanColumns snapshot: %v", err)
+		return
+	}
+
 	// Delete columns absent from the request
 	for id := range existingIDs {
 		if keepIDs[id] {
@@ -389,39 +527,59 @@ func (a *App) putKanbanColumns(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Read back the full updated column list so the client gets IDs for new columns
+	columns, err := loadBoardColumns(r.Context(), tx, boardID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("putKanbanColumns fetch result: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "kanban.columns.replace",
+		TargetType: "board",
+		TargetID:   boardID,
+		Before:     columnsAuditSnapshot(beforeColumns),
+		After:      columnsAuditSnapshot(columns),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("putKanbanColumns audit: %v", err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		http.Error(w, "commit failed", http.StatusInternalServerError)
 		log.Printf("putKanbanColumns commit: %v", err)
 		return
 	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.BoardUpdated, map[string]string{"board_id": boardID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(columns)
+}
 
-	// Return the full updated column list so the client gets IDs for new columns
-	colRows, err := a.db.QueryContext(r.Context(), `
+// loadBoardColumns returns a board's columns ordered by position.
+func loadBoardColumns(ctx context.Context, q queryer, boardID string) ([]kanbanColumn, error) {
+	rows, err := q.QueryContext(ctx, `
 		SELECT id, created_at, updated_at, name, position, zendesk_status, color
 		FROM board_columns
 		WHERE board_id = $1
 		ORDER BY position ASC
 	`, boardID)
 	if err != nil {
-		http.Error(w, "query failed", http.StatusInternalServerError)
-		log.Printf("putKanbanColumns fetch result: %v", err)
-		return
+		return nil, err
 	}
-	defer colRows.Close()
+	defer rows.Close()
 
 	columns := []kanbanColumn{}
-	for colRows.Next() {
+	for rows.Next() {
 		var c kanbanColumn
-		if err := colRows.Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt, &c.Name, &c.Position, &c.ZendeskStatus, &c.Color); err != nil {
-			http.Error(w, "scan failed", http.StatusInternalServerError)
-			log.Printf("putKanbanColumns scan result: %v", err)
-			return
+		if err := rows.Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt, &c.Name, &c.Position, &c.ZendeskStatus, &c.Color); err != nil {
+			return nil, err
 		}
 		columns = append(columns, c)
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(columns)
+	return columns, rows.Err()
 }
 
 // requireColumnInBoard checks that the column URL param exists and belongs to the board.
@@ -430,7 +588,7 @@ func (a *App) requireColumnInBoard(w http.ResponseWriter, r *http.Request, board
 	columnID := chi.URLParam(r, "columnID")
 
 	var exists bool
-	err := a.db.QueryRowContext(r.Context(),
+	err := a.conn(r.Context()).QueryRowContext(r.Context(),
 		`SELECT EXISTS(SELECT 1 FROM board_columns WHERE id = $1 AND board_id = $2)`,
 		columnID, boardID,
 	).Scan(&exists)
@@ -483,7 +641,7 @@ func (a *App) putColumnTickets(w http.ResponseWriter, r *http.Request) {
 	o := orgFromContext(r.Context())
 	for _, tid := range ticketIDs {
 		var exists bool
-		err := a.db.QueryRowContext(r.Context(),
+		err := a.conn(r.Context()).QueryRowContext(r.Context(),
 			`SELECT EXISTS(SELECT 1 FROM tickets WHERE id = $1 AND org_id = $2)`,
 			tid, o.ID,
 		).Scan(&exists)
@@ -498,7 +656,7 @@ func (a *App) putColumnTickets(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	tx, err := a.db.BeginTx(r.Context(), nil)
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
 	if err != nil {
 		http.Error(w, "transaction failed", http.StatusInternalServerError)
 		log.Printf("putColumnTickets begin tx: %v", err)
@@ -506,6 +664,26 @@ func (a *App) putColumnTickets(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	beforeIDs := []string{}
+	prevRows, err := tx.QueryContext(r.Context(),
+		`SELECT ticket_id FROM board_tickets WHERE column_id = $1 ORDER BY position ASC`, columnID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("putColumnTickets snapshot: %v", err)
+		return
+	}
+	for prevRows.Next() {
+		var id string
+		if err := prevRows.Scan(&id); err != nil {
+			prevRows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("putColumnTickets snapshot scan: %v", err)
+			return
+		}
+		beforeIDs = append(beforeIDs, id)
+	}
+	prevRows.Close()
+
 	// Remove all tickets currently in this column. Tickets being moved here
 	// from another column are handled per-ticket below.
 	if _, err := tx.ExecContext(r.Context(),
@@ -537,11 +715,28 @@ func (a *App) putColumnTickets(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if ticketIDs == nil {
+		ticketIDs = []string{}
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "kanban.column_tickets.replace",
+		TargetType: "board_column",
+		TargetID:   columnID,
+		Before:     map[string]any{"board_id": boardID, "ticket_ids": beforeIDs},
+		After:      map[string]any{"board_id": boardID, "ticket_ids": ticketIDs},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("putColumnTickets audit: %v", err)
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		http.Error(w, "commit failed", http.StatusInternalServerError)
 		log.Printf("putColumnTickets commit: %v", err)
 		return
 	}
+	a.bus.Publish(r.Context(), o.ID, events.BoardTicketsChanged,
+		map[string]string{"board_id": boardID, "column_id": columnID})
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ticketIDs)
@@ -574,7 +769,7 @@ func (a *App) listKanbanTickets(w http.ResponseWriter, r *http.Request) {
 
 	// Verify the board exists and belongs to this org (readable regardless of is_default)
 	var exists bool
-	err := a.db.QueryRowContext(r.Context(),
+	err := a.conn(r.Context()).QueryRowContext(r.Context(),
 		`SELECT EXISTS(SELECT 1 FROM boards WHERE id = $1 AND org_id = $2)`,
 		boardID, o.ID,
 	).Scan(&exists)
@@ -588,14 +783,14 @@ func (a *App) listKanbanTickets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := a.db.QueryContext(r.Context(), `
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
 		SELECT kbt.column_id, kbt.position, t.id, t.title, t.zendesk_status, c.name, t.created_at
 		FROM board_tickets kbt
 		JOIN tickets t ON t.id = kbt.ticket_id
 		JOIN customers c ON c.id = t.reporter_id
-		WHERE kbt.board_id = $1
+		WHERE kbt.board_id = $1 AND t.org_id = $2
 		ORDER BY kbt.column_id, kbt.position ASC
-	`, boardID)
+	`, boardID, o.ID)
 	if err != nil {
 		http.Error(w, "query failed", http.StatusInternalServerError)
 		log.Printf("listKanbanTickets query: %v", err)
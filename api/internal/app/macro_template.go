@@ -0,0 +1,89 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Macro bodies are plain text with {{variable}} placeholders, e.g.
+//
+//	Hi {{customer.first_name}}, ticket #{{ticket.id}} is now with {{agent.name}}.
+//
+// Variables:
+//
+//	customer.name, customer.first_name, customer.email
+//	ticket.id (the Zendesk ticket number, or the Purl ID if unlinked), ticket.title, ticket.status
+//	agent.name, agent.first_name, agent.email (the agent applying the macro)
+//	ticket.custom_fields.<field ID>
+//
+// Unknown variables are rejected when the macro is saved; known ones with no
+// value render as empty.
+var reTemplateVar = regexp.MustCompile(`\{\{\s*([a-z0-9_.]+)\s*\}\}`)
+
+// templateVars are the variables a macro body may use besides custom fields.
+var templateVars = map[string]bool{
+	"customer.name": true, "customer.first_name": true, "customer.email": true,
+	"ticket.id": true, "ticket.title": true, "ticket.status": true,
+	"agent.name": true, "agent.first_name": true, "agent.email": true,
+}
+
+const customFieldVarPrefix = "ticket.custom_fields."
+
+// validateTemplate reports the first unknown variable in tmpl, if any.
+func validateTemplate(tmpl string) error {
+	for _, m := range reTemplateVar.FindAllStringSubmatch(tmpl, -1) {
+		name := m[1]
+		if templateVars[name] {
+			continue
+		}
+		if id, ok := strings.CutPrefix(name, customFieldVarPrefix); ok {
+			if _, err := strconv.ParseInt(id, 10, 64); err == nil {
+				continue
+			}
+		}
+		return fmt.Errorf("unknown variable {{%s}}", name)
+	}
+	return nil
+}
+
+// renderTemplate replaces tmpl's variables with their values in vars, and
+// custom field variables with the matching entry of customFields.
+func renderTemplate(tmpl string, vars map[string]string, customFields map[string]any) string {
+	return reTemplateVar.ReplaceAllStringFunc(tmpl, func(s string) string {
+		name := reTemplateVar.FindStringSubmatch(s)[1]
+		if id, ok := strings.CutPrefix(name, customFieldVarPrefix); ok {
+			return customFieldText(customFields[id])
+		}
+		return vars[name]
+	})
+}
+
+// customFieldText formats a Zendesk custom field value for a reply.
+func customFieldText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		parts := make([]string, len(v))
+		for i, p := range v {
+			parts[i] = customFieldText(p)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// firstName returns the first word of a display name.
+func firstName(name string) string {
+	if f := strings.Fields(name); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
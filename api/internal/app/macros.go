@@ -0,0 +1,769 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// macro is a canned reply and/or set of ticket changes applied in one step.
+type macro struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	// Body is the reply template; see macro_template.go for its variables.
+	// Empty for macros that only change the ticket.
+	Body string `json:"body"`
+	// Public is whether the reply is public (true) or an internal note.
+	Public  bool         `json:"public"`
+	Actions macroActions `json:"actions"`
+	// Position orders macros in the picker, ascending.
+	Position int `json:"position"`
+}
+
+// macroActions are the ticket changes a macro makes besides replying.
+type macroActions struct {
+	// Status is open, pending, solved or closed.
+	Status  string   `json:"status,omitempty"`
+	AddTags []string `json:"add_tags,omitempty"`
+	// AssigneeID is an agent ID, or "me" for the agent applying the macro.
+	AssigneeID string `json:"assignee_id,omitempty"`
+}
+
+type createMacroRequest struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+	// Public defaults to true.
+	Public   *bool        `json:"public"`
+	Actions  macroActions `json:"actions"`
+	Position int          `json:"position"`
+}
+
+// updateMacroRequest replaces only the fields that are present.
+type updateMacroRequest struct {
+	Name     *string       `json:"name"`
+	Body     *string       `json:"body"`
+	Public   *bool         `json:"public"`
+	Actions  *macroActions `json:"actions"`
+	Position *int          `json:"position"`
+}
+
+// macroPreview is a macro rendered against a ticket.
+type macroPreview struct {
+	Body   string `json:"body"`
+	Public bool   `json:"public"`
+	// Actions has "me" resolved to the calling agent's ID.
+	Actions macroActions `json:"actions"`
+}
+
+type macroApplyResponse struct {
+	Ticket ticketRow `json:"ticket"`
+	// Comment is the posted reply; null for macros without a body.
+	Comment *ticketCommentRow `json:"comment"`
+}
+
+const macroColumns = `id, created_at, updated_at, name, body, public, actions, position`
+
+func scanMacro(row rowScanner) (macro, error) {
+	var m macro
+	var actions []byte
+	if err := row.Scan(&m.ID, &m.CreatedAt, &m.UpdatedAt, &m.Name, &m.Body, &m.Public, &actions, &m.Position); err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(actions, &m.Actions)
+}
+
+// auditSnapshot returns the audited view of a macro.
+func (m macro) auditSnapshot() map[string]any {
+	return map[string]any{"name": m.Name, "body": m.Body, "public": m.Public, "actions": m.Actions, "position": m.Position}
+}
+
+// validateMacro checks and normalizes m, returning a client-facing message if
+// it is invalid.
+func validateMacro(ctx context.Context, q queryer, m *macro) string {
+	if strings.TrimSpace(m.Name) == "" {
+		return "name is required"
+	}
+	if m.Position < 0 {
+		return "position must not be negative"
+	}
+	if err := validateTemplate(m.Body); err != nil {
+		return "body: " + err.Error()
+	}
+	act := &m.Actions
+	if strings.TrimSpace(m.Body) == "" && act.Status == "" && len(act.AddTags) == 0 && act.AssigneeID == "" {
+		return "a macro needs a body or at least one action"
+	}
+	if act.Status != "" && !slices.Contains([]string{"open", "pending", "solved", "closed"}, act.Status) {
+		return "actions.status must be open, pending, solved or closed"
+	}
+	if len(act.AddTags) > 0 {
+		tags, err := normalizeTags(act.AddTags)
+		if err != nil {
+			return "actions.add_tags: " + err.Error()
+		}
+		act.AddTags = tags
+	}
+	if act.AssigneeID != "" && act.AssigneeID != "me" {
+		if !reUUID.MatchString(act.AssigneeID) {
+			return "actions.assignee_id: agent not found"
+		}
+		var exists bool
+		if err := q.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM agents WHERE id = $1)`, act.AssigneeID,
+		).Scan(&exists); err != nil {
+			log.Printf("validateMacro assignee: %v", err)
+			return "assignee lookup failed"
+		}
+		if !exists {
+			return "actions.assignee_id: agent not found"
+		}
+	}
+	return ""
+}
+
+// loadMacro loads the macroID URL param. Writes a 404 (or 500) and returns
+// false if it doesn't exist.
+func loadMacro(w http.ResponseWriter, r *http.Request, q queryer, forUpdate bool) (macro, bool) {
+	macroID := chi.URLParam(r, "macroID")
+	if !reUUID.MatchString(macroID) {
+		http.Error(w, "macro not found", http.StatusNotFound)
+		return macro{}, false
+	}
+	query := `SELECT ` + macroColumns + ` FROM macros WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	m, err := scanMacro(q.QueryRowContext(r.Context(), query, macroID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "macro not found", http.StatusNotFound)
+		return m, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadMacro: %v", err)
+		return m, false
+	}
+	return m, true
+}
+
+// renderMacro renders m against the ticket for the calling agent, if any,
+// resolving assignee "me".
+func renderMacro(ctx context.Context, q queryer, m macro, ticketID string) (macroPreview, error) {
+	var purlID, title, status, customerName string
+	var zendeskTicketID *int64
+	var customerEmail *string
+	var customFields []byte
+	err := q.QueryRowContext(ctx, `
+		SELECT t.id, t.zendesk_ticket_id, t.title, COALESCE(t.zendesk_status::text, ''),
+		       c.name, (SELECT ce.email FROM customer_emails ce WHERE ce.customer_id = c.id LIMIT 1),
+		       t.custom_fields
+		FROM tickets t
+		JOIN customers c ON c.id = t.reporter_id
+		WHERE t.id = $1`,
+		ticketID,
+	).Scan(&purlID, &zendeskTicketID, &title, &status, &customerName, &customerEmail, &customFields)
+	if err != nil {
+		return macroPreview{}, fmt.Errorf("load ticket: %w", err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(customFields, &fields); err != nil {
+		return macroPreview{}, fmt.Errorf("parse custom fields: %w", err)
+	}
+
+	vars := map[string]string{
+		"customer.name":       customerName,
+		"customer.first_name": firstName(customerName),
+		"ticket.id":           purlID,
+		"ticket.title":        title,
+		"ticket.status":       status,
+	}
+	if customerEmail != nil {
+		vars["customer.email"] = *customerEmail
+	}
+	if zendeskTicketID != nil {
+		vars["ticket.id"] = strconv.FormatInt(*zendeskTicketID, 10)
+	}
+	ag, hasAgent := agentFromContext(ctx)
+	if hasAgent {
+		vars["agent.name"] = ag.Name
+		vars["agent.first_name"] = firstName(ag.Name)
+		vars["agent.email"] = ag.Email
+	}
+
+	p := macroPreview{Body: renderTemplate(m.Body, vars, fields), Public: m.Public, Actions: m.Actions}
+	if p.Actions.AssigneeID == "me" {
+		if !hasAgent {
+			return p, errFilterNeedsAgent
+		}
+		p.Actions.AssigneeID = ag.ID
+	}
+	return p, nil
+}
+
+// @Summary     List macros
+// @Tags        Macros
+// @Description Returns the org's macros in picker order
+// @Produce     json
+// @Success     200  {array}   macro
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /macros [get]
+func (a *App) listMacros(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT `+macroColumns+`
+		FROM macros
+		ORDER BY position, name, id`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listMacros query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	macros := []macro{}
+	for rows.Next() {
+		m, err := scanMacro(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listMacros scan: %v", err)
+			return
+		}
+		macros = append(macros, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(macros)
+}
+
+// @Summary     Create a macro
+// @Tags        Macros
+// @Description Creates a macro: a reply template and/or ticket actions. Template variables are
+// @Description {{customer.name}}, {{customer.first_name}}, {{customer.email}}, {{ticket.id}}, {{ticket.title}},
+// @Description {{ticket.status}}, {{agent.name}}, {{agent.first_name}}, {{agent.email}} and
+// @Description {{ticket.custom_fields.<field ID>}}.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createMacroRequest  true  "Macro to create"
+// @Success     201   {object}  macro
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /macros [post]
+func (a *App) createMacro(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createMacroRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	m := macro{Name: req.Name, Body: req.Body, Public: req.Public == nil || *req.Public, Actions: req.Actions, Position: req.Position}
+	conn := a.conn(r.Context())
+	if msg := validateMacro(r.Context(), conn, &m); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	actions, _ := json.Marshal(m.Actions)
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createMacro begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	m, err = scanMacro(tx.QueryRowContext(r.Context(), `
+		INSERT INTO macros (org_id, name, body, public, actions, position)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+macroColumns,
+		o.ID, m.Name, m.Body, m.Public, actions, m.Position))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createMacro insert: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "macro.create",
+		TargetType: "macro",
+		TargetID:   m.ID,
+		After:      m.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createMacro audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createMacro commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.MacroUpdated, map[string]string{"macro_id": m.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+// @Summary     Get a macro
+// @Tags        Macros
+// @Produce     json
+// @Param       macroID  path      string  true  "Macro ID"
+// @Success     200      {object}  macro
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /macros/{macroID} [get]
+func (a *App) getMacro(w http.ResponseWriter, r *http.Request) {
+	m, ok := loadMacro(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// @Summary     Update a macro
+// @Tags        Macros
+// @Description Updates the fields present in the body. actions, if present, replaces all actions.
+// @Accept      json
+// @Produce     json
+// @Param       macroID  path      string              true  "Macro ID"
+// @Param       body     body      updateMacroRequest  true  "Fields to update"
+// @Success     200      {object}  macro
+// @Failure     400      {string}  string  "Bad Request"
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /macros/{macroID} [patch]
+func (a *App) updateMacro(w http.ResponseWriter, r *http.Request) {
+	var req updateMacroRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateMacro begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := loadMacro(w, r, tx, true)
+	if !ok {
+		return
+	}
+	next := old
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Body != nil {
+		next.Body = *req.Body
+	}
+	if req.Public != nil {
+		next.Public = *req.Public
+	}
+	if req.Actions != nil {
+		next.Actions = *req.Actions
+	}
+	if req.Position != nil {
+		next.Position = *req.Position
+	}
+	if msg := validateMacro(r.Context(), tx, &next); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	actions, _ := json.Marshal(next.Actions)
+
+	m, err := scanMacro(tx.QueryRowContext(r.Context(), `
+		UPDATE macros
+		SET name = $2, body = $3, public = $4, actions = $5, position = $6
+		WHERE id = $1
+		RETURNING `+macroColumns,
+		old.ID, next.Name, next.Body, next.Public, actions, next.Position))
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateMacro update: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "macro.update",
+		TargetType: "macro",
+		TargetID:   m.ID,
+		Before:     old.auditSnapshot(),
+		After:      m.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateMacro audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateMacro commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.MacroUpdated, map[string]string{"macro_id": m.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// @Summary     Delete a macro
+// @Tags        Macros
+// @Param       macroID  path      string  true  "Macro ID"
+// @Success     204
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /macros/{macroID} [delete]
+func (a *App) deleteMacro(w http.ResponseWriter, r *http.Request) {
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteMacro begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	m, ok := loadMacro(w, r, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM macros WHERE id = $1`, m.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteMacro delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "macro.delete",
+		TargetType: "macro",
+		TargetID:   m.ID,
+		Before:     m.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteMacro audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteMacro commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.MacroUpdated, map[string]string{"macro_id": m.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary     Preview a macro
+// @Tags        Macros
+// @Description Renders the macro against the ticket for the calling agent (x-agent-id) without changing anything.
+// @Description Agent variables render empty without x-agent-id.
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Param       macroID   path      string  true  "Macro ID"
+// @Success     200  {object}  macroPreview
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/macros/{macroID}/preview [get]
+func (a *App) previewMacro(w http.ResponseWriter, r *http.Request) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	conn := a.conn(r.Context())
+	m, ok := loadMacro(w, r, conn, false)
+	if !ok {
+		return
+	}
+	p, err := renderMacro(r.Context(), conn, m, ticketID)
+	if errors.Is(err, errFilterNeedsAgent) {
+		http.Error(w, `assignee "me" requires the x-agent-id header`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("previewMacro: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Apply a macro
+// @Tags        Macros
+// @Description Renders the macro against the ticket and, in one Zendesk update made as the calling agent
+// @Description (x-agent-id), posts the reply and performs the actions. The result is stored in Purl right away.
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Param       macroID   path      string  true  "Macro ID"
+// @Success     200  {object}  macroApplyResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Failure     422  {string}  string  "Unprocessable Entity"
+// @Failure     502  {string}  string  "Bad Gateway"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/macros/{macroID}/apply [post]
+func (a *App) applyMacro(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	m, ok := loadMacro(w, r, conn, false)
+	if !ok {
+		return
+	}
+	p, err := renderMacro(r.Context(), conn, m, ticketID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro render: %v", err)
+		return
+	}
+
+	var zendeskTicketID, agentZendeskID *int64
+	err = conn.QueryRowContext(r.Context(), `
+		SELECT t.zendesk_ticket_id, ag.zendesk_user_id
+		FROM tickets t, agents ag
+		WHERE t.id = $1 AND ag.id = $2`,
+		ticketID, ag.ID,
+	).Scan(&zendeskTicketID, &agentZendeskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro lookup: %v", err)
+		return
+	}
+	if zendeskTicketID == nil {
+		http.Error(w, "ticket is not linked to Zendesk", http.StatusUnprocessableEntity)
+		return
+	}
+	if agentZendeskID == nil || *agentZendeskID <= 0 {
+		http.Error(w, "agent has no Zendesk user", http.StatusUnprocessableEntity)
+		return
+	}
+
+	update := map[string]any{}
+	if strings.TrimSpace(p.Body) != "" {
+		update["comment"] = map[string]any{"body": p.Body, "public": p.Public, "author_id": *agentZendeskID}
+	}
+	if p.Actions.Status != "" {
+		update["status"] = p.Actions.Status
+	}
+	if len(p.Actions.AddTags) > 0 {
+		update["additional_tags"] = p.Actions.AddTags
+	}
+	if p.Actions.AssigneeID != "" {
+		var assigneeZendeskID *int64
+		err := conn.QueryRowContext(r.Context(),
+			`SELECT zendesk_user_id FROM agents WHERE id = $1`, p.Actions.AssigneeID,
+		).Scan(&assigneeZendeskID)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("applyMacro assignee: %v", err)
+			return
+		}
+		if assigneeZendeskID == nil || *assigneeZendeskID <= 0 {
+			http.Error(w, "assignee has no Zendesk user", http.StatusUnprocessableEntity)
+			return
+		}
+		update["assignee_id"] = *assigneeZendeskID
+	}
+
+	resp, err := zendeskTicketUpdate(r.Context(), conn, o.ID, *zendeskTicketID, update, a.zendeskLimiter)
+	if errors.Is(err, errZendeskNotConfigured) {
+		http.Error(w, "zendesk not configured", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "zendesk update failed", http.StatusBadGateway)
+		log.Printf("applyMacro zendesk: %v", err)
+		return
+	}
+
+	// Store the result now rather than waiting for the webhooks, which will
+	// find it already applied.
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "begin tx failed", http.StatusInternalServerError)
+		log.Printf("applyMacro begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var oldStatus string
+	var oldAssignee *string
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT COALESCE(zendesk_status::text, ''), assignee_id FROM tickets WHERE id = $1 FOR UPDATE`, ticketID,
+	).Scan(&oldStatus, &oldAssignee); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro lock: %v", err)
+		return
+	}
+	oldTags, err := ticketTags(r.Context(), tx, ticketID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro tags: %v", err)
+		return
+	}
+	before := map[string]any{"status": oldStatus, "assignee_id": oldAssignee, "tags": oldTags}
+	after := map[string]any{"macro_id": m.ID}
+
+	var comment *ticketCommentRow
+	if zc := resp.comment(); zc != nil {
+		if _, _, err := insertCommentForTicket(r.Context(), tx, tx, o.ID, ticketID, zc, a.zendeskLimiter); err != nil {
+			http.Error(w, "store comment failed", http.StatusInternalServerError)
+			log.Printf("applyMacro insert comment: %v", err)
+			return
+		}
+		c, err := scanTicketComment(tx.QueryRowContext(r.Context(), ticketCommentSelect+`
+			WHERE tc.ticket_id = $1 AND tc.zendesk_comment_id = $2
+			ORDER BY tc.zendesk_sub_index
+			LIMIT 1
+		`, ticketID, zc.ID))
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("applyMacro read back comment: %v", err)
+			return
+		}
+		comment = &c
+		after["comment_id"] = c.ID
+	}
+
+	var boardID string
+	var sent []sentNotification
+	statusChanged := false
+	if s := p.Actions.Status; s != "" {
+		if _, err := tx.ExecContext(r.Context(), `
+			UPDATE tickets SET
+				zendesk_status = $1::zendesk_status_category,
+				resolved_at    = CASE
+					WHEN $1::zendesk_status_category IN ('solved', 'closed') THEN COALESCE(resolved_at, now())
+					ELSE NULL
+				END
+			WHERE id = $2`,
+			s, ticketID,
+		); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("applyMacro status: %v", err)
+			return
+		}
+		if s != oldStatus {
+			statusChanged = true
+			if boardID, err = syncTicketToDefaultKanban(r.Context(), tx, o.ID, ticketID, s); err != nil {
+				http.Error(w, "update failed", http.StatusInternalServerError)
+				log.Printf("applyMacro sync kanban: %v", err)
+				return
+			}
+			if sent, err = notifyFollowersOfStatus(r.Context(), tx, o.ID, ticketID, oldStatus, s, &ag.ID); err != nil {
+				http.Error(w, "update failed", http.StatusInternalServerError)
+				log.Printf("applyMacro notify: %v", err)
+				return
+			}
+		}
+		after["status"] = s
+	}
+	if id := p.Actions.AssigneeID; id != "" {
+		if _, err := tx.ExecContext(r.Context(),
+			`UPDATE tickets SET assignee_id = $1 WHERE id = $2`, id, ticketID,
+		); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("applyMacro assign: %v", err)
+			return
+		}
+		after["assignee_id"] = id
+	}
+	if len(p.Actions.AddTags) > 0 {
+		if resp.Ticket.Tags != nil {
+			err = setTicketTags(r.Context(), tx, o.ID, ticketID, resp.Ticket.Tags)
+		} else {
+			err = addTicketTags(r.Context(), tx, o.ID, ticketID, p.Actions.AddTags)
+		}
+		if err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("applyMacro tags: %v", err)
+			return
+		}
+		newTags, err := ticketTags(r.Context(), tx, ticketID)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("applyMacro tags after: %v", err)
+			return
+		}
+		after["tags"] = newTags
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.macro.apply",
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		Before:     before,
+		After:      after,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("applyMacro audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("applyMacro commit: %v", err)
+		return
+	}
+	if comment != nil {
+		a.bus.Publish(r.Context(), o.ID, events.CommentCreated, map[string]string{"ticket_id": ticketID})
+	}
+	publishTicketChange(r.Context(), a.bus, o.ID, ticketID, boardID)
+	publishNotifications(r.Context(), a.bus, o.ID, sent)
+	// The webhooks will find the changes already stored, so their effect on
+	// the ticket's SLA, and the automations they trigger, are applied here.
+	logSLA(refreshTicketSLA(r.Context(), conn, o.ID, ticketID, a.bus), ticketID)
+	if comment != nil {
+		logAutomations(runAutomations(r.Context(), conn, o.ID, ticketID,
+			automationEvent{Trigger: triggerCommentAdded, CommentChannel: comment.Channel}, a.zendeskLimiter, a.bus), ticketID)
+	}
+	if statusChanged {
+		logAutomations(runAutomations(r.Context(), conn, o.ID, ticketID,
+			automationEvent{Trigger: triggerStatusChanged}, a.zendeskLimiter, a.bus), ticketID)
+	}
+
+	t, err := scanTicket(conn.QueryRowContext(r.Context(), ticketSelect+` WHERE t.id = $1`, ticketID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro read back: %v", err)
+		return
+	}
+	tickets := []ticketRow{t}
+	if err := setWaitingTimes(r.Context(), conn, o.ID, tickets); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("applyMacro waiting times: %v", err)
+		return
+	}
+	t = tickets[0]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(macroApplyResponse{Ticket: t, Comment: comment})
+}
@@ -4,14 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"net"
 	"net/http"
+	"regexp"
 )
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, x-api-key, x-agent-id")
+		w.Header().Set("Access-Control-Expose-Headers", rateLimitHeaders)
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -22,19 +25,75 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 type contextKey string
 
-const orgContextKey contextKey = "org"
+const (
+	orgContextKey     contextKey = "org"
+	agentContextKey   contextKey = "agent"
+	requestContextKey contextKey = "request"
+)
 
 type org struct {
-	ID                string
-	Name              string
-	APIKey            string
-	ZendeskSubdomain  string
+	ID               string
+	Name             string
+	APIKey           string
+	ZendeskSubdomain string
 }
 
 func orgFromContext(ctx context.Context) org {
 	return ctx.Value(orgContextKey).(org)
 }
 
+// agent is the staff member acting on behalf of the org, identified by the
+// optional x-agent-id header. The org API key authenticates the request; the
+// agent header only attributes it.
+type agent struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// agentFromContext returns the acting agent, or false if the request did not
+// identify one.
+func agentFromContext(ctx context.Context) (agent, bool) {
+	ag, ok := ctx.Value(agentContextKey).(agent)
+	return ag, ok
+}
+
+// requestInfo captures caller metadata recorded alongside audit events.
+type requestInfo struct {
+	IP        string
+	UserAgent string
+}
+
+func requestInfoFromContext(ctx context.Context) requestInfo {
+	info, _ := ctx.Value(requestContextKey).(requestInfo)
+	return info
+}
+
+var reUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// clientIP prefers X-Real-IP, which the production nginx sets from the TCP peer,
+// and falls back to the connection's remote address.
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// orgByAPIKey looks up the org owning key. Returns sql.ErrNoRows if none does.
+// It runs on the privileged pool connection since the org isn't known yet.
+func (a *App) orgByAPIKey(ctx context.Context, key string) (org, error) {
+	var o org
+	err := a.db.QueryRowContext(ctx, `
+		SELECT id, name, api_key, COALESCE(zendesk_subdomain, '') FROM organizations WHERE api_key = $1
+	`, key).Scan(&o.ID, &o.Name, &o.APIKey, &o.ZendeskSubdomain)
+	return o, err
+}
+
 func (a *App) requireAPIKey(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		key := r.Header.Get("x-api-key")
@@ -43,10 +102,7 @@ func (a *App) requireAPIKey(next http.Handler) http.Handler {
 			return
 		}
 
-		var o org
-		err := a.db.QueryRowContext(r.Context(), `
-			SELECT id, name, api_key, COALESCE(zendesk_subdomain, '') FROM organizations WHERE api_key = $1
-		`, key).Scan(&o.ID, &o.Name, &o.APIKey, &o.ZendeskSubdomain)
+		o, err := a.orgByAPIKey(r.Context(), key)
 		if err == sql.ErrNoRows {
 			http.Error(w, "invalid api key", http.StatusUnauthorized)
 			return
@@ -58,6 +114,30 @@ func (a *App) requireAPIKey(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), orgContextKey, o)
+		ctx = context.WithValue(ctx, requestContextKey, requestInfo{IP: clientIP(r), UserAgent: r.UserAgent()})
+
+		if agentID := r.Header.Get("x-agent-id"); agentID != "" {
+			if !reUUID.MatchString(agentID) {
+				http.Error(w, "invalid x-agent-id header", http.StatusUnauthorized)
+				return
+			}
+			var ag agent
+			err := a.db.QueryRowContext(r.Context(),
+				`SELECT id, name, email FROM agents WHERE id = $1 AND org_id = $2`,
+				agentID, o.ID,
+			).Scan(&ag.ID, &ag.Name, &ag.Email)
+			if err == sql.ErrNoRows {
+				http.Error(w, "unknown agent", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				log.Printf("requireAPIKey agent query: %v", err)
+				return
+			}
+			ctx = context.WithValue(ctx, agentContextKey, ag)
+		}
+
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,566 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// ticketNote is an agent's working note on a ticket. Notes live only in Purl:
+// they are never sent to Zendesk, so customers can't see them.
+type ticketNote struct {
+	ID        string    `json:"id"`
+	TicketID  string    `json:"ticket_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// AuthorAgentID is null if the author has since been removed, or if the
+	// note was posted by an automation rule.
+	AuthorAgentID *string `json:"author_agent_id"`
+	AuthorName    *string `json:"author_name"`
+	// AutomationRuleID is set on notes posted by an automation rule's add_note
+	// action, while the rule exists.
+	AutomationRuleID *string `json:"automation_rule_id"`
+	Body             string  `json:"body"`
+	// Version counts edits, starting at 1.
+	Version  int           `json:"version"`
+	Mentions []noteMention `json:"mentions"`
+}
+
+// noteMention is an agent @mentioned in a note.
+type noteMention struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ticketNoteVersion is one entry of a note's edit history.
+type ticketNoteVersion struct {
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	EditorAgentID *string   `json:"editor_agent_id"`
+	EditorName    *string   `json:"editor_name"`
+	Body          string    `json:"body"`
+}
+
+type createNoteRequest struct {
+	Body string `json:"body"`
+	// Mentions are the IDs of agents @mentioned in the body.
+	Mentions []string `json:"mentions"`
+}
+
+// updateNoteRequest replaces the note's body and, if present, its mentions.
+type updateNoteRequest struct {
+	Body     string   `json:"body"`
+	Mentions []string `json:"mentions"`
+	// Version, if set, must match the note's current version, so an edit made
+	// against a stale copy is rejected instead of overwriting someone else's.
+	Version *int `json:"version"`
+}
+
+const ticketNoteSelect = `
+	SELECT n.id, n.ticket_id, n.created_at, n.updated_at, n.author_agent_id, a.name, n.automation_rule_id,
+	       n.body, n.version,
+	       COALESCE((SELECT json_agg(json_build_object('id', ma.id, 'name', ma.name) ORDER BY ma.name)
+	                 FROM ticket_note_mentions m
+	                 JOIN agents ma ON ma.id = m.agent_id
+	                 WHERE m.note_id = n.id), '[]')
+	FROM ticket_notes n
+	LEFT JOIN agents a ON a.id = n.author_agent_id`
+
+func scanTicketNote(row rowScanner) (ticketNote, error) {
+	var n ticketNote
+	var mentions []byte
+	if err := row.Scan(&n.ID, &n.TicketID, &n.CreatedAt, &n.UpdatedAt, &n.AuthorAgentID, &n.AuthorName, &n.AutomationRuleID, &n.Body, &n.Version, &mentions); err != nil {
+		return n, err
+	}
+	return n, json.Unmarshal(mentions, &n.Mentions)
+}
+
+// auditSnapshot returns the audited view of a note.
+func (n ticketNote) auditSnapshot() map[string]any {
+	ids := make([]string, len(n.Mentions))
+	for i, m := range n.Mentions {
+		ids[i] = m.ID
+	}
+	return map[string]any{"body": n.Body, "version": n.Version, "mentions": ids}
+}
+
+// validateMentions de-duplicates agent IDs and checks each is an agent in the
+// org, returning an error suitable for a 400 if not.
+func validateMentions(ctx context.Context, q queryer, ids []string) ([]string, error) {
+	out := make([]string, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !reUUID.MatchString(id) {
+			return nil, fmt.Errorf("mentions: invalid agent ID %q", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+	var n int
+	if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM agents WHERE id = ANY($1)`, out).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n != len(out) {
+		return nil, fmt.Errorf("mentions: unknown agent")
+	}
+	return out, nil
+}
+
+// setNoteMentions replaces the note's mentions with agentIDs.
+func setNoteMentions(ctx context.Context, ex execer, noteID string, agentIDs []string) error {
+	if _, err := ex.ExecContext(ctx,
+		`DELETE FROM ticket_note_mentions WHERE note_id = $1 AND NOT (agent_id = ANY($2))`,
+		noteID, agentIDs,
+	); err != nil {
+		return fmt.Errorf("delete mentions: %w", err)
+	}
+	if _, err := ex.ExecContext(ctx, `
+		INSERT INTO ticket_note_mentions (note_id, agent_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT DO NOTHING`,
+		noteID, agentIDs,
+	); err != nil {
+		return fmt.Errorf("insert mentions: %w", err)
+	}
+	return nil
+}
+
+// loadTicketNote loads the noteID URL param if it belongs to ticketID. Writes
+// a 404 (or 500) and returns false otherwise.
+func loadTicketNote(w http.ResponseWriter, r *http.Request, q queryer, ticketID string, forUpdate bool) (ticketNote, bool) {
+	noteID := chi.URLParam(r, "noteID")
+	if !reUUID.MatchString(noteID) {
+		http.Error(w, "note not found", http.StatusNotFound)
+		return ticketNote{}, false
+	}
+	query := ticketNoteSelect + ` WHERE n.id = $1 AND n.ticket_id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE OF n`
+	}
+	n, err := scanTicketNote(q.QueryRowContext(r.Context(), query, noteID, ticketID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "note not found", http.StatusNotFound)
+		return n, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadTicketNote: %v", err)
+		return n, false
+	}
+	return n, true
+}
+
+// @Summary     List ticket notes
+// @Tags        Notes
+// @Description Returns the ticket's Purl notes, oldest first. Notes are never synced to Zendesk.
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {array}   ticketNote
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/notes [get]
+func (a *App) listTicketNotes(w http.ResponseWriter, r *http.Request) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), ticketNoteSelect+`
+		WHERE n.ticket_id = $1
+		ORDER BY n.created_at, n.id`, ticketID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTicketNotes query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	notes := []ticketNote{}
+	for rows.Next() {
+		n, err := scanTicketNote(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listTicketNotes scan: %v", err)
+			return
+		}
+		notes = append(notes, n)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTicketNotes rows: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+// @Summary     Add a ticket note
+// @Tags        Notes
+// @Description Adds a note to the ticket as the calling agent (x-agent-id). mentions lists the agents @mentioned in the body.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string             true  "Ticket ID"
+// @Param       body      body      createNoteRequest  true  "Note"
+// @Success     201  {object}  ticketNote
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/notes [post]
+func (a *App) createTicketNote(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	var req createNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	mentions, err := validateMentions(r.Context(), conn, req.Mentions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var noteID string
+	if err := tx.QueryRowContext(r.Context(), `
+		INSERT INTO ticket_notes (ticket_id, author_agent_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		ticketID, ag.ID, req.Body,
+	).Scan(&noteID); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote insert: %v", err)
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO ticket_note_versions (note_id, version, editor_agent_id, body)
+		VALUES ($1, 1, $2, $3)`,
+		noteID, ag.ID, req.Body,
+	); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote version: %v", err)
+		return
+	}
+	if err := setNoteMentions(r.Context(), tx, noteID, mentions); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote mentions: %v", err)
+		return
+	}
+	n, err := scanTicketNote(tx.QueryRowContext(r.Context(), ticketNoteSelect+` WHERE n.id = $1`, noteID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote read back: %v", err)
+		return
+	}
+
+	sent, err := notify(r.Context(), tx, o.ID, notifyMention, ticketID, &n.ID, &ag.ID, nil, mentions)
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote notify: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.note.create",
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		After:      n.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createTicketNote commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.NoteChanged, map[string]string{"ticket_id": ticketID, "note_id": n.ID})
+	publishNotifications(r.Context(), a.bus, o.ID, sent)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(n)
+}
+
+// @Summary     Edit a ticket note
+// @Tags        Notes
+// @Description Replaces the note's body as the calling agent (x-agent-id), keeping the previous text in its history.
+// @Description mentions, if present, replaces the mentioned agents. If version is given and the note has been
+// @Description edited since, returns 409 with the current note.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string             true  "Ticket ID"
+// @Param       noteID    path      string             true  "Note ID"
+// @Param       body      body      updateNoteRequest  true  "New text"
+// @Success     200  {object}  ticketNote
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Failure     409  {object}  ticketNote
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/notes/{noteID} [patch]
+func (a *App) updateTicketNote(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	var req updateNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	var mentions []string
+	if req.Mentions != nil {
+		var err error
+		if mentions, err = validateMentions(r.Context(), conn, req.Mentions); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateTicketNote begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := loadTicketNote(w, r, tx, ticketID, true)
+	if !ok {
+		return
+	}
+	if req.Version != nil && *req.Version != old.Version {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(old)
+		return
+	}
+
+	if req.Body != old.Body {
+		if _, err := tx.ExecContext(r.Context(),
+			`UPDATE ticket_notes SET body = $2, version = version + 1 WHERE id = $1`,
+			old.ID, req.Body,
+		); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("updateTicketNote update: %v", err)
+			return
+		}
+		if _, err := tx.ExecContext(r.Context(), `
+			INSERT INTO ticket_note_versions (note_id, version, editor_agent_id, body)
+			VALUES ($1, $2, $3, $4)`,
+			old.ID, old.Version+1, ag.ID, req.Body,
+		); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("updateTicketNote version: %v", err)
+			return
+		}
+	}
+	var sent []sentNotification
+	if req.Mentions != nil {
+		if err := setNoteMentions(r.Context(), tx, old.ID, mentions); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("updateTicketNote mentions: %v", err)
+			return
+		}
+		// Only agents newly mentioned by this edit are notified.
+		var added []string
+		for _, id := range mentions {
+			if !slices.ContainsFunc(old.Mentions, func(m noteMention) bool { return m.ID == id }) {
+				added = append(added, id)
+			}
+		}
+		if sent, err = notify(r.Context(), tx, o.ID, notifyMention, ticketID, &old.ID, &ag.ID, nil, added); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			log.Printf("updateTicketNote notify: %v", err)
+			return
+		}
+	}
+	n, err := scanTicketNote(tx.QueryRowContext(r.Context(), ticketNoteSelect+` WHERE n.id = $1`, old.ID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("updateTicketNote read back: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.note.update",
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		Before:     old.auditSnapshot(),
+		After:      n.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateTicketNote audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateTicketNote commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.NoteChanged, map[string]string{"ticket_id": ticketID, "note_id": n.ID})
+	publishNotifications(r.Context(), a.bus, o.ID, sent)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
+
+// @Summary     Delete a ticket note
+// @Tags        Notes
+// @Description Deletes the note and its history. The audit log keeps its last text.
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Param       noteID    path      string  true  "Note ID"
+// @Success     204
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/notes/{noteID} [delete]
+func (a *App) deleteTicketNote(w http.ResponseWriter, r *http.Request) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteTicketNote begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	n, ok := loadTicketNote(w, r, tx, ticketID, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM ticket_notes WHERE id = $1`, n.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteTicketNote delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.note.delete",
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		Before:     n.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteTicketNote audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteTicketNote commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.NoteChanged, map[string]string{"ticket_id": ticketID, "note_id": n.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary     List a note's edit history
+// @Tags        Notes
+// @Description Returns every version of the note, newest first
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Param       noteID    path      string  true  "Note ID"
+// @Success     200  {array}   ticketNoteVersion
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/notes/{noteID}/versions [get]
+func (a *App) listTicketNoteVersions(w http.ResponseWriter, r *http.Request) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	conn := a.conn(r.Context())
+	n, ok := loadTicketNote(w, r, conn, ticketID, false)
+	if !ok {
+		return
+	}
+
+	rows, err := conn.QueryContext(r.Context(), `
+		SELECT v.version, v.created_at, v.editor_agent_id, a.name, v.body
+		FROM ticket_note_versions v
+		LEFT JOIN agents a ON a.id = v.editor_agent_id
+		WHERE v.note_id = $1
+		ORDER BY v.version DESC`, n.ID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTicketNoteVersions query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	versions := []ticketNoteVersion{}
+	for rows.Next() {
+		var v ticketNoteVersion
+		if err := rows.Scan(&v.Version, &v.CreatedAt, &v.EditorAgentID, &v.EditorName, &v.Body); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listTicketNoteVersions scan: %v", err)
+			return
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTicketNoteVersions rows: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
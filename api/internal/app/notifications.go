@@ -0,0 +1,376 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// Notification kinds.
+const (
+	// notifyMention: the agent was @mentioned in a ticket note.
+	notifyMention = "mention"
+	// notifyCustomerReply: the customer wrote on a ticket assigned to the agent.
+	notifyCustomerReply = "customer_reply"
+	// notifyStatusChange: a ticket the agent follows changed status.
+	notifyStatusChange = "status_change"
+	// notifyAutomation: an automation rule's notify action named the agent.
+	notifyAutomation = "automation"
+)
+
+// notification is an entry in an agent's inbox.
+type notification struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Kind is mention, customer_reply, status_change or automation.
+	Kind        string  `json:"kind"`
+	TicketID    string  `json:"ticket_id"`
+	TicketTitle string  `json:"ticket_title"`
+	NoteID      *string `json:"note_id"`
+	// ActorAgentID is the agent who caused the notification; null when it
+	// came from the customer or Zendesk.
+	ActorAgentID *string `json:"actor_agent_id"`
+	ActorName    *string `json:"actor_name"`
+	// Data is {"from", "to"} for status_change, {"rule_id", "rule_name"} for
+	// automation; empty otherwise.
+	Data   map[string]string `json:"data"`
+	ReadAt *time.Time        `json:"read_at"`
+}
+
+type notificationsResponse struct {
+	Notifications []notification `json:"notifications"`
+	UnreadCount   int            `json:"unread_count"`
+	// NextCursor is passed back as ?cursor= to fetch the next (older) page. Null on the last page.
+	NextCursor *string `json:"next_cursor"`
+}
+
+type unreadCountResponse struct {
+	Count int `json:"count"`
+}
+
+// sentNotification identifies a stored notification so it can be pushed once
+// the transaction that created it commits.
+type sentNotification struct {
+	ID      string
+	AgentID string
+}
+
+// notify stores a notification of kind about ticketID for each of agentIDs
+// other than actorAgentID and returns what it stored.
+func notify(ctx context.Context, q queryer, orgID, kind, ticketID string, noteID, actorAgentID *string, data map[string]string, agentIDs []string) ([]sentNotification, error) {
+	if len(agentIDs) == 0 {
+		return nil, nil
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	payload, _ := json.Marshal(data)
+	rows, err := q.QueryContext(ctx, `
+		INSERT INTO notifications (org_id, agent_id, kind, ticket_id, note_id, actor_agent_id, data)
+		SELECT $1, agent_id, $3, $4, $5, $6, $7
+		FROM unnest($2::uuid[]) AS agent_id
+		WHERE agent_id IS DISTINCT FROM $6::uuid
+		RETURNING id, agent_id`,
+		orgID, agentIDs, kind, ticketID, noteID, actorAgentID, payload,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var sent []sentNotification
+	for rows.Next() {
+		var n sentNotification
+		if err := rows.Scan(&n.ID, &n.AgentID); err != nil {
+			return nil, err
+		}
+		sent = append(sent, n)
+	}
+	return sent, rows.Err()
+}
+
+// notifyAssigneeOfReply notifies the ticket's assignee, if any, that the
+// customer wrote.
+func notifyAssigneeOfReply(ctx context.Context, q queryer, orgID, ticketID string) ([]sentNotification, error) {
+	var assigneeID *string
+	if err := q.QueryRowContext(ctx,
+		`SELECT assignee_id FROM tickets WHERE id = $1`, ticketID,
+	).Scan(&assigneeID); err != nil {
+		return nil, fmt.Errorf("load assignee: %w", err)
+	}
+	if assigneeID == nil {
+		return nil, nil
+	}
+	return notify(ctx, q, orgID, notifyCustomerReply, ticketID, nil, nil, nil, []string{*assigneeID})
+}
+
+// notifyFollowersOfStatus notifies the ticket's followers, except the agent
+// who made the change, that its status went from one value to another.
+func notifyFollowersOfStatus(ctx context.Context, q queryer, orgID, ticketID, from, to string, actorAgentID *string) ([]sentNotification, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT agent_id FROM ticket_agent_state WHERE ticket_id = $1 AND following`, ticketID)
+	if err != nil {
+		return nil, fmt.Errorf("load followers: %w", err)
+	}
+	var followers []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		followers = append(followers, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return notify(ctx, q, orgID, notifyStatusChange, ticketID, nil, actorAgentID,
+		map[string]string{"from": from, "to": to}, followers)
+}
+
+// publishNotifications pushes committed notifications to their agents.
+func publishNotifications(ctx context.Context, bus *events.Bus, orgID string, sent []sentNotification) {
+	for _, n := range sent {
+		bus.Publish(ctx, orgID, events.NotificationCreated, map[string]string{"agent_id": n.AgentID, "notification_id": n.ID})
+	}
+}
+
+// unreadNotificationCount returns how many of the agent's notifications are unread.
+func unreadNotificationCount(ctx context.Context, q queryer, agentID string) (int, error) {
+	var n int
+	err := q.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE agent_id = $1 AND read_at IS NULL`, agentID,
+	).Scan(&n)
+	return n, err
+}
+
+// @Summary     List notifications
+// @Tags        Notifications
+// @Description Returns the calling agent's (x-agent-id) notifications, newest first, paginated with an
+// @Description opaque cursor, together with their unread count. New notifications are also pushed on
+// @Description GET /events as notification.created to streams opened with the agent's ?agent_id=.
+// @Produce     json
+// @Param       unread  query     bool    false  "Only unread notifications"
+// @Param       limit   query     int     false  "Page size (default 50, max 200)"
+// @Param       cursor  query     string  false  "Cursor from a previous page"
+// @Success     200  {object}  notificationsResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /notifications [get]
+func (a *App) listNotifications(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+
+	where := "n.agent_id = $1"
+	args := []any{ag.ID}
+	if v := q.Get("unread"); v != "" {
+		unread, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "unread: must be true or false", http.StatusBadRequest)
+			return
+		}
+		if unread {
+			where += " AND n.read_at IS NULL"
+		}
+	}
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 200)
+	}
+	if v := q.Get("cursor"); v != "" {
+		createdAt, id, err := decodeAuditCursor(v)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		args = append(args, createdAt, id)
+		where += fmt.Sprintf(" AND (n.created_at, n.id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	conn := a.conn(r.Context())
+	resp := notificationsResponse{Notifications: []notification{}}
+
+	// Fetch one extra row to learn whether another page exists.
+	args = append(args, limit+1)
+	rows, err := conn.QueryContext(r.Context(), `
+		SELECT n.id, n.created_at, n.kind::text, n.ticket_id, t.title, n.note_id,
+		       n.actor_agent_id, a.name, n.data, n.read_at
+		FROM notifications n
+		JOIN tickets t ON t.id = n.ticket_id
+		LEFT JOIN agents a ON a.id = n.actor_agent_id
+		WHERE `+where+`
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listNotifications query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n notification
+		var data []byte
+		if err := rows.Scan(&n.ID, &n.CreatedAt, &n.Kind, &n.TicketID, &n.TicketTitle, &n.NoteID,
+			&n.ActorAgentID, &n.ActorName, &data, &n.ReadAt); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listNotifications scan: %v", err)
+			return
+		}
+		if err := json.Unmarshal(data, &n.Data); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listNotifications data: %v", err)
+			return
+		}
+		resp.Notifications = append(resp.Notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listNotifications iterate: %v", err)
+		return
+	}
+	rows.Close()
+
+	if len(resp.Notifications) > limit {
+		resp.Notifications = resp.Notifications[:limit]
+		last := resp.Notifications[limit-1]
+		cursor := encodeAuditCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+	if resp.UnreadCount, err = unreadNotificationCount(r.Context(), conn, ag.ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listNotifications unread count: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary     Count unread notifications
+// @Tags        Notifications
+// @Description Returns how many of the calling agent's (x-agent-id) notifications are unread
+// @Produce     json
+// @Success     200  {object}  unreadCountResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /notifications/unread-count [get]
+func (a *App) getUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	n, err := unreadNotificationCount(r.Context(), a.conn(r.Context()), ag.ID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getUnreadNotificationCount: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unreadCountResponse{Count: n})
+}
+
+// @Summary     Mark a notification read
+// @Tags        Notifications
+// @Description Marks one of the calling agent's (x-agent-id) notifications read and returns the new unread count
+// @Produce     json
+// @Param       notificationID  path      string  true  "Notification ID"
+// @Success     200  {object}  unreadCountResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /notifications/{notificationID}/read [put]
+func (a *App) markNotificationRead(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	notificationID := chi.URLParam(r, "notificationID")
+	if !reUUID.MatchString(notificationID) {
+		http.Error(w, "notification not found", http.StatusNotFound)
+		return
+	}
+	conn := a.conn(r.Context())
+
+	var id string
+	err := conn.QueryRowContext(r.Context(), `
+		UPDATE notifications SET read_at = COALESCE(read_at, now())
+		WHERE id = $1 AND agent_id = $2
+		RETURNING id`,
+		notificationID, ag.ID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "notification not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("markNotificationRead: %v", err)
+		return
+	}
+	a.writeUnreadAfterRead(w, r, conn, ag.ID)
+}
+
+// @Summary     Mark all notifications read
+// @Tags        Notifications
+// @Description Marks all of the calling agent's (x-agent-id) notifications read
+// @Produce     json
+// @Success     200  {object}  unreadCountResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /notifications/read [put]
+func (a *App) markAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	conn := a.conn(r.Context())
+	if _, err := conn.ExecContext(r.Context(),
+		`UPDATE notifications SET read_at = now() WHERE agent_id = $1 AND read_at IS NULL`, ag.ID,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("markAllNotificationsRead: %v", err)
+		return
+	}
+	a.writeUnreadAfterRead(w, r, conn, ag.ID)
+}
+
+// writeUnreadAfterRead tells the agent's other clients their inbox changed and
+// writes the remaining unread count.
+func (a *App) writeUnreadAfterRead(w http.ResponseWriter, r *http.Request, q queryer, agentID string) {
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.NotificationsRead, map[string]string{"agent_id": agentID})
+
+	n, err := unreadNotificationCount(r.Context(), q, agentID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("writeUnreadAfterRead: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(unreadCountResponse{Count: n})
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"purl/api/internal/events"
+)
+
+// presenceTTL is how long a heartbeat keeps an agent present. Clients should
+// heartbeat every 10–15 seconds while the ticket is open.
+const presenceTTL = 30 * time.Second
+
+type presenceEntry struct {
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	// State is "viewing" or "composing".
+	State string `json:"state"`
+	// OpenedAt is when the agent opened the ticket, i.e. the first heartbeat of
+	// the current visit. Replies are checked for collisions against it.
+	OpenedAt time.Time `json:"opened_at"`
+	// ExpiresAt is when the entry lapses unless refreshed. Clients holding a
+	// presence list should drop entries past this time.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type putPresenceRequest struct {
+	// State is "viewing" or "composing".
+	State string `json:"state"`
+}
+
+// presenceKey is a Redis hash of agent ID -> presenceEntry JSON. Entries carry
+// their own expiry since hash fields can't expire individually; the key's TTL
+// is refreshed on every heartbeat so abandoned tickets are cleaned up.
+func presenceKey(orgID, ticketID string) string {
+	return fmt.Sprintf("presence:%s:%s", orgID, ticketID)
+}
+
+// loadPresence returns the live presence entries for a ticket, ordered by
+// OpenedAt, pruning any that have expired.
+func (a *App) loadPresence(ctx context.Context, orgID, ticketID string) ([]presenceEntry, error) {
+	key := presenceKey(orgID, ticketID)
+	raw, err := a.redis.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entries := []presenceEntry{}
+	var expired []string
+	for agentID, v := range raw {
+		var e presenceEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil || now.After(e.ExpiresAt) {
+			expired = append(expired, agentID)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(expired) > 0 {
+		a.redis.HDel(ctx, key, expired...)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].OpenedAt.Before(entries[j].OpenedAt) })
+	return entries, nil
+}
+
+// presenceFor returns the agent's live presence entry on a ticket, if any.
+func (a *App) presenceFor(ctx context.Context, orgID, ticketID, agentID string) (presenceEntry, bool) {
+	v, err := a.redis.HGet(ctx, presenceKey(orgID, ticketID), agentID).Result()
+	if err != nil {
+		return presenceEntry{}, false
+	}
+	var e presenceEntry
+	if err := json.Unmarshal([]byte(v), &e); err != nil || time.Now().After(e.ExpiresAt) {
+		return presenceEntry{}, false
+	}
+	return e, true
+}
+
+// publishPresence announces the ticket's current presence list. Unlike other
+// events the payload includes the full list so clients needn't refetch on
+// every heartbeat change.
+func (a *App) publishPresence(ctx context.Context, orgID, ticketID string) {
+	entries, err := a.loadPresence(ctx, orgID, ticketID)
+	if err != nil {
+		log.Printf("publishPresence: %v", err)
+		return
+	}
+	a.bus.Publish(ctx, orgID, events.PresenceChanged, map[string]any{"ticket_id": ticketID, "presence": entries})
+}
+
+// @Summary     Heartbeat ticket presence
+// @Tags        Tickets
+// @Description Records that the calling agent (x-agent-id) is viewing or composing on the ticket.
+// @Description Call every 10–15 seconds while the ticket is open; presence lapses after 30 seconds
+// @Description without a heartbeat. Changes are broadcast as presence.changed on GET /events.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string              true  "Ticket ID"
+// @Param       body      body      putPresenceRequest  true  "Presence state"
+// @Success     200  {array}   presenceEntry
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/presence [put]
+func (a *App) putTicketPresence(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	var req putPresenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.State != "viewing" && req.State != "composing" {
+		http.Error(w, "state must be viewing or composing", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+
+	now := time.Now()
+	entry := presenceEntry{AgentID: ag.ID, AgentName: ag.Name, State: req.State, OpenedAt: now}
+	prev, existed := a.presenceFor(r.Context(), o.ID, ticketID, ag.ID)
+	if existed {
+		entry.OpenedAt = prev.OpenedAt
+	}
+	entry.ExpiresAt = now.Add(presenceTTL)
+
+	v, _ := json.Marshal(entry)
+	key := presenceKey(o.ID, ticketID)
+	pipe := a.redis.TxPipeline()
+	pipe.HSet(r.Context(), key, ag.ID, v)
+	pipe.Expire(r.Context(), key, presenceTTL)
+	if _, err := pipe.Exec(r.Context()); err != nil {
+		http.Error(w, "presence update failed", http.StatusInternalServerError)
+		log.Printf("putTicketPresence: %v", err)
+		return
+	}
+
+	// Plain heartbeats don't change what others see, so only announce arrivals
+	// and state changes.
+	if !existed || prev.State != entry.State {
+		a.publishPresence(r.Context(), o.ID, ticketID)
+	}
+
+	entries, err := a.loadPresence(r.Context(), o.ID, ticketID)
+	if err != nil {
+		http.Error(w, "presence lookup failed", http.StatusInternalServerError)
+		log.Printf("putTicketPresence load: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// @Summary     Leave a ticket
+// @Tags        Tickets
+// @Description Clears the calling agent's (x-agent-id) presence on the ticket, e.g. when they close it
+// @Param       ticketID  path  string  true  "Ticket ID"
+// @Success     204
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/presence [delete]
+func (a *App) deleteTicketPresence(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+
+	n, err := a.redis.HDel(r.Context(), presenceKey(o.ID, ticketID), ag.ID).Result()
+	if err != nil {
+		http.Error(w, "presence update failed", http.StatusInternalServerError)
+		log.Printf("deleteTicketPresence: %v", err)
+		return
+	}
+	if n > 0 {
+		a.publishPresence(r.Context(), o.ID, ticketID)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
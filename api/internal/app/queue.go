@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Queue strategies for GET /queue/next.
+const (
+	// queueLongestWaiting picks the ticket whose customer has waited longest
+	// for a reply. Tickets the customer isn't waiting on are left out.
+	queueLongestWaiting = "longest_waiting"
+	// queueHottest picks the ticket with the highest AI temperature.
+	queueHottest = "hottest"
+	// queueOldestUnresolved picks the ticket that arrived first.
+	queueOldestUnresolved = "oldest_unresolved"
+	// queueSLAAtRisk picks the ticket whose next SLA target is due soonest,
+	// breached ones first. Tickets without an unmet target are left out.
+	queueSLAAtRisk = "sla_at_risk"
+)
+
+var queueStrategies = []string{queueLongestWaiting, queueHottest, queueOldestUnresolved, queueSLAAtRisk}
+
+// queueReservationTTL is how long a ticket handed out by GET /queue/next is
+// held for the agent before others can be handed it.
+const queueReservationTTL = 2 * time.Minute
+
+// queueCandidateLimit caps how many tickets GET /queue/next considers, in
+// strategy order, when looking for one that isn't reserved.
+const queueCandidateLimit = 50
+
+// queueOrder is the ORDER BY clause of each strategy, ending with the ticket
+// ID so the order is total.
+var queueOrder = map[string]string{
+	queueLongestWaiting:   `waiting.since, t.id`,
+	queueHottest:          `t.ai_temperature DESC NULLS LAST, COALESCE(t.received_at, t.created_at), t.id`,
+	queueOldestUnresolved: `COALESCE(t.received_at, t.created_at), t.id`,
+	queueSLAAtRisk:        slaNextDueExpr + `, t.id`,
+}
+
+type queueNextResponse struct {
+	Strategy string    `json:"strategy"`
+	Ticket   ticketRow `json:"ticket"`
+	// ReservedUntil is when the reservation lapses and the ticket can be handed
+	// to another agent.
+	ReservedUntil time.Time `json:"reserved_until"`
+}
+
+// queueReservationKey holds the ID of the agent a ticket is reserved for.
+func queueReservationKey(orgID, ticketID string) string {
+	return fmt.Sprintf("queue:reservation:%s:%s", orgID, ticketID)
+}
+
+// reserveScript sets KEYS[1] to the agent ID in ARGV[1] for ARGV[2]
+// milliseconds unless another agent holds it, and returns 1 if the agent now
+// holds it. Checking the holder and renewing happen atomically, so a
+// reservation can't lapse and be taken by another agent in between.
+var reserveScript = redis.NewScript(`
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1
+`)
+
+// reserveQueueTicket reserves the ticket for agentID for queueReservationTTL.
+// It reports false if another agent holds the reservation; an agent's own
+// reservation is renewed.
+func (a *App) reserveQueueTicket(ctx context.Context, orgID, ticketID, agentID string) (bool, error) {
+	n, err := reserveScript.Run(ctx, a.redis, []string{queueReservationKey(orgID, ticketID)},
+		agentID, queueReservationTTL.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// @Summary     Get the next ticket to work on
+// @Tags        Tickets
+// @Description Picks the calling agent's (x-agent-id) next ticket by strategy and reserves it for two minutes,
+// @Description so concurrent callers are handed different tickets. Calling again while holding a reservation
+// @Description renews it. Only new and open tickets that aren't snoozed and are unassigned or assigned to the
+// @Description caller are considered. Responds 204 when there is nothing to work on.
+// @Produce     json
+// @Param       strategy  query     string  false  "longest_waiting (default), hottest, oldest_unresolved or sla_at_risk"
+// @Success     200       {object}  queueNextResponse
+// @Success     204
+// @Failure     400       {string}  string  "Bad Request"
+// @Failure     401       {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /queue/next [get]
+func (a *App) queueNext(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	strategy := r.URL.Query().Get("strategy")
+	if strategy == "" {
+		strategy = queueLongestWaiting
+	}
+	if !slices.Contains(queueStrategies, strategy) {
+		http.Error(w, "strategy must be one of "+strings.Join(queueStrategies, ", "), http.StatusBadRequest)
+		return
+	}
+	o := orgFromContext(r.Context())
+
+	// waiting.since mirrors customer_waiting_since in ticketSelect.
+	query := ticketSelect + `
+		CROSS JOIN LATERAL (
+		    SELECT CASE WHEN MAX(COALESCE(tc.received_at, tc.created_at)) FILTER (WHERE tc.role = 'customer') >
+		                     COALESCE(MAX(COALESCE(tc.received_at, tc.created_at)) FILTER (WHERE tc.role = 'agent'), '-infinity'::timestamptz)
+		                THEN MAX(COALESCE(tc.received_at, tc.created_at)) FILTER (WHERE tc.role = 'customer')
+		           END AS since
+		    FROM ticket_comments tc
+		    WHERE tc.ticket_id = t.id
+		) waiting
+		WHERE t.zendesk_status IN ('new', 'open')
+		  AND t.snoozed_at IS NULL
+		  AND (t.assignee_id IS NULL OR t.assignee_id = $1)`
+	switch strategy {
+	case queueLongestWaiting:
+		query += ` AND waiting.since IS NOT NULL`
+	case queueSLAAtRisk:
+		query += ` AND ` + slaNextDueExpr + ` IS NOT NULL`
+	}
+	query += ` ORDER BY ` + queueOrder[strategy] + ` LIMIT $2`
+
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), query, ag.ID, queueCandidateLimit)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("queueNext query: %v", err)
+		return
+	}
+	var candidates []ticketRow
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("queueNext scan: %v", err)
+			return
+		}
+		candidates = append(candidates, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("queueNext rows: %v", err)
+		return
+	}
+	if err := setWaitingTimes(r.Context(), a.conn(r.Context()), o.ID, candidates); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("queueNext waiting times: %v", err)
+		return
+	}
+
+	for _, t := range candidates {
+		ok, err := a.reserveQueueTicket(r.Context(), o.ID, t.ID, ag.ID)
+		if err != nil {
+			http.Error(w, "reservation failed", http.StatusInternalServerError)
+			log.Printf("queueNext reserve: %v", err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(queueNextResponse{
+			Strategy:      strategy,
+			Ticket:        t,
+			ReservedUntil: time.Now().Add(queueReservationTTL),
+		})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
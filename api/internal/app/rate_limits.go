@@ -0,0 +1,114 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/ratelimit"
+)
+
+// RateLimits configures inbound request budgets, each a token bucket refilled
+// at the given rate per minute that can absorb a burst of up to one minute's
+// budget. A zero value disables that budget.
+type RateLimits struct {
+	// OrgPerMinute caps authenticated API requests per org, across all its keys.
+	OrgPerMinute int64
+	// KeyPerMinute caps API requests per API key. It is checked before the key
+	// is authenticated, so floods with bad keys are rejected without a DB lookup.
+	KeyPerMinute int64
+	// WebhookPerMinute caps Zendesk webhook deliveries per org slug.
+	WebhookPerMinute int64
+}
+
+// rateLimitHeaders are exposed to browsers via CORS so the frontend can back off.
+const rateLimitHeaders = "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset"
+
+func newLimiter(a *App, name string, perMinute int64) *ratelimit.Limiter {
+	if perMinute <= 0 || a.redis == nil {
+		return nil
+	}
+	return ratelimit.NewTokenBucket(a.redis, name, perMinute, time.Minute, perMinute)
+}
+
+// rateLimit returns middleware that charges each request to the budget named
+// by keyFn. Requests for which keyFn returns "" pass through uncounted (e.g. a
+// missing API key, which auth rejects anyway). If Redis is unavailable the
+// request is allowed: a limiter outage shouldn't take the API down with it.
+func rateLimit(l *ratelimit.Limiter, keyFn func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFn(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := l.Allow(r.Context(), key)
+			if err != nil {
+				log.Printf("rateLimit: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			setRateLimitHeaders(w, res)
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders reports the most constrained budget when several apply
+// to one request: a budget only overwrites the headers if it has fewer
+// requests remaining than the one already reported.
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	h := w.Header()
+	if prev := h.Get("X-RateLimit-Remaining"); prev != "" {
+		if n, err := strconv.ParseInt(prev, 10, 64); err == nil && n <= res.Remaining {
+			return
+		}
+	}
+	h.Set("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	h.Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// apiKeyBudget identifies the caller's API key, from the header or (for the
+// recording proxy) the api_key query parameter. The key is hashed so raw keys
+// never appear in Redis.
+func apiKeyBudget(r *http.Request) string {
+	key := r.Header.Get("x-api-key")
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// orgBudget must run after requireAPIKey.
+func orgBudget(r *http.Request) string {
+	return orgFromContext(r.Context()).ID
+}
+
+func webhookBudget(r *http.Request) string {
+	return chi.URLParam(r, "orgSlug")
+}
@@ -1,17 +1,38 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"purl/api/internal/diskcache"
 )
 
+// recordingFillTimeout bounds how long a background cache fill may spend
+// downloading a single recording from Zendesk.
+const recordingFillTimeout = 10 * time.Minute
+
+// recordingPassthroughHeaders are copied from the Zendesk response to the
+// client so range requests and conditional requests behave end to end.
+var recordingPassthroughHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified",
+}
+
 // proxyRecording streams a Zendesk call recording to the client.
 // Uses query-param auth (?api_key=) so <audio> elements can reference it directly.
 // The raw recording_url is never exposed — the frontend hits this proxy instead.
+//
+// Range, If-Range and If-None-Match are honoured so the audio player can seek
+// without restarting the download. Recordings are cached on local disk after
+// the first play; cached copies are served (including partial content) without
+// contacting Zendesk.
 func (a *App) proxyRecording(w http.ResponseWriter, r *http.Request) {
 	key := r.URL.Query().Get("api_key")
 	if key == "" {
@@ -19,10 +40,7 @@ func (a *App) proxyRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var o org
-	err := a.db.QueryRowContext(r.Context(),
-		`SELECT id, name, api_key FROM organizations WHERE api_key = $1`, key,
-	).Scan(&o.ID, &o.Name, &o.APIKey)
+	o, err := a.orgByAPIKey(r.Context(), key)
 	if err == sql.ErrNoRows {
 		http.Error(w, "invalid api key", http.StatusUnauthorized)
 		return
@@ -36,36 +54,60 @@ func (a *App) proxyRecording(w http.ResponseWriter, r *http.Request) {
 	ticketID := chi.URLParam(r, "ticketID")
 	commentID := chi.URLParam(r, "commentID")
 
-	// Look up recording URL, verifying the comment belongs to this org's ticket
-	var recordingURL string
-	err = a.db.QueryRowContext(r.Context(), `
-		SELECT tc.recording_url
+	// Look up the recording URL and Zendesk credentials, verifying the comment
+	// belongs to this org's ticket. The scoped connection is released before
+	// streaming so a long playback doesn't hold it.
+	conn, release, err := a.orgConn(r.Context(), o.ID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		log.Printf("proxyRecording scope conn: %v", err)
+		return
+	}
+	var recordingURL, subdomain, email, apiKey string
+	err = conn.QueryRowContext(r.Context(), `
+		SELECT tc.recording_url,
+		       COALESCE(o.zendesk_subdomain, ''), COALESCE(o.zendesk_email, ''), COALESCE(o.zendesk_api_key, '')
 		FROM ticket_comments tc
 		JOIN tickets t ON t.id = tc.ticket_id
+		JOIN organizations o ON o.id = t.org_id
 		WHERE tc.id = $1 AND tc.ticket_id = $2 AND t.org_id = $3
 		  AND tc.recording_url IS NOT NULL
-	`, commentID, ticketID, o.ID).Scan(&recordingURL)
+	`, commentID, ticketID, o.ID).Scan(&recordingURL, &subdomain, &email, &apiKey)
+	release()
 	if err != nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	// Fetch Zendesk credentials for this org
-	var subdomain, email, apiKey string
-	err = a.db.QueryRowContext(r.Context(),
-		`SELECT COALESCE(zendesk_subdomain,''), COALESCE(zendesk_email,''), COALESCE(zendesk_api_key,'')
-		 FROM organizations WHERE id = $1`,
-		o.ID,
-	).Scan(&subdomain, &email, &apiKey)
-	if err != nil || subdomain == "" || email == "" || apiKey == "" {
-		http.Error(w, "zendesk not configured", http.StatusInternalServerError)
-		if err != nil {
-			log.Printf("proxyRecording creds: %v", err)
+	// Recordings never change once a call ends, so the comment ID is a stable cache key.
+	cacheKey := "recording:" + commentID
+	if a.recordings != nil {
+		f, meta, err := a.recordings.Open(cacheKey)
+		if err == nil {
+			defer f.Close()
+			if meta.ContentType != "" {
+				w.Header().Set("Content-Type", meta.ContentType)
+			}
+			if meta.ETag != "" {
+				w.Header().Set("ETag", meta.ETag)
+			}
+			w.Header().Set("Cache-Control", "private, max-age=3600")
+			// ServeContent handles Range (206), If-Range and If-None-Match (304).
+			http.ServeContent(w, r, "", meta.LastModified, f)
+			return
+		}
+		if !errors.Is(err, diskcache.ErrMiss) {
+			log.Printf("proxyRecording cache open: %v", err)
 		}
+	}
+
+	if subdomain == "" || email == "" || apiKey == "" {
+		http.Error(w, "zendesk not configured", http.StatusInternalServerError)
 		return
 	}
 
-	// Stream from Zendesk
+	// Stream from Zendesk, forwarding the headers that make seeking and
+	// revalidation work.
 	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, recordingURL, nil)
 	if err != nil {
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -73,6 +115,11 @@ func (a *App) proxyRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	req.SetBasicAuth(email+"/token", apiKey)
+	for _, h := range []string{"Range", "If-Range", "If-None-Match"} {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -81,16 +128,100 @@ func (a *App) proxyRecording(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer resp.Body.Close()
+	a.observeZendesk(r.Context(), email, apiKey, resp.Header)
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified, http.StatusRequestedRangeNotSatisfiable:
+	default:
 		http.Error(w, "upstream error", http.StatusBadGateway)
 		log.Printf("proxyRecording upstream status: %d", resp.StatusCode)
 		return
 	}
 
-	if ct := resp.Header.Get("Content-Type"); ct != "" {
-		w.Header().Set("Content-Type", ct)
+	// Populate the cache in the background so later plays and seeks are served
+	// locally. The client's own response is streamed straight through meanwhile.
+	if a.recordings != nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
+		a.fillRecordingCache(cacheKey, recordingURL, email, apiKey)
+	}
+
+	for _, h := range recordingPassthroughHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	if w.Header().Get("Accept-Ranges") == "" {
+		w.Header().Set("Accept-Ranges", "bytes")
 	}
 	w.Header().Set("Cache-Control", "private, max-age=3600")
-	io.Copy(w, resp.Body)
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		// Usually the client seeking away or closing the player; not actionable.
+		log.Printf("proxyRecording copy: %v", err)
+	}
+}
+
+// fillRecordingCache downloads the full recording into the disk cache in a
+// background goroutine. Concurrent calls for the same key share one download.
+func (a *App) fillRecordingCache(cacheKey, recordingURL, email, apiKey string) {
+	a.recordingFillsMu.Lock()
+	if a.recordingFills[cacheKey] {
+		a.recordingFillsMu.Unlock()
+		return
+	}
+	a.recordingFills[cacheKey] = true
+	a.recordingFillsMu.Unlock()
+
+	go func() {
+		defer func() {
+			a.recordingFillsMu.Lock()
+			delete(a.recordingFills, cacheKey)
+			a.recordingFillsMu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), recordingFillTimeout)
+		defer cancel()
+		if err := a.downloadRecording(ctx, cacheKey, recordingURL, email, apiKey); err != nil {
+			log.Printf("proxyRecording cache fill %s: %v", cacheKey, err)
+		}
+	}()
+}
+
+func (a *App) downloadRecording(ctx context.Context, cacheKey, recordingURL, email, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, recordingURL, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.SetBasicAuth(email+"/token", apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch: %w", err)
+	}
+	defer resp.Body.Close()
+	a.observeZendesk(ctx, email, apiKey, resp.Header)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+
+	meta := diskcache.Meta{
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if meta.ETag == "" {
+		meta.ETag = fmt.Sprintf("%q", cacheKey)
+	}
+	if lm, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		meta.LastModified = lm
+	}
+	return a.recordings.Put(cacheKey, meta, resp.Body)
+}
+
+// observeZendesk tells the Zendesk limiter, if any, the rate-limit headers of
+// a response fetched with the org's credentials.
+func (a *App) observeZendesk(ctx context.Context, email, apiKey string, h http.Header) {
+	if a.zendeskLimiter == nil {
+		return
+	}
+	creds := base64.StdEncoding.EncodeToString([]byte(email + "/token:" + apiKey))
+	a.zendeskLimiter.Observe(ctx, creds, h)
 }
@@ -0,0 +1,228 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"purl/api/internal/events"
+)
+
+type postReplyRequest struct {
+	Body string `json:"body"`
+	// Public defaults to true; false posts an internal note.
+	Public *bool `json:"public"`
+	// OpenedAt is when the composer opened the ticket. Defaults to the agent's
+	// presence OpenedAt; if neither is known the collision check is skipped.
+	OpenedAt *time.Time `json:"opened_at"`
+	// Force sends the reply even if another agent replied after OpenedAt.
+	Force bool `json:"force"`
+}
+
+// collisionReply is a reply by another agent that the composer hasn't seen.
+type collisionReply struct {
+	ID         string    `json:"id"`
+	AuthorName string    `json:"author_name"`
+	Body       string    `json:"body"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type replyConflictResponse struct {
+	Error string `json:"error"`
+	// Replies are the other agents' replies posted after the composer opened the ticket.
+	Replies []collisionReply `json:"replies"`
+}
+
+// @Summary     Reply to a ticket
+// @Tags        Tickets
+// @Description Posts a comment to the Zendesk ticket as the calling agent (x-agent-id) and stores it.
+// @Description If another agent replied after the composer opened the ticket, returns 409 with those
+// @Description replies instead of sending; resubmit with force=true to send anyway.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string            true  "Ticket ID"
+// @Param       body      body      postReplyRequest  true  "Reply"
+// @Success     201  {object}  ticketCommentRow
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Failure     409  {object}  replyConflictResponse
+// @Failure     422  {string}  string  "Unprocessable Entity"
+// @Failure     502  {string}  string  "Bad Gateway"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/replies [post]
+func (a *App) postTicketReply(w http.ResponseWriter, r *http.Request) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	var req postReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		http.Error(w, "body is required", http.StatusBadRequest)
+		return
+	}
+	public := req.Public == nil || *req.Public
+
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	var zendeskTicketID, agentZendeskID *int64
+	err := conn.QueryRowContext(r.Context(), `
+		SELECT t.zendesk_ticket_id, ag.zendesk_user_id
+		FROM tickets t, agents ag
+		WHERE t.id = $1 AND ag.id = $2`,
+		ticketID, ag.ID,
+	).Scan(&zendeskTicketID, &agentZendeskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply lookup: %v", err)
+		return
+	}
+	if zendeskTicketID == nil {
+		http.Error(w, "ticket is not linked to Zendesk", http.StatusUnprocessableEntity)
+		return
+	}
+	if agentZendeskID == nil || *agentZendeskID <= 0 {
+		http.Error(w, "agent has no Zendesk user", http.StatusUnprocessableEntity)
+		return
+	}
+
+	openedAt := req.OpenedAt
+	if openedAt == nil {
+		if p, ok := a.presenceFor(r.Context(), o.ID, ticketID, ag.ID); ok {
+			openedAt = &p.OpenedAt
+		}
+	}
+	if openedAt != nil && !req.Force {
+		replies, err := collidingReplies(r.Context(), conn, ticketID, ag.ID, *openedAt)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("postTicketReply collision check: %v", err)
+			return
+		}
+		if len(replies) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(replyConflictResponse{
+				Error:   "another agent replied after you opened this ticket",
+				Replies: replies,
+			})
+			return
+		}
+	}
+
+	update, err := zendeskTicketUpdate(r.Context(), conn, o.ID, *zendeskTicketID, map[string]any{
+		"comment": map[string]any{"body": req.Body, "public": public, "author_id": *agentZendeskID},
+	}, a.zendeskLimiter)
+	if errors.Is(err, errZendeskNotConfigured) {
+		http.Error(w, "zendesk not configured", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "zendesk update failed", http.StatusBadGateway)
+		log.Printf("postTicketReply zendesk: %v", err)
+		return
+	}
+	comment := update.comment()
+	if comment == nil {
+		http.Error(w, "zendesk update failed", http.StatusBadGateway)
+		log.Printf("postTicketReply: no comment in audit for ticket %d", *zendeskTicketID)
+		return
+	}
+
+	// Store the comment now rather than waiting for the webhook, which will
+	// find it already present (same zendesk_comment_id) and skip it.
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "begin tx failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, _, err := insertCommentForTicket(r.Context(), tx, tx, o.ID, ticketID, comment, a.zendeskLimiter); err != nil {
+		http.Error(w, "store comment failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply insert: %v", err)
+		return
+	}
+	c, err := scanTicketComment(tx.QueryRowContext(r.Context(), ticketCommentSelect+`
+		WHERE tc.ticket_id = $1 AND tc.zendesk_comment_id = $2
+		ORDER BY tc.zendesk_sub_index
+		LIMIT 1
+	`, ticketID, comment.ID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply read back: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "ticket.reply",
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		After:      map[string]any{"comment_id": c.ID, "public": public},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("postTicketReply commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.CommentCreated, map[string]string{"ticket_id": ticketID})
+	// The webhook will find the comment already stored, so the reply's effect
+	// on the ticket's SLA, and the automations it triggers, are applied here.
+	logSLA(refreshTicketSLA(r.Context(), conn, o.ID, ticketID, a.bus), ticketID)
+	logAutomations(runAutomations(r.Context(), conn, o.ID, ticketID,
+		automationEvent{Trigger: triggerCommentAdded, CommentChannel: c.Channel}, a.zendeskLimiter, a.bus), ticketID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// collidingReplies returns replies on the ticket by agents other than agentID
+// received after openedAt. Automated comments from the Zendesk system agent
+// don't count as collisions.
+func collidingReplies(ctx context.Context, q queryer, ticketID, agentID string, openedAt time.Time) ([]collisionReply, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT tc.id, a.name, tc.body, COALESCE(tc.received_at, tc.created_at)
+		FROM ticket_comments tc
+		JOIN agents a ON a.id = tc.agent_author_id
+		WHERE tc.ticket_id = $1
+		  AND tc.role = 'agent'
+		  AND tc.agent_author_id <> $2
+		  AND a.zendesk_user_id IS DISTINCT FROM -1
+		  AND COALESCE(tc.received_at, tc.created_at) > $3
+		ORDER BY COALESCE(tc.received_at, tc.created_at), tc.zendesk_sub_index`,
+		ticketID, agentID, openedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	replies := []collisionReply{}
+	for rows.Next() {
+		var c collisionReply
+		if err := rows.Scan(&c.ID, &c.AuthorName, &c.Body, &c.ReceivedAt); err != nil {
+			return nil, err
+		}
+		replies = append(replies, c)
+	}
+	return replies, rows.Err()
+}
@@ -0,0 +1,751 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"purl/api/internal/businesstime"
+)
+
+// reportChannels are the channels a ticket can arrive on: the channel of its
+// first public comment.
+var reportChannels = []string{"email", "sms", "voice", "web", "chat"}
+
+// reportGranularities are the bucket sizes of report time series.
+var reportGranularities = []string{"day", "week", "month"}
+
+// ticketChannelExpr is the channel of a ticket's first public comment, or
+// null if it has none yet.
+const ticketChannelExpr = `(SELECT tc.channel::text FROM ticket_comments tc
+	WHERE tc.ticket_id = t.id AND tc.channel <> 'internal'
+	ORDER BY COALESCE(tc.received_at, tc.created_at), tc.id LIMIT 1)`
+
+// agentReplyCond selects the comments tc that are public replies by a
+// person: Zendesk triggers and automations post as the system agent.
+const agentReplyCond = `tc.role = 'agent' AND tc.channel <> 'internal'
+	AND NOT EXISTS (SELECT 1 FROM agents sa WHERE sa.id = tc.agent_author_id AND sa.zendesk_user_id = -1)`
+
+// reportFilter is the query shared by the /reports endpoints:
+//
+//	from         RFC 3339, inclusive (default 30 days before to)
+//	to           RFC 3339, exclusive (default now)
+//	granularity  day (default), week or month
+//	assignee     an agent ID or "none"
+//	channel      email, sms, voice, web or chat
+//
+// Reports are read from the daily metric rollups, so the range is widened to
+// whole days in the rollups' time zone (the org's business-hours time zone,
+// or UTC if it has none). Weeks start on Monday.
+type reportFilter struct {
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Assignee    string
+	Channel     string
+	loc         *time.Location
+	// asOf is when the rollups were last refreshed; nil before the first
+	// rollup.
+	asOf *time.Time
+}
+
+// parseReportFilter reads a reportFilter from the request, returning a
+// client-facing message if it is invalid.
+func parseReportFilter(r *http.Request) (reportFilter, string) {
+	v := r.URL.Query()
+	f := reportFilter{To: time.Now(), Granularity: v.Get("granularity"), Assignee: v.Get("assignee"), Channel: v.Get("channel")}
+	if s := v.Get("to"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return f, "to must be an RFC 3339 timestamp"
+		}
+		f.To = t
+	}
+	f.From = f.To.AddDate(0, 0, -30)
+	if s := v.Get("from"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return f, "from must be an RFC 3339 timestamp"
+		}
+		f.From = t
+	}
+	if !f.From.Before(f.To) {
+		return f, "from must be before to"
+	}
+	if f.Granularity == "" {
+		f.Granularity = "day"
+	}
+	if !slices.Contains(reportGranularities, f.Granularity) {
+		return f, "granularity must be one of " + strings.Join(reportGranularities, ", ")
+	}
+	if f.Granularity == "day" && f.To.Sub(f.From) > 2*366*24*time.Hour {
+		return f, "daily reports span at most two years"
+	}
+	if f.Assignee != "" && f.Assignee != "none" && !reUUID.MatchString(f.Assignee) {
+		return f, `assignee must be "none" or an agent ID`
+	}
+	if f.Channel != "" && !slices.Contains(reportChannels, f.Channel) {
+		return f, "channel must be one of " + strings.Join(reportChannels, ", ")
+	}
+	return f, ""
+}
+
+// loadReportFilter parses the request's reportFilter, loads the rollups' time
+// zone and freshness into it and widens its range to whole days. It writes an
+// error and returns false on failure.
+func (a *App) loadReportFilter(w http.ResponseWriter, r *http.Request) (reportFilter, bool) {
+	f, msg := parseReportFilter(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return f, false
+	}
+	ctx := r.Context()
+	conn := a.conn(ctx)
+	orgID := orgFromContext(ctx).ID
+
+	var zone string
+	var asOf time.Time
+	err := conn.QueryRowContext(ctx,
+		`SELECT time_zone, refreshed_at FROM metric_rollup_state WHERE org_id = $1`, orgID,
+	).Scan(&zone, &asOf)
+	switch {
+	case err == nil:
+		f.asOf = &asOf
+		f.loc, err = time.LoadLocation(zone)
+	case err == sql.ErrNoRows:
+		// Not rolled up yet: the reports are empty, in the zone the rollups
+		// will use.
+		var schedule *businesstime.Schedule
+		schedule, err = loadOrgSchedule(ctx, conn, orgID)
+		f.loc = schedule.Location()
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadReportFilter rollup state: %v", err)
+		return f, false
+	}
+
+	f.From = localDay(f.From, f.loc)
+	if to := localDay(f.To, f.loc); to.Before(f.To) {
+		f.To = to.AddDate(0, 0, 1)
+	}
+	return f, true
+}
+
+// where returns a SQL condition over t selecting the org's tickets matching
+// the filter's assignee and channel, extending args like ticketFilter.where.
+// The date range is left to the caller.
+func (f reportFilter) where(orgID string, args []any) (string, []any) {
+	addArg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conds := []string{"t.org_id = " + addArg(orgID)}
+	switch f.Assignee {
+	case "":
+	case "none":
+		conds = append(conds, "t.assignee_id IS NULL")
+	default:
+		conds = append(conds, "t.assignee_id = "+addArg(f.Assignee))
+	}
+	if f.Channel != "" {
+		conds = append(conds, ticketChannelExpr+" = "+addArg(f.Channel))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// rollupWhere returns a SQL condition over daily_ticket_metrics m selecting
+// the org's rows in the filter's range, assignee and channel, and its args.
+func (f reportFilter) rollupWhere(orgID string) (string, []any) {
+	args := []any{orgID, f.From.Format(businesstime.DateLayout), f.To.Format(businesstime.DateLayout)}
+	conds := []string{"m.org_id = $1", "m.day >= $2", "m.day < $3"}
+	switch f.Assignee {
+	case "":
+	case "none":
+		conds = append(conds, "m.assignee_id IS NULL")
+	default:
+		args = append(args, f.Assignee)
+		conds = append(conds, "m.assignee_id = $"+strconv.Itoa(len(args)))
+	}
+	if f.Channel != "" {
+		args = append(args, f.Channel)
+		conds = append(conds, "m.channel = $"+strconv.Itoa(len(args)))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// bucket returns the start of the series bucket containing t.
+func (f reportFilter) bucket(t time.Time) time.Time {
+	t = t.In(f.loc)
+	switch f.Granularity {
+	case "week":
+		// Monday is day 0.
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, f.loc)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, f.loc)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, f.loc)
+	}
+}
+
+// buckets returns the start of every bucket overlapping [From, To).
+func (f reportFilter) buckets() []time.Time {
+	var out []time.Time
+	for b := f.bucket(f.From); b.Before(f.To); {
+		out = append(out, b)
+		switch f.Granularity {
+		case "week":
+			b = time.Date(b.Year(), b.Month(), b.Day()+7, 0, 0, 0, 0, f.loc)
+		case "month":
+			b = time.Date(b.Year(), b.Month()+1, 1, 0, 0, 0, 0, f.loc)
+		default:
+			b = time.Date(b.Year(), b.Month(), b.Day()+1, 0, 0, 0, 0, f.loc)
+		}
+	}
+	return out
+}
+
+// index returns the position of t's bucket in buckets().
+func (f reportFilter) index(buckets []time.Time, t time.Time) int {
+	b := f.bucket(t)
+	return sort.Search(len(buckets), func(i int) bool { return !buckets[i].Before(b) })
+}
+
+// dayIndex returns the position in buckets() of the bucket containing a
+// rollup day, as scanned from a DATE column.
+func (f reportFilter) dayIndex(buckets []time.Time, day time.Time) int {
+	return f.index(buckets, time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, f.loc))
+}
+
+// reportMeta echoes the filter a report was computed for.
+type reportMeta struct {
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Granularity string    `json:"granularity"`
+	// TimeZone is the zone days and series are bucketed in.
+	TimeZone string  `json:"time_zone"`
+	Assignee *string `json:"assignee"`
+	Channel  *string `json:"channel"`
+	// AsOf is how fresh the report is: it reflects every change made before
+	// this. Null if the org's metrics haven't been rolled up yet.
+	AsOf *time.Time `json:"as_of"`
+}
+
+func (f reportFilter) meta() reportMeta {
+	m := reportMeta{From: f.From, To: f.To, Granularity: f.Granularity, TimeZone: f.loc.String(), AsOf: f.asOf}
+	if f.Assignee != "" {
+		m.Assignee = &f.Assignee
+	}
+	if f.Channel != "" {
+		m.Channel = &f.Channel
+	}
+	return m
+}
+
+// writeReport writes a report response.
+func writeReport(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type volumePoint struct {
+	Start time.Time `json:"start"`
+	// Created counts tickets received in the bucket.
+	Created int `json:"created"`
+	// Solved counts tickets last solved in the bucket.
+	Solved int `json:"solved"`
+}
+
+type volumeReport struct {
+	reportMeta
+	Created int           `json:"created"`
+	Solved  int           `json:"solved"`
+	Points  []volumePoint `json:"points"`
+}
+
+// @Summary     Ticket volume
+// @Tags        Reports
+// @Description Counts tickets received and tickets solved over time
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  volumeReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/volume [get]
+func (a *App) getVolumeReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	buckets := f.buckets()
+	report := volumeReport{reportMeta: f.meta(), Points: make([]volumePoint, len(buckets))}
+	for i, b := range buckets {
+		report.Points[i].Start = b
+	}
+
+	cond, args := f.rollupWhere(orgFromContext(r.Context()).ID)
+	err := queryEach(r.Context(), a.conn(r.Context()), `
+		SELECT m.day, SUM(m.created), SUM(m.solved)
+		FROM daily_ticket_metrics m
+		WHERE `+cond+`
+		GROUP BY 1`, args,
+		func(scan func(...any) error) error {
+			var day time.Time
+			var created, solved int
+			if err := scan(&day, &created, &solved); err != nil {
+				return err
+			}
+			if i := f.dayIndex(buckets, day); i < len(buckets) {
+				report.Points[i].Created += created
+				report.Points[i].Solved += solved
+				report.Created += created
+				report.Solved += solved
+			}
+			return nil
+		})
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getVolumeReport query: %v", err)
+		return
+	}
+	writeReport(w, report)
+}
+
+// durationStats summarises a set of durations in raw and business time.
+type durationStats struct {
+	// Tickets is how many tickets the durations are over.
+	Tickets int `json:"tickets"`
+	// Median and average wall-clock seconds; null without tickets.
+	MedianSeconds  *int64 `json:"median_seconds"`
+	AverageSeconds *int64 `json:"average_seconds"`
+	// Median and average seconds counting only business hours.
+	MedianBusinessSeconds  *int64 `json:"median_business_seconds"`
+	AverageBusinessSeconds *int64 `json:"average_business_seconds"`
+}
+
+// durationSample collects the durations, in seconds, for one durationStats.
+type durationSample struct {
+	raw, business []int64
+}
+
+func (s *durationSample) add(raw, business int64) {
+	s.raw = append(s.raw, raw)
+	s.business = append(s.business, business)
+}
+
+func (s *durationSample) stats() durationStats {
+	st := durationStats{Tickets: len(s.raw)}
+	st.MedianSeconds, st.AverageSeconds = medianAndAverage(s.raw)
+	st.MedianBusinessSeconds, st.AverageBusinessSeconds = medianAndAverage(s.business)
+	return st
+}
+
+// medianAndAverage returns the median and mean of ds, or nils if ds is empty.
+// It sorts ds.
+func medianAndAverage(ds []int64) (*int64, *int64) {
+	if len(ds) == 0 {
+		return nil, nil
+	}
+	slices.Sort(ds)
+	median := ds[len(ds)/2]
+	if len(ds)%2 == 0 {
+		median = (ds[len(ds)/2-1] + ds[len(ds)/2]) / 2
+	}
+	var sum int64
+	for _, d := range ds {
+		sum += d
+	}
+	avg := sum / int64(len(ds))
+	return &median, &avg
+}
+
+type durationPoint struct {
+	Start time.Time `json:"start"`
+	durationStats
+}
+
+type durationReport struct {
+	reportMeta
+	durationStats
+	Points []durationPoint `json:"points"`
+}
+
+// writeDurationReport writes the durations in the given pair of
+// daily_ticket_metrics second arrays, bucketed by rollup day.
+func (a *App) writeDurationReport(w http.ResponseWriter, r *http.Request, f reportFilter, name, rawColumn, businessColumn string) {
+	buckets := f.buckets()
+	samples := make([]durationSample, len(buckets))
+	var total durationSample
+	cond, args := f.rollupWhere(orgFromContext(r.Context()).ID)
+	err := queryEach(r.Context(), a.conn(r.Context()), `
+		SELECT m.day, u.raw, u.business
+		FROM daily_ticket_metrics m
+		CROSS JOIN LATERAL unnest(m.`+rawColumn+`, m.`+businessColumn+`) AS u(raw, business)
+		WHERE `+cond, args,
+		func(scan func(...any) error) error {
+			var day time.Time
+			var raw, business int64
+			if err := scan(&day, &raw, &business); err != nil {
+				return err
+			}
+			if i := f.dayIndex(buckets, day); i < len(buckets) {
+				samples[i].add(raw, business)
+				total.add(raw, business)
+			}
+			return nil
+		})
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("%s query: %v", name, err)
+		return
+	}
+
+	report := durationReport{reportMeta: f.meta(), durationStats: total.stats(), Points: make([]durationPoint, len(buckets))}
+	for i, b := range buckets {
+		report.Points[i] = durationPoint{Start: b, durationStats: samples[i].stats()}
+	}
+	writeReport(w, report)
+}
+
+// @Summary     First-response time
+// @Tags        Reports
+// @Description Median and average time from a ticket being received to the first public agent reply, in
+// @Description wall-clock and business hours, for tickets first replied to in each bucket
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  durationReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/first-response [get]
+func (a *App) getFirstResponseReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	a.writeDurationReport(w, r, f, "getFirstResponseReport", "first_response_seconds", "first_response_business_seconds")
+}
+
+// @Summary     Resolution time
+// @Tags        Reports
+// @Description Median and average time from a ticket being received to it first being solved, in wall-clock
+// @Description and business hours, for tickets solved in each bucket
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  durationReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/resolution [get]
+func (a *App) getResolutionReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	a.writeDurationReport(w, r, f, "getResolutionReport", "resolution_seconds", "resolution_business_seconds")
+}
+
+type oneTouchPoint struct {
+	Start time.Time `json:"start"`
+	// Solved counts tickets last solved in the bucket.
+	Solved int `json:"solved"`
+	// OneTouch counts those solved with exactly one public agent reply.
+	OneTouch int `json:"one_touch"`
+	// Rate is OneTouch / Solved; null when nothing was solved.
+	Rate *float64 `json:"rate"`
+}
+
+func (p *oneTouchPoint) setRate() {
+	if p.Solved > 0 {
+		rate := float64(p.OneTouch) / float64(p.Solved)
+		p.Rate = &rate
+	}
+}
+
+type oneTouchReport struct {
+	reportMeta
+	Solved   int             `json:"solved"`
+	OneTouch int             `json:"one_touch"`
+	Rate     *float64        `json:"rate"`
+	Points   []oneTouchPoint `json:"points"`
+}
+
+// @Summary     One-touch resolution rate
+// @Tags        Reports
+// @Description Share of tickets solved with exactly one public agent reply, by when they were solved
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  oneTouchReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/one-touch [get]
+func (a *App) getOneTouchReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	buckets := f.buckets()
+	report := oneTouchReport{reportMeta: f.meta(), Points: make([]oneTouchPoint, len(buckets))}
+	for i, b := range buckets {
+		report.Points[i].Start = b
+	}
+
+	cond, args := f.rollupWhere(orgFromContext(r.Context()).ID)
+	err := queryEach(r.Context(), a.conn(r.Context()), `
+		SELECT m.day, SUM(m.solved), SUM(m.one_touch)
+		FROM daily_ticket_metrics m
+		WHERE `+cond+`
+		GROUP BY 1`, args,
+		func(scan func(...any) error) error {
+			var day time.Time
+			var solved, oneTouch int
+			if err := scan(&day, &solved, &oneTouch); err != nil {
+				return err
+			}
+			if i := f.dayIndex(buckets, day); i < len(buckets) {
+				report.Points[i].Solved += solved
+				report.Points[i].OneTouch += oneTouch
+				report.Solved += solved
+				report.OneTouch += oneTouch
+			}
+			return nil
+		})
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getOneTouchReport query: %v", err)
+		return
+	}
+	for i := range report.Points {
+		report.Points[i].setRate()
+	}
+	total := oneTouchPoint{Solved: report.Solved, OneTouch: report.OneTouch}
+	total.setRate()
+	report.Rate = total.Rate
+	writeReport(w, report)
+}
+
+type backlogPoint struct {
+	Start time.Time `json:"start"`
+	// Unresolved counts tickets received, and not yet solved, by the end of
+	// the bucket (or by to, for the last bucket).
+	Unresolved int `json:"unresolved"`
+}
+
+type backlogReport struct {
+	reportMeta
+	// ByStatus counts the unsolved tickets in each status now.
+	ByStatus map[string]int `json:"by_status"`
+	Points   []backlogPoint `json:"points"`
+}
+
+// @Summary     Backlog
+// @Tags        Reports
+// @Description Counts the tickets currently new, open and pending, and the unsolved backlog at the end of each bucket
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  backlogReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/backlog [get]
+func (a *App) getBacklogReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	conn := a.conn(r.Context())
+	cond, args := f.where(orgFromContext(r.Context()).ID, nil)
+
+	// The backlog is read from the tickets, not the rollups, so it is fresh
+	// as of now.
+	now := time.Now()
+	report := backlogReport{reportMeta: f.meta(), ByStatus: map[string]int{"new": 0, "open": 0, "pending": 0}}
+	report.AsOf = &now
+	rows, err := conn.QueryContext(r.Context(), `
+		SELECT t.zendesk_status::text, COUNT(*) FROM tickets t
+		WHERE `+cond+` AND t.zendesk_status IN `+openTicketStatuses+`
+		GROUP BY 1`, args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBacklogReport status query: %v", err)
+		return
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("getBacklogReport status scan: %v", err)
+			return
+		}
+		report.ByStatus[status] = n
+	}
+	rows.Close()
+
+	// The backlog at each bucket's end, from one pass over the tickets
+	// received before to and not solved before from.
+	buckets := f.buckets()
+	ends := make([]time.Time, len(buckets))
+	for i := range buckets {
+		if i+1 < len(buckets) {
+			ends[i] = buckets[i+1]
+		} else {
+			ends[i] = f.To
+		}
+	}
+	n := len(args)
+	args = append(args, f.From, f.To, ends)
+	rows, err = conn.QueryContext(r.Context(), fmt.Sprintf(`
+		SELECT e.idx, COUNT(t.id)
+		FROM unnest($%[3]d::timestamptz[]) WITH ORDINALITY AS e(at, idx)
+		LEFT JOIN tickets t ON %[4]s
+		     AND COALESCE(t.received_at, t.created_at) < e.at
+		     AND (t.resolved_at IS NULL OR t.resolved_at >= e.at)
+		     AND COALESCE(t.received_at, t.created_at) < $%[2]d
+		     AND (t.resolved_at IS NULL OR t.resolved_at >= $%[1]d)
+		GROUP BY e.idx`, n+1, n+2, n+3, cond), args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBacklogReport series query: %v", err)
+		return
+	}
+	defer rows.Close()
+	report.Points = make([]backlogPoint, len(buckets))
+	for i, b := range buckets {
+		report.Points[i].Start = b
+	}
+	for rows.Next() {
+		var idx, count int
+		if err := rows.Scan(&idx, &count); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("getBacklogReport series scan: %v", err)
+			return
+		}
+		report.Points[idx-1].Unresolved = count
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getBacklogReport series rows: %v", err)
+		return
+	}
+	writeReport(w, report)
+}
+
+type channelBreakdown struct {
+	Channel string `json:"channel"`
+	// Created counts tickets received on the channel.
+	Created int `json:"created"`
+	// Solved counts tickets from the channel last solved in the range.
+	Solved int `json:"solved"`
+	// Points counts the channel's tickets per bucket.
+	Points []volumePoint `json:"points"`
+}
+
+type channelReport struct {
+	reportMeta
+	Channels []channelBreakdown `json:"channels"`
+}
+
+// @Summary     Breakdown by channel
+// @Tags        Reports
+// @Description Ticket volume per channel, a ticket's channel being that of its first public comment. Tickets
+// @Description with no public comment yet are left out.
+// @Produce     json
+// @Param       from         query     string  false  "RFC 3339 start, inclusive (default 30 days before to)"
+// @Param       to           query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Param       granularity  query     string  false  "day (default), week or month"
+// @Param       assignee     query     string  false  "Agent ID or none"
+// @Param       channel      query     string  false  "email, sms, voice, web or chat"
+// @Success     200          {object}  channelReport
+// @Failure     400          {string}  string  "Bad Request"
+// @Failure     401          {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/channels [get]
+func (a *App) getChannelReport(w http.ResponseWriter, r *http.Request) {
+	f, ok := a.loadReportFilter(w, r)
+	if !ok {
+		return
+	}
+	buckets := f.buckets()
+	byChannel := map[string]*channelBreakdown{}
+	for _, ch := range reportChannels {
+		if f.Channel != "" && ch != f.Channel {
+			continue
+		}
+		b := &channelBreakdown{Channel: ch, Points: make([]volumePoint, len(buckets))}
+		for i, start := range buckets {
+			b.Points[i].Start = start
+		}
+		byChannel[ch] = b
+	}
+
+	cond, args := f.rollupWhere(orgFromContext(r.Context()).ID)
+	err := queryEach(r.Context(), a.conn(r.Context()), `
+		SELECT m.channel, m.day, SUM(m.created), SUM(m.solved)
+		FROM daily_ticket_metrics m
+		WHERE `+cond+` AND m.channel IS NOT NULL
+		GROUP BY 1, 2`, args,
+		func(scan func(...any) error) error {
+			var ch string
+			var day time.Time
+			var created, solved int
+			if err := scan(&ch, &day, &created, &solved); err != nil {
+				return err
+			}
+			b := byChannel[ch]
+			if b == nil {
+				return nil
+			}
+			if i := f.dayIndex(buckets, day); i < len(buckets) {
+				b.Points[i].Created += created
+				b.Points[i].Solved += solved
+				b.Created += created
+				b.Solved += solved
+			}
+			return nil
+		})
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getChannelReport query: %v", err)
+		return
+	}
+
+	report := channelReport{reportMeta: f.meta(), Channels: []channelBreakdown{}}
+	for _, ch := range reportChannels {
+		if b := byChannel[ch]; b != nil {
+			report.Channels = append(report.Channels, *b)
+		}
+	}
+	writeReport(w, report)
+}
@@ -0,0 +1,399 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"purl/api/internal/businesstime"
+)
+
+// Report metrics are rolled up per org and day into daily_ticket_metrics and
+// daily_agent_metrics, so that reports never scan comments. Triggers on
+// tickets and ticket_comments mark the hours whose metrics a change touches
+// in metric_rollup_dirty, and RollupMetrics rebuilds the days containing them.
+
+// ticketRollupKey is the grain of daily_ticket_metrics; empty means null.
+type ticketRollupKey struct {
+	assigneeID string
+	channel    string
+}
+
+// ticketRollup is one daily_ticket_metrics row.
+type ticketRollup struct {
+	created, solved, oneTouch            int
+	firstResponse, firstResponseBusiness []int64
+	resolution, resolutionBusiness       []int64
+	temperatureSum, temperatureCount     int
+}
+
+// agentRollup is one daily_agent_metrics row.
+type agentRollup struct {
+	replies, calls                       int
+	callSeconds                          int64
+	firstResponse, firstResponseBusiness []int64
+}
+
+// RollupMetrics brings every org's metric rollups up to date, rebuilding the
+// days with changes marked since its last run. An org whose business hours
+// (or time zone) have changed, or that has never been rolled up, is rebuilt
+// in full. An org that fails is logged and skipped. It returns how many days
+// it rebuilt.
+func RollupMetrics(ctx context.Context, db *sql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM organizations ORDER BY id`)
+	if err != nil {
+		return 0, fmt.Errorf("list orgs: %w", err)
+	}
+	var orgIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan org: %w", err)
+		}
+		orgIDs = append(orgIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("list orgs: %w", err)
+	}
+
+	total := 0
+	for _, orgID := range orgIDs {
+		n, err := rollupOrg(ctx, db, orgID, false)
+		if err != nil {
+			// The org's days stay marked and are retried on the next run.
+			log.Printf("rollup-metrics: org %s: %v", orgID, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// RebuildMetricRollups rebuilds all of an org's metric rollups from its
+// tickets and comments. It returns how many days it rebuilt.
+func RebuildMetricRollups(ctx context.Context, db *sql.DB, orgID string) (int, error) {
+	return rollupOrg(ctx, db, orgID, true)
+}
+
+// rollupOrg rebuilds the org's dirty days, or every day if full or the
+// rollups are out of date, in one transaction.
+func rollupOrg(ctx context.Context, db *sql.DB, orgID string, full bool) (int, error) {
+	hours, err := loadOrgHours(ctx, db, orgID)
+	if err != nil {
+		return 0, fmt.Errorf("load business hours: %w", err)
+	}
+	var schedule *businesstime.Schedule
+	var hoursJSON []byte
+	if hours != nil {
+		if schedule, err = hours.Schedule(); err != nil {
+			return 0, fmt.Errorf("business hours: %w", err)
+		}
+		if hoursJSON, err = json.Marshal(hours); err != nil {
+			return 0, fmt.Errorf("marshal business hours: %w", err)
+		}
+	}
+	loc := schedule.Location()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// One rollup per org at a time: the worker and a backfill would otherwise
+	// each miss the other's uncommitted rows when clearing days, and both
+	// insert them.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('metric_rollup:' || $1))`, orgID); err != nil {
+		return 0, fmt.Errorf("lock org: %w", err)
+	}
+
+	// Every change committed before the transaction started is visible to
+	// the statements below, so the rollups are fresh as of its start.
+	var asOf time.Time
+	var stateZone *string
+	var stateHours []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT now(), s.time_zone, s.hours
+		FROM (SELECT 1) one
+		LEFT JOIN metric_rollup_state s ON s.org_id = $1`, orgID,
+	).Scan(&asOf, &stateZone, &stateHours)
+	if err != nil {
+		return 0, fmt.Errorf("load state: %w", err)
+	}
+	if !full && (stateZone == nil || *stateZone != loc.String()) {
+		full = true
+	}
+	if !full {
+		// Compare through Hours so that JSONB's normalisation doesn't matter.
+		var prev *businesstime.Hours
+		if stateHours != nil {
+			if err := json.Unmarshal(stateHours, &prev); err != nil {
+				return 0, fmt.Errorf("parse state hours: %w", err)
+			}
+		}
+		prevJSON, _ := json.Marshal(prev)
+		currJSON, _ := json.Marshal(hours)
+		full = string(prevJSON) != string(currJSON)
+	}
+
+	var days []time.Time
+	if full {
+		for _, table := range []string{"daily_ticket_metrics", "daily_agent_metrics", "metric_rollup_dirty"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE org_id = $1`, orgID); err != nil {
+				return 0, fmt.Errorf("clear %s: %w", table, err)
+			}
+		}
+		var first *time.Time
+		if err := tx.QueryRowContext(ctx,
+			`SELECT MIN(COALESCE(received_at, created_at)) FROM tickets WHERE org_id = $1`, orgID,
+		).Scan(&first); err != nil {
+			return 0, fmt.Errorf("first ticket: %w", err)
+		}
+		if first != nil {
+			for d := localDay(*first, loc); !d.After(asOf); d = d.AddDate(0, 0, 1) {
+				days = append(days, d)
+			}
+		}
+	} else {
+		rows, err := tx.QueryContext(ctx,
+			`DELETE FROM metric_rollup_dirty WHERE org_id = $1 RETURNING hour`, orgID)
+		if err != nil {
+			return 0, fmt.Errorf("claim dirty hours: %w", err)
+		}
+		seen := map[time.Time]bool{}
+		for rows.Next() {
+			var hour time.Time
+			if err := rows.Scan(&hour); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("scan dirty hour: %w", err)
+			}
+			// An hour spans two local days in zones with a part-hour offset.
+			for _, d := range []time.Time{localDay(hour, loc), localDay(hour.Add(time.Hour-time.Nanosecond), loc)} {
+				if !seen[d] {
+					seen[d] = true
+					days = append(days, d)
+				}
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("claim dirty hours: %w", err)
+		}
+	}
+
+	for _, day := range days {
+		if err := rollupDay(ctx, tx, orgID, schedule, day); err != nil {
+			return 0, fmt.Errorf("day %s: %w", day.Format(businesstime.DateLayout), err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO metric_rollup_state (org_id, time_zone, hours, refreshed_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (org_id) DO UPDATE
+		SET time_zone = EXCLUDED.time_zone, hours = EXCLUDED.hours, refreshed_at = EXCLUDED.refreshed_at`,
+		orgID, loc.String(), hoursJSON, asOf,
+	); err != nil {
+		return 0, fmt.Errorf("save state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(days), nil
+}
+
+// localDay returns local midnight of the day containing t in loc.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// rollupDay recomputes the org's rollup rows for the local day starting at
+// day from its tickets and comments.
+func rollupDay(ctx context.Context, tx *sql.Tx, orgID string, schedule *businesstime.Schedule, day time.Time) error {
+	start, end := day, day.AddDate(0, 0, 1)
+	date := day.Format(businesstime.DateLayout)
+	inDay := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+	seconds := func(a, b time.Time) (int64, int64) {
+		if b.Before(a) {
+			b = a
+		}
+		return int64(b.Sub(a) / time.Second), int64(schedule.Between(a, b) / time.Second)
+	}
+
+	tickets := map[ticketRollupKey]*ticketRollup{}
+	agents := map[string]*agentRollup{}
+	agentRow := func(id string) *agentRollup {
+		if agents[id] == nil {
+			agents[id] = &agentRollup{}
+		}
+		return agents[id]
+	}
+
+	// Every ticket received, solved or first replied to on the day, with the
+	// first public agent reply and the number of public agent replies.
+	err := queryEach(ctx, tx, `
+		SELECT COALESCE(t.assignee_id::text, ''), COALESCE(`+ticketChannelExpr+`, ''),
+		       COALESCE(t.received_at, t.created_at), t.resolved_at, t.ai_temperature,
+		       fr.agent_author_id, fr.at,
+		       (SELECT COUNT(*) FROM ticket_comments tc WHERE tc.ticket_id = t.id AND `+agentReplyCond+`)
+		FROM tickets t
+		LEFT JOIN LATERAL (
+			SELECT tc.agent_author_id, COALESCE(tc.received_at, tc.created_at) AS at
+			FROM ticket_comments tc
+			WHERE tc.ticket_id = t.id AND `+agentReplyCond+`
+			  AND COALESCE(tc.received_at, tc.created_at) >= COALESCE(t.received_at, t.created_at)
+			ORDER BY 2, tc.id
+			LIMIT 1
+		) fr ON true
+		WHERE t.org_id = $1
+		  AND (COALESCE(t.received_at, t.created_at) >= $2 AND COALESCE(t.received_at, t.created_at) < $3
+		       OR t.resolved_at >= $2 AND t.resolved_at < $3
+		       OR t.id IN (SELECT tc.ticket_id FROM ticket_comments tc
+		                   WHERE COALESCE(tc.received_at, tc.created_at) >= $2
+		                     AND COALESCE(tc.received_at, tc.created_at) < $3
+		                     AND `+agentReplyCond+`))`,
+		[]any{orgID, start, end},
+		func(scan func(...any) error) error {
+			var key ticketRollupKey
+			var received time.Time
+			var resolved, respondedAt *time.Time
+			var temperature *int
+			var responder *string
+			var replies int
+			if err := scan(&key.assigneeID, &key.channel, &received, &resolved, &temperature,
+				&responder, &respondedAt, &replies); err != nil {
+				return err
+			}
+			m := tickets[key]
+			if m == nil {
+				m = &ticketRollup{}
+				tickets[key] = m
+			}
+			if inDay(received) {
+				m.created++
+			}
+			if resolved != nil && inDay(*resolved) {
+				m.solved++
+				if replies == 1 {
+					m.oneTouch++
+				}
+				raw, business := seconds(received, *resolved)
+				m.resolution = append(m.resolution, raw)
+				m.resolutionBusiness = append(m.resolutionBusiness, business)
+				if temperature != nil {
+					m.temperatureSum += *temperature
+					m.temperatureCount++
+				}
+			}
+			if respondedAt != nil && inDay(*respondedAt) {
+				raw, business := seconds(received, *respondedAt)
+				m.firstResponse = append(m.firstResponse, raw)
+				m.firstResponseBusiness = append(m.firstResponseBusiness, business)
+				if responder != nil {
+					a := agentRow(*responder)
+					a.firstResponse = append(a.firstResponse, raw)
+					a.firstResponseBusiness = append(a.firstResponseBusiness, business)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("tickets: %w", err)
+	}
+
+	err = queryEach(ctx, tx, `
+		SELECT tc.agent_author_id, COUNT(*)
+		FROM ticket_comments tc JOIN tickets t ON t.id = tc.ticket_id
+		WHERE t.org_id = $1 AND tc.agent_author_id IS NOT NULL AND `+agentReplyCond+`
+		  AND COALESCE(tc.received_at, tc.created_at) >= $2 AND COALESCE(tc.received_at, tc.created_at) < $3
+		GROUP BY 1`,
+		[]any{orgID, start, end},
+		func(scan func(...any) error) error {
+			var agentID string
+			var n int
+			if err := scan(&agentID, &n); err != nil {
+				return err
+			}
+			agentRow(agentID).replies = n
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("replies: %w", err)
+	}
+
+	err = queryEach(ctx, tx, `
+		SELECT tc.agent_author_id, COUNT(*), COALESCE(SUM(tc.call_duration), 0)
+		FROM ticket_comments tc
+		JOIN tickets t ON t.id = tc.ticket_id
+		JOIN agents ag ON ag.id = tc.agent_author_id
+		WHERE t.org_id = $1 AND tc.call_id IS NOT NULL AND ag.zendesk_user_id IS DISTINCT FROM -1
+		  AND COALESCE(tc.call_started_at, tc.received_at, tc.created_at) >= $2
+		  AND COALESCE(tc.call_started_at, tc.received_at, tc.created_at) < $3
+		GROUP BY 1`,
+		[]any{orgID, start, end},
+		func(scan func(...any) error) error {
+			var agentID string
+			var n int
+			var seconds int64
+			if err := scan(&agentID, &n, &seconds); err != nil {
+				return err
+			}
+			a := agentRow(agentID)
+			a.calls, a.callSeconds = n, seconds
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("calls: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM daily_ticket_metrics WHERE org_id = $1 AND day = $2`, orgID, date); err != nil {
+		return fmt.Errorf("clear ticket metrics: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM daily_agent_metrics WHERE org_id = $1 AND day = $2`, orgID, date); err != nil {
+		return fmt.Errorf("clear agent metrics: %w", err)
+	}
+	for key, m := range tickets {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO daily_ticket_metrics
+				(org_id, day, assignee_id, channel, created, solved, one_touch,
+				 first_response_seconds, first_response_business_seconds,
+				 resolution_seconds, resolution_business_seconds, temperature_sum, temperature_count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			orgID, date, nilIfEmpty(key.assigneeID), nilIfEmpty(key.channel), m.created, m.solved, m.oneTouch,
+			int64Array(m.firstResponse), int64Array(m.firstResponseBusiness),
+			int64Array(m.resolution), int64Array(m.resolutionBusiness), m.temperatureSum, m.temperatureCount,
+		); err != nil {
+			return fmt.Errorf("insert ticket metrics: %w", err)
+		}
+	}
+	for agentID, m := range agents {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO daily_agent_metrics
+				(org_id, day, agent_id, replies, calls, call_seconds,
+				 first_response_seconds, first_response_business_seconds)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			orgID, date, agentID, m.replies, m.calls, m.callSeconds,
+			int64Array(m.firstResponse), int64Array(m.firstResponseBusiness),
+		); err != nil {
+			return fmt.Errorf("insert agent metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// int64Array returns s, or an empty slice for nil so that it is stored as
+// '{}' rather than null.
+func int64Array(s []int64) []int64 {
+	if s == nil {
+		return []int64{}
+	}
+	return s
+}
@@ -0,0 +1,922 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+	"purl/api/internal/ratelimit"
+)
+
+// Routing strategies.
+const (
+	// routeRoundRobin assigns to each eligible agent in turn.
+	routeRoundRobin = "round_robin"
+	// routeLeastOpen assigns to the eligible agent with the fewest open tickets.
+	routeLeastOpen = "least_open"
+	// routeSkills assigns to the eligible agent whose skills match the most of
+	// the ticket's tags, then as least_open. Tickets no agent has a skill for
+	// are left unassigned.
+	routeSkills = "skills"
+)
+
+var routingStrategies = []string{routeRoundRobin, routeLeastOpen, routeSkills}
+
+// routingPolicy decides who new, unassigned tickets are assigned to.
+type routingPolicy struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	// Position orders policies, ascending. The first enabled policy that
+	// matches a ticket routes it.
+	Position int `json:"position"`
+	// Strategy is round_robin, least_open or skills.
+	Strategy string `json:"strategy"`
+	// MatchTags limits the policy to tickets with any of these tags. Empty
+	// matches every ticket.
+	MatchTags []string `json:"match_tags"`
+	// AgentIDs is the pool the policy assigns to. Empty means every agent.
+	AgentIDs []string `json:"agent_ids"`
+	// LastAgentID is the agent the policy assigned last.
+	LastAgentID *string `json:"last_agent_id"`
+}
+
+type createRoutingPolicyRequest struct {
+	Name string `json:"name"`
+	// Enabled defaults to true.
+	Enabled   *bool    `json:"enabled"`
+	Position  int      `json:"position"`
+	Strategy  string   `json:"strategy"`
+	MatchTags []string `json:"match_tags"`
+	AgentIDs  []string `json:"agent_ids"`
+}
+
+// updateRoutingPolicyRequest replaces only the fields that are present.
+type updateRoutingPolicyRequest struct {
+	Name      *string   `json:"name"`
+	Enabled   *bool     `json:"enabled"`
+	Position  *int      `json:"position"`
+	Strategy  *string   `json:"strategy"`
+	MatchTags *[]string `json:"match_tags"`
+	AgentIDs  *[]string `json:"agent_ids"`
+}
+
+// agentRouting is an agent's routing settings and current load.
+type agentRouting struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	// Available is false while the agent is paused.
+	Available bool `json:"available"`
+	// MaxOpenTickets caps the agent's open tickets; null for no limit.
+	MaxOpenTickets *int `json:"max_open_tickets"`
+	// Skills are the tags the agent handles, for the skills strategy.
+	Skills []string `json:"skills"`
+	// OpenTickets counts the new, open and pending tickets assigned to the agent.
+	OpenTickets int `json:"open_tickets"`
+}
+
+// putAgentRoutingRequest replaces an agent's routing settings.
+type putAgentRoutingRequest struct {
+	Available      bool     `json:"available"`
+	MaxOpenTickets *int     `json:"max_open_tickets"`
+	Skills         []string `json:"skills"`
+}
+
+// openTicketStatuses are the statuses that count towards an agent's load.
+const openTicketStatuses = `('new', 'open', 'pending')`
+
+const routingPolicySelect = `
+	SELECT p.id, p.created_at, p.updated_at, p.name, p.enabled, p.position, p.strategy::text,
+	       to_json(p.match_tags),
+	       COALESCE((SELECT json_agg(pa.agent_id ORDER BY pa.agent_id)
+	                 FROM routing_policy_agents pa WHERE pa.policy_id = p.id), '[]'),
+	       p.last_agent_id
+	FROM routing_policies p`
+
+func scanRoutingPolicy(row rowScanner) (routingPolicy, error) {
+	var p routingPolicy
+	var matchTags, agentIDs []byte
+	if err := row.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.Name, &p.Enabled, &p.Position, &p.Strategy,
+		&matchTags, &agentIDs, &p.LastAgentID); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(matchTags, &p.MatchTags); err != nil {
+		return p, err
+	}
+	return p, json.Unmarshal(agentIDs, &p.AgentIDs)
+}
+
+// auditSnapshot returns the audited view of a policy.
+func (p routingPolicy) auditSnapshot() map[string]any {
+	return map[string]any{
+		"name": p.Name, "enabled": p.Enabled, "position": p.Position, "strategy": p.Strategy,
+		"match_tags": p.MatchTags, "agent_ids": p.AgentIDs,
+	}
+}
+
+// validateRoutingPolicy checks and normalizes p, returning a client-facing
+// message if it is invalid.
+func validateRoutingPolicy(ctx context.Context, q queryer, p *routingPolicy) string {
+	if strings.TrimSpace(p.Name) == "" {
+		return "name is required"
+	}
+	if p.Position < 0 {
+		return "position must not be negative"
+	}
+	if !slices.Contains(routingStrategies, p.Strategy) {
+		return "strategy must be one of " + strings.Join(routingStrategies, ", ")
+	}
+	tags, err := normalizeTags(p.MatchTags)
+	if err != nil {
+		return "match_tags: " + err.Error()
+	}
+	p.MatchTags = tags
+	ids, err := validateMentions(ctx, q, p.AgentIDs)
+	if err != nil {
+		return strings.Replace(err.Error(), "mentions:", "agent_ids:", 1)
+	}
+	p.AgentIDs = ids
+	return ""
+}
+
+// setRoutingPolicyAgents replaces the policy's agent pool with agentIDs.
+func setRoutingPolicyAgents(ctx context.Context, ex execer, policyID string, agentIDs []string) error {
+	if _, err := ex.ExecContext(ctx,
+		`DELETE FROM routing_policy_agents WHERE policy_id = $1 AND NOT (agent_id = ANY($2))`,
+		policyID, agentIDs,
+	); err != nil {
+		return fmt.Errorf("delete policy agents: %w", err)
+	}
+	if _, err := ex.ExecContext(ctx, `
+		INSERT INTO routing_policy_agents (policy_id, agent_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT DO NOTHING`,
+		policyID, agentIDs,
+	); err != nil {
+		return fmt.Errorf("insert policy agents: %w", err)
+	}
+	return nil
+}
+
+// loadRoutingPolicy loads the policyID URL param. Writes a 404 (or 500) and
+// returns false if it doesn't exist.
+func loadRoutingPolicy(w http.ResponseWriter, r *http.Request, q queryer, forUpdate bool) (routingPolicy, bool) {
+	policyID := chi.URLParam(r, "policyID")
+	if !reUUID.MatchString(policyID) {
+		http.Error(w, "routing policy not found", http.StatusNotFound)
+		return routingPolicy{}, false
+	}
+	query := routingPolicySelect + ` WHERE p.id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE OF p`
+	}
+	p, err := scanRoutingPolicy(q.QueryRowContext(r.Context(), query, policyID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "routing policy not found", http.StatusNotFound)
+		return p, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadRoutingPolicy: %v", err)
+		return p, false
+	}
+	return p, true
+}
+
+// @Summary     List routing policies
+// @Tags        Routing
+// @Description Returns the org's routing policies in the order they are tried
+// @Produce     json
+// @Success     200  {array}   routingPolicy
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /routing-policies [get]
+func (a *App) listRoutingPolicies(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(),
+		routingPolicySelect+` ORDER BY p.position, p.created_at, p.id`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listRoutingPolicies query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	policies := []routingPolicy{}
+	for rows.Next() {
+		p, err := scanRoutingPolicy(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listRoutingPolicies scan: %v", err)
+			return
+		}
+		policies = append(policies, p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// @Summary     Create a routing policy
+// @Tags        Routing
+// @Description Creates a policy for assigning new, unassigned tickets as they arrive from Zendesk. The first
+// @Description enabled policy (by position) matching the ticket's tags picks an agent from its pool who is
+// @Description available, under capacity and has a Zendesk user, and the assignment is written back to Zendesk.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createRoutingPolicyRequest  true  "Policy to create"
+// @Success     201   {object}  routingPolicy
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /routing-policies [post]
+func (a *App) createRoutingPolicy(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createRoutingPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	p := routingPolicy{
+		Name: req.Name, Enabled: req.Enabled == nil || *req.Enabled, Position: req.Position,
+		Strategy: req.Strategy, MatchTags: req.MatchTags, AgentIDs: req.AgentIDs,
+	}
+	conn := a.conn(r.Context())
+	if msg := validateRoutingPolicy(r.Context(), conn, &p); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var policyID string
+	if err := tx.QueryRowContext(r.Context(), `
+		INSERT INTO routing_policies (org_id, name, enabled, position, strategy, match_tags)
+		VALUES ($1, $2, $3, $4, $5::routing_strategy, $6)
+		RETURNING id`,
+		o.ID, p.Name, p.Enabled, p.Position, p.Strategy, p.MatchTags,
+	).Scan(&policyID); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy insert: %v", err)
+		return
+	}
+	if err := setRoutingPolicyAgents(r.Context(), tx, policyID, p.AgentIDs); err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy agents: %v", err)
+		return
+	}
+	p, err = scanRoutingPolicy(tx.QueryRowContext(r.Context(), routingPolicySelect+` WHERE p.id = $1`, policyID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy read back: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "routing_policy.create",
+		TargetType: "routing_policy",
+		TargetID:   p.ID,
+		After:      p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createRoutingPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.RoutingPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Get a routing policy
+// @Tags        Routing
+// @Produce     json
+// @Param       policyID  path      string  true  "Policy ID"
+// @Success     200       {object}  routingPolicy
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /routing-policies/{policyID} [get]
+func (a *App) getRoutingPolicy(w http.ResponseWriter, r *http.Request) {
+	p, ok := loadRoutingPolicy(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Update a routing policy
+// @Tags        Routing
+// @Description Updates the fields present in the body. match_tags and agent_ids, if present, are replaced.
+// @Accept      json
+// @Produce     json
+// @Param       policyID  path      string                      true  "Policy ID"
+// @Param       body      body      updateRoutingPolicyRequest  true  "Fields to update"
+// @Success     200       {object}  routingPolicy
+// @Failure     400       {string}  string  "Bad Request"
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /routing-policies/{policyID} [patch]
+func (a *App) updateRoutingPolicy(w http.ResponseWriter, r *http.Request) {
+	var req updateRoutingPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := loadRoutingPolicy(w, r, tx, true)
+	if !ok {
+		return
+	}
+	next := old
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	if req.Position != nil {
+		next.Position = *req.Position
+	}
+	if req.Strategy != nil {
+		next.Strategy = *req.Strategy
+	}
+	if req.MatchTags != nil {
+		next.MatchTags = *req.MatchTags
+	}
+	if req.AgentIDs != nil {
+		next.AgentIDs = *req.AgentIDs
+	}
+	if msg := validateRoutingPolicy(r.Context(), tx, &next); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), `
+		UPDATE routing_policies
+		SET name = $2, enabled = $3, position = $4, strategy = $5::routing_strategy, match_tags = $6
+		WHERE id = $1`,
+		old.ID, next.Name, next.Enabled, next.Position, next.Strategy, next.MatchTags,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy update: %v", err)
+		return
+	}
+	if err := setRoutingPolicyAgents(r.Context(), tx, old.ID, next.AgentIDs); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy agents: %v", err)
+		return
+	}
+	p, err := scanRoutingPolicy(tx.QueryRowContext(r.Context(), routingPolicySelect+` WHERE p.id = $1`, old.ID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy read back: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "routing_policy.update",
+		TargetType: "routing_policy",
+		TargetID:   p.ID,
+		Before:     old.auditSnapshot(),
+		After:      p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateRoutingPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.RoutingPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Delete a routing policy
+// @Tags        Routing
+// @Param       policyID  path      string  true  "Policy ID"
+// @Success     204
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /routing-policies/{policyID} [delete]
+func (a *App) deleteRoutingPolicy(w http.ResponseWriter, r *http.Request) {
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteRoutingPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, ok := loadRoutingPolicy(w, r, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM routing_policies WHERE id = $1`, p.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteRoutingPolicy delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "routing_policy.delete",
+		TargetType: "routing_policy",
+		TargetID:   p.ID,
+		Before:     p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteRoutingPolicy audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteRoutingPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.RoutingPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+const agentRoutingSelect = `
+	SELECT ag.id, ag.name, ag.email, COALESCE(ar.available, true), ar.max_open_tickets,
+	       to_json(COALESCE(ar.skills, '{}')),
+	       (SELECT COUNT(*) FROM tickets t
+	        WHERE t.assignee_id = ag.id AND t.zendesk_status IN ` + openTicketStatuses + `)
+	FROM agents ag
+	LEFT JOIN agent_routing ar ON ar.agent_id = ag.id`
+
+func scanAgentRouting(row rowScanner) (agentRouting, error) {
+	var ar agentRouting
+	var skills []byte
+	if err := row.Scan(&ar.AgentID, &ar.Name, &ar.Email, &ar.Available, &ar.MaxOpenTickets, &skills, &ar.OpenTickets); err != nil {
+		return ar, err
+	}
+	return ar, json.Unmarshal(skills, &ar.Skills)
+}
+
+// auditSnapshot returns the audited view of an agent's routing settings.
+func (ar agentRouting) auditSnapshot() map[string]any {
+	return map[string]any{"available": ar.Available, "max_open_tickets": ar.MaxOpenTickets, "skills": ar.Skills}
+}
+
+// @Summary     List agents' routing settings
+// @Tags        Routing
+// @Description Returns every agent that tickets can be routed to (those with a Zendesk user), with their
+// @Description availability, capacity, skills and current open-ticket count
+// @Produce     json
+// @Success     200  {array}   agentRouting
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /agents/routing [get]
+func (a *App) listAgentRouting(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(),
+		agentRoutingSelect+` WHERE ag.zendesk_user_id > 0 ORDER BY ag.name, ag.id`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listAgentRouting query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	agents := []agentRouting{}
+	for rows.Next() {
+		ar, err := scanAgentRouting(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listAgentRouting scan: %v", err)
+			return
+		}
+		agents = append(agents, ar)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agents)
+}
+
+// setAgentRouting applies change to the agentID URL param's routing settings,
+// audits it as action and writes the result.
+func (a *App) setAgentRouting(w http.ResponseWriter, r *http.Request, action string, change func(*agentRouting)) {
+	agentID := chi.URLParam(r, "agentID")
+	if !reUUID.MatchString(agentID) {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	conn := a.conn(r.Context())
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("setAgentRouting begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, err := scanAgentRouting(tx.QueryRowContext(r.Context(),
+		agentRoutingSelect+` WHERE ag.id = $1 FOR UPDATE OF ag`, agentID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("setAgentRouting load: %v", err)
+		return
+	}
+	next := old
+	change(&next)
+
+	if _, err := tx.ExecContext(r.Context(), `
+		INSERT INTO agent_routing (agent_id, available, max_open_tickets, skills)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (agent_id) DO UPDATE SET
+			available        = EXCLUDED.available,
+			max_open_tickets = EXCLUDED.max_open_tickets,
+			skills           = EXCLUDED.skills`,
+		agentID, next.Available, next.MaxOpenTickets, next.Skills,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("setAgentRouting upsert: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     action,
+		TargetType: "agent",
+		TargetID:   agentID,
+		Before:     old.auditSnapshot(),
+		After:      next.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("setAgentRouting audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("setAgentRouting commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.AgentRoutingUpdated, map[string]string{"agent_id": agentID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(next)
+}
+
+// @Summary     Set an agent's routing settings
+// @Tags        Routing
+// @Description Replaces the agent's availability, capacity (max_open_tickets, null for no limit) and skills
+// @Accept      json
+// @Produce     json
+// @Param       agentID  path      string                  true  "Agent ID"
+// @Param       body     body      putAgentRoutingRequest  true  "Routing settings"
+// @Success     200      {object}  agentRouting
+// @Failure     400      {string}  string  "Bad Request"
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /agents/{agentID}/routing [put]
+func (a *App) putAgentRouting(w http.ResponseWriter, r *http.Request) {
+	var req putAgentRoutingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MaxOpenTickets != nil && *req.MaxOpenTickets < 0 {
+		http.Error(w, "max_open_tickets must not be negative", http.StatusBadRequest)
+		return
+	}
+	skills, err := normalizeTags(req.Skills)
+	if err != nil {
+		http.Error(w, "skills: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.setAgentRouting(w, r, "agent.routing.update", func(ar *agentRouting) {
+		ar.Available, ar.MaxOpenTickets, ar.Skills = req.Available, req.MaxOpenTickets, skills
+	})
+}
+
+// @Summary     Pause an agent
+// @Tags        Routing
+// @Description Stops routing new tickets to the agent until they are resumed. Tickets already assigned stay.
+// @Produce     json
+// @Param       agentID  path      string  true  "Agent ID"
+// @Success     200      {object}  agentRouting
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /agents/{agentID}/pause [put]
+func (a *App) pauseAgent(w http.ResponseWriter, r *http.Request) {
+	a.setAgentRouting(w, r, "agent.pause", func(ar *agentRouting) { ar.Available = false })
+}
+
+// @Summary     Resume an agent
+// @Tags        Routing
+// @Description Makes a paused agent available for routing again
+// @Produce     json
+// @Param       agentID  path      string  true  "Agent ID"
+// @Success     200      {object}  agentRouting
+// @Failure     401      {string}  string  "Unauthorized"
+// @Failure     404      {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /agents/{agentID}/pause [delete]
+func (a *App) resumeAgent(w http.ResponseWriter, r *http.Request) {
+	a.setAgentRouting(w, r, "agent.resume", func(ar *agentRouting) { ar.Available = true })
+}
+
+// routingCandidate is an agent a policy could assign a ticket to.
+type routingCandidate struct {
+	id            string
+	zendeskUserID int64
+	skills        []string
+	openTickets   int
+}
+
+// routeNewTicket assigns a new, unassigned, unresolved ticket using the first
+// enabled policy of orgID that matches it, writing the assignment back to
+// Zendesk. It does nothing if no policy matches or no agent is eligible. It
+// must be called after the ticket has committed.
+//
+// db is the owner connection; limiter may be nil to skip rate limiting and
+// bus may be nil to skip publishing change events.
+func routeNewTicket(ctx context.Context, db *sql.DB, orgID, ticketID string, limiter *ratelimit.Limiter, bus *events.Bus) error {
+	var zendeskTicketID *int64
+	var assigneeID *string
+	var status string
+	var tagsJSON []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT t.zendesk_ticket_id, t.assignee_id, COALESCE(t.zendesk_status::text, ''),
+		       COALESCE((SELECT json_agg(tg.name)
+		                 FROM ticket_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		                 WHERE tt.ticket_id = t.id), '[]')
+		FROM tickets t
+		WHERE t.id = $1`,
+		ticketID,
+	).Scan(&zendeskTicketID, &assigneeID, &status, &tagsJSON)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load ticket: %w", err)
+	}
+	if zendeskTicketID == nil || assigneeID != nil || status == "solved" || status == "closed" {
+		return nil
+	}
+	var tags []string
+	if err := json.Unmarshal(tagsJSON, &tags); err != nil {
+		return fmt.Errorf("parse tags: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, routingPolicySelect+`
+		WHERE p.org_id = $1 AND p.enabled
+		ORDER BY p.position, p.created_at, p.id`, orgID)
+	if err != nil {
+		return fmt.Errorf("load policies: %w", err)
+	}
+	var policy *routingPolicy
+	for rows.Next() {
+		p, err := scanRoutingPolicy(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan policy: %w", err)
+		}
+		if len(p.MatchTags) == 0 || slices.ContainsFunc(p.MatchTags, func(t string) bool { return slices.Contains(tags, t) }) {
+			policy = &p
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate policies: %w", err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	chosen, prevAgentID, err := claimRoutingAgent(ctx, db, orgID, ticketID, *policy, tags)
+	if err != nil || chosen == nil {
+		return err
+	}
+	bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+
+	// The assignment is written back outside the policy lock, since it may
+	// wait on the rate limit. If it fails, the ticket is unassigned again
+	// unless it has been reassigned meanwhile.
+	_, err = zendeskTicketUpdate(ctx, db, orgID, *zendeskTicketID, map[string]any{"assignee_id": chosen.zendeskUserID}, limiter)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, errZendeskNotConfigured) {
+		err = nil
+	} else {
+		err = fmt.Errorf("assign in zendesk: %w", err)
+	}
+	if revertErr := unclaimRoutingAgent(context.WithoutCancel(ctx), db, ticketID, policy.ID, chosen.id, prevAgentID); revertErr != nil {
+		return errors.Join(err, revertErr)
+	}
+	bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+	return err
+}
+
+// claimRoutingAgent chooses the agent policy assigns the ticket to, assigns
+// it locally and advances the policy's round robin, in one short transaction
+// holding the policy's row lock so that concurrent routing sees each other's
+// assignments in capacity counts and round-robin order. chosen is nil if the
+// ticket was assigned meanwhile, the policy was disabled or no agent is
+// eligible. prevAgentID is the policy's last agent before the advance.
+func claimRoutingAgent(ctx context.Context, db *sql.DB, orgID, ticketID string, policy routingPolicy, tags []string) (chosen *routingCandidate, prevAgentID *string, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT last_agent_id FROM routing_policies WHERE id = $1 AND enabled FOR UPDATE`, policy.ID,
+	).Scan(&policy.LastAgentID)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("lock policy: %w", err)
+	}
+	var unassigned bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT assignee_id IS NULL FROM tickets WHERE id = $1 FOR UPDATE`, ticketID,
+	).Scan(&unassigned); err != nil {
+		return nil, nil, fmt.Errorf("lock ticket: %w", err)
+	}
+	if !unassigned {
+		return nil, nil, nil
+	}
+
+	candidates, err := routingCandidates(ctx, tx, orgID, policy.AgentIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	chosen = chooseRoutingCandidate(policy, candidates, tags)
+	if chosen == nil {
+		log.Printf("routing: ticket %s: policy %s found no eligible agent", ticketID, policy.ID)
+		return nil, nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE tickets SET assignee_id = $1 WHERE id = $2`, chosen.id, ticketID,
+	); err != nil {
+		return nil, nil, fmt.Errorf("assign: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE routing_policies SET last_agent_id = $1 WHERE id = $2`, chosen.id, policy.ID,
+	); err != nil {
+		return nil, nil, fmt.Errorf("advance policy: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("commit: %w", err)
+	}
+	return chosen, policy.LastAgentID, nil
+}
+
+// unclaimRoutingAgent undoes claimRoutingAgent after its write-back failed:
+// the ticket is unassigned if still assigned to agentID, and the policy's
+// round robin is moved back if nothing has advanced it since.
+func unclaimRoutingAgent(ctx context.Context, db *sql.DB, ticketID, policyID, agentID string, prevAgentID *string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE tickets SET assignee_id = NULL WHERE id = $1 AND assignee_id = $2`, ticketID, agentID,
+	); err != nil {
+		return fmt.Errorf("unassign: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE routing_policies SET last_agent_id = $1 WHERE id = $2 AND last_agent_id = $3`, prevAgentID, policyID, agentID,
+	); err != nil {
+		return fmt.Errorf("rewind policy: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// routingCandidates returns the agents of orgID, limited to pool if it isn't
+// empty, that can take a ticket now: they have a Zendesk user, aren't paused
+// and are under capacity. They are ordered by ID.
+func routingCandidates(ctx context.Context, q queryer, orgID string, pool []string) ([]routingCandidate, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT ag.id, ag.zendesk_user_id, to_json(COALESCE(ar.skills, '{}')), ar.max_open_tickets,
+		       (SELECT COUNT(*) FROM tickets t
+		        WHERE t.assignee_id = ag.id AND t.zendesk_status IN `+openTicketStatuses+`)
+		FROM agents ag
+		LEFT JOIN agent_routing ar ON ar.agent_id = ag.id
+		WHERE ag.org_id = $1 AND ag.zendesk_user_id > 0 AND COALESCE(ar.available, true)
+		  AND (cardinality($2::uuid[]) = 0 OR ag.id = ANY($2))
+		ORDER BY ag.id`,
+		orgID, pool,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []routingCandidate
+	for rows.Next() {
+		var c routingCandidate
+		var skills []byte
+		var maxOpen *int
+		if err := rows.Scan(&c.id, &c.zendeskUserID, &skills, &maxOpen, &c.openTickets); err != nil {
+			return nil, fmt.Errorf("scan candidate: %w", err)
+		}
+		if maxOpen != nil && c.openTickets >= *maxOpen {
+			continue
+		}
+		if err := json.Unmarshal(skills, &c.skills); err != nil {
+			return nil, fmt.Errorf("parse skills: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// chooseRoutingCandidate picks the agent p assigns a ticket with tags to from
+// candidates (ordered by ID), or nil if none fits.
+func chooseRoutingCandidate(p routingPolicy, candidates []routingCandidate, tags []string) *routingCandidate {
+	if len(candidates) == 0 {
+		return nil
+	}
+	switch p.Strategy {
+	case routeRoundRobin:
+		// The first agent after the last one assigned, wrapping around.
+		if p.LastAgentID != nil {
+			for i := range candidates {
+				if candidates[i].id > *p.LastAgentID {
+					return &candidates[i]
+				}
+			}
+		}
+		return &candidates[0]
+	case routeSkills:
+		var best *routingCandidate
+		bestScore := 0
+		for i := range candidates {
+			c := &candidates[i]
+			score := 0
+			for _, s := range c.skills {
+				if slices.Contains(tags, s) {
+					score++
+				}
+			}
+			if score > bestScore || (score == bestScore && score > 0 && c.openTickets < best.openTickets) {
+				best, bestScore = c, score
+			}
+		}
+		return best
+	default: // routeLeastOpen
+		best := &candidates[0]
+		for i := range candidates[1:] {
+			if c := &candidates[i+1]; c.openTickets < best.openTickets {
+				best = c
+			}
+		}
+		return best
+	}
+}
@@ -0,0 +1,293 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinels passed to ts_headline as StartSel/StopSel. The fragment is
+// HTML-escaped in Go and the sentinels then replaced with <mark> tags, so
+// ticket text can never inject markup.
+const (
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+const headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \""
+
+// commentsPerResult caps how many matching comments are returned per ticket.
+const commentsPerResult = 3
+
+type searchCommentHit struct {
+	ID string `json:"id"`
+	// Highlight is an HTML fragment with matches wrapped in <mark>; all other text is escaped.
+	Highlight  string    `json:"highlight"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type searchResult struct {
+	Ticket ticketRow `json:"ticket"`
+	Rank   float64   `json:"rank"`
+	// Highlights maps field name (title, ai_summary, description) to an HTML
+	// fragment with matches wrapped in <mark>. Only fields that matched appear.
+	Highlights map[string]string `json:"highlights"`
+	// Comments are the best-matching comments on the ticket, if any matched.
+	Comments []searchCommentHit `json:"comments"`
+}
+
+type searchResponse struct {
+	Results []searchResult `json:"results"`
+}
+
+// @Summary     Search tickets
+// @Tags        Tickets
+// @Description Full-text search over ticket titles, descriptions, AI summaries, comment bodies and call
+// @Description transcriptions, ranked by relevance. Free text supports "quoted phrases", or, and -exclusions.
+// @Description Filters: from:<name|email>, status:<status>, assignee:<name|email|me|none>,
+// @Description after:YYYY-MM-DD, before:YYYY-MM-DD, date:YYYY-MM-DD[..YYYY-MM-DD]. Quote values with spaces.
+// @Description Highlights are HTML with matches wrapped in <mark>.
+// @Produce     json
+// @Param       q       query     string  true   "Search query"
+// @Param       limit   query     int     false  "Page size (default 25, max 100)"
+// @Param       offset  query     int     false  "Results to skip"
+// @Success     200  {object}  searchResponse
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /search [get]
+func (a *App) searchTickets(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	params := r.URL.Query()
+
+	sq, err := parseSearchQuery(params.Get("q"))
+	if err != nil {
+		http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sq.Text == "" && len(sq.From) == 0 && len(sq.Statuses) == 0 && len(sq.Assignees) == 0 && sq.After == nil && sq.Before == nil {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := 25, 0
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, 100)
+	}
+	if v := params.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	// $1 is always the org and $2 the tsquery text (possibly empty).
+	args := []any{o.ID, sq.Text}
+	where := []string{"t.org_id = $1"}
+	addArg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if sq.Text != "" {
+		where = append(where, `(t.search_vector @@ q.query OR EXISTS (
+			SELECT 1 FROM ticket_comments tc WHERE tc.ticket_id = t.id AND tc.search_vector @@ q.query))`)
+	}
+	if len(sq.Statuses) > 0 {
+		where = append(where, "t.zendesk_status::text = ANY("+addArg(sq.Statuses)+")")
+	}
+	for _, v := range sq.From {
+		p := addArg("%" + likeEscaper.Replace(v) + "%")
+		where = append(where, fmt.Sprintf(`(EXISTS (
+			SELECT 1 FROM customers c
+			LEFT JOIN customer_emails ce ON ce.customer_id = c.id
+			WHERE c.id = t.reporter_id AND (c.name ILIKE %[1]s ESCAPE '\' OR ce.email ILIKE %[1]s ESCAPE '\'))
+		OR EXISTS (
+			SELECT 1 FROM ticket_comments tc
+			LEFT JOIN customers c ON c.id = tc.customer_author_id
+			LEFT JOIN customer_emails ce ON ce.customer_id = c.id
+			LEFT JOIN agents ag ON ag.id = tc.agent_author_id
+			WHERE tc.ticket_id = t.id
+			  AND (c.name ILIKE %[1]s ESCAPE '\' OR ce.email ILIKE %[1]s ESCAPE '\'
+			       OR ag.name ILIKE %[1]s ESCAPE '\' OR ag.email ILIKE %[1]s ESCAPE '\')))`, p))
+	}
+	for _, v := range sq.Assignees {
+		switch strings.ToLower(v) {
+		case "none":
+			where = append(where, "t.assignee_id IS NULL")
+		case "me":
+			ag, ok := agentFromContext(r.Context())
+			if !ok {
+				http.Error(w, "assignee:me requires the x-agent-id header", http.StatusBadRequest)
+				return
+			}
+			where = append(where, "t.assignee_id = "+addArg(ag.ID))
+		default:
+			p := addArg("%" + likeEscaper.Replace(v) + "%")
+			where = append(where, fmt.Sprintf(
+				`EXISTS (SELECT 1 FROM agents ag WHERE ag.id = t.assignee_id AND (ag.name ILIKE %[1]s ESCAPE '\' OR ag.email ILIKE %[1]s ESCAPE '\'))`, p))
+		}
+	}
+	if sq.After != nil {
+		where = append(where, "COALESCE(t.received_at, t.created_at) >= "+addArg(*sq.After))
+	}
+	if sq.Before != nil {
+		where = append(where, "COALESCE(t.received_at, t.created_at) < "+addArg(*sq.Before))
+	}
+	limitArg, offsetArg := addArg(limit), addArg(offset)
+
+	conn := a.conn(r.Context())
+
+	// Rank tickets by their own match plus their best comment match, weighted
+	// lower. Without free text, rank is 0 and results are newest first.
+	rows, err := conn.QueryContext(r.Context(), `
+		WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+		SELECT t.id,
+		       CASE WHEN $2 = '' THEN 0 ELSE
+		           ts_rank(t.search_vector, q.query) + 0.5 * COALESCE((
+		               SELECT MAX(ts_rank(tc.search_vector, q.query))
+		               FROM ticket_comments tc
+		               WHERE tc.ticket_id = t.id AND tc.search_vector @@ q.query), 0)
+		       END AS rank,
+		       CASE WHEN $2 <> '' AND to_tsvector('english', COALESCE(t.title, '')) @@ q.query
+		            THEN ts_headline('english', t.title, q.query, '`+headlineOptions+`') END,
+		       CASE WHEN $2 <> '' AND to_tsvector('english', COALESCE(t.ai_summary, '')) @@ q.query
+		            THEN ts_headline('english', t.ai_summary, q.query, '`+headlineOptions+`') END,
+		       CASE WHEN $2 <> '' AND to_tsvector('english', COALESCE(t.description, '')) @@ q.query
+		            THEN ts_headline('english', t.description, q.query, '`+headlineOptions+`') END
+		FROM tickets t, q
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY rank DESC, COALESCE(t.received_at, t.created_at) DESC, t.id
+		LIMIT `+limitArg+` OFFSET `+offsetArg, args...)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("searchTickets query: %v", err)
+		return
+	}
+
+	resp := searchResponse{Results: []searchResult{}}
+	var ids []string
+	for rows.Next() {
+		var id string
+		var rank float64
+		var title, summary, description *string
+		if err := rows.Scan(&id, &rank, &title, &summary, &description); err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("searchTickets scan: %v", err)
+			return
+		}
+		res := searchResult{Rank: rank, Highlights: map[string]string{}, Comments: []searchCommentHit{}}
+		for field, h := range map[string]*string{"title": title, "ai_summary": summary, "description": description} {
+			if h != nil {
+				res.Highlights[field] = renderHeadline(*h)
+			}
+		}
+		resp.Results = append(resp.Results, res)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("searchTickets iterate: %v", err)
+		return
+	}
+
+	if len(ids) > 0 {
+		if err := fillSearchResults(r.Context(), conn, o.ID, sq.Text, ids, resp.Results); err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("searchTickets fill: %v", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// fillSearchResults loads the ticket rows (with their waiting times) and
+// matching comments for ids, in place into results (which is in the same order
+// as ids).
+func fillSearchResults(ctx context.Context, q queryer, orgID, text string, ids []string, results []searchResult) error {
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	rows, err := q.QueryContext(ctx, ticketSelect+`
+		WHERE t.id = ANY($1)
+	`, ids)
+	if err != nil {
+		return fmt.Errorf("load tickets: %w", err)
+	}
+	var tickets []ticketRow
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan ticket: %w", err)
+		}
+		tickets = append(tickets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := setWaitingTimes(ctx, q, orgID, tickets); err != nil {
+		return fmt.Errorf("waiting times: %w", err)
+	}
+	for _, t := range tickets {
+		results[index[t.ID]].Ticket = t
+	}
+
+	if text == "" {
+		return nil
+	}
+	rows, err = q.QueryContext(ctx, `
+		WITH q AS (SELECT websearch_to_tsquery('english', $2) AS query)
+		SELECT tc.ticket_id, tc.id,
+		       ts_headline('english', COALESCE(tc.body, '') || ' ' || COALESCE(tc.transcription_text, ''), q.query, '`+headlineOptions+`'),
+		       COALESCE(tc.received_at, tc.created_at)
+		FROM ticket_comments tc, q
+		WHERE tc.ticket_id = ANY($1) AND tc.search_vector @@ q.query
+		ORDER BY tc.ticket_id, ts_rank(tc.search_vector, q.query) DESC`, ids, text)
+	if err != nil {
+		return fmt.Errorf("load comments: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ticketID, headline string
+		var hit searchCommentHit
+		if err := rows.Scan(&ticketID, &hit.ID, &headline, &hit.ReceivedAt); err != nil {
+			return fmt.Errorf("scan comment: %w", err)
+		}
+		res := &results[index[ticketID]]
+		if len(res.Comments) >= commentsPerResult {
+			continue
+		}
+		hit.Highlight = renderHeadline(headline)
+		res.Comments = append(res.Comments, hit)
+	}
+	return rows.Err()
+}
+
+// renderHeadline HTML-escapes a ts_headline fragment and turns the sentinel
+// match delimiters into <mark> tags.
+func renderHeadline(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, headlineStart, "<mark>")
+	return strings.ReplaceAll(s, headlineStop, "</mark>")
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// searchQuery is a parsed GET /search query string.
+//
+// Syntax: free text uses Postgres websearch syntax — bare words are ANDed,
+// "quoted phrases" match in order, "or" between terms means OR and a leading
+// "-" excludes a term. These filters may appear anywhere in the query:
+//
+//	from:<name or email>     reporter or any comment author matches (substring)
+//	status:<status>          Zendesk status; repeat to match any of several
+//	assignee:<name or email> assigned agent matches (substring); "me" or "none"
+//	after:YYYY-MM-DD         received on or after the date
+//	before:YYYY-MM-DD        received before the date
+//	date:YYYY-MM-DD[..YYYY-MM-DD]  received on the date, or within the inclusive range
+//
+// Filter values containing spaces may be quoted: from:"Jane Doe". Dates are UTC.
+type searchQuery struct {
+	// Text is the free-text portion in websearch_to_tsquery syntax; may be empty.
+	Text      string
+	From      []string
+	Statuses  []string
+	Assignees []string
+	// After is inclusive, Before exclusive.
+	After  *time.Time
+	Before *time.Time
+}
+
+var reSearchFilter = regexp.MustCompile(`^([a-z]+):(.+)$`)
+
+var validStatuses = map[string]bool{"new": true, "open": true, "pending": true, "solved": true, "closed": true}
+
+// parseSearchQuery splits s into free text and filters. Unrecognised field
+// prefixes are left in the free text.
+func parseSearchQuery(s string) (searchQuery, error) {
+	var q searchQuery
+	var text []string
+
+	for _, tok := range tokenizeSearch(s) {
+		m := reSearchFilter.FindStringSubmatch(tok)
+		if m == nil {
+			text = append(text, tok)
+			continue
+		}
+		field, value := m[1], strings.Trim(m[2], `"`)
+		if value == "" {
+			return q, fmt.Errorf("%s: missing value", field)
+		}
+		switch field {
+		case "from":
+			q.From = append(q.From, value)
+		case "status":
+			// "hold" is accepted as Zendesk's name for what we store as pending.
+			if s := strings.ToLower(value); !validStatuses[s] && s != "hold" {
+				return q, fmt.Errorf("status: unknown status %q", value)
+			}
+			q.Statuses = append(q.Statuses, mapZendeskStatus(value))
+		case "assignee":
+			q.Assignees = append(q.Assignees, value)
+		case "after":
+			d, err := parseSearchDate(value)
+			if err != nil {
+				return q, fmt.Errorf("after: %w", err)
+			}
+			q.After = laterOf(q.After, d)
+		case "before":
+			d, err := parseSearchDate(value)
+			if err != nil {
+				return q, fmt.Errorf("before: %w", err)
+			}
+			q.Before = earlierOf(q.Before, d)
+		case "date":
+			from, to, isRange := strings.Cut(value, "..")
+			if !isRange {
+				to = from
+			}
+			if from != "" {
+				d, err := parseSearchDate(from)
+				if err != nil {
+					return q, fmt.Errorf("date: %w", err)
+				}
+				q.After = laterOf(q.After, d)
+			}
+			if to != "" {
+				d, err := parseSearchDate(to)
+				if err != nil {
+					return q, fmt.Errorf("date: %w", err)
+				}
+				q.Before = earlierOf(q.Before, d.AddDate(0, 0, 1))
+			}
+		default:
+			text = append(text, tok)
+		}
+	}
+
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// tokenizeSearch splits on whitespace, keeping double-quoted runs (including
+// the quotes, and any field: prefix) together as one token.
+func tokenizeSearch(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+func parseSearchDate(s string) (time.Time, error) {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+func laterOf(cur *time.Time, t time.Time) *time.Time {
+	if cur == nil || t.After(*cur) {
+		return &t
+	}
+	return cur
+}
+
+func earlierOf(cur *time.Time, t time.Time) *time.Time {
+	if cur == nil || t.Before(*cur) {
+		return &t
+	}
+	return cur
+}
@@ -0,0 +1,865 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/businesstime"
+	"purl/api/internal/events"
+)
+
+// zendeskPriorities are the values of tickets.zendesk_priority.
+var zendeskPriorities = []string{"low", "normal", "high", "urgent"}
+
+// slaAtRiskWindow is how close to a target a ticket counts as at risk.
+const slaAtRiskWindow = time.Hour
+
+// slaNextDueExpr is a ticket's earliest target that hasn't been met, or null.
+const slaNextDueExpr = `LEAST(
+	CASE WHEN t.first_responded_at IS NULL AND t.resolved_at IS NULL THEN t.first_response_due END,
+	CASE WHEN t.resolved_at IS NULL THEN t.resolution_due END)`
+
+// slaBreachedExpr is whether a ticket missed or is past one of its targets,
+// or null if no SLA policy applies to it. A first-response target is met by
+// resolving the ticket without a reply.
+const slaBreachedExpr = `CASE WHEN t.sla_policy_id IS NOT NULL THEN
+	COALESCE(t.first_response_due < COALESCE(t.first_responded_at, t.resolved_at, now()), false) OR
+	COALESCE(t.resolution_due < COALESCE(t.resolved_at, now()), false) END`
+
+// slaPolicy sets first-response and resolution targets for matching tickets.
+type slaPolicy struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	// Position orders policies, ascending. The first enabled policy that
+	// matches a ticket applies to it.
+	Position int `json:"position"`
+	// Priorities limits the policy to tickets with one of these Zendesk
+	// priorities (low, normal, high, urgent). Empty matches any priority.
+	Priorities []string `json:"priorities"`
+	// MatchTags limits the policy to tickets with any of these tags, e.g. a
+	// customer tier. Empty matches every ticket.
+	MatchTags []string `json:"match_tags"`
+	// FirstResponseMinutes is the time allowed for the first agent reply;
+	// null for no target.
+	FirstResponseMinutes *int `json:"first_response_minutes"`
+	// ResolutionMinutes is the time allowed to solve the ticket; null for no
+	// target.
+	ResolutionMinutes *int `json:"resolution_minutes"`
+	// BusinessHours are the hours targets are measured in; null for around
+	// the clock, unless UseOrgHours.
+	BusinessHours *businesstime.Hours `json:"business_hours"`
+	// UseOrgHours measures targets in the org's business hours (see GET
+	// /business-hours) instead. It excludes BusinessHours.
+	UseOrgHours bool `json:"use_org_hours"`
+}
+
+type createSLAPolicyRequest struct {
+	Name string `json:"name"`
+	// Enabled defaults to true.
+	Enabled              *bool               `json:"enabled"`
+	Position             int                 `json:"position"`
+	Priorities           []string            `json:"priorities"`
+	MatchTags            []string            `json:"match_tags"`
+	FirstResponseMinutes *int                `json:"first_response_minutes"`
+	ResolutionMinutes    *int                `json:"resolution_minutes"`
+	BusinessHours        *businesstime.Hours `json:"business_hours"`
+	UseOrgHours          bool                `json:"use_org_hours"`
+}
+
+// updateSLAPolicyRequest replaces only the fields that are present. Targets
+// and business_hours can't be cleared this way; replace the policy instead.
+// Setting business_hours turns use_org_hours off, and turning use_org_hours
+// on clears business_hours.
+type updateSLAPolicyRequest struct {
+	Name                 *string             `json:"name"`
+	Enabled              *bool               `json:"enabled"`
+	Position             *int                `json:"position"`
+	Priorities           *[]string           `json:"priorities"`
+	MatchTags            *[]string           `json:"match_tags"`
+	FirstResponseMinutes *int                `json:"first_response_minutes"`
+	ResolutionMinutes    *int                `json:"resolution_minutes"`
+	BusinessHours        *businesstime.Hours `json:"business_hours"`
+	UseOrgHours          *bool               `json:"use_org_hours"`
+}
+
+const slaPolicySelect = `
+	SELECT id, created_at, updated_at, name, enabled, position, to_json(priorities), to_json(match_tags),
+	       first_response_minutes, resolution_minutes, business_hours, use_org_hours
+	FROM sla_policies`
+
+func scanSLAPolicy(row rowScanner) (slaPolicy, error) {
+	var p slaPolicy
+	var priorities, matchTags, hours []byte
+	if err := row.Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt, &p.Name, &p.Enabled, &p.Position, &priorities, &matchTags,
+		&p.FirstResponseMinutes, &p.ResolutionMinutes, &hours, &p.UseOrgHours); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(priorities, &p.Priorities); err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(matchTags, &p.MatchTags); err != nil {
+		return p, err
+	}
+	if hours != nil {
+		p.BusinessHours = &businesstime.Hours{}
+		return p, json.Unmarshal(hours, p.BusinessHours)
+	}
+	return p, nil
+}
+
+// businessHoursJSON returns h for the business_hours column, or nil for null.
+func businessHoursJSON(h *businesstime.Hours) []byte {
+	if h == nil {
+		return nil
+	}
+	b, _ := json.Marshal(h)
+	return b
+}
+
+// auditSnapshot returns the audited view of a policy.
+func (p slaPolicy) auditSnapshot() map[string]any {
+	return map[string]any{
+		"name": p.Name, "enabled": p.Enabled, "position": p.Position, "priorities": p.Priorities,
+		"match_tags": p.MatchTags, "first_response_minutes": p.FirstResponseMinutes,
+		"resolution_minutes": p.ResolutionMinutes, "business_hours": p.BusinessHours,
+		"use_org_hours": p.UseOrgHours,
+	}
+}
+
+// matches reports whether p applies to a ticket with priority and tags.
+func (p slaPolicy) matches(priority *string, tags []string) bool {
+	if len(p.Priorities) > 0 && (priority == nil || !slices.Contains(p.Priorities, *priority)) {
+		return false
+	}
+	return len(p.MatchTags) == 0 || slices.ContainsFunc(p.MatchTags, func(t string) bool { return slices.Contains(tags, t) })
+}
+
+// validateSLAPolicy checks and normalizes p, returning a client-facing
+// message if it is invalid.
+func validateSLAPolicy(p *slaPolicy) string {
+	if strings.TrimSpace(p.Name) == "" {
+		return "name is required"
+	}
+	if p.Position < 0 {
+		return "position must not be negative"
+	}
+	priorities := make([]string, 0, len(p.Priorities))
+	for _, pr := range p.Priorities {
+		pr = strings.ToLower(strings.TrimSpace(pr))
+		if !slices.Contains(zendeskPriorities, pr) {
+			return "priorities must be among " + strings.Join(zendeskPriorities, ", ")
+		}
+		if !slices.Contains(priorities, pr) {
+			priorities = append(priorities, pr)
+		}
+	}
+	p.Priorities = priorities
+	tags, err := normalizeTags(p.MatchTags)
+	if err != nil {
+		return "match_tags: " + err.Error()
+	}
+	p.MatchTags = tags
+	if p.FirstResponseMinutes == nil && p.ResolutionMinutes == nil {
+		return "first_response_minutes or resolution_minutes is required"
+	}
+	if (p.FirstResponseMinutes != nil && *p.FirstResponseMinutes <= 0) || (p.ResolutionMinutes != nil && *p.ResolutionMinutes <= 0) {
+		return "targets must be positive"
+	}
+	if p.BusinessHours != nil {
+		if p.UseOrgHours {
+			return "business_hours and use_org_hours are mutually exclusive"
+		}
+		if _, err := p.BusinessHours.Schedule(); err != nil {
+			return "business_hours: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// loadSLAPolicy loads the policyID URL param. Writes a 404 (or 500) and
+// returns false if it doesn't exist.
+func loadSLAPolicy(w http.ResponseWriter, r *http.Request, q queryer, forUpdate bool) (slaPolicy, bool) {
+	policyID := chi.URLParam(r, "policyID")
+	if !reUUID.MatchString(policyID) {
+		http.Error(w, "SLA policy not found", http.StatusNotFound)
+		return slaPolicy{}, false
+	}
+	query := slaPolicySelect + ` WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	p, err := scanSLAPolicy(q.QueryRowContext(r.Context(), query, policyID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "SLA policy not found", http.StatusNotFound)
+		return p, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadSLAPolicy: %v", err)
+		return p, false
+	}
+	return p, true
+}
+
+// @Summary     List SLA policies
+// @Tags        SLA
+// @Description Returns the org's SLA policies in the order they are tried
+// @Produce     json
+// @Success     200  {array}   slaPolicy
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /sla-policies [get]
+func (a *App) listSLAPolicies(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), slaPolicySelect+` ORDER BY position, created_at, id`)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listSLAPolicies query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	policies := []slaPolicy{}
+	for rows.Next() {
+		p, err := scanSLAPolicy(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listSLAPolicies scan: %v", err)
+			return
+		}
+		policies = append(policies, p)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policies)
+}
+
+// @Summary     Create an SLA policy
+// @Tags        SLA
+// @Description Creates first-response and resolution targets, measured from when the ticket was received, for
+// @Description tickets matching the policy's priorities and tags. The first enabled policy (by position) that
+// @Description matches a ticket applies. Tickets' targets are recomputed as they and their comments change, and
+// @Description unresolved tickets' shortly after any policy is created, updated or deleted.
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createSLAPolicyRequest  true  "Policy to create"
+// @Success     201   {object}  slaPolicy
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /sla-policies [post]
+func (a *App) createSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createSLAPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	p := slaPolicy{
+		Name: req.Name, Enabled: req.Enabled == nil || *req.Enabled, Position: req.Position,
+		Priorities: req.Priorities, MatchTags: req.MatchTags,
+		FirstResponseMinutes: req.FirstResponseMinutes, ResolutionMinutes: req.ResolutionMinutes,
+		BusinessHours: req.BusinessHours, UseOrgHours: req.UseOrgHours,
+	}
+	if msg := validateSLAPolicy(&p); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createSLAPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, err = scanSLAPolicy(tx.QueryRowContext(r.Context(), `
+		INSERT INTO sla_policies (org_id, name, enabled, position, priorities, match_tags,
+		                          first_response_minutes, resolution_minutes, business_hours, use_org_hours)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at, name, enabled, position, to_json(priorities), to_json(match_tags),
+		          first_response_minutes, resolution_minutes, business_hours, use_org_hours`,
+		o.ID, p.Name, p.Enabled, p.Position, p.Priorities, p.MatchTags,
+		p.FirstResponseMinutes, p.ResolutionMinutes, businessHoursJSON(p.BusinessHours), p.UseOrgHours,
+	))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createSLAPolicy insert: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "sla_policy.create",
+		TargetType: "sla_policy",
+		TargetID:   p.ID,
+		After:      p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createSLAPolicy audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, o.ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("createSLAPolicy request refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createSLAPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.SLAPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Get an SLA policy
+// @Tags        SLA
+// @Produce     json
+// @Param       policyID  path      string  true  "Policy ID"
+// @Success     200       {object}  slaPolicy
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /sla-policies/{policyID} [get]
+func (a *App) getSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	p, ok := loadSLAPolicy(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Update an SLA policy
+// @Tags        SLA
+// @Description Updates the fields present in the body. priorities and match_tags, if present, are replaced.
+// @Accept      json
+// @Produce     json
+// @Param       policyID  path      string                  true  "Policy ID"
+// @Param       body      body      updateSLAPolicyRequest  true  "Fields to update"
+// @Success     200       {object}  slaPolicy
+// @Failure     400       {string}  string  "Bad Request"
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /sla-policies/{policyID} [patch]
+func (a *App) updateSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	var req updateSLAPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateSLAPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := loadSLAPolicy(w, r, tx, true)
+	if !ok {
+		return
+	}
+	next := old
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		next.Enabled = *req.Enabled
+	}
+	if req.Position != nil {
+		next.Position = *req.Position
+	}
+	if req.Priorities != nil {
+		next.Priorities = *req.Priorities
+	}
+	if req.MatchTags != nil {
+		next.MatchTags = *req.MatchTags
+	}
+	if req.FirstResponseMinutes != nil {
+		next.FirstResponseMinutes = req.FirstResponseMinutes
+	}
+	if req.ResolutionMinutes != nil {
+		next.ResolutionMinutes = req.ResolutionMinutes
+	}
+	if req.BusinessHours != nil {
+		next.BusinessHours = req.BusinessHours
+		next.UseOrgHours = false
+	}
+	if req.UseOrgHours != nil {
+		next.UseOrgHours = *req.UseOrgHours
+		if next.UseOrgHours && req.BusinessHours == nil {
+			next.BusinessHours = nil
+		}
+	}
+	if msg := validateSLAPolicy(&next); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	p, err := scanSLAPolicy(tx.QueryRowContext(r.Context(), `
+		UPDATE sla_policies
+		SET name = $2, enabled = $3, position = $4, priorities = $5, match_tags = $6,
+		    first_response_minutes = $7, resolution_minutes = $8, business_hours = $9, use_org_hours = $10
+		WHERE id = $1
+		RETURNING id, created_at, updated_at, name, enabled, position, to_json(priorities), to_json(match_tags),
+		          first_response_minutes, resolution_minutes, business_hours, use_org_hours`,
+		old.ID, next.Name, next.Enabled, next.Position, next.Priorities, next.MatchTags,
+		next.FirstResponseMinutes, next.ResolutionMinutes, businessHoursJSON(next.BusinessHours), next.UseOrgHours,
+	))
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateSLAPolicy update: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "sla_policy.update",
+		TargetType: "sla_policy",
+		TargetID:   p.ID,
+		Before:     old.auditSnapshot(),
+		After:      p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateSLAPolicy audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, orgFromContext(r.Context()).ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("updateSLAPolicy request refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateSLAPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.SLAPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// @Summary     Delete an SLA policy
+// @Tags        SLA
+// @Description Deletes the policy. Unresolved tickets' targets are recomputed shortly after; resolved tickets
+// @Description keep theirs.
+// @Param       policyID  path      string  true  "Policy ID"
+// @Success     204
+// @Failure     401       {string}  string  "Unauthorized"
+// @Failure     404       {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /sla-policies/{policyID} [delete]
+func (a *App) deleteSLAPolicy(w http.ResponseWriter, r *http.Request) {
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteSLAPolicy begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	p, ok := loadSLAPolicy(w, r, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM sla_policies WHERE id = $1`, p.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteSLAPolicy delete: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "sla_policy.delete",
+		TargetType: "sla_policy",
+		TargetID:   p.ID,
+		Before:     p.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteSLAPolicy audit: %v", err)
+		return
+	}
+	if err := requestSLARefresh(r.Context(), tx, orgFromContext(r.Context()).ID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("deleteSLAPolicy request refresh: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteSLAPolicy commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.SLAPolicyUpdated, map[string]string{"policy_id": p.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshTicketSLA recomputes which SLA policy applies to the ticket, its
+// targets and whether its first response has been sent, then records any
+// targets it has missed. It must be called after the ticket (or comment)
+// change has committed.
+//
+// db is the owner connection for workers, or the request's org-scoped
+// connection for handlers; bus may be nil to skip publishing change events.
+func refreshTicketSLA(ctx context.Context, db dbConn, orgID, ticketID string, bus *events.Bus) error {
+	var receivedAt time.Time
+	var priority *string
+	var firstRespondedAt *time.Time
+	var tagsJSON []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(t.received_at, t.created_at), t.zendesk_priority,
+		       COALESCE((SELECT json_agg(tg.name)
+		                 FROM ticket_tags tt JOIN tags tg ON tg.id = tt.tag_id
+		                 WHERE tt.ticket_id = t.id), '[]'),
+		       -- The first public reply by a person: Zendesk triggers and
+		       -- automations post as the system agent.
+		       (SELECT MIN(COALESCE(tc.received_at, tc.created_at))
+		        FROM ticket_comments tc
+		        JOIN agents ag ON ag.id = tc.agent_author_id
+		        WHERE tc.ticket_id = t.id AND tc.role = 'agent' AND tc.channel <> 'internal'
+		          AND ag.zendesk_user_id IS DISTINCT FROM -1
+		          AND COALESCE(tc.received_at, tc.created_at) >= COALESCE(t.received_at, t.created_at))
+		FROM tickets t
+		WHERE t.id = $1 AND t.org_id = $2`,
+		ticketID, orgID,
+	).Scan(&receivedAt, &priority, &tagsJSON, &firstRespondedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("load ticket: %w", err)
+	}
+	var tags []string
+	if err := json.Unmarshal(tagsJSON, &tags); err != nil {
+		return fmt.Errorf("parse tags: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, slaPolicySelect+`
+		WHERE org_id = $1 AND enabled
+		ORDER BY position, created_at, id`, orgID)
+	if err != nil {
+		return fmt.Errorf("load policies: %w", err)
+	}
+	var policy *slaPolicy
+	for rows.Next() {
+		p, err := scanSLAPolicy(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan policy: %w", err)
+		}
+		if p.matches(priority, tags) {
+			policy = &p
+			break
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate policies: %w", err)
+	}
+
+	var policyID *string
+	var firstResponseDue, resolutionDue *time.Time
+	if policy != nil {
+		// A nil schedule is open around the clock.
+		var schedule *businesstime.Schedule
+		if policy.BusinessHours != nil {
+			if schedule, err = policy.BusinessHours.Schedule(); err != nil {
+				return fmt.Errorf("policy %s business hours: %w", policy.ID, err)
+			}
+		} else if policy.UseOrgHours {
+			if schedule, err = loadOrgSchedule(ctx, db, orgID); err != nil {
+				return fmt.Errorf("org business hours: %w", err)
+			}
+		}
+		due := func(minutes *int) *time.Time {
+			if minutes == nil {
+				return nil
+			}
+			t := schedule.Add(receivedAt, time.Duration(*minutes)*time.Minute)
+			return &t
+		}
+		policyID = &policy.ID
+		firstResponseDue = due(policy.FirstResponseMinutes)
+		resolutionDue = due(policy.ResolutionMinutes)
+	}
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE tickets
+		SET sla_policy_id = $2, first_response_due = $3, first_responded_at = $4, resolution_due = $5
+		WHERE id = $1
+		  AND (sla_policy_id, first_response_due, first_responded_at, resolution_due)
+		      IS DISTINCT FROM ($2::uuid, $3::timestamptz, $4::timestamptz, $5::timestamptz)`,
+		ticketID, policyID, firstResponseDue, firstRespondedAt, resolutionDue,
+	)
+	if err != nil {
+		return fmt.Errorf("update targets: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+	}
+	_, err = recordSLABreaches(ctx, db, `t.id = $1`, []any{ticketID}, bus)
+	return err
+}
+
+// logSLA logs the failure, if any, of refreshing a ticket's SLA. It doesn't
+// fail the webhook event: the targets are recomputed on the next change.
+func logSLA(err error, ticketID string) {
+	if err != nil {
+		log.Printf("SLA for ticket %s: %v", ticketID, err)
+	}
+}
+
+// recordSLABreaches records a breach for each target of the tickets selected
+// by cond (over t, with args) that was missed, or has passed unmet, and
+// hasn't been recorded yet. It returns how many it recorded.
+func recordSLABreaches(ctx context.Context, q queryer, cond string, args []any, bus *events.Bus) (int, error) {
+	rows, err := q.QueryContext(ctx, `
+		INSERT INTO sla_breaches (org_id, ticket_id, policy_id, metric, due_at)
+		SELECT t.org_id, t.id, t.sla_policy_id, 'first_response', t.first_response_due
+		FROM tickets t
+		WHERE (`+cond+`) AND t.first_response_due < COALESCE(t.first_responded_at, t.resolved_at, now())
+		UNION ALL
+		SELECT t.org_id, t.id, t.sla_policy_id, 'resolution', t.resolution_due
+		FROM tickets t
+		WHERE (`+cond+`) AND t.resolution_due < COALESCE(t.resolved_at, now())
+		ON CONFLICT (ticket_id, metric) DO NOTHING
+		RETURNING org_id, ticket_id, metric::text`,
+		args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("record breaches: %w", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var orgID, ticketID, metric string
+		if err := rows.Scan(&orgID, &ticketID, &metric); err != nil {
+			return n, err
+		}
+		bus.Publish(ctx, orgID, events.SLABreached, map[string]string{"ticket_id": ticketID, "metric": metric})
+		n++
+	}
+	return n, rows.Err()
+}
+
+// requestSLARefresh asks the record-sla-breaches worker to recompute the
+// targets of orgID's unresolved tickets, whose policies have changed. It is
+// called in the transaction making the change.
+func requestSLARefresh(ctx context.Context, ex execer, orgID string) error {
+	_, err := ex.ExecContext(ctx, `
+		INSERT INTO sla_refresh_pending (org_id) VALUES ($1)
+		ON CONFLICT (org_id) DO UPDATE SET requested_at = now()`, orgID)
+	return err
+}
+
+// RecordSLABreaches first recomputes the targets of unresolved tickets in
+// orgs whose policies have changed, then records a breach for every ticket,
+// across all orgs, with a target that has passed unmet since it was last
+// checked. Targets met late are recorded as the reply or resolution arrives;
+// this catches the ones nothing has happened on. It returns how many breaches
+// it recorded in the second step.
+func RecordSLABreaches(ctx context.Context, db *sql.DB, bus *events.Bus) (int, error) {
+	if err := refreshPendingSLAs(ctx, db, bus); err != nil {
+		return 0, err
+	}
+	// Resolved tickets were checked as they were resolved.
+	return recordSLABreaches(ctx, db, `t.resolved_at IS NULL`, nil, bus)
+}
+
+// refreshPendingSLAs recomputes the targets of the unresolved tickets of each
+// org in sla_refresh_pending. An org stays pending if any of its tickets
+// fails, or if its policies change again meanwhile.
+func refreshPendingSLAs(ctx context.Context, db *sql.DB, bus *events.Bus) error {
+	type pending struct {
+		orgID       string
+		requestedAt time.Time
+	}
+	var orgs []pending
+	err := queryEach(ctx, db, `SELECT org_id, requested_at FROM sla_refresh_pending ORDER BY requested_at`, nil,
+		func(scan func(...any) error) error {
+			var p pending
+			if err := scan(&p.orgID, &p.requestedAt); err != nil {
+				return err
+			}
+			orgs = append(orgs, p)
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("list pending refreshes: %w", err)
+	}
+
+	for _, p := range orgs {
+		var ticketIDs []string
+		err := queryEach(ctx, db, `SELECT id FROM tickets WHERE org_id = $1 AND resolved_at IS NULL ORDER BY id`,
+			[]any{p.orgID}, func(scan func(...any) error) error {
+				var id string
+				if err := scan(&id); err != nil {
+					return err
+				}
+				ticketIDs = append(ticketIDs, id)
+				return nil
+			})
+		if err != nil {
+			return fmt.Errorf("org %s: list tickets: %w", p.orgID, err)
+		}
+		failed := false
+		for _, id := range ticketIDs {
+			if err := refreshTicketSLA(ctx, db, p.orgID, id, bus); err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+				logSLA(err, id)
+				failed = true
+			}
+		}
+		if failed {
+			continue
+		}
+		if _, err := db.ExecContext(ctx,
+			`DELETE FROM sla_refresh_pending WHERE org_id = $1 AND requested_at = $2`, p.orgID, p.requestedAt,
+		); err != nil {
+			return fmt.Errorf("org %s: clear pending refresh: %w", p.orgID, err)
+		}
+	}
+	return nil
+}
+
+// slaMetricReport counts a metric's outcomes over a report's tickets.
+type slaMetricReport struct {
+	// Targeted counts the tickets with a target for this metric.
+	Targeted int `json:"targeted"`
+	// Met counts targets that were achieved in time.
+	Met int `json:"met"`
+	// Breached counts targets missed, or passed without being achieved.
+	Breached int `json:"breached"`
+	// Pending counts targets not yet achieved or passed.
+	Pending int `json:"pending"`
+	// ComplianceRate is met / (met + breached); null when neither.
+	ComplianceRate *float64 `json:"compliance_rate"`
+}
+
+func (m *slaMetricReport) add(o slaMetricReport) {
+	m.Targeted += o.Targeted
+	m.Met += o.Met
+	m.Breached += o.Breached
+	m.Pending += o.Pending
+}
+
+func (m *slaMetricReport) setRate() {
+	if decided := m.Met + m.Breached; decided > 0 {
+		rate := float64(m.Met) / float64(decided)
+		m.ComplianceRate = &rate
+	}
+}
+
+type slaPolicyReport struct {
+	// PolicyID is null for tickets whose policy has since been deleted.
+	PolicyID      *string         `json:"policy_id"`
+	Name          *string         `json:"name"`
+	FirstResponse slaMetricReport `json:"first_response"`
+	Resolution    slaMetricReport `json:"resolution"`
+}
+
+type slaReport struct {
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	FirstResponse slaMetricReport   `json:"first_response"`
+	Resolution    slaMetricReport   `json:"resolution"`
+	Policies      []slaPolicyReport `json:"policies"`
+}
+
+// @Summary     SLA compliance report
+// @Tags        SLA
+// @Description Counts first-response and resolution targets met, breached and pending for the tickets received
+// @Description in [from, to), overall and by policy. Defaults to the last 30 days.
+// @Produce     json
+// @Param       from  query     string  false  "RFC 3339 start, inclusive"
+// @Param       to    query     string  false  "RFC 3339 end, exclusive (default now)"
+// @Success     200   {object}  slaReport
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /reports/sla [get]
+func (a *App) getSLAReport(w http.ResponseWriter, r *http.Request) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if s := r.URL.Query().Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT t.sla_policy_id, p.name,
+		       COUNT(*) FILTER (WHERE t.first_response_due IS NOT NULL),
+		       COUNT(*) FILTER (WHERE t.first_response_due >= COALESCE(t.first_responded_at, t.resolved_at)),
+		       COUNT(*) FILTER (WHERE t.first_response_due < COALESCE(t.first_responded_at, t.resolved_at, now())),
+		       COUNT(*) FILTER (WHERE t.first_responded_at IS NULL AND t.resolved_at IS NULL AND t.first_response_due >= now()),
+		       COUNT(*) FILTER (WHERE t.resolution_due IS NOT NULL),
+		       COUNT(*) FILTER (WHERE t.resolution_due >= t.resolved_at),
+		       COUNT(*) FILTER (WHERE t.resolution_due < COALESCE(t.resolved_at, now())),
+		       COUNT(*) FILTER (WHERE t.resolved_at IS NULL AND t.resolution_due >= now())
+		FROM tickets t
+		LEFT JOIN sla_policies p ON p.id = t.sla_policy_id
+		WHERE (t.sla_policy_id IS NOT NULL OR t.first_response_due IS NOT NULL OR t.resolution_due IS NOT NULL)
+		  AND COALESCE(t.received_at, t.created_at) >= $1 AND COALESCE(t.received_at, t.created_at) < $2
+		GROUP BY t.sla_policy_id, p.name, p.position
+		ORDER BY p.position NULLS LAST, p.name`,
+		from, to,
+	)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getSLAReport query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	report := slaReport{From: from, To: to, Policies: []slaPolicyReport{}}
+	for rows.Next() {
+		var pr slaPolicyReport
+		fr, res := &pr.FirstResponse, &pr.Resolution
+		if err := rows.Scan(&pr.PolicyID, &pr.Name,
+			&fr.Targeted, &fr.Met, &fr.Breached, &fr.Pending,
+			&res.Targeted, &res.Met, &res.Breached, &res.Pending); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("getSLAReport scan: %v", err)
+			return
+		}
+		fr.setRate()
+		res.setRate()
+		report.FirstResponse.add(*fr)
+		report.Resolution.add(*res)
+		report.Policies = append(report.Policies, pr)
+	}
+	report.FirstResponse.setRate()
+	report.Resolution.setRate()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"purl/api/internal/events"
+)
+
+type snoozeRequest struct {
+	// Until is when the ticket wakes. Omit or null to snooze until the customer
+	// next writes; a customer comment also wakes a ticket snoozed until a time.
+	Until *time.Time `json:"until"`
+}
+
+// snoozeState is the audited snooze state of a ticket.
+type snoozeState struct {
+	SnoozedAt    *time.Time `json:"snoozed_at"`
+	SnoozedUntil *time.Time `json:"snoozed_until"`
+}
+
+// setTicketSnooze snoozes the ticket (snooze true) until until, or wakes it,
+// audits the change as action and writes the updated ticket.
+func (a *App) setTicketSnooze(w http.ResponseWriter, r *http.Request, snooze bool, until *time.Time, action string) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var before snoozeState
+	if err := tx.QueryRowContext(r.Context(),
+		`SELECT snoozed_at, snoozed_until FROM tickets WHERE id = $1 FOR UPDATE`, ticketID,
+	).Scan(&before.SnoozedAt, &before.SnoozedUntil); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze lock: %v", err)
+		return
+	}
+
+	var after snoozeState
+	if err := tx.QueryRowContext(r.Context(), `
+		UPDATE tickets SET
+			snoozed_at    = CASE WHEN $2 THEN now() END,
+			snoozed_until = CASE WHEN $2 THEN $3::timestamptz END,
+			snoozed_by    = CASE WHEN $2 THEN $4::uuid END
+		WHERE id = $1
+		RETURNING snoozed_at, snoozed_until`,
+		ticketID, snooze, until, callerAgentID(r.Context()),
+	).Scan(&after.SnoozedAt, &after.SnoozedUntil); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze update: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     action,
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		Before:     before,
+		After:      after,
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+
+	t, err := scanTicket(conn.QueryRowContext(r.Context(), ticketSelect+` WHERE t.id = $1`, ticketID))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze read back: %v", err)
+		return
+	}
+	tickets := []ticketRow{t}
+	if err := setWaitingTimes(r.Context(), conn, o.ID, tickets); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("setTicketSnooze waiting times: %v", err)
+		return
+	}
+	t = tickets[0]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// @Summary     Snooze a ticket
+// @Tags        Tickets
+// @Description Hides the ticket from ticket lists until the given time, or until the customer next writes if
+// @Description until is omitted. A customer comment wakes the ticket either way. Snoozing again replaces the
+// @Description previous snooze.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string         true  "Ticket ID"
+// @Param       body      body      snoozeRequest  true  "Snooze"
+// @Success     200  {object}  ticketRow
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/snooze [put]
+func (a *App) snoozeTicket(w http.ResponseWriter, r *http.Request) {
+	var req snoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		http.Error(w, "until must be in the future", http.StatusBadRequest)
+		return
+	}
+	a.setTicketSnooze(w, r, true, req.Until, "ticket.snooze")
+}
+
+// @Summary     Unsnooze a ticket
+// @Tags        Tickets
+// @Description Wakes a snoozed ticket now
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketRow
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/snooze [delete]
+func (a *App) unsnoozeTicket(w http.ResponseWriter, r *http.Request) {
+	a.setTicketSnooze(w, r, false, nil, "ticket.unsnooze")
+}
+
+// UnsnoozeDueTickets wakes every ticket, in any org, whose snooze has run out
+// and announces the change. It returns the number of tickets woken.
+func UnsnoozeDueTickets(ctx context.Context, db *sql.DB, bus *events.Bus) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE tickets SET snoozed_at = NULL, snoozed_until = NULL, snoozed_by = NULL
+		WHERE snoozed_until <= now()
+		RETURNING id, org_id`)
+	if err != nil {
+		return 0, fmt.Errorf("unsnooze tickets: %w", err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var ticketID, orgID string
+		if err := rows.Scan(&ticketID, &orgID); err != nil {
+			return n, err
+		}
+		bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+		n++
+	}
+	return n, rows.Err()
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"purl/api/internal/events"
+)
+
+// streamHeartbeat keeps idle SSE connections from being closed by proxies.
+const streamHeartbeat = 25 * time.Second
+
+// agentEvents are the event types meant for one agent, named by the agent_id
+// in their data. They are only sent to streams opened for that agent.
+var agentEvents = map[string]bool{
+	events.NotificationCreated: true,
+	events.NotificationsRead:   true,
+}
+
+// forAgent reports whether e may be sent to a stream opened for agentID
+// ("" for none).
+func forAgent(e events.Event, agentID string) bool {
+	if !agentEvents[e.Type] {
+		return true
+	}
+	var data struct {
+		AgentID string `json:"agent_id"`
+	}
+	if agentID == "" || json.Unmarshal(e.Data, &data) != nil {
+		return false
+	}
+	return data.AgentID == agentID
+}
+
+// @Summary     Stream change events
+// @Tags        Events
+// @Description Server-Sent Events stream of changes to the org's tickets, boards and settings.
+// @Description Each event's data is a JSON object of IDs (ticket_id, board_id, column_id, ...);
+// @Description clients refetch what they display. Event types: ticket.updated, ticket.deleted,
+// @Description comment.created, comment.updated, board.updated, board.tickets_changed,
+// @Description presence.changed, note.changed, view.updated, macro.updated, automation.updated,
+// @Description routing_policy.updated, agent_routing.updated, sla_policy.updated, sla.breached,
+// @Description business_hours.updated, export.updated, notification.created and notifications.read.
+// @Description The last two are only sent to streams opened with the agent's ?agent_id=.
+// @Description Uses query-param auth (?api_key=) because EventSource cannot send headers.
+// @Description Reconnecting clients resume from the Last-Event-ID header (or ?last_event_id=);
+// @Description only the most recent events are retained for replay. A client resuming from an event that is
+// @Description no longer retained is sent a resync event first instead of the replay, and must refetch everything.
+// @Produce     text/event-stream
+// @Param       api_key        query   string  true   "Org API key"
+// @Param       agent_id       query   string  false  "Agent to receive notification events for"
+// @Param       last_event_id  query   string  false  "Resume after this event ID"
+// @Success     200  {string}  string  "event stream"
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Router      /events [get]
+func (a *App) streamEvents(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("api_key")
+	if key == "" {
+		http.Error(w, "missing api_key", http.StatusUnauthorized)
+		return
+	}
+	o, err := a.orgByAPIKey(r.Context(), key)
+	if err == sql.ErrNoRows {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		log.Printf("streamEvents auth: %v", err)
+		return
+	}
+
+	agentID := r.URL.Query().Get("agent_id")
+	if agentID != "" {
+		if !reUUID.MatchString(agentID) {
+			http.Error(w, "invalid agent_id", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if err := a.db.QueryRowContext(r.Context(),
+			`SELECT EXISTS (SELECT 1 FROM agents WHERE id = $1 AND org_id = $2)`, agentID, o.ID,
+		).Scan(&exists); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Printf("streamEvents agent query: %v", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "unknown agent", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if lastID != "" && !events.ValidID(lastID) {
+		http.Error(w, "invalid last event id", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok || a.bus == nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	stream, err := a.bus.Subscribe(r.Context(), o.ID, lastID)
+	if err != nil {
+		http.Error(w, "subscribe failed", http.StatusInternalServerError)
+		log.Printf("streamEvents subscribe: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Disable nginx response buffering so events are delivered immediately.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-stream:
+			if !ok {
+				return
+			}
+			if !forAgent(e, agentID) {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"purl/api/internal/events"
+)
+
+// tagUsage is a tag and how many of the org's tickets carry it.
+type tagUsage struct {
+	Name        string `json:"name"`
+	TicketCount int    `json:"ticket_count"`
+}
+
+type addTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// zendeskTagsResponse is the body of the Zendesk ticket tags endpoints: the
+// ticket's full tag list after the change.
+type zendeskTagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// normalizeTag returns tag as Zendesk stores it: lowercase, trimmed. Tags may
+// not be empty or contain whitespace or commas; ok is false if it does.
+func normalizeTag(tag string) (string, bool) {
+	t := strings.ToLower(strings.TrimSpace(tag))
+	if t == "" || strings.ContainsFunc(t, func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == ',' }) {
+		return "", false
+	}
+	return t, true
+}
+
+// normalizeTags normalizes and de-duplicates tags, returning an error naming
+// the first invalid one.
+func normalizeTags(tags []string) ([]string, error) {
+	out := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		t, ok := normalizeTag(tag)
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// addTicketTags adds tags, which must be normalized, to the ticket, creating
+// any the org doesn't have yet.
+func addTicketTags(ctx context.Context, ex execer, orgID, ticketID string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if _, err := ex.ExecContext(ctx, `
+		INSERT INTO tags (org_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (org_id, name) DO NOTHING`,
+		orgID, tags,
+	); err != nil {
+		return fmt.Errorf("insert tags: %w", err)
+	}
+	if _, err := ex.ExecContext(ctx, `
+		INSERT INTO ticket_tags (ticket_id, tag_id)
+		SELECT $1, id FROM tags WHERE org_id = $2 AND name = ANY($3)
+		ON CONFLICT DO NOTHING`,
+		ticketID, orgID, tags,
+	); err != nil {
+		return fmt.Errorf("insert ticket tags: %w", err)
+	}
+	return nil
+}
+
+// removeTicketTags removes tags from the ticket. The tags themselves are kept
+// so their names stay available to other tickets and filters.
+func removeTicketTags(ctx context.Context, ex execer, ticketID string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	_, err := ex.ExecContext(ctx, `
+		DELETE FROM ticket_tags tt
+		USING tags tg
+		WHERE tt.ticket_id = $1 AND tg.id = tt.tag_id AND tg.name = ANY($2)`,
+		ticketID, tags,
+	)
+	if err != nil {
+		return fmt.Errorf("delete ticket tags: %w", err)
+	}
+	return nil
+}
+
+// setTicketTags replaces the ticket's tags with tags, as reported by Zendesk.
+// Tags Purl can't store (see normalizeTag) are skipped.
+func setTicketTags(ctx context.Context, ex execer, orgID, ticketID string, tags []string) error {
+	keep := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if t, ok := normalizeTag(tag); ok {
+			keep = append(keep, t)
+		}
+	}
+	if _, err := ex.ExecContext(ctx, `
+		DELETE FROM ticket_tags tt
+		USING tags tg
+		WHERE tt.ticket_id = $1 AND tg.id = tt.tag_id AND NOT (tg.name = ANY($2))`,
+		ticketID, keep,
+	); err != nil {
+		return fmt.Errorf("delete stale ticket tags: %w", err)
+	}
+	return addTicketTags(ctx, ex, orgID, ticketID, keep)
+}
+
+// ticketTags returns the ticket's tag names in order.
+func ticketTags(ctx context.Context, q queryer, ticketID string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT tg.name FROM ticket_tags tt
+		JOIN tags tg ON tg.id = tt.tag_id
+		WHERE tt.ticket_id = $1
+		ORDER BY tg.name`,
+		ticketID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// @Summary     List tags
+// @Tags        Tickets
+// @Description Returns the org's tags with how many tickets carry each, most used first
+// @Produce     json
+// @Success     200  {array}   tagUsage
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /tags [get]
+func (a *App) listTags(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT tg.name, COUNT(tt.ticket_id)
+		FROM tags tg
+		LEFT JOIN ticket_tags tt ON tt.tag_id = tg.id
+		WHERE tg.org_id = $1
+		GROUP BY tg.id, tg.name
+		ORDER BY COUNT(tt.ticket_id) DESC, tg.name`,
+		o.ID,
+	)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTags: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	tags := []tagUsage{}
+	for rows.Next() {
+		var t tagUsage
+		if err := rows.Scan(&t.Name, &t.TicketCount); err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listTags scan: %v", err)
+			return
+		}
+		tags = append(tags, t)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTags rows: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// changeTicketTags writes a tag change to Zendesk with method (PUT adds, DELETE
+// removes), stores the ticket's resulting tags, audits the change as action and
+// writes the new tag list.
+func (a *App) changeTicketTags(w http.ResponseWriter, r *http.Request, method, action string, tags []string) {
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+	o := orgFromContext(r.Context())
+	conn := a.conn(r.Context())
+
+	var zendeskTicketID *int64
+	if err := conn.QueryRowContext(r.Context(),
+		`SELECT zendesk_ticket_id FROM tickets WHERE id = $1`, ticketID,
+	).Scan(&zendeskTicketID); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags lookup: %v", err)
+		return
+	}
+	// Zendesk owns the tag list and its webhooks overwrite ours, so a change
+	// that can't be written back wouldn't stick.
+	if zendeskTicketID == nil {
+		http.Error(w, "ticket is not linked to Zendesk", http.StatusUnprocessableEntity)
+		return
+	}
+	before, err := ticketTags(r.Context(), conn, ticketID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags before: %v", err)
+		return
+	}
+
+	body, err := zendeskRequest(r.Context(), conn, o.ID, method,
+		fmt.Sprintf("/api/v2/tickets/%d/tags.json", *zendeskTicketID),
+		map[string]any{"tags": tags}, a.zendeskLimiter)
+	if errors.Is(err, errZendeskNotConfigured) {
+		http.Error(w, "zendesk not configured", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "zendesk update failed", http.StatusBadGateway)
+		log.Printf("changeTicketTags zendesk: %v", err)
+		return
+	}
+	var resp zendeskTagsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		http.Error(w, "zendesk update failed", http.StatusBadGateway)
+		log.Printf("changeTicketTags parse: %v", err)
+		return
+	}
+
+	tx, err := conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "begin tx failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setTicketTags(r.Context(), tx, o.ID, ticketID, resp.Tags); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags store: %v", err)
+		return
+	}
+	after, err := ticketTags(r.Context(), tx, ticketID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags after: %v", err)
+		return
+	}
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     action,
+		TargetType: "ticket",
+		TargetID:   ticketID,
+		Before:     map[string]any{"tags": before},
+		After:      map[string]any{"tags": after},
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags audit: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("changeTicketTags commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(after)
+}
+
+// @Summary     Add tags to a ticket
+// @Tags        Tickets
+// @Description Adds tags to the ticket in Zendesk and stores the result. Tags are lowercased and may not
+// @Description contain whitespace or commas. Returns the ticket's full tag list.
+// @Accept      json
+// @Produce     json
+// @Param       ticketID  path      string          true  "Ticket ID"
+// @Param       body      body      addTagsRequest  true  "Tags to add"
+// @Success     200  {array}   string
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Failure     422  {string}  string  "Unprocessable Entity"
+// @Failure     502  {string}  string  "Bad Gateway"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/tags [post]
+func (a *App) addTagsToTicket(w http.ResponseWriter, r *http.Request) {
+	var req addTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tags) == 0 {
+		http.Error(w, "tags are required", http.StatusBadRequest)
+		return
+	}
+	a.changeTicketTags(w, r, http.MethodPut, "ticket.tags.add", tags)
+}
+
+// @Summary     Remove tags from a ticket
+// @Tags        Tickets
+// @Description Removes tags from the ticket in Zendesk and stores the result. Returns the ticket's full tag list.
+// @Produce     json
+// @Param       ticketID  path      string    true  "Ticket ID"
+// @Param       tag       query     []string  true  "Tag to remove (repeatable)"
+// @Success     200  {array}   string
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Failure     422  {string}  string  "Unprocessable Entity"
+// @Failure     502  {string}  string  "Bad Gateway"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/tags [delete]
+func (a *App) removeTagsFromTicket(w http.ResponseWriter, r *http.Request) {
+	tags, err := normalizeTags(r.URL.Query()["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tags) == 0 {
+		http.Error(w, "tag is required", http.StatusBadRequest)
+		return
+	}
+	a.changeTicketTags(w, r, http.MethodDelete, "ticket.tags.remove", tags)
+}
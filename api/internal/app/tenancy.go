@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// appRole is the unprivileged Postgres role request-scoped connections switch
+// to. Row-level security policies on every org-scoped table restrict it to the
+// org named by the app.current_org_id setting (see migration 00028). The role
+// the API connects as owns the tables and bypasses RLS; only background
+// workers, which legitimately span orgs, use it directly.
+const appRole = "purl_app"
+
+const connContextKey contextKey = "conn"
+
+// dbConn is satisfied by *sql.DB and *sql.Conn.
+type dbConn interface {
+	execer
+	queryer
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// orgConn checks out a dedicated connection whose session is restricted to
+// orgID by RLS. The caller must call release when done; release resets the
+// session before returning the connection to the pool, or discards the
+// connection if the reset fails so a scoped session can never be reused by
+// another org.
+func (a *App) orgConn(ctx context.Context, orgID string) (conn *sql.Conn, release func(), err error) {
+	return openOrgConn(ctx, a.db, orgID)
+}
+
+// openOrgConn is orgConn for workers, which hold the owner db rather than an
+// App.
+func openOrgConn(ctx context.Context, db *sql.DB, orgID string) (conn *sql.Conn, release func(), err error) {
+	conn, err = db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquire conn: %w", err)
+	}
+	release = func() {
+		ctx := context.Background()
+		_, err := conn.ExecContext(ctx, `RESET ROLE`)
+		if err == nil {
+			_, err = conn.ExecContext(ctx,
+				`SELECT set_config('app.current_org_id', '', false), set_config('app.current_agent_id', '', false)`)
+		}
+		if err != nil {
+			log.Printf("orgConn reset: %v", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+
+	if _, err := conn.ExecContext(ctx, `SELECT set_config('app.current_org_id', $1, false)`, orgID); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("set org: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `SET ROLE `+appRole); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("set role: %w", err)
+	}
+	return conn, release, nil
+}
+
+// scopeToOrg runs the rest of the request on a connection restricted to the
+// authenticated org. It must come after requireAPIKey. The acting agent, if
+// any, is exposed to SQL as current_agent_id() for per-agent ticket state.
+func (a *App) scopeToOrg(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o := orgFromContext(r.Context())
+		conn, release, err := a.orgConn(r.Context(), o.ID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			log.Printf("scopeToOrg: %v", err)
+			return
+		}
+		defer release()
+
+		if ag, ok := agentFromContext(r.Context()); ok {
+			if _, err := conn.ExecContext(r.Context(), `SELECT set_config('app.current_agent_id', $1, false)`, ag.ID); err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				log.Printf("scopeToOrg set agent: %v", err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), connContextKey, conn)))
+	})
+}
+
+// conn returns the org-scoped connection for the request. Handlers behind
+// scopeToOrg use it instead of a.db for all queries. A single connection
+// serves the whole request, so one result set must be closed (or fully
+// iterated) before the next query is issued.
+func (a *App) conn(ctx context.Context) dbConn {
+	return ctx.Value(connContextKey).(*sql.Conn)
+}
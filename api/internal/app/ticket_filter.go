@@ -0,0 +1,291 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ticketFilter selects tickets within an org. It is shared by the GET /tickets
+// query parameters and saved views, which store it as JSON:
+//
+//	{
+//	  "statuses":        ["new", "open"],          // any of these; omitted means all
+//	  "assignee":        "me",                     // "me", "none" or an agent ID
+//	  "reporter":        "jane",                   // reporter name or email contains
+//	  "awaiting_reply":  true,                     // customer spoke last (false: agent did)
+//	  "min_temperature": 7,                        // AI temperature 1–10, at least
+//	  "read":            false,                    // the calling agent has (not) read it
+//	  "starred":         true,                     // the calling agent has (not) starred it
+//	  "received_after":  "2026-01-01T00:00:00Z",   // inclusive
+//	  "received_before": "2026-02-01T00:00:00Z",   // exclusive
+//	  "query":           "refund -test",           // full-text, same syntax as GET /search free text
+//	  "snoozed":         "exclude",                // "include" (default), "exclude" or "only"
+//	  "sla":             "at_risk"                 // "breached", or "at_risk": an unmet target due within the hour
+//	}
+//
+// Every field is optional and fields are ANDed. "me", read and starred refer to
+// the agent named by x-agent-id on the request evaluating the filter, so one
+// shared view shows each agent their own tickets.
+type ticketFilter struct {
+	Statuses       []string   `json:"statuses,omitempty"`
+	Assignee       string     `json:"assignee,omitempty"`
+	Reporter       string     `json:"reporter,omitempty"`
+	AwaitingReply  *bool      `json:"awaiting_reply,omitempty"`
+	MinTemperature *int       `json:"min_temperature,omitempty"`
+	Read           *bool      `json:"read,omitempty"`
+	Starred        *bool      `json:"starred,omitempty"`
+	ReceivedAfter  *time.Time `json:"received_after,omitempty"`
+	ReceivedBefore *time.Time `json:"received_before,omitempty"`
+	Query          string     `json:"query,omitempty"`
+	Snoozed        string     `json:"snoozed,omitempty"`
+	SLA            string     `json:"sla,omitempty"`
+}
+
+// errFilterNeedsAgent is returned when a filter uses assignee "me", read or
+// starred but the request has no x-agent-id.
+var errFilterNeedsAgent = errors.New(`assignee "me", read and starred filters require the x-agent-id header`)
+
+// defaultTicketSort is the order of GET /tickets when no sort is given.
+const defaultTicketSort = "created_desc"
+
+// ticketSorts maps sort names to ORDER BY clauses over ticketSelect. Each ends
+// with t.id so pages are stable.
+var ticketSorts = map[string]string{
+	"created_desc":  "t.created_at DESC, t.id",
+	"received_desc": "COALESCE(t.received_at, t.created_at) DESC, t.id",
+	"received_asc":  "COALESCE(t.received_at, t.created_at) ASC, t.id",
+	"customer_reply_desc": `(SELECT MAX(COALESCE(tc.received_at, tc.created_at))
+		FROM ticket_comments tc
+		WHERE tc.ticket_id = t.id AND tc.role = 'customer') DESC NULLS LAST, t.id`,
+	"temperature_desc": "t.ai_temperature DESC NULLS LAST, COALESCE(t.received_at, t.created_at) DESC, t.id",
+	"sla_due_asc":      slaNextDueExpr + " ASC NULLS LAST, t.id",
+}
+
+// validate reports the first invalid field, if any.
+func (f ticketFilter) validate() error {
+	for _, s := range f.Statuses {
+		if !validStatuses[s] {
+			return fmt.Errorf("statuses: unknown status %q", s)
+		}
+	}
+	if f.Assignee != "" && f.Assignee != "me" && f.Assignee != "none" && !reUUID.MatchString(f.Assignee) {
+		return fmt.Errorf(`assignee: must be "me", "none" or an agent ID`)
+	}
+	if f.MinTemperature != nil && (*f.MinTemperature < 1 || *f.MinTemperature > 10) {
+		return fmt.Errorf("min_temperature: must be between 1 and 10")
+	}
+	switch f.Snoozed {
+	case "", "exclude", "include", "only":
+	default:
+		return fmt.Errorf(`snoozed: must be "exclude", "include" or "only"`)
+	}
+	switch f.SLA {
+	case "", "breached", "at_risk":
+	default:
+		return fmt.Errorf(`sla: must be "breached" or "at_risk"`)
+	}
+	if f.ReceivedAfter != nil && f.ReceivedBefore != nil && !f.ReceivedAfter.Before(*f.ReceivedBefore) {
+		return fmt.Errorf("received_after must be before received_before")
+	}
+	return nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input, so it is matched
+// literally in a pattern with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where returns a SQL condition over t (tickets) selecting the filter's tickets
+// in orgID, with args to pass to the query. Placeholders are numbered from
+// len(args)+1, so the returned args extend those given.
+func (f ticketFilter) where(ctx context.Context, orgID string, args []any) (string, []any, error) {
+	addArg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	conds := []string{"t.org_id = " + addArg(orgID)}
+
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "t.zendesk_status::text = ANY("+addArg(f.Statuses)+")")
+	}
+	switch f.Assignee {
+	case "":
+	case "none":
+		conds = append(conds, "t.assignee_id IS NULL")
+	case "me":
+		ag, ok := agentFromContext(ctx)
+		if !ok {
+			return "", nil, errFilterNeedsAgent
+		}
+		conds = append(conds, "t.assignee_id = "+addArg(ag.ID))
+	default:
+		conds = append(conds, "t.assignee_id = "+addArg(f.Assignee))
+	}
+	if f.Reporter != "" {
+		p := addArg("%" + likeEscaper.Replace(f.Reporter) + "%")
+		conds = append(conds, fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM customers rc
+			LEFT JOIN customer_emails rce ON rce.customer_id = rc.id
+			WHERE rc.id = t.reporter_id AND (rc.name ILIKE %[1]s ESCAPE '\' OR rce.email ILIKE %[1]s ESCAPE '\'))`, p))
+	}
+	if f.AwaitingReply != nil {
+		// Same rule as ticketRow.CustomerWaitingSince: the latest customer
+		// comment is newer than the latest agent comment.
+		cond := `(SELECT MAX(CASE WHEN tc.role = 'customer' THEN COALESCE(tc.received_at, tc.created_at) END) >
+		          COALESCE(MAX(CASE WHEN tc.role = 'agent' THEN COALESCE(tc.received_at, tc.created_at) END), '-infinity'::timestamptz)
+		   FROM ticket_comments tc WHERE tc.ticket_id = t.id)`
+		if *f.AwaitingReply {
+			conds = append(conds, cond+" IS TRUE")
+		} else {
+			conds = append(conds, cond+" IS NOT TRUE")
+		}
+	}
+	if f.MinTemperature != nil {
+		conds = append(conds, "t.ai_temperature >= "+addArg(*f.MinTemperature))
+	}
+	if f.Read != nil || f.Starred != nil {
+		ag, ok := agentFromContext(ctx)
+		if !ok {
+			return "", nil, errFilterNeedsAgent
+		}
+		p := addArg(ag.ID)
+		if f.Read != nil {
+			cond := fmt.Sprintf(`EXISTS (
+				SELECT 1 FROM ticket_agent_state s
+				WHERE s.ticket_id = t.id AND s.agent_id = %s AND s.last_read_at IS NOT NULL)`, p)
+			if !*f.Read {
+				cond = "NOT " + cond
+			}
+			conds = append(conds, cond)
+		}
+		if f.Starred != nil {
+			cond := fmt.Sprintf(`EXISTS (
+				SELECT 1 FROM ticket_agent_state s
+				WHERE s.ticket_id = t.id AND s.agent_id = %s AND s.starred)`, p)
+			if !*f.Starred {
+				cond = "NOT " + cond
+			}
+			conds = append(conds, cond)
+		}
+	}
+	if f.ReceivedAfter != nil {
+		conds = append(conds, "COALESCE(t.received_at, t.created_at) >= "+addArg(*f.ReceivedAfter))
+	}
+	if f.ReceivedBefore != nil {
+		conds = append(conds, "COALESCE(t.received_at, t.created_at) < "+addArg(*f.ReceivedBefore))
+	}
+	switch f.Snoozed {
+	case "exclude":
+		conds = append(conds, "t.snoozed_at IS NULL")
+	case "only":
+		conds = append(conds, "t.snoozed_at IS NOT NULL")
+	}
+	switch f.SLA {
+	case "breached":
+		conds = append(conds, "("+slaBreachedExpr+") IS TRUE")
+	case "at_risk":
+		conds = append(conds, fmt.Sprintf("(%s) IS FALSE AND %s < %s",
+			slaBreachedExpr, slaNextDueExpr, addArg(time.Now().Add(slaAtRiskWindow))))
+	}
+	if f.Query != "" {
+		p := addArg(f.Query)
+		conds = append(conds, fmt.Sprintf(`(t.search_vector @@ websearch_to_tsquery('english', %[1]s) OR EXISTS (
+			SELECT 1 FROM ticket_comments tc
+			WHERE tc.ticket_id = t.id AND tc.search_vector @@ websearch_to_tsquery('english', %[1]s)))`, p))
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// ticketFilterFromQuery reads a filter from GET /tickets query parameters.
+// Parameter names match the JSON fields, except status (repeatable or
+// comma-separated) and q. Unlike a stored filter, snoozed defaults to
+// "exclude": the ticket list hides snoozed tickets unless asked.
+func ticketFilterFromQuery(v url.Values) (ticketFilter, error) {
+	var f ticketFilter
+	for _, s := range v["status"] {
+		for _, part := range strings.Split(s, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				f.Statuses = append(f.Statuses, part)
+			}
+		}
+	}
+	f.Assignee = v.Get("assignee")
+	f.Reporter = v.Get("reporter")
+	f.Query = v.Get("q")
+	f.Snoozed = v.Get("snoozed")
+	if f.Snoozed == "" {
+		f.Snoozed = "exclude"
+	}
+	f.SLA = v.Get("sla")
+	for name, dst := range map[string]**bool{"awaiting_reply": &f.AwaitingReply, "read": &f.Read, "starred": &f.Starred} {
+		if s := v.Get(name); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return f, fmt.Errorf("%s: must be true or false", name)
+			}
+			*dst = &b
+		}
+	}
+	if s := v.Get("min_temperature"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return f, fmt.Errorf("min_temperature: must be an integer")
+		}
+		f.MinTemperature = &n
+	}
+	for name, dst := range map[string]**time.Time{"received_after": &f.ReceivedAfter, "received_before": &f.ReceivedBefore} {
+		if s := v.Get(name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return f, fmt.Errorf("%s: must be an RFC 3339 timestamp", name)
+			}
+			*dst = &t
+		}
+	}
+	return f, f.validate()
+}
+
+// queryTickets returns the org's tickets matching f in the named sort order,
+// which must be a key of ticketSorts, with their waiting times set.
+func queryTickets(ctx context.Context, q queryer, orgID string, f ticketFilter, sort string) ([]ticketRow, error) {
+	cond, args, err := f.where(ctx, orgID, nil)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx, ticketSelect+`
+		WHERE `+cond+`
+		ORDER BY `+ticketSorts[sort], args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []ticketRow{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return tickets, setWaitingTimes(ctx, q, orgID, tickets)
+}
+
+// countTickets returns how many of the org's tickets match f.
+func countTickets(ctx context.Context, q queryer, orgID string, f ticketFilter) (int, error) {
+	cond, args, err := f.where(ctx, orgID, nil)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = q.QueryRowContext(ctx, `SELECT COUNT(*) FROM tickets t WHERE `+cond, args...).Scan(&n)
+	return n, err
+}
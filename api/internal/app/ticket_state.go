@@ -0,0 +1,142 @@
+package app
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ticketAgentState is the calling agent's personal state for a ticket. Like
+// presence it is per-agent view state, so changes are not audited.
+type ticketAgentState struct {
+	TicketID string `json:"ticket_id"`
+	Read     bool   `json:"read"`
+	Starred  bool   `json:"starred"`
+	// Following agents are notified when the ticket's status changes.
+	Following bool `json:"following"`
+	// LastReadAt is when the agent last marked the ticket read; null while unread.
+	LastReadAt *time.Time `json:"last_read_at"`
+}
+
+// setTicketAgentState sets column (last_read_at, starred or following) of the calling
+// agent's state for the ticket to value and writes the resulting state.
+func (a *App) setTicketAgentState(w http.ResponseWriter, r *http.Request, column string, value any) {
+	ag, ok := agentFromContext(r.Context())
+	if !ok {
+		http.Error(w, "x-agent-id header required", http.StatusBadRequest)
+		return
+	}
+	ticketID := a.requireTicketInOrg(w, r)
+	if ticketID == "" {
+		return
+	}
+
+	s := ticketAgentState{TicketID: ticketID}
+	err := a.conn(r.Context()).QueryRowContext(r.Context(), `
+		INSERT INTO ticket_agent_state (ticket_id, agent_id, `+column+`)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (ticket_id, agent_id) DO UPDATE SET `+column+` = EXCLUDED.`+column+`
+		RETURNING last_read_at, starred, following`,
+		ticketID, ag.ID, value,
+	).Scan(&s.LastReadAt, &s.Starred, &s.Following)
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("setTicketAgentState %s: %v", column, err)
+		return
+	}
+	s.Read = s.LastReadAt != nil
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// @Summary     Mark a ticket read
+// @Tags        Tickets
+// @Description Marks the ticket read for the calling agent (x-agent-id). It becomes unread again when the customer next writes.
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/read [put]
+func (a *App) markTicketRead(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "last_read_at", time.Now())
+}
+
+// @Summary     Mark a ticket unread
+// @Tags        Tickets
+// @Description Marks the ticket unread for the calling agent (x-agent-id)
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/read [delete]
+func (a *App) markTicketUnread(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "last_read_at", nil)
+}
+
+// @Summary     Star a ticket
+// @Tags        Tickets
+// @Description Stars the ticket for the calling agent (x-agent-id)
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/star [put]
+func (a *App) starTicket(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "starred", true)
+}
+
+// @Summary     Unstar a ticket
+// @Tags        Tickets
+// @Description Removes the calling agent's (x-agent-id) star from the ticket
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/star [delete]
+func (a *App) unstarTicket(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "starred", false)
+}
+
+// @Summary     Follow a ticket
+// @Tags        Tickets
+// @Description Follows the ticket for the calling agent (x-agent-id), who is then notified when its status changes
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/follow [put]
+func (a *App) followTicket(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "following", true)
+}
+
+// @Summary     Unfollow a ticket
+// @Tags        Tickets
+// @Description Stops the calling agent (x-agent-id) following the ticket
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketAgentState
+// @Failure     400  {string}  string  "Bad Request"
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID}/follow [delete]
+func (a *App) unfollowTicket(w http.ResponseWriter, r *http.Request) {
+	a.setTicketAgentState(w, r, "following", false)
+}
@@ -1,7 +1,9 @@
 package app
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
@@ -15,6 +17,8 @@ type ticketRow struct {
 	Description     string  `json:"description"`
 	ZendeskStatus   *string `json:"zendesk_status"`
 	ZendeskTicketID *int64  `json:"zendesk_ticket_id"`
+	// ZendeskPriority is low, normal, high or urgent; null when unset in Zendesk.
+	ZendeskPriority *string `json:"zendesk_priority"`
 	ReporterName    string  `json:"reporter_name"`
 	ReporterEmail   *string `json:"reporter_email"`
 	AssigneeName    *string `json:"assignee_name"`
@@ -24,6 +28,12 @@ type ticketRow struct {
 	// CustomerWaitingSince is the timestamp of the customer's most recent message when no agent
 	// reply has been sent after it, or null if the agent has already replied.
 	CustomerWaitingSince *time.Time `json:"customer_waiting_since"`
+	// WaitingSeconds is how long the customer has been waiting, since
+	// CustomerWaitingSince; null if they aren't.
+	WaitingSeconds *int64 `json:"waiting_seconds"`
+	// BusinessWaitingSeconds is WaitingSeconds counting only the org's
+	// business hours (see GET /business-hours).
+	BusinessWaitingSeconds *int64 `json:"business_waiting_seconds"`
 	// LastCustomerReplyAt is the timestamp of the customer's most recent message, regardless of
 	// whether the agent has replied. Used to sort tickets by most recent customer activity.
 	LastCustomerReplyAt *time.Time `json:"last_customer_reply_at"`
@@ -35,6 +45,37 @@ type ticketRow struct {
 	AiSummary *string `json:"ai_summary"`
 	// AiTemperature is a 1-10 score of how urgent or frustrated the customer is.
 	AiTemperature *int `json:"ai_temperature"`
+	// SnoozedAt is when the ticket was snoozed; null unless it is snoozed.
+	SnoozedAt *time.Time `json:"snoozed_at"`
+	// SnoozedUntil is when a snoozed ticket wakes. Null while snoozed means it
+	// wakes only when the customer next writes, which wakes any snoozed ticket.
+	SnoozedUntil *time.Time `json:"snoozed_until"`
+	// Read is whether the calling agent (x-agent-id) has read the ticket since the
+	// customer last wrote. Null when the request names no agent.
+	Read *bool `json:"read"`
+	// Starred is whether the calling agent has starred the ticket. Null when the
+	// request names no agent.
+	Starred *bool `json:"starred"`
+	// Following is whether the calling agent follows the ticket. Null when the
+	// request names no agent.
+	Following *bool `json:"following"`
+	// Tags are the ticket's tags in name order, kept in sync with Zendesk.
+	Tags []string `json:"tags"`
+	// CustomFields are the Zendesk custom field values keyed by field ID.
+	CustomFields map[string]any `json:"custom_fields"`
+	// SLAPolicyID is the SLA policy applied to the ticket; null if none matches.
+	SLAPolicyID *string `json:"sla_policy_id"`
+	// FirstResponseDue is when the first agent reply is due under the SLA
+	// policy; null without a first-response target.
+	FirstResponseDue *time.Time `json:"first_response_due"`
+	// FirstRespondedAt is when an agent first replied publicly.
+	FirstRespondedAt *time.Time `json:"first_responded_at"`
+	// ResolutionDue is when the ticket is due to be solved under the SLA
+	// policy; null without a resolution target.
+	ResolutionDue *time.Time `json:"resolution_due"`
+	// SLABreached is whether the ticket missed, or is past, one of its
+	// targets. Null when no SLA policy applies.
+	SLABreached *bool `json:"sla_breached"`
 }
 
 type ticketCommentRow struct {
@@ -62,15 +103,64 @@ type ticketCommentRow struct {
 
 // @Summary     List tickets
 // @Tags        Tickets
-// @Description Returns all tickets for the org, ordered by creation date descending
+// @Description Returns the org's tickets, newest first unless sort is given. Filters are ANDed; they are the
+// @Description same filters saved views store (see POST /views), except that snoozed defaults to exclude here: snoozed tickets are left
+// @Description out unless snoozed says otherwise. Saved views, bulk jobs and exports include them by default.
 // @Produce     json
+// @Param       status           query     []string  false  "Zendesk status; repeat or comma-separate for any of several"  collectionFormat(multi)
+// @Param       assignee         query     string    false  "me, none or an agent ID"
+// @Param       reporter         query     string    false  "Reporter name or email contains"
+// @Param       awaiting_reply   query     bool      false  "true: customer spoke last; false: an agent did"
+// @Param       min_temperature  query     int       false  "Minimum AI temperature (1-10)"
+// @Param       read             query     bool      false  "Read (true) or unread (false) by the calling agent; requires x-agent-id"
+// @Param       starred          query     bool      false  "Starred (true) or not (false) by the calling agent; requires x-agent-id"
+// @Param       received_after   query     string    false  "RFC 3339 timestamp, inclusive"
+// @Param       received_before  query     string    false  "RFC 3339 timestamp, exclusive"
+// @Param       q                query     string    false  "Full-text query"
+// @Param       snoozed          query     string    false  "exclude (default), include or only snoozed tickets"
+// @Param       sla              query     string    false  "breached, or at_risk: an unmet SLA target due within the hour"
+// @Param       sort             query     string    false  "created_desc (default), received_desc, received_asc, customer_reply_desc, temperature_desc or sla_due_asc"
 // @Success     200  {array}   ticketRow
+// @Failure     400  {string}  string  "Bad Request"
 // @Failure     401  {string}  string  "Unauthorized"
 // @Security    ApiKeyAuth
 // @Router      /tickets [get]
 func (a *App) listTickets(w http.ResponseWriter, r *http.Request) {
 	o := orgFromContext(r.Context())
-	rows, err := a.db.QueryContext(r.Context(), `
+	f, err := ticketFilterFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = defaultTicketSort
+	}
+	if _, ok := ticketSorts[sort]; !ok {
+		http.Error(w, "unknown sort", http.StatusBadRequest)
+		return
+	}
+
+	tickets, err := queryTickets(r.Context(), a.conn(r.Context()), o.ID, f, sort)
+	if errors.Is(err, errFilterNeedsAgent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listTickets query: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tickets)
+}
+
+// ticketSelect is the SELECT ... FROM shared by every endpoint returning ticketRow.
+// Callers append WHERE/ORDER BY clauses referencing t (tickets), c (reporter),
+// a (assignee) and tas (the calling agent's ticket_agent_state), and scan each
+// row with scanTicket.
+const ticketSelect = `
 		SELECT t.id, t.title, t.description, t.zendesk_status, t.zendesk_ticket_id,
 		       c.name,
 		       (SELECT ce.email FROM customer_emails ce WHERE ce.customer_id = c.id LIMIT 1),
@@ -93,33 +183,130 @@ func (a *App) listTickets(w http.ResponseWriter, r *http.Request) {
 		       t.resolved_at,
 		       t.ai_title,
 		       t.ai_summary,
-		       t.ai_temperature
+		       t.ai_temperature,
+		       t.snoozed_at,
+		       t.snoozed_until,
+		       CASE WHEN current_agent_id() IS NOT NULL THEN COALESCE(tas.last_read_at IS NOT NULL, false) END,
+		       CASE WHEN current_agent_id() IS NOT NULL THEN COALESCE(tas.starred, false) END,
+		       CASE WHEN current_agent_id() IS NOT NULL THEN COALESCE(tas.following, false) END,
+		       COALESCE((SELECT json_agg(tg.name ORDER BY tg.name)
+		                 FROM ticket_tags tt
+		                 JOIN tags tg ON tg.id = tt.tag_id
+		                 WHERE tt.ticket_id = t.id), '[]'),
+		       t.custom_fields,
+		       t.zendesk_priority,
+		       t.sla_policy_id,
+		       t.first_response_due,
+		       t.first_responded_at,
+		       t.resolution_due,
+		       ` + slaBreachedExpr + `
 		FROM tickets t
 		JOIN customers c ON c.id = t.reporter_id
 		LEFT JOIN agents a ON a.id = t.assignee_id
-		WHERE t.org_id = $1
-		ORDER BY t.created_at DESC
-	`, o.ID)
+		LEFT JOIN ticket_agent_state tas ON tas.ticket_id = t.id AND tas.agent_id = current_agent_id()`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTicket(row rowScanner) (ticketRow, error) {
+	var t ticketRow
+	var tags, customFields []byte
+	err := row.Scan(&t.ID, &t.Title, &t.Description, &t.ZendeskStatus, &t.ZendeskTicketID, &t.ReporterName, &t.ReporterEmail, &t.AssigneeName, &t.ReceivedAt, &t.CustomerWaitingSince, &t.LastCustomerReplyAt, &t.ResolvedAt, &t.AiTitle, &t.AiSummary, &t.AiTemperature, &t.SnoozedAt, &t.SnoozedUntil, &t.Read, &t.Starred, &t.Following, &tags, &customFields,
+		&t.ZendeskPriority, &t.SLAPolicyID, &t.FirstResponseDue, &t.FirstRespondedAt, &t.ResolutionDue, &t.SLABreached)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(tags, &t.Tags); err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(customFields, &t.CustomFields)
+	return t, err
+}
+
+// ticketDetail is the single-ticket response: the list fields plus live state.
+type ticketDetail struct {
+	ticketRow
+	// Presence lists agents currently viewing or composing on the ticket.
+	Presence []presenceEntry `json:"presence"`
+}
+
+// @Summary     Get a ticket
+// @Tags        Tickets
+// @Description Returns a single ticket, including which agents are currently viewing or composing on it
+// @Produce     json
+// @Param       ticketID  path      string  true  "Ticket ID"
+// @Success     200  {object}  ticketDetail
+// @Failure     401  {string}  string  "Unauthorized"
+// @Failure     404  {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /tickets/{ticketID} [get]
+func (a *App) getTicket(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+	ticketID := chi.URLParam(r, "ticketID")
+	if !reUUID.MatchString(ticketID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	t, err := scanTicket(a.conn(r.Context()).QueryRowContext(r.Context(), ticketSelect+`
+		WHERE t.id = $1 AND t.org_id = $2
+	`, ticketID, o.ID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "query failed", http.StatusInternalServerError)
-		log.Printf("listTickets query: %v", err)
+		log.Printf("getTicket query: %v", err)
 		return
 	}
-	defer rows.Close()
 
-	tickets := []ticketRow{}
-	for rows.Next() {
-		var t ticketRow
-		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.ZendeskStatus, &t.ZendeskTicketID, &t.ReporterName, &t.ReporterEmail, &t.AssigneeName, &t.ReceivedAt, &t.CustomerWaitingSince, &t.LastCustomerReplyAt, &t.ResolvedAt, &t.AiTitle, &t.AiSummary, &t.AiTemperature); err != nil {
-			http.Error(w, "scan failed", http.StatusInternalServerError)
-			log.Printf("listTickets scan: %v", err)
-			return
-		}
-		tickets = append(tickets, t)
+	tickets := []ticketRow{t}
+	if err := setWaitingTimes(r.Context(), a.conn(r.Context()), o.ID, tickets); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("getTicket waiting times: %v", err)
+		return
+	}
+	t = tickets[0]
+
+	presence, err := a.loadPresence(r.Context(), o.ID, ticketID)
+	if err != nil {
+		// Presence is advisory; serve the ticket without it.
+		log.Printf("getTicket presence: %v", err)
+		presence = []presenceEntry{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tickets)
+	json.NewEncoder(w).Encode(ticketDetail{ticketRow: t, Presence: presence})
+}
+
+// requireTicketInOrg checks that the ticketID URL param names a ticket in the org.
+// Returns the ticket ID on success, or writes an appropriate error and returns "".
+func (a *App) requireTicketInOrg(w http.ResponseWriter, r *http.Request) string {
+	ticketID := chi.URLParam(r, "ticketID")
+	if !reUUID.MatchString(ticketID) {
+		http.Error(w, "ticket not found", http.StatusNotFound)
+		return ""
+	}
+	o := orgFromContext(r.Context())
+
+	var exists bool
+	err := a.conn(r.Context()).QueryRowContext(r.Context(),
+		`SELECT EXISTS(SELECT 1 FROM tickets WHERE id = $1 AND org_id = $2)`,
+		ticketID, o.ID,
+	).Scan(&exists)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("requireTicketInOrg query: %v", err)
+		return ""
+	}
+	if !exists {
+		http.Error(w, "ticket not found", http.StatusNotFound)
+		return ""
+	}
+	return ticketID
 }
 
 // @Summary     List ticket comments
@@ -138,7 +325,7 @@ func (a *App) listTicketComments(w http.ResponseWriter, r *http.Request) {
 
 	// Verify the ticket belongs to this org
 	var exists bool
-	err := a.db.QueryRowContext(r.Context(),
+	err := a.conn(r.Context()).QueryRowContext(r.Context(),
 		`SELECT EXISTS(SELECT 1 FROM tickets WHERE id = $1 AND org_id = $2)`,
 		ticketID, o.ID,
 	).Scan(&exists)
@@ -152,24 +339,7 @@ func (a *App) listTicketComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := a.db.QueryContext(r.Context(), `
-		SELECT tc.id, tc.body, tc.html_body, tc.channel::text, tc.role::text,
-		       COALESCE(a.name, c.name, '') AS author_name,
-		       tc.author_display_name,
-		       COALESCE(tc.received_at, tc.created_at),
-		       tc.call_id,
-		       tc.recording_url IS NOT NULL AS has_recording,
-		       tc.transcription_text,
-		       tc.transcription_status,
-		       tc.call_duration,
-		       tc.call_from,
-		       tc.call_to,
-		       tc.answered_by_name,
-		       tc.call_location,
-		       tc.call_started_at
-		FROM ticket_comments tc
-		LEFT JOIN agents a ON a.id = tc.agent_author_id
-		LEFT JOIN customers c ON c.id = tc.customer_author_id
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), ticketCommentSelect+`
 		WHERE tc.ticket_id = $1
 		ORDER BY tc.created_at ASC, tc.zendesk_sub_index ASC
 	`, ticketID)
@@ -182,11 +352,8 @@ func (a *App) listTicketComments(w http.ResponseWriter, r *http.Request) {
 
 	comments := []ticketCommentRow{}
 	for rows.Next() {
-		var c ticketCommentRow
-		if err := rows.Scan(&c.ID, &c.Body, &c.HtmlBody, &c.Channel, &c.Role, &c.AuthorName, &c.AuthorDisplayName, &c.ReceivedAt,
-			&c.CallID, &c.HasRecording, &c.TranscriptionText, &c.TranscriptionStatus,
-			&c.CallDuration, &c.CallFrom, &c.CallTo, &c.AnsweredByName,
-			&c.CallLocation, &c.CallStartedAt); err != nil {
+		c, err := scanTicketComment(rows)
+		if err != nil {
 			http.Error(w, "scan failed", http.StatusInternalServerError)
 			log.Printf("listTicketComments scan: %v", err)
 			return
@@ -197,3 +364,39 @@ func (a *App) listTicketComments(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
 }
+
+// ticketCommentSelect is the SELECT ... FROM shared by endpoints returning
+// ticketCommentRow. Callers append clauses referencing tc (ticket_comments).
+const ticketCommentSelect = `
+		SELECT ` + ticketCommentColumns + ticketCommentFrom
+
+// ticketCommentColumns and ticketCommentFrom make up ticketCommentSelect, for
+// queries that select more alongside.
+const ticketCommentColumns = `tc.id, tc.body, tc.html_body, tc.channel::text, tc.role::text,
+		       COALESCE(a.name, c.name, '') AS author_name,
+		       tc.author_display_name,
+		       COALESCE(tc.received_at, tc.created_at),
+		       tc.call_id,
+		       tc.recording_url IS NOT NULL AS has_recording,
+		       tc.transcription_text,
+		       tc.transcription_status,
+		       tc.call_duration,
+		       tc.call_from,
+		       tc.call_to,
+		       tc.answered_by_name,
+		       tc.call_location,
+		       tc.call_started_at`
+
+const ticketCommentFrom = `
+		FROM ticket_comments tc
+		LEFT JOIN agents a ON a.id = tc.agent_author_id
+		LEFT JOIN customers c ON c.id = tc.customer_author_id`
+
+func scanTicketComment(row rowScanner) (ticketCommentRow, error) {
+	var c ticketCommentRow
+	err := row.Scan(&c.ID, &c.Body, &c.HtmlBody, &c.Channel, &c.Role, &c.AuthorName, &c.AuthorDisplayName, &c.ReceivedAt,
+		&c.CallID, &c.HasRecording, &c.TranscriptionText, &c.TranscriptionStatus,
+		&c.CallDuration, &c.CallFrom, &c.CallTo, &c.AnsweredByName,
+		&c.CallLocation, &c.CallStartedAt)
+	return c, err
+}
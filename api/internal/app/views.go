@@ -0,0 +1,512 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
+)
+
+// savedView is a named ticketFilter shown in the sidebar.
+type savedView struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `json:"name"`
+	// Visibility is "shared" (everyone in the org) or "personal" (only the owner).
+	Visibility string `json:"visibility"`
+	// OwnerAgentID is the agent who owns a personal view; null for shared views.
+	OwnerAgentID *string      `json:"owner_agent_id"`
+	Filter       ticketFilter `json:"filter"`
+	// Sort is the ticket order: created_desc, received_desc, received_asc,
+	// customer_reply_desc, temperature_desc or sla_due_asc.
+	Sort string `json:"sort"`
+	// Position orders views in the sidebar, ascending.
+	Position int `json:"position"`
+}
+
+// viewAuditSnapshot is the audited view of a saved view.
+type viewAuditSnapshot struct {
+	Name       string       `json:"name"`
+	Visibility string       `json:"visibility"`
+	Filter     ticketFilter `json:"filter"`
+	Sort       string       `json:"sort"`
+	Position   int          `json:"position"`
+}
+
+func (v savedView) auditSnapshot() viewAuditSnapshot {
+	return viewAuditSnapshot{Name: v.Name, Visibility: v.Visibility, Filter: v.Filter, Sort: v.Sort, Position: v.Position}
+}
+
+type createViewRequest struct {
+	Name string `json:"name"`
+	// Visibility is "shared" or "personal"; personal views require x-agent-id.
+	Visibility string       `json:"visibility"`
+	Filter     ticketFilter `json:"filter"`
+	// Sort defaults to created_desc.
+	Sort     string `json:"sort"`
+	Position int    `json:"position"`
+}
+
+// updateViewRequest replaces only the fields that are present.
+type updateViewRequest struct {
+	Name       *string       `json:"name"`
+	Visibility *string       `json:"visibility"`
+	Filter     *ticketFilter `json:"filter"`
+	Sort       *string       `json:"sort"`
+	Position   *int          `json:"position"`
+}
+
+type viewCount struct {
+	ViewID string `json:"view_id"`
+	Count  int    `json:"count"`
+}
+
+const savedViewColumns = `id, created_at, updated_at, name, visibility::text, owner_agent_id, filter, sort, position`
+
+func scanSavedView(row rowScanner) (savedView, error) {
+	var v savedView
+	var filter []byte
+	if err := row.Scan(&v.ID, &v.CreatedAt, &v.UpdatedAt, &v.Name, &v.Visibility, &v.OwnerAgentID, &filter, &v.Sort, &v.Position); err != nil {
+		return v, err
+	}
+	return v, json.Unmarshal(filter, &v.Filter)
+}
+
+// validateView checks the fields shared by create and update, writing a 400
+// and returning false if any is invalid.
+func validateView(w http.ResponseWriter, r *http.Request, name, visibility string, f ticketFilter, sort string) bool {
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return false
+	}
+	if visibility != "shared" && visibility != "personal" {
+		http.Error(w, "visibility must be shared or personal", http.StatusBadRequest)
+		return false
+	}
+	if _, ok := agentFromContext(r.Context()); visibility == "personal" && !ok {
+		http.Error(w, "personal views require the x-agent-id header", http.StatusBadRequest)
+		return false
+	}
+	if _, ok := ticketSorts[sort]; !ok {
+		http.Error(w, "unknown sort", http.StatusBadRequest)
+		return false
+	}
+	if err := f.validate(); err != nil {
+		http.Error(w, "invalid filter: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// visibleViewsCondition restricts saved_views to those the caller may see:
+// shared views plus their own personal views. $1 is the caller's agent ID, or
+// NULL when the request has no x-agent-id.
+const visibleViewsCondition = `(visibility = 'shared' OR owner_agent_id = $1)`
+
+func callerAgentID(ctx context.Context) *string {
+	if ag, ok := agentFromContext(ctx); ok {
+		return &ag.ID
+	}
+	return nil
+}
+
+// loadVisibleView loads the viewID URL param if the caller may see it. Writes
+// a 404 (or 500) and returns false otherwise.
+func (a *App) loadVisibleView(w http.ResponseWriter, r *http.Request, q queryer, forUpdate bool) (savedView, bool) {
+	viewID := chi.URLParam(r, "viewID")
+	if !reUUID.MatchString(viewID) {
+		http.Error(w, "view not found", http.StatusNotFound)
+		return savedView{}, false
+	}
+	query := `SELECT ` + savedViewColumns + ` FROM saved_views WHERE ` + visibleViewsCondition + ` AND id = $2`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+	v, err := scanSavedView(q.QueryRowContext(r.Context(), query, callerAgentID(r.Context()), viewID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "view not found", http.StatusNotFound)
+		return v, false
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("loadVisibleView: %v", err)
+		return v, false
+	}
+	return v, true
+}
+
+// @Summary     List saved views
+// @Tags        Views
+// @Description Returns the shared views plus the calling agent's (x-agent-id) personal views, in sidebar order
+// @Produce     json
+// @Success     200  {array}   savedView
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /views [get]
+func (a *App) listViews(w http.ResponseWriter, r *http.Request) {
+	rows, err := a.conn(r.Context()).QueryContext(r.Context(), `
+		SELECT `+savedViewColumns+`
+		FROM saved_views
+		WHERE `+visibleViewsCondition+`
+		ORDER BY position, name, id
+	`, callerAgentID(r.Context()))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listViews query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	views := []savedView{}
+	for rows.Next() {
+		v, err := scanSavedView(rows)
+		if err != nil {
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listViews scan: %v", err)
+			return
+		}
+		views = append(views, v)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// @Summary     Create a saved view
+// @Tags        Views
+// @Description Saves a ticket filter as a view. The filter uses the same fields as the GET /tickets
+// @Description query parameters; see ticketFilter. Personal views belong to the calling agent (x-agent-id).
+// @Accept      json
+// @Produce     json
+// @Param       body  body      createViewRequest  true  "View to create"
+// @Success     201   {object}  savedView
+// @Failure     400   {string}  string  "Bad Request"
+// @Failure     401   {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /views [post]
+func (a *App) createView(w http.ResponseWriter, r *http.Request) {
+	o := orgFromContext(r.Context())
+
+	var req createViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Sort == "" {
+		req.Sort = defaultTicketSort
+	}
+	if !validateView(w, r, req.Name, req.Visibility, req.Filter, req.Sort) {
+		return
+	}
+	if req.Position < 0 {
+		http.Error(w, "position must not be negative", http.StatusBadRequest)
+		return
+	}
+	var owner *string
+	if req.Visibility == "personal" {
+		owner = callerAgentID(r.Context())
+	}
+	filter, _ := json.Marshal(req.Filter)
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("createView begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	v, err := scanSavedView(tx.QueryRowContext(r.Context(), `
+		INSERT INTO saved_views (org_id, owner_agent_id, name, visibility, filter, sort, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+savedViewColumns,
+		o.ID, owner, req.Name, req.Visibility, filter, req.Sort, req.Position))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		log.Printf("createView insert: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "view.create",
+		TargetType: "view",
+		TargetID:   v.ID,
+		After:      v.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("createView audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("createView commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), o.ID, events.ViewUpdated, map[string]string{"view_id": v.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+// @Summary     Get a saved view
+// @Tags        Views
+// @Produce     json
+// @Param       viewID  path      string  true  "View ID"
+// @Success     200     {object}  savedView
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /views/{viewID} [get]
+func (a *App) getView(w http.ResponseWriter, r *http.Request) {
+	v, ok := a.loadVisibleView(w, r, a.conn(r.Context()), false)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// @Summary     Update a saved view
+// @Tags        Views
+// @Description Updates the fields present in the body. Making a shared view personal gives it to the calling agent.
+// @Accept      json
+// @Produce     json
+// @Param       viewID  path      string             true  "View ID"
+// @Param       body    body      updateViewRequest  true  "Fields to update"
+// @Success     200     {object}  savedView
+// @Failure     400     {string}  string  "Bad Request"
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /views/{viewID} [patch]
+func (a *App) updateView(w http.ResponseWriter, r *http.Request) {
+	var req updateViewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("updateView begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	old, ok := a.loadVisibleView(w, r, tx, true)
+	if !ok {
+		return
+	}
+	next := old
+	if req.Name != nil {
+		next.Name = *req.Name
+	}
+	if req.Visibility != nil {
+		next.Visibility = *req.Visibility
+	}
+	if req.Filter != nil {
+		next.Filter = *req.Filter
+	}
+	if req.Sort != nil {
+		next.Sort = *req.Sort
+	}
+	if req.Position != nil {
+		next.Position = *req.Position
+	}
+	if !validateView(w, r, next.Name, next.Visibility, next.Filter, next.Sort) {
+		return
+	}
+	if next.Position < 0 {
+		http.Error(w, "position must not be negative", http.StatusBadRequest)
+		return
+	}
+	next.OwnerAgentID = nil
+	if next.Visibility == "personal" {
+		next.OwnerAgentID = old.OwnerAgentID
+		if next.OwnerAgentID == nil {
+			next.OwnerAgentID = callerAgentID(r.Context())
+		}
+	}
+	filter, _ := json.Marshal(next.Filter)
+
+	v, err := scanSavedView(tx.QueryRowContext(r.Context(), `
+		UPDATE saved_views
+		SET name = $2, visibility = $3, owner_agent_id = $4, filter = $5, sort = $6, position = $7
+		WHERE id = $1
+		RETURNING `+savedViewColumns,
+		old.ID, next.Name, next.Visibility, next.OwnerAgentID, filter, next.Sort, next.Position))
+	if err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		log.Printf("updateView update: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "view.update",
+		TargetType: "view",
+		TargetID:   v.ID,
+		Before:     old.auditSnapshot(),
+		After:      v.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("updateView audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("updateView commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.ViewUpdated, map[string]string{"view_id": v.ID})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// @Summary     Delete a saved view
+// @Tags        Views
+// @Param       viewID  path      string  true  "View ID"
+// @Success     204
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /views/{viewID} [delete]
+func (a *App) deleteView(w http.ResponseWriter, r *http.Request) {
+	tx, err := a.conn(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		http.Error(w, "transaction failed", http.StatusInternalServerError)
+		log.Printf("deleteView begin tx: %v", err)
+		return
+	}
+	defer tx.Rollback()
+
+	v, ok := a.loadVisibleView(w, r, tx, true)
+	if !ok {
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM saved_views WHERE id = $1`, v.ID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		log.Printf("deleteView delete: %v", err)
+		return
+	}
+
+	if err := recordAudit(r.Context(), tx, auditEntry{
+		Action:     "view.delete",
+		TargetType: "view",
+		TargetID:   v.ID,
+		Before:     v.auditSnapshot(),
+	}); err != nil {
+		http.Error(w, "audit failed", http.StatusInternalServerError)
+		log.Printf("deleteView audit: %v", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		log.Printf("deleteView commit: %v", err)
+		return
+	}
+	a.bus.Publish(r.Context(), orgFromContext(r.Context()).ID, events.ViewUpdated, map[string]string{"view_id": v.ID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary     List a saved view's tickets
+// @Tags        Views
+// @Description Evaluates the view's filter and sort, exactly as GET /tickets would with the same parameters
+// @Produce     json
+// @Param       viewID  path      string  true  "View ID"
+// @Success     200     {array}   ticketRow
+// @Failure     400     {string}  string  "Bad Request"
+// @Failure     401     {string}  string  "Unauthorized"
+// @Failure     404     {string}  string  "Not Found"
+// @Security    ApiKeyAuth
+// @Router      /views/{viewID}/tickets [get]
+func (a *App) listViewTickets(w http.ResponseWriter, r *http.Request) {
+	conn := a.conn(r.Context())
+	v, ok := a.loadVisibleView(w, r, conn, false)
+	if !ok {
+		return
+	}
+
+	tickets, err := queryTickets(r.Context(), conn, orgFromContext(r.Context()).ID, v.Filter, v.Sort)
+	if errors.Is(err, errFilterNeedsAgent) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listViewTickets query: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tickets)
+}
+
+// @Summary     Count tickets per saved view
+// @Tags        Views
+// @Description Returns the current ticket count of every view visible to the caller, for sidebar badges.
+// @Description Counts are computed on request; refetch on ticket.* and view.updated events from GET /events.
+// @Description Views filtering on assignee "me", read or starred are omitted when the request has no x-agent-id.
+// @Produce     json
+// @Success     200  {array}   viewCount
+// @Failure     401  {string}  string  "Unauthorized"
+// @Security    ApiKeyAuth
+// @Router      /views/counts [get]
+func (a *App) listViewCounts(w http.ResponseWriter, r *http.Request) {
+	conn := a.conn(r.Context())
+	rows, err := conn.QueryContext(r.Context(), `
+		SELECT `+savedViewColumns+`
+		FROM saved_views
+		WHERE `+visibleViewsCondition+`
+		ORDER BY position, name, id
+	`, callerAgentID(r.Context()))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		log.Printf("listViewCounts query: %v", err)
+		return
+	}
+	// Read every view before counting: the connection serves one result set at a time.
+	var views []savedView
+	for rows.Next() {
+		v, err := scanSavedView(rows)
+		if err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			log.Printf("listViewCounts scan: %v", err)
+			return
+		}
+		views = append(views, v)
+	}
+	rows.Close()
+
+	o := orgFromContext(r.Context())
+	counts := []viewCount{}
+	for _, v := range views {
+		n, err := countTickets(r.Context(), conn, o.ID, v.Filter)
+		if errors.Is(err, errFilterNeedsAgent) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			log.Printf("listViewCounts count %s: %v", v.ID, err)
+			return
+		}
+		counts = append(counts, viewCount{ViewID: v.ID, Count: n})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
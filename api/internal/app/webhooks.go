@@ -10,11 +10,13 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"purl/api/internal/events"
 	"purl/api/internal/ratelimit"
 )
 
@@ -60,10 +62,36 @@ type webhookTicketDetail struct {
 	Subject     string     `json:"subject"`
 	Description string     `json:"description"`
 	Status      string     `json:"status"`
+	Priority    *string    `json:"priority"`
 	RequesterID flexInt64  `json:"requester_id"`
 	AssigneeID  *flexInt64 `json:"assignee_id"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	// Tags is the ticket's full tag list; nil when the payload omits it.
+	Tags []string `json:"tags"`
+	// CustomFields is nil when the payload omits them.
+	CustomFields []zendeskCustomField `json:"custom_fields"`
+	CreatedAt    time.Time            `json:"created_at"`
+	UpdatedAt    time.Time            `json:"updated_at"`
+}
+
+// zendeskCustomField is one ticket custom field value. Value is a string,
+// number, bool, list of option tags or null depending on the field type.
+type zendeskCustomField struct {
+	ID    flexInt64 `json:"id"`
+	Value any       `json:"value"`
+}
+
+// customFieldsJSON returns fields as the tickets.custom_fields document, keyed
+// by field ID, or nil if fields is nil so callers can leave the column alone.
+func customFieldsJSON(fields []zendeskCustomField) []byte {
+	if fields == nil {
+		return nil
+	}
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		m[strconv.FormatInt(int64(f.ID), 10)] = f.Value
+	}
+	b, _ := json.Marshal(m)
+	return b
 }
 
 type webhookTicketDeletedDetail struct {
@@ -156,9 +184,17 @@ func (a *App) handleZendeskWebhook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	conn, release, err := a.orgConn(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		log.Printf("webhook: scope conn for org %q: %v", orgSlug, err)
+		return
+	}
+	defer release()
+
 	// Store the raw payload — processing happens asynchronously via
 	// the process-zendesk-webhooks command.
-	_, err = a.db.ExecContext(r.Context(), `
+	_, err = conn.ExecContext(r.Context(), `
 		INSERT INTO zendesk_webhook_events (org_id, event_id, event_type, payload)
 		VALUES ($1, $2, $3, $4)`,
 		orgID, envelope.ID, envelope.Type, body,
@@ -181,8 +217,9 @@ func (a *App) handleZendeskWebhook(w http.ResponseWriter, r *http.Request) {
 // they are not retried. Unsupported event types are silently acknowledged and also marked as
 // processed to prevent them from accumulating.
 //
-// limiter may be nil to skip rate limiting. Returns the number of events marked as processed.
-func ProcessPendingWebhooks(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter) (int, error) {
+// limiter may be nil to skip rate limiting, and bus may be nil to skip publishing
+// change events. Returns the number of events marked as processed.
+func ProcessPendingWebhooks(ctx context.Context, db *sql.DB, limiter *ratelimit.Limiter, bus *events.Bus) (int, error) {
 	rows, err := db.QueryContext(ctx, `
 		SELECT id, org_id, event_type, payload
 		FROM zendesk_webhook_events
@@ -200,14 +237,14 @@ func ProcessPendingWebhooks(ctx context.Context, db *sql.DB, limiter *ratelimit.
 		eventType string
 		payload   []byte
 	}
-	var events []pending
+	var pendingEvents []pending
 	for rows.Next() {
 		var e pending
 		if err := rows.Scan(&e.id, &e.orgID, &e.eventType, &e.payload); err != nil {
 			rows.Close()
 			return 0, fmt.Errorf("scan event: %w", err)
 		}
-		events = append(events, e)
+		pendingEvents = append(pendingEvents, e)
 	}
 	rows.Close()
 	if err := rows.Err(); err != nil {
@@ -215,8 +252,8 @@ func ProcessPendingWebhooks(ctx context.Context, db *sql.DB, limiter *ratelimit.
 	}
 
 	processed := 0
-	for _, e := range events {
-		if err := processZendeskEvent(ctx, db, e.orgID, e.eventType, e.payload, limiter); err != nil {
+	for _, e := range pendingEvents {
+		if err := processZendeskEvent(ctx, db, e.orgID, e.eventType, e.payload, limiter, bus); err != nil {
 			log.Printf("process-zendesk-webhooks: event %s (%s) failed (no retry): %v", e.id, e.eventType, err)
 			if _, dbErr := db.ExecContext(ctx,
 				`UPDATE zendesk_webhook_events SET processed_at = now(), last_error = $1 WHERE id = $2`,
@@ -241,7 +278,7 @@ func ProcessPendingWebhooks(ctx context.Context, db *sql.DB, limiter *ratelimit.
 // processZendeskEvent dispatches a single webhook event to the appropriate
 // handler based on event_type. Unknown types are silently ignored (return nil)
 // so the caller can mark them as processed without logging noise.
-func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType string, payload []byte, limiter *ratelimit.Limiter) error {
+func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType string, payload []byte, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	var envelope zendeskWebhookEnvelope
 	if err := json.Unmarshal(payload, &envelope); err != nil {
 		return fmt.Errorf("unmarshal envelope: %w", err)
@@ -253,12 +290,13 @@ func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType strin
 		"zen:event-type:ticket.subject_changed",
 		"zen:event-type:ticket.description_changed",
 		"zen:event-type:ticket.agent_assignment_changed",
+		"zen:event-type:ticket.tags_changed",
 		"zen:event-type:ticket.merged":
 		var d webhookTicketDetail
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal ticket detail: %w", err)
 		}
-		return handleTicketUpsert(ctx, db, orgID, &d, limiter)
+		return handleTicketUpsert(ctx, db, orgID, &d, limiter, bus)
 
 	case "zen:event-type:ticket.comment_added", "zen:event-type:messaging_ticket.message_added":
 		// Comment data in these events is incomplete (no html_body, no created_at),
@@ -269,14 +307,14 @@ func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType strin
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal ticket detail: %w", err)
 		}
-		return handleTicketCommentAdded(ctx, db, orgID, d.ID, limiter)
+		return handleTicketCommentAdded(ctx, db, orgID, d.ID, limiter, bus)
 
 	case "zen:event-type:ticket.status_changed":
 		var d webhookTicketDetail
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal ticket detail: %w", err)
 		}
-		return handleTicketStatusChanged(ctx, db, orgID, &d)
+		return handleTicketStatusChanged(ctx, db, orgID, &d, limiter, bus)
 
 	case "zen:event-type:ticket.deleted",
 		"zen:event-type:ticket.soft_deleted",
@@ -285,21 +323,21 @@ func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType strin
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal ticket deleted detail: %w", err)
 		}
-		return handleTicketDeleted(ctx, db, orgID, d.ID)
+		return handleTicketDeleted(ctx, db, orgID, d.ID, bus)
 
 	case "zen:event-type:comment.created":
 		var d webhookCommentDetail
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal comment detail: %w", err)
 		}
-		return handleCommentCreated(ctx, db, orgID, &d, limiter)
+		return handleCommentCreated(ctx, db, orgID, &d, limiter, bus)
 
 	case "zen:event-type:comment.updated":
 		var d webhookCommentDetail
 		if err := json.Unmarshal(envelope.Detail, &d); err != nil {
 			return fmt.Errorf("unmarshal comment detail: %w", err)
 		}
-		return handleCommentUpdated(ctx, db, orgID, &d, limiter)
+		return handleCommentUpdated(ctx, db, orgID, &d, limiter, bus)
 
 	case "zen:event-type:user.created", "zen:event-type:user.updated":
 		var d webhookUserDetail
@@ -317,7 +355,7 @@ func processZendeskEvent(ctx context.Context, db *sql.DB, orgID, eventType strin
 
 // ── Event handlers ────────────────────────────────────────────────────────────
 
-func handleTicketUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhookTicketDetail, limiter *ratelimit.Limiter) error {
+func handleTicketUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhookTicketDetail, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -370,16 +408,21 @@ func handleTicketUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhoo
 	var ticketID string
 	err = tx.QueryRowContext(ctx, `
 		INSERT INTO tickets (title, description, reporter_id, assignee_id, org_id,
-		                     zendesk_status, zendesk_ticket_id, received_at, zendesk_updated_at, resolved_at)
+		                     zendesk_status, zendesk_ticket_id, received_at, zendesk_updated_at, resolved_at,
+		                     custom_fields, zendesk_priority)
 		VALUES ($1, $2, $3, $4, $5, $6::zendesk_status_category, $7, $8, $9,
 		        CASE WHEN $6::zendesk_status_category IN ('solved'::zendesk_status_category, 'closed'::zendesk_status_category)
-		             THEN $9::TIMESTAMPTZ ELSE NULL END)
+		             THEN $9::TIMESTAMPTZ ELSE NULL END,
+		        COALESCE($10::jsonb, '{}'), $11)
 		ON CONFLICT (org_id, zendesk_ticket_id) DO UPDATE SET
 			title              = EXCLUDED.title,
 			description        = EXCLUDED.description,
 			reporter_id        = EXCLUDED.reporter_id,
 			assignee_id        = EXCLUDED.assignee_id,
 			zendesk_status     = EXCLUDED.zendesk_status,
+			zendesk_priority   = EXCLUDED.zendesk_priority,
+			-- Keep stored custom fields when the payload doesn't carry them.
+			custom_fields      = CASE WHEN $10::jsonb IS NULL THEN tickets.custom_fields ELSE EXCLUDED.custom_fields END,
 			zendesk_updated_at = EXCLUDED.zendesk_updated_at,
 			-- Preserve original resolved_at when already set; clear it if no longer solved/closed.
 			resolved_at        = CASE
@@ -389,7 +432,7 @@ func handleTicketUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhoo
 			END
 		RETURNING id`,
 		d.Subject, d.Description, reporterID, assigneeID, orgID,
-		newStatus, d.ID, d.CreatedAt, d.UpdatedAt,
+		newStatus, d.ID, d.CreatedAt, d.UpdatedAt, customFieldsJSON(d.CustomFields), mapZendeskPriority(d.Priority),
 	).Scan(&ticketID)
 	if err != nil {
 		return fmt.Errorf("upsert ticket: %w", err)
@@ -398,37 +441,79 @@ func handleTicketUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhoo
 	// Sync default kanban only when the ticket is new or its status changed.
 	isNew := oldStatus == nil
 	statusChanged := oldStatus != nil && *oldStatus != newStatus
+	var boardID string
 	if isNew || statusChanged {
-		if err := syncTicketToDefaultKanban(ctx, tx, orgID, ticketID, newStatus); err != nil {
+		if boardID, err = syncTicketToDefaultKanban(ctx, tx, orgID, ticketID, newStatus); err != nil {
 			return fmt.Errorf("sync kanban: %w", err)
 		}
 	}
+	var sent []sentNotification
+	if statusChanged {
+		if sent, err = notifyFollowersOfStatus(ctx, tx, orgID, ticketID, *oldStatus, newStatus, nil); err != nil {
+			return fmt.Errorf("notify followers: %w", err)
+		}
+	}
+
+	if d.Tags != nil {
+		if err := setTicketTags(ctx, tx, orgID, ticketID, d.Tags); err != nil {
+			return fmt.Errorf("sync tags: %w", err)
+		}
+	}
 
 	if err := tx.Commit(); err != nil {
 		return err
 	}
+	publishTicketChange(ctx, bus, orgID, ticketID, boardID)
+	publishNotifications(ctx, bus, orgID, sent)
 
 	// Sync all comments for this ticket from the Zendesk API. This covers the
 	// case where comment.created webhooks are not fired (e.g. Zendesk does not
 	// send a separate comment.created event for the initial message when a
 	// ticket is first created). The insert is idempotent, so re-syncing on
 	// ticket.updated is safe.
-	if err := syncTicketComments(ctx, db, orgID, d.ID, limiter); err != nil {
+	if err := syncTicketComments(ctx, db, orgID, d.ID, limiter, bus); err != nil {
 		return fmt.Errorf("sync comments for ticket %d: %w", d.ID, err)
 	}
 
+	logSLA(refreshTicketSLA(ctx, db, orgID, ticketID, bus), ticketID)
+
+	// Routing runs before automations so ticket_created rules see the
+	// assignee it picked.
+	if isNew {
+		if err := routeNewTicket(ctx, db, orgID, ticketID, limiter, bus); err != nil {
+			log.Printf("routing for ticket %s: %v", ticketID, err)
+		}
+	}
+
+	// Automations run once the comments are in, so rules on a new ticket can
+	// test the channel of its first message.
+	if isNew {
+		logAutomations(runAutomations(ctx, db, orgID, ticketID, automationEvent{Trigger: triggerTicketCreated}, limiter, bus), ticketID)
+	}
+	if statusChanged {
+		logAutomations(runAutomations(ctx, db, orgID, ticketID, automationEvent{Trigger: triggerStatusChanged}, limiter, bus), ticketID)
+	}
+
 	return nil
 }
 
-func handleTicketDeleted(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64) error {
-	_, err := db.ExecContext(ctx,
-		`DELETE FROM tickets WHERE org_id = $1 AND zendesk_ticket_id = $2`,
+func handleTicketDeleted(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64, bus *events.Bus) error {
+	var ticketID string
+	err := db.QueryRowContext(ctx,
+		`DELETE FROM tickets WHERE org_id = $1 AND zendesk_ticket_id = $2 RETURNING id`,
 		orgID, zendeskTicketID,
-	)
-	return err
+	).Scan(&ticketID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	bus.Publish(ctx, orgID, events.TicketDeleted, map[string]string{"ticket_id": ticketID})
+	return nil
 }
 
-func handleTicketStatusChanged(ctx context.Context, db *sql.DB, orgID string, d *webhookTicketDetail) error {
+func handleTicketStatusChanged(ctx context.Context, db *sql.DB, orgID string, d *webhookTicketDetail, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -467,16 +552,48 @@ func handleTicketStatusChanged(ctx context.Context, db *sql.DB, orgID string, d
 		return fmt.Errorf("update ticket status: %w", err)
 	}
 
+	var boardID string
+	var sent []sentNotification
 	if oldStatus != newStatus {
-		if err := syncTicketToDefaultKanban(ctx, tx, orgID, ticketID, newStatus); err != nil {
+		if boardID, err = syncTicketToDefaultKanban(ctx, tx, orgID, ticketID, newStatus); err != nil {
 			return fmt.Errorf("sync kanban: %w", err)
 		}
+		if sent, err = notifyFollowersOfStatus(ctx, tx, orgID, ticketID, oldStatus, newStatus, nil); err != nil {
+			return fmt.Errorf("notify followers: %w", err)
+		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	publishTicketChange(ctx, bus, orgID, ticketID, boardID)
+	publishNotifications(ctx, bus, orgID, sent)
+	logSLA(refreshTicketSLA(ctx, db, orgID, ticketID, bus), ticketID)
+	if oldStatus != newStatus {
+		logAutomations(runAutomations(ctx, db, orgID, ticketID, automationEvent{Trigger: triggerStatusChanged}, limiter, bus), ticketID)
+	}
+	return nil
 }
 
-func handleTicketCommentAdded(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64, limiter *ratelimit.Limiter) error {
+// logAutomations logs the failure, if any, of the automations run for a
+// ticket. It doesn't fail the webhook event: the change itself was stored,
+// and each failed rule is recorded in its run trace.
+func logAutomations(err error, ticketID string) {
+	if err != nil {
+		log.Printf("automations for ticket %s: %v", ticketID, err)
+	}
+}
+
+// publishTicketChange announces a committed ticket upsert and, if boardID is
+// set, the resulting move on that board.
+func publishTicketChange(ctx context.Context, bus *events.Bus, orgID, ticketID, boardID string) {
+	bus.Publish(ctx, orgID, events.TicketUpdated, map[string]string{"ticket_id": ticketID})
+	if boardID != "" {
+		bus.Publish(ctx, orgID, events.BoardTicketsChanged, map[string]string{"board_id": boardID, "ticket_id": ticketID})
+	}
+}
+
+func handleTicketCommentAdded(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	// Ensure the ticket exists; fetch from Zendesk if we haven't seen it yet.
 	var exists bool
 	if err := db.QueryRowContext(ctx,
@@ -493,11 +610,11 @@ func handleTicketCommentAdded(ctx context.Context, db *sql.DB, orgID string, zen
 		if ticket == nil {
 			return fmt.Errorf("ticket %d not found and Zendesk credentials not configured", zendeskTicketID)
 		}
-		if upsertErr := handleTicketUpsert(ctx, db, orgID, ticket, limiter); upsertErr != nil {
+		if upsertErr := handleTicketUpsert(ctx, db, orgID, ticket, limiter, bus); upsertErr != nil {
 			return fmt.Errorf("upsert fetched ticket %d: %w", zendeskTicketID, upsertErr)
 		}
 	}
-	return syncTicketComments(ctx, db, orgID, zendeskTicketID, limiter)
+	return syncTicketComments(ctx, db, orgID, zendeskTicketID, limiter, bus)
 }
 
 // ── Web chat parsing ──────────────────────────────────────────────────────────
@@ -558,17 +675,22 @@ func parseWebChatBody(body string) []webChatLine {
 // insertCommentForTicket resolves the comment author and inserts the appropriate
 // ticket_comments row(s) for d within tx. Web-chat bodies are split into one row
 // per transcript line; all other comments produce a single row. Also marks the
-// ticket as AI-summary-stale.
-func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID, ticketID string, d *webhookCommentDetail, limiter *ratelimit.Limiter) error {
+// ticket as AI-summary-stale. Reports whether any new row was inserted (false
+// when the comment was already stored), and whether any new row was the
+// customer's.
+//
+// q serves the lookups outside tx: the owner connection in workers, the
+// request's transaction in handlers so that they stay within its org.
+func insertCommentForTicket(ctx context.Context, q queryer, tx *sql.Tx, orgID, ticketID string, d *webhookCommentDetail, limiter *ratelimit.Limiter) (bool, bool, error) {
 	var customerAuthorID *string
 	var agentAuthorID *string
 	var role string
 
 	if d.AuthorID <= 0 {
 		// author_id <= 0 is the Zendesk system/automation user.
-		id, err := resolveSystemAgent(ctx, db, orgID)
+		id, err := resolveSystemAgent(ctx, q, orgID)
 		if err != nil {
-			return fmt.Errorf("resolve system agent: %w", err)
+			return false, false, fmt.Errorf("resolve system agent: %w", err)
 		}
 		agentAuthorID = &id
 		role = "agent"
@@ -589,21 +711,21 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 				agentAuthorID = &agentID
 				role = "agent"
 			} else {
-				fetched, fetchErr := fetchZendeskUser(ctx, db, orgID, d.AuthorID, limiter)
+				fetched, fetchErr := fetchZendeskUser(ctx, q, orgID, d.AuthorID, limiter)
 				if fetchErr != nil || fetched == nil {
-					return fmt.Errorf("author %d not found (may arrive in a later event)", d.AuthorID)
+					return false, false, fmt.Errorf("author %d not found (may arrive in a later event)", d.AuthorID)
 				}
 				if fetched.Role == "end-user" {
 					cid, upsertErr := upsertCustomer(ctx, tx, orgID, fetched.ID, fetched.Name, fetched.Email)
 					if upsertErr != nil {
-						return fmt.Errorf("upsert author customer: %w", upsertErr)
+						return false, false, fmt.Errorf("upsert author customer: %w", upsertErr)
 					}
 					customerAuthorID = &cid
 					role = "customer"
 				} else {
 					aid, upsertErr := upsertAgent(ctx, tx, orgID, fetched.ID, fetched.Name, fetched.Email)
 					if upsertErr != nil {
-						return fmt.Errorf("upsert author agent: %w", upsertErr)
+						return false, false, fmt.Errorf("upsert author agent: %w", upsertErr)
 					}
 					agentAuthorID = &aid
 					role = "agent"
@@ -612,12 +734,14 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 		}
 	}
 
+	// inserted and customerInserted track whether any row, and any customer row, was new.
+	inserted, customerInserted := false, false
 	// Zendesk uses via.channel="chat_transcript" for all web chat messages.
 	if d.Via.Channel == "chat_transcript" {
 		chatLines := parseWebChatBody(d.Body)
-		systemAgentID, err := resolveSystemAgent(ctx, db, orgID)
+		systemAgentID, err := resolveSystemAgent(ctx, q, orgID)
 		if err != nil {
-			return fmt.Errorf("resolve system agent: %w", err)
+			return false, false, fmt.Errorf("resolve system agent: %w", err)
 		}
 
 		// Customer-role lines are attributed to the ticket's reporter.
@@ -643,7 +767,7 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 			} else {
 				lineAgentAuthorID = &systemAgentID
 			}
-			if _, err := tx.ExecContext(ctx, `
+			res, err := tx.ExecContext(ctx, `
 				INSERT INTO ticket_comments
 					(ticket_id, customer_author_id, agent_author_id, role, body, html_body,
 					 channel, zendesk_comment_id, zendesk_sub_index, author_display_name,
@@ -654,8 +778,13 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 				ON CONFLICT (ticket_id, zendesk_comment_id, zendesk_sub_index) DO NOTHING`,
 				ticketID, lineCustomerAuthorID, lineAgentAuthorID, line.Role,
 				line.Text, d.ID, i, line.Speaker, d.CreatedAt,
-			); err != nil {
-				return fmt.Errorf("insert web chat line %d: %w", i, err)
+			)
+			if err != nil {
+				return false, false, fmt.Errorf("insert web chat line %d: %w", i, err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				inserted = true
+				customerInserted = customerInserted || line.Role == "customer"
 			}
 		}
 	} else {
@@ -687,7 +816,7 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 			}
 		}
 
-		if _, err := tx.ExecContext(ctx, `
+		res, err := tx.ExecContext(ctx, `
 			INSERT INTO ticket_comments
 				(ticket_id, customer_author_id, agent_author_id, role, body, html_body, channel, zendesk_comment_id, zendesk_sub_index, received_at,
 				 call_id, recording_url, transcription_text, transcription_status, call_duration,
@@ -699,8 +828,13 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 			d.Body, nilIfEmpty(d.HtmlBody), mapCommentChannel(d.Via.Channel, d.Public), d.ID, d.CreatedAt,
 			callID, recordingURL, transcriptionText, transcriptionStatus, callDuration,
 			callFrom, callTo, answeredByName, callLocation, callStartedAt,
-		); err != nil {
-			return fmt.Errorf("upsert comment: %w", err)
+		)
+		if err != nil {
+			return false, false, fmt.Errorf("upsert comment: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			inserted = true
+			customerInserted = role == "customer"
 		}
 	}
 
@@ -708,13 +842,13 @@ func insertCommentForTicket(ctx context.Context, db *sql.DB, tx *sql.Tx, orgID,
 	if _, err := tx.ExecContext(ctx,
 		`UPDATE tickets SET ai_summary_stale = TRUE, ai_summary_error_count = 0 WHERE id = $1`, ticketID,
 	); err != nil {
-		return fmt.Errorf("mark ticket stale: %w", err)
+		return false, false, fmt.Errorf("mark ticket stale: %w", err)
 	}
 
-	return nil
+	return inserted, customerInserted, nil
 }
 
-func handleCommentCreated(ctx context.Context, db *sql.DB, orgID string, d *webhookCommentDetail, limiter *ratelimit.Limiter) error {
+func handleCommentCreated(ctx context.Context, db *sql.DB, orgID string, d *webhookCommentDetail, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	// Resolve the ticket, fetching from Zendesk if not yet in the DB.
 	var ticketID string
 	if err := db.QueryRowContext(ctx,
@@ -728,7 +862,7 @@ func handleCommentCreated(ctx context.Context, db *sql.DB, orgID string, d *webh
 		if ticket == nil {
 			return fmt.Errorf("ticket %d not found and Zendesk credentials not configured", d.TicketID)
 		}
-		if upsertErr := handleTicketUpsert(ctx, db, orgID, ticket, limiter); upsertErr != nil {
+		if upsertErr := handleTicketUpsert(ctx, db, orgID, ticket, limiter, bus); upsertErr != nil {
 			return fmt.Errorf("upsert fetched ticket %d: %w", d.TicketID, upsertErr)
 		}
 		if err := db.QueryRowContext(ctx,
@@ -747,14 +881,50 @@ func handleCommentCreated(ctx context.Context, db *sql.DB, orgID string, d *webh
 	}
 	defer tx.Rollback()
 
-	if err := insertCommentForTicket(ctx, db, tx, orgID, ticketID, d, limiter); err != nil {
+	inserted, customerInserted, err := insertCommentForTicket(ctx, db, tx, orgID, ticketID, d, limiter)
+	if err != nil {
 		return err
 	}
+	var sent []sentNotification
+	// A new customer message makes the ticket unread for every agent, wakes it
+	// if snoozed and notifies its assignee.
+	if customerInserted {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE ticket_agent_state SET last_read_at = NULL WHERE ticket_id = $1 AND last_read_at IS NOT NULL`, ticketID,
+		); err != nil {
+			return fmt.Errorf("mark ticket unread: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE tickets SET snoozed_at = NULL, snoozed_until = NULL, snoozed_by = NULL
+			 WHERE id = $1 AND snoozed_at IS NOT NULL`, ticketID,
+		); err != nil {
+			return fmt.Errorf("wake ticket: %w", err)
+		}
+		if sent, err = notifyAssigneeOfReply(ctx, tx, orgID, ticketID); err != nil {
+			return err
+		}
+	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if inserted {
+		bus.Publish(ctx, orgID, events.CommentCreated, map[string]string{"ticket_id": ticketID})
+	}
+	publishNotifications(ctx, bus, orgID, sent)
+	if inserted {
+		logSLA(refreshTicketSLA(ctx, db, orgID, ticketID, bus), ticketID)
+		channel := mapCommentChannel(d.Via.Channel, d.Public)
+		if d.Via.Channel == "chat_transcript" {
+			channel = "chat"
+		}
+		logAutomations(runAutomations(ctx, db, orgID, ticketID,
+			automationEvent{Trigger: triggerCommentAdded, CommentChannel: channel}, limiter, bus), ticketID)
+	}
+	return nil
 }
 
-func handleCommentUpdated(ctx context.Context, db *sql.DB, orgID string, d *webhookCommentDetail, limiter *ratelimit.Limiter) error {
+func handleCommentUpdated(ctx context.Context, db *sql.DB, orgID string, d *webhookCommentDetail, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	// Resolve the ticket. If it doesn't exist yet, there's nothing to update.
 	var ticketID string
 	if err := db.QueryRowContext(ctx,
@@ -780,11 +950,18 @@ func handleCommentUpdated(ctx context.Context, db *sql.DB, orgID string, d *webh
 		return fmt.Errorf("delete comment rows: %w", err)
 	}
 
-	if err := insertCommentForTicket(ctx, db, tx, orgID, ticketID, d, limiter); err != nil {
+	// Edits are re-inserted as new rows, so customerInserted is ignored here:
+	// the original comment already made the ticket unread, woke it and
+	// notified the assignee.
+	if _, _, err := insertCommentForTicket(ctx, db, tx, orgID, ticketID, d, limiter); err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	bus.Publish(ctx, orgID, events.CommentUpdated, map[string]string{"ticket_id": ticketID})
+	return nil
 }
 
 func handleUserUpsert(ctx context.Context, db *sql.DB, orgID string, d *webhookUserDetail) error {
@@ -876,9 +1053,9 @@ func upsertCustomer(ctx context.Context, tx *sql.Tx, orgID string, zendeskUserID
 // resolveSystemAgent upserts a "Zendesk Automation" agent for the org and returns
 // its purl ID. Zendesk uses author_id <= 0 for comments from triggers, automations,
 // bots, and other system processes that have no real user behind them.
-func resolveSystemAgent(ctx context.Context, db *sql.DB, orgID string) (string, error) {
+func resolveSystemAgent(ctx context.Context, q queryer, orgID string) (string, error) {
 	var id string
-	err := db.QueryRowContext(ctx, `
+	err := q.QueryRowContext(ctx, `
 		INSERT INTO agents (email, name, org_id, zendesk_user_id)
 		VALUES ('zendesk-automation@system.invalid', 'Zendesk Automation', $1, -1)
 		ON CONFLICT (org_id, zendesk_user_id) DO UPDATE SET name = EXCLUDED.name
@@ -904,24 +1081,25 @@ func upsertAgent(ctx context.Context, tx *sql.Tx, orgID string, zendeskUserID fl
 // syncTicketToDefaultKanban removes a ticket from its current column in the
 // default board and re-inserts it into the column matching zendesk_status.
 // If no matching column exists, the ticket is simply removed from the board.
-func syncTicketToDefaultKanban(ctx context.Context, tx *sql.Tx, orgID, ticketID, status string) error {
+// Returns the default board's ID, or "" if the org has no default board.
+func syncTicketToDefaultKanban(ctx context.Context, tx *sql.Tx, orgID, ticketID, status string) (string, error) {
 	var defaultBoardID string
 	err := tx.QueryRowContext(ctx,
 		`SELECT id FROM boards WHERE org_id = $1 AND is_default = true`,
 		orgID,
 	).Scan(&defaultBoardID)
 	if err == sql.ErrNoRows {
-		return nil // no default board configured
+		return "", nil // no default board configured
 	}
 	if err != nil {
-		return fmt.Errorf("query default board: %w", err)
+		return "", fmt.Errorf("query default board: %w", err)
 	}
 
 	if _, err := tx.ExecContext(ctx,
 		`DELETE FROM board_tickets WHERE board_id = $1 AND ticket_id = $2`,
 		defaultBoardID, ticketID,
 	); err != nil {
-		return fmt.Errorf("remove from board: %w", err)
+		return "", fmt.Errorf("remove from board: %w", err)
 	}
 
 	var columnID string
@@ -930,10 +1108,10 @@ func syncTicketToDefaultKanban(ctx context.Context, tx *sql.Tx, orgID, ticketID,
 		defaultBoardID, status,
 	).Scan(&columnID)
 	if err == sql.ErrNoRows {
-		return nil // status not covered by any column; ticket stays off the board
+		return defaultBoardID, nil // status not covered by any column; ticket stays off the board
 	}
 	if err != nil {
-		return fmt.Errorf("query column for status %q: %w", status, err)
+		return "", fmt.Errorf("query column for status %q: %w", status, err)
 	}
 
 	_, err = tx.ExecContext(ctx, `
@@ -943,17 +1121,17 @@ func syncTicketToDefaultKanban(ctx context.Context, tx *sql.Tx, orgID, ticketID,
 		defaultBoardID, columnID, ticketID,
 	)
 	if err != nil {
-		return fmt.Errorf("insert into board: %w", err)
+		return "", fmt.Errorf("insert into board: %w", err)
 	}
 
-	return nil
+	return defaultBoardID, nil
 }
 
 // fetchZendeskUser fetches a single user from the Zendesk REST API using the
 // org's stored credentials. Returns nil if credentials are not configured.
-func fetchZendeskUser(ctx context.Context, db *sql.DB, orgID string, zendeskUserID flexInt64, limiter *ratelimit.Limiter) (*webhookUserDetail, error) {
+func fetchZendeskUser(ctx context.Context, q queryer, orgID string, zendeskUserID flexInt64, limiter *ratelimit.Limiter) (*webhookUserDetail, error) {
 	var subdomain, email, apiKey string
-	err := db.QueryRowContext(ctx,
+	err := q.QueryRowContext(ctx,
 		`SELECT COALESCE(zendesk_subdomain,''), COALESCE(zendesk_email,''), COALESCE(zendesk_api_key,'')
 		 FROM organizations WHERE id = $1`,
 		orgID,
@@ -984,6 +1162,9 @@ func fetchZendeskUser(ctx context.Context, db *sql.DB, orgID string, zendeskUser
 		return nil, fmt.Errorf("zendesk request: %w", err)
 	}
 	defer resp.Body.Close()
+	if limiter != nil {
+		limiter.Observe(ctx, creds, resp.Header)
+	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -1037,6 +1218,9 @@ func fetchZendeskTicket(ctx context.Context, db *sql.DB, orgID string, zendeskTi
 		return nil, fmt.Errorf("zendesk request: %w", err)
 	}
 	defer resp.Body.Close()
+	if limiter != nil {
+		limiter.Observe(ctx, creds, resp.Header)
+	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -1094,6 +1278,9 @@ func fetchZendeskTicketComments(ctx context.Context, db *sql.DB, orgID string, z
 		return nil, fmt.Errorf("zendesk request: %w", err)
 	}
 	defer resp.Body.Close()
+	if limiter != nil {
+		limiter.Observe(ctx, creds, resp.Header)
+	}
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -1134,7 +1321,7 @@ func fetchZendeskTicketComments(ctx context.Context, db *sql.DB, orgID string, z
 
 // syncTicketComments fetches all comments for a ticket from the Zendesk API
 // and upserts each one. Returns nil if credentials are not configured.
-func syncTicketComments(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64, limiter *ratelimit.Limiter) error {
+func syncTicketComments(ctx context.Context, db *sql.DB, orgID string, zendeskTicketID flexInt64, limiter *ratelimit.Limiter, bus *events.Bus) error {
 	comments, err := fetchZendeskTicketComments(ctx, db, orgID, zendeskTicketID, limiter)
 	if err != nil {
 		return fmt.Errorf("fetch comments: %w", err)
@@ -1143,13 +1330,26 @@ func syncTicketComments(ctx context.Context, db *sql.DB, orgID string, zendeskTi
 		return nil // credentials not configured
 	}
 	for _, c := range comments {
-		if err := handleCommentCreated(ctx, db, orgID, &c, limiter); err != nil {
+		if err := handleCommentCreated(ctx, db, orgID, &c, limiter, bus); err != nil {
 			return fmt.Errorf("upsert comment %d: %w", c.ID, err)
 		}
 	}
 	return nil
 }
 
+// mapZendeskPriority returns a Zendesk ticket priority as stored in
+// tickets.zendesk_priority, or nil if it is unset or unrecognised.
+func mapZendeskPriority(p *string) *string {
+	if p == nil {
+		return nil
+	}
+	lower := strings.ToLower(*p)
+	if !slices.Contains(zendeskPriorities, lower) {
+		return nil
+	}
+	return &lower
+}
+
 // mapZendeskStatus maps a raw Zendesk ticket status string to our
 // zendesk_status_category enum value. Accepts mixed case (e.g. "SOLVED").
 func mapZendeskStatus(s string) string {
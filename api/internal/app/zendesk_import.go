@@ -16,14 +16,18 @@ import (
 )
 
 type ZendeskTicket struct {
-	ID          int64     `json:"id"`
-	Subject     string    `json:"subject"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	RequesterID int64     `json:"requester_id"`
-	AssigneeID  *int64    `json:"assignee_id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int64    `json:"id"`
+	Subject     string   `json:"subject"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Priority    *string  `json:"priority"`
+	RequesterID int64    `json:"requester_id"`
+	AssigneeID  *int64   `json:"assignee_id"`
+	Tags        []string `json:"tags"`
+	// CustomFields are stored as tickets.custom_fields.
+	CustomFields []zendeskCustomField `json:"custom_fields"`
+	CreatedAt    time.Time            `json:"created_at"`
+	UpdatedAt    time.Time            `json:"updated_at"`
 }
 
 type ZendeskTicketsResponse struct {
@@ -109,9 +113,11 @@ func nilIfEmpty(s string) *string {
 	return &s
 }
 
-func ZendeskGet(subdomain, creds, path string) ([]byte, error) {
+// ZendeskGet fetches path from the Zendesk API. limiter, if not nil, is told
+// the rate-limit headers of the response; the caller waits on it beforehand.
+func ZendeskGet(ctx context.Context, limiter *ratelimit.Limiter, subdomain, creds, path string) ([]byte, error) {
 	url := fmt.Sprintf("https://%s.zendesk.com%s", subdomain, path)
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -123,6 +129,9 @@ func ZendeskGet(subdomain, creds, path string) ([]byte, error) {
 		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
+	if limiter != nil {
+		limiter.Observe(ctx, creds, resp.Header)
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -145,7 +154,7 @@ func fetchAllAgents(ctx context.Context, limiter *ratelimit.Limiter, subdomain,
 				return nil, err
 			}
 		}
-		body, err := ZendeskGet(subdomain, creds, path)
+		body, err := ZendeskGet(ctx, limiter, subdomain, creds, path)
 		if err != nil {
 			return nil, err
 		}
@@ -228,7 +237,7 @@ func ImportZendeskData(ctx context.Context, db *sql.DB, limiter *ratelimit.Limit
 			return err
 		}
 	}
-	ticketsBody, err := ZendeskGet(subdomain, creds, "/api/v2/tickets.json?sort_by=created_at&sort_order=desc&per_page=50")
+	ticketsBody, err := ZendeskGet(ctx, limiter, subdomain, creds, "/api/v2/tickets.json?sort_by=created_at&sort_order=desc&per_page=50")
 	if err != nil {
 		return fmt.Errorf("fetch tickets: %w", err)
 	}
@@ -249,7 +258,7 @@ func ImportZendeskData(ctx context.Context, db *sql.DB, limiter *ratelimit.Limit
 				return err
 			}
 		}
-		commentsBody, err := ZendeskGet(subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticket.ID))
+		commentsBody, err := ZendeskGet(ctx, limiter, subdomain, creds, fmt.Sprintf("/api/v2/tickets/%d/comments.json", ticket.ID))
 		if err != nil {
 			return fmt.Errorf("fetch comments for ticket %d: %w", ticket.ID, err)
 		}
@@ -286,7 +295,7 @@ func ImportZendeskData(ctx context.Context, db *sql.DB, limiter *ratelimit.Limit
 				return err
 			}
 		}
-		usersBody, err := ZendeskGet(subdomain, creds, "/api/v2/users/show_many.json?ids="+strings.Join(endUserIDs, ","))
+		usersBody, err := ZendeskGet(ctx, limiter, subdomain, creds, "/api/v2/users/show_many.json?ids="+strings.Join(endUserIDs, ","))
 		if err != nil {
 			return fmt.Errorf("fetch users: %w", err)
 		}
@@ -358,10 +367,11 @@ func ImportZendeskData(ctx context.Context, db *sql.DB, limiter *ratelimit.Limit
 
 		var ticketID string
 		err := db.QueryRow(
-			`INSERT INTO tickets (title, description, reporter_id, assignee_id, org_id, received_at, zendesk_status, zendesk_ticket_id, zendesk_updated_at, resolved_at)
+			`INSERT INTO tickets (title, description, reporter_id, assignee_id, org_id, received_at, zendesk_status, zendesk_ticket_id, zendesk_updated_at, resolved_at, custom_fields, zendesk_priority)
 			 VALUES ($1, $2, $3, $4, $5, $6, $7::zendesk_status_category, $8, $9,
 			         CASE WHEN $7::zendesk_status_category IN ('solved'::zendesk_status_category, 'closed'::zendesk_status_category)
-			              THEN $9::TIMESTAMPTZ ELSE NULL END)
+			              THEN $9::TIMESTAMPTZ ELSE NULL END,
+			         COALESCE($10::jsonb, '{}'), $11)
 			 RETURNING id`,
 			ticket.Subject,
 			ticket.Description,
@@ -372,10 +382,15 @@ func ImportZendeskData(ctx context.Context, db *sql.DB, limiter *ratelimit.Limit
 			status,
 			ticket.ID,
 			ticket.UpdatedAt,
+			customFieldsJSON(ticket.CustomFields),
+			mapZendeskPriority(ticket.Priority),
 		).Scan(&ticketID)
 		if err != nil {
 			return fmt.Errorf("insert ticket %d: %w", ticket.ID, err)
 		}
+		if err := setTicketTags(ctx, db, orgID, ticketID, ticket.Tags); err != nil {
+			return fmt.Errorf("insert tags for ticket %d: %w", ticket.ID, err)
+		}
 		ticketsByZendeskID[ticket.ID] = ticketID
 		ticketReporterByZendeskID[ticket.ID] = reporterID
 	}
@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"purl/api/internal/ratelimit"
+)
+
+// errZendeskNotConfigured is returned by write-back helpers when the org has no
+// Zendesk credentials, so there is nowhere to write to.
+var errZendeskNotConfigured = errors.New("zendesk credentials not configured")
+
+// zendeskAuditEvent is one entry of the audit Zendesk returns for a ticket update.
+// Only Comment events are used.
+type zendeskAuditEvent struct {
+	ID       flexInt64 `json:"id"`
+	Type     string    `json:"type"`
+	AuthorID flexInt64 `json:"author_id"`
+	Body     string    `json:"body"`
+	HtmlBody string    `json:"html_body"`
+	Public   bool      `json:"public"`
+}
+
+// zendeskTicketUpdateResponse is the body of PUT /api/v2/tickets/{id}.json.
+type zendeskTicketUpdateResponse struct {
+	Ticket webhookTicketDetail `json:"ticket"`
+	Audit  struct {
+		CreatedAt time.Time           `json:"created_at"`
+		Events    []zendeskAuditEvent `json:"events"`
+	} `json:"audit"`
+}
+
+// comment returns the comment added by the update, or nil if it added none.
+func (u *zendeskTicketUpdateResponse) comment() *webhookCommentDetail {
+	for _, e := range u.Audit.Events {
+		if e.Type != "Comment" {
+			continue
+		}
+		return &webhookCommentDetail{
+			ID:        e.ID,
+			TicketID:  u.Ticket.ID,
+			AuthorID:  e.AuthorID,
+			Body:      e.Body,
+			HtmlBody:  e.HtmlBody,
+			Public:    e.Public,
+			Via:       webhookCommentVia{Channel: "web"},
+			CreatedAt: u.Audit.CreatedAt,
+		}
+	}
+	return nil
+}
+
+// zendeskRequest sends a request to the org's Zendesk API, with payload (if not
+// nil) as the JSON body, and returns the response body. path is relative to the
+// account root, e.g. "/api/v2/tickets/1.json". Returns errZendeskNotConfigured
+// if the org has no credentials.
+func zendeskRequest(ctx context.Context, q queryer, orgID, method, path string, payload any, limiter *ratelimit.Limiter) ([]byte, error) {
+	var subdomain, email, apiKey string
+	err := q.QueryRowContext(ctx,
+		`SELECT COALESCE(zendesk_subdomain,''), COALESCE(zendesk_email,''), COALESCE(zendesk_api_key,'')
+		 FROM organizations WHERE id = $1`,
+		orgID,
+	).Scan(&subdomain, &email, &apiKey)
+	if err != nil {
+		return nil, fmt.Errorf("load zendesk creds: %w", err)
+	}
+	if subdomain == "" || email == "" || apiKey == "" {
+		return nil, errZendeskNotConfigured
+	}
+
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	creds := base64.StdEncoding.EncodeToString([]byte(email + "/token:" + apiKey))
+	if limiter != nil {
+		if err := limiter.Wait(ctx, creds); err != nil {
+			return nil, err
+		}
+	}
+	endpoint := fmt.Sprintf("https://%s.zendesk.com%s", subdomain, path)
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Basic "+creds)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("zendesk request: %w", err)
+	}
+	defer resp.Body.Close()
+	if limiter != nil {
+		limiter.Observe(ctx, creds, resp.Header)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errZendeskNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("zendesk returned %s: %s", resp.Status, respBody)
+	}
+	return respBody, nil
+}
+
+// zendeskTicketUpdate applies update (the value of the "ticket" key) to a
+// Zendesk ticket and returns the updated ticket and its audit.
+func zendeskTicketUpdate(ctx context.Context, q queryer, orgID string, zendeskTicketID int64, update any, limiter *ratelimit.Limiter) (*zendeskTicketUpdateResponse, error) {
+	body, err := zendeskRequest(ctx, q, orgID, http.MethodPut,
+		fmt.Sprintf("/api/v2/tickets/%d.json", zendeskTicketID),
+		map[string]any{"ticket": update}, limiter)
+	if err != nil {
+		return nil, err
+	}
+	var resp zendeskTicketUpdateResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parse ticket update: %w", err)
+	}
+	return &resp, nil
+}
+
+// zendeskUpdateManyLimit is the most tickets Zendesk accepts in one update_many call.
+const zendeskUpdateManyLimit = 100
+
+// zendeskJobStatus is a Zendesk background job, as returned by update_many and
+// GET /api/v2/job_statuses/{id}.json.
+type zendeskJobStatus struct {
+	ID string `json:"id"`
+	// Status is queued, working, completed, failed or killed.
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Results []struct {
+		ID      flexInt64 `json:"id"`
+		Success bool      `json:"success"`
+		Status  string    `json:"status"`
+		Error   string    `json:"error"`
+		Details string    `json:"details"`
+	} `json:"results"`
+}
+
+func (j *zendeskJobStatus) done() bool {
+	return j.Status == "completed" || j.Status == "failed" || j.Status == "killed"
+}
+
+// zendeskUpdateMany applies the same update (the value of the "ticket" key) to
+// up to zendeskUpdateManyLimit tickets, waits for Zendesk's background job to
+// finish and returns its final status. Each poll goes through the limiter.
+func zendeskUpdateMany(ctx context.Context, q queryer, orgID string, zendeskTicketIDs []int64, update any, limiter *ratelimit.Limiter) (*zendeskJobStatus, error) {
+	ids := make([]string, len(zendeskTicketIDs))
+	for i, id := range zendeskTicketIDs {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	body, err := zendeskRequest(ctx, q, orgID, http.MethodPut,
+		"/api/v2/tickets/update_many.json?ids="+strings.Join(ids, ","),
+		map[string]any{"ticket": update}, limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var resp struct {
+			JobStatus zendeskJobStatus `json:"job_status"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("parse job status: %w", err)
+		}
+		if resp.JobStatus.done() {
+			return &resp.JobStatus, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+		body, err = zendeskRequest(ctx, q, orgID, http.MethodGet,
+			"/api/v2/job_statuses/"+url.PathEscape(resp.JobStatus.ID)+".json", nil, limiter)
+		if err != nil {
+			return nil, fmt.Errorf("poll job status: %w", err)
+		}
+	}
+}
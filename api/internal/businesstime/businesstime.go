@@ -0,0 +1,213 @@
+// Package businesstime does time arithmetic in business hours: the weekly
+// opening hours of a schedule, in the schedule's time zone.
+package businesstime
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hours is the JSON form of a Schedule:
+//
+//	{
+//	  "time_zone": "Europe/London",
+//	  "weekly": {
+//	    "monday":  [{"start": "09:00", "end": "17:30"}],
+//	    "tuesday": [{"start": "09:00", "end": "12:00"}, {"start": "13:00", "end": "17:30"}]
+//	  },
+//	  "holidays": ["2026-12-25", "2026-12-26"]
+//	}
+//
+// Days that are omitted are closed, as are holidays (dates in the time zone).
+// Times are "HH:MM" on a 24-hour clock and end may be "24:00" for midnight at
+// the end of the day.
+type Hours struct {
+	TimeZone string            `json:"time_zone"`
+	Weekly   map[string][]Span `json:"weekly"`
+	Holidays []string          `json:"holidays,omitempty"`
+}
+
+// Span is one opening period within a day.
+type Span struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// interval is an opening period in minutes since midnight, local time.
+type interval struct{ start, end int }
+
+// Schedule is a parsed Hours.
+type Schedule struct {
+	loc      *time.Location
+	week     [7][]interval   // indexed by time.Weekday, sorted and non-overlapping
+	holidays map[string]bool // DateLayout dates
+}
+
+// DateLayout is the time layout of holiday dates.
+const DateLayout = "2006-01-02"
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// Schedule validates h and returns its Schedule. At least one day must have
+// opening hours.
+func (h Hours) Schedule() (*Schedule, error) {
+	if h.TimeZone == "" {
+		return nil, fmt.Errorf("time_zone is required")
+	}
+	loc, err := time.LoadLocation(h.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("time_zone: unknown time zone %q", h.TimeZone)
+	}
+	s := &Schedule{loc: loc, holidays: map[string]bool{}}
+	for _, d := range h.Holidays {
+		if _, err := time.Parse(DateLayout, d); err != nil {
+			return nil, fmt.Errorf("holidays: %q is not a YYYY-MM-DD date", d)
+		}
+		s.holidays[d] = true
+	}
+	open := false
+	for day, spans := range h.Weekly {
+		wd, ok := weekdays[strings.ToLower(day)]
+		if !ok {
+			return nil, fmt.Errorf("weekly: unknown day %q", day)
+		}
+		ivs := make([]interval, 0, len(spans))
+		for _, sp := range spans {
+			start, err := parseClock(sp.Start)
+			if err != nil {
+				return nil, fmt.Errorf("weekly.%s: start: %w", day, err)
+			}
+			end, err := parseClock(sp.End)
+			if err != nil {
+				return nil, fmt.Errorf("weekly.%s: end: %w", day, err)
+			}
+			if start >= end {
+				return nil, fmt.Errorf("weekly.%s: start %s is not before end %s", day, sp.Start, sp.End)
+			}
+			ivs = append(ivs, interval{start, end})
+		}
+		sort.Slice(ivs, func(i, j int) bool { return ivs[i].start < ivs[j].start })
+		for i := 1; i < len(ivs); i++ {
+			if ivs[i].start < ivs[i-1].end {
+				return nil, fmt.Errorf("weekly.%s: opening hours overlap", day)
+			}
+		}
+		s.week[wd] = append(s.week[wd], ivs...)
+		open = open || len(ivs) > 0
+	}
+	if !open {
+		return nil, fmt.Errorf("weekly: at least one day must have opening hours")
+	}
+	return s, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight, allowing "24:00".
+func parseClock(s string) (int, error) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	h, herr := strconv.Atoi(s[:2])
+	m, merr := strconv.Atoi(s[3:])
+	if herr != nil || merr != nil {
+		return 0, fmt.Errorf("%q is not HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("%q is not a time of day", s)
+	}
+	return h*60 + m, nil
+}
+
+// maxClosedDays bounds the search for the next opening, for schedules whose
+// open days are all holidays from some date on.
+const maxClosedDays = 3660
+
+// openings calls fn with each opening period of the schedule that ends after
+// t, in order, until fn returns false or the schedule stays closed for
+// maxClosedDays. Periods are clipped to start no earlier than t.
+func (s *Schedule) openings(t time.Time, fn func(start, end time.Time) bool) {
+	t = t.In(s.loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.loc)
+	for closed := 0; closed < maxClosedDays; day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.loc) {
+		closed++
+		if s.holidays[day.Format(DateLayout)] {
+			continue
+		}
+		for _, iv := range s.week[day.Weekday()] {
+			// time.Date rather than Add so opening hours follow the wall
+			// clock across DST changes.
+			start := time.Date(day.Year(), day.Month(), day.Day(), 0, iv.start, 0, 0, s.loc)
+			end := time.Date(day.Year(), day.Month(), day.Day(), 0, iv.end, 0, 0, s.loc)
+			if !end.After(t) {
+				continue
+			}
+			if start.Before(t) {
+				start = t
+			}
+			if !fn(start, end) {
+				return
+			}
+			closed = 0
+		}
+	}
+}
+
+// Add returns the time d of business hours after t. A nil Schedule is open
+// around the clock, so Add is t.Add(d); so is a schedule that stops opening
+// before d has passed (its open days all being holidays), rather than have a
+// target that is never due.
+func (s *Schedule) Add(t time.Time, d time.Duration) time.Time {
+	if s == nil || d <= 0 {
+		return t.Add(d)
+	}
+	var due time.Time
+	left := d
+	s.openings(t, func(start, end time.Time) bool {
+		if span := end.Sub(start); left > span {
+			left -= span
+			return true
+		}
+		due = start.Add(left)
+		return false
+	})
+	if due.IsZero() {
+		return t.Add(d)
+	}
+	return due
+}
+
+// Location returns the schedule's time zone. A nil Schedule is in UTC.
+func (s *Schedule) Location() *time.Location {
+	if s == nil {
+		return time.UTC
+	}
+	return s.loc
+}
+
+// Between returns the business hours from a to b, or zero if b isn't after
+// a. A nil Schedule is open around the clock, so Between is b.Sub(a).
+func (s *Schedule) Between(a, b time.Time) time.Duration {
+	if !b.After(a) {
+		return 0
+	}
+	if s == nil {
+		return b.Sub(a)
+	}
+	var total time.Duration
+	s.openings(a, func(start, end time.Time) bool {
+		if !start.Before(b) {
+			return false
+		}
+		if end.After(b) {
+			end = b
+		}
+		total += end.Sub(start)
+		return true
+	})
+	return total
+}
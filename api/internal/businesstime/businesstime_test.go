@@ -0,0 +1,188 @@
+package businesstime
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var london = mustLoad("Europe/London")
+
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func at(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, london)
+}
+
+func weekdayHours(start, end string) map[string][]Span {
+	week := map[string][]Span{}
+	for _, d := range []string{"monday", "tuesday", "wednesday", "thursday", "friday"} {
+		week[d] = []Span{{start, end}}
+	}
+	return week
+}
+
+func mustSchedule(t *testing.T, h Hours) *Schedule {
+	t.Helper()
+	s, err := h.Schedule()
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	return s
+}
+
+// Dates are in March 2026: the 2nd is a Monday, and UK clocks go forward an
+// hour at 01:00 on Sunday the 29th.
+var (
+	officeHours = Hours{TimeZone: "Europe/London", Weekly: weekdayHours("09:00", "17:00")}
+	withHoliday = Hours{TimeZone: "Europe/London", Weekly: weekdayHours("09:00", "17:00"), Holidays: []string{"2026-03-03"}}
+	allDay      = Hours{TimeZone: "Europe/London", Weekly: map[string][]Span{"sunday": {{"00:00", "24:00"}}}}
+	// Overnight is open from Saturday 22:00 to Sunday 06:00.
+	overnight = Hours{TimeZone: "Europe/London", Weekly: map[string][]Span{
+		"saturday": {{"22:00", "24:00"}},
+		"sunday":   {{"00:00", "06:00"}},
+	}}
+	split = Hours{TimeZone: "Europe/London", Weekly: map[string][]Span{
+		"monday": {{"13:00", "17:00"}, {"09:00", "12:00"}},
+	}}
+)
+
+// neverOpen is open on Mondays only, every one of which is a holiday for
+// longer than Add searches.
+func neverOpen() Hours {
+	h := Hours{TimeZone: "Europe/London", Weekly: map[string][]Span{"monday": {{"09:00", "17:00"}}}}
+	for d := at(2026, 3, 2, 0, 0); d.Year() < 2040; d = d.AddDate(0, 0, 7) {
+		h.Holidays = append(h.Holidays, d.Format(DateLayout))
+	}
+	return h
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours *Hours
+		from  time.Time
+		d     time.Duration
+		want  time.Time
+	}{
+		{"nil schedule", nil, at(2026, 3, 7, 12, 0), 2 * time.Hour, at(2026, 3, 7, 14, 0)},
+		{"within a day", &officeHours, at(2026, 3, 2, 10, 0), 3 * time.Hour, at(2026, 3, 2, 13, 0)},
+		{"ends at closing", &officeHours, at(2026, 3, 2, 16, 0), time.Hour, at(2026, 3, 2, 17, 0)},
+		{"into the next day", &officeHours, at(2026, 3, 2, 16, 0), 2 * time.Hour, at(2026, 3, 3, 10, 0)},
+		{"before opening", &officeHours, at(2026, 3, 2, 6, 0), time.Hour, at(2026, 3, 2, 10, 0)},
+		{"over the weekend", &officeHours, at(2026, 3, 6, 16, 30), time.Hour, at(2026, 3, 9, 9, 30)},
+		{"from the weekend", &officeHours, at(2026, 3, 7, 12, 0), time.Hour, at(2026, 3, 9, 10, 0)},
+		{"several days", &officeHours, at(2026, 3, 2, 9, 0), 20 * time.Hour, at(2026, 3, 4, 13, 0)},
+		{"over a holiday", &withHoliday, at(2026, 3, 2, 16, 0), 2 * time.Hour, at(2026, 3, 4, 10, 0)},
+		{"from a holiday", &withHoliday, at(2026, 3, 3, 12, 0), time.Hour, at(2026, 3, 4, 10, 0)},
+		{"over the clocks going forward", &officeHours, at(2026, 3, 27, 16, 0), 2 * time.Hour, at(2026, 3, 30, 10, 0)},
+		// The 29th is 23 hours long, so 2 hours from midnight is 03:00 BST.
+		{"on the short day", &allDay, at(2026, 3, 29, 0, 0), 2 * time.Hour, at(2026, 3, 29, 3, 0)},
+		{"overnight", &overnight, at(2026, 3, 7, 23, 0), 2 * time.Hour, at(2026, 3, 8, 1, 0)},
+		{"split day", &split, at(2026, 3, 2, 11, 0), 2 * time.Hour, at(2026, 3, 2, 14, 0)},
+		{"zero duration", &officeHours, at(2026, 3, 7, 12, 0), 0, at(2026, 3, 7, 12, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s *Schedule
+			if tt.hours != nil {
+				s = mustSchedule(t, *tt.hours)
+			}
+			if got := s.Add(tt.from, tt.d); !got.Equal(tt.want) {
+				t.Errorf("Add(%s, %s) = %s, want %s", tt.from, tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddNeverOpen(t *testing.T) {
+	s := mustSchedule(t, neverOpen())
+	from := at(2026, 3, 2, 10, 0)
+	if got, want := s.Add(from, time.Hour), from.Add(time.Hour); !got.Equal(want) {
+		t.Errorf("Add = %s, want %s (around the clock)", got, want)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name  string
+		hours *Hours
+		a, b  time.Time
+		want  time.Duration
+	}{
+		{"nil schedule", nil, at(2026, 3, 7, 12, 0), at(2026, 3, 7, 14, 30), 150 * time.Minute},
+		{"b before a", &officeHours, at(2026, 3, 2, 12, 0), at(2026, 3, 2, 10, 0), 0},
+		{"within a day", &officeHours, at(2026, 3, 2, 10, 0), at(2026, 3, 2, 13, 0), 3 * time.Hour},
+		{"overnight closure", &officeHours, at(2026, 3, 2, 16, 0), at(2026, 3, 3, 10, 0), 2 * time.Hour},
+		{"weekend", &officeHours, at(2026, 3, 6, 16, 0), at(2026, 3, 9, 10, 0), 2 * time.Hour},
+		{"while closed", &officeHours, at(2026, 3, 7, 10, 0), at(2026, 3, 8, 10, 0), 0},
+		{"holiday", &withHoliday, at(2026, 3, 2, 16, 0), at(2026, 3, 4, 10, 0), 2 * time.Hour},
+		{"short day", &allDay, at(2026, 3, 29, 0, 0), at(2026, 3, 30, 0, 0), 23 * time.Hour},
+		{"overnight", &overnight, at(2026, 3, 7, 23, 0), at(2026, 3, 8, 12, 0), 7 * time.Hour},
+		{"split day", &split, at(2026, 3, 2, 8, 0), at(2026, 3, 2, 18, 0), 7 * time.Hour},
+		{"never open", ptr(neverOpen()), at(2026, 3, 2, 10, 0), at(2026, 3, 9, 10, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s *Schedule
+			if tt.hours != nil {
+				s = mustSchedule(t, *tt.hours)
+			}
+			if got := s.Between(tt.a, tt.b); got != tt.want {
+				t.Errorf("Between(%s, %s) = %s, want %s", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		hours   Hours
+		wantErr string
+	}{
+		{"valid", officeHours, ""},
+		{"until midnight", allDay, ""},
+		{"day names are case-insensitive", Hours{TimeZone: "UTC", Weekly: map[string][]Span{"Monday": {{"09:00", "17:00"}}}}, ""},
+		{"no time zone", Hours{Weekly: weekdayHours("09:00", "17:00")}, "time_zone is required"},
+		{"unknown time zone", Hours{TimeZone: "Mars/Olympus", Weekly: weekdayHours("09:00", "17:00")}, "unknown time zone"},
+		{"never open", Hours{TimeZone: "UTC"}, "at least one day"},
+		{"only empty days", Hours{TimeZone: "UTC", Weekly: map[string][]Span{"monday": {}}}, "at least one day"},
+		{"unknown day", Hours{TimeZone: "UTC", Weekly: map[string][]Span{"funday": {{"09:00", "17:00"}}}}, "unknown day"},
+		{"end before start", Hours{TimeZone: "UTC", Weekly: weekdayHours("17:00", "09:00")}, "is not before end"},
+		{"empty span", Hours{TimeZone: "UTC", Weekly: weekdayHours("09:00", "09:00")}, "is not before end"},
+		{"bad clock", Hours{TimeZone: "UTC", Weekly: weekdayHours("9am", "17:00")}, "is not HH:MM"},
+		{"past midnight", Hours{TimeZone: "UTC", Weekly: weekdayHours("09:00", "24:30")}, "is not a time of day"},
+		{"overlap", Hours{TimeZone: "UTC", Weekly: map[string][]Span{"monday": {{"09:00", "13:00"}, {"12:00", "17:00"}}}}, "overlap"},
+		{"bad holiday", Hours{TimeZone: "UTC", Weekly: weekdayHours("09:00", "17:00"), Holidays: []string{"25/12/2026"}}, "holidays"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.hours.Schedule()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Schedule: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Schedule error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLocation(t *testing.T) {
+	var s *Schedule
+	if got := s.Location(); got != time.UTC {
+		t.Errorf("nil Location = %s, want UTC", got)
+	}
+	if got := mustSchedule(t, officeHours).Location(); got.String() != "Europe/London" {
+		t.Errorf("Location = %s, want Europe/London", got)
+	}
+}
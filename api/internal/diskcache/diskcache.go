@@ -0,0 +1,229 @@
+package diskcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Meta is stored alongside each cached body so it can be served without
+// consulting the origin.
+type Meta struct {
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// Cache is a size-bounded, least-recently-used cache of immutable blobs on
+// local disk. Each entry is a pair of files named after the SHA-256 of its
+// key: "<hash>.data" holds the body and "<hash>.meta" holds Meta as JSON.
+// The LRU order is rebuilt from file modification times on startup, and
+// reads touch the data file so the order survives restarts.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List               // front = most recently used
+	items map[string]*list.Element // hash -> element holding *entry
+}
+
+type entry struct {
+	hash string
+	size int64
+}
+
+// ErrMiss is returned by Open when the key is not cached.
+var ErrMiss = errors.New("diskcache: miss")
+
+// New opens (creating if needed) a cache rooted at dir that holds at most
+// maxBytes of body data. Existing entries are indexed and, if they exceed
+// maxBytes, the least recently used are evicted immediately.
+func New(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	c := &Cache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache dir: %w", err)
+	}
+	type found struct {
+		hash    string
+		size    int64
+		modTime time.Time
+	}
+	var existing []found
+	for _, de := range dirEntries {
+		name := de.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			// Leftover from a write interrupted by a crash.
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".data") {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		hash := strings.TrimSuffix(name, ".data")
+		if _, err := os.Stat(c.metaPath(hash)); err != nil {
+			os.Remove(c.dataPath(hash))
+			continue
+		}
+		existing = append(existing, found{hash: hash, size: info.Size(), modTime: info.ModTime()})
+	}
+	// Oldest first, so pushing each to the front leaves the newest at the front.
+	sort.Slice(existing, func(i, j int) bool { return existing[i].modTime.Before(existing[j].modTime) })
+	for _, f := range existing {
+		c.items[f.hash] = c.order.PushFront(&entry{hash: f.hash, size: f.size})
+		c.size += f.size
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Open returns the cached body and metadata for key, marking it as recently
+// used. The caller must close the returned file. Returns ErrMiss if absent.
+func (c *Cache) Open(key string) (*os.File, Meta, error) {
+	hash := hashKey(key)
+
+	c.mu.Lock()
+	el, ok := c.items[hash]
+	if ok {
+		c.order.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, Meta{}, ErrMiss
+	}
+
+	metaBytes, err := os.ReadFile(c.metaPath(hash))
+	if err != nil {
+		c.remove(hash)
+		return nil, Meta{}, ErrMiss
+	}
+	var meta Meta
+	if err := json.Unmarshal(metaBytes, &meta); err != nil {
+		c.remove(hash)
+		return nil, Meta{}, ErrMiss
+	}
+
+	f, err := os.Open(c.dataPath(hash))
+	if err != nil {
+		c.remove(hash)
+		return nil, Meta{}, ErrMiss
+	}
+	now := time.Now()
+	os.Chtimes(c.dataPath(hash), now, now)
+	return f, meta, nil
+}
+
+// Put stores the full contents of r under key. The body is written to a
+// temporary file and only becomes visible once completely copied, so a
+// failed or partial read never leaves a truncated entry behind. Bodies
+// larger than the cache itself are discarded.
+func (c *Cache) Put(key string, meta Meta, r io.Reader) error {
+	hash := hashKey(key)
+
+	tmp, err := os.CreateTemp(c.dir, hash+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	n, err := io.Copy(tmp, io.LimitReader(r, c.maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write body: %w", err)
+	}
+	if n > c.maxBytes {
+		return fmt.Errorf("body exceeds cache size of %d bytes", c.maxBytes)
+	}
+
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("marshal meta: %w", err)
+	}
+	if err := os.WriteFile(c.metaPath(hash), metaBytes, 0o644); err != nil {
+		return fmt.Errorf("write meta: %w", err)
+	}
+	if err := os.Rename(tmpName, c.dataPath(hash)); err != nil {
+		os.Remove(c.metaPath(hash))
+		return fmt.Errorf("commit body: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[hash]; ok {
+		c.size -= el.Value.(*entry).size
+		c.order.Remove(el)
+	}
+	c.items[hash] = c.order.PushFront(&entry{hash: hash, size: n})
+	c.size += n
+	c.evictLocked()
+	return nil
+}
+
+// evictLocked removes least recently used entries until the cache fits in
+// maxBytes. c.mu must be held.
+func (c *Cache) evictLocked() {
+	for c.size > c.maxBytes {
+		el := c.order.Back()
+		if el == nil {
+			return
+		}
+		e := el.Value.(*entry)
+		c.order.Remove(el)
+		delete(c.items, e.hash)
+		c.size -= e.size
+		// Open readers keep their file handle; unlinking is safe on POSIX.
+		os.Remove(c.dataPath(e.hash))
+		os.Remove(c.metaPath(e.hash))
+	}
+}
+
+func (c *Cache) remove(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[hash]; ok {
+		c.size -= el.Value.(*entry).size
+		c.order.Remove(el)
+		delete(c.items, hash)
+	}
+	os.Remove(c.dataPath(hash))
+	os.Remove(c.metaPath(hash))
+}
+
+func (c *Cache) dataPath(hash string) string { return filepath.Join(c.dir, hash+".data") }
+func (c *Cache) metaPath(hash string) string { return filepath.Join(c.dir, hash+".meta") }
+
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,262 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Event types delivered to clients. Payloads carry IDs only, except where
+// noted; clients refetch whatever they are displaying.
+const (
+	// TicketUpdated: {"ticket_id"} — ticket created or any field changed.
+	TicketUpdated = "ticket.updated"
+	// TicketDeleted: {"ticket_id"}.
+	TicketDeleted = "ticket.deleted"
+	// CommentCreated: {"ticket_id"} — one or more comments added.
+	CommentCreated = "comment.created"
+	// CommentUpdated: {"ticket_id"} — an existing comment was edited.
+	CommentUpdated = "comment.updated"
+	// BoardUpdated: {"board_id"} — board created, renamed, deleted or its columns replaced.
+	BoardUpdated = "board.updated"
+	// BoardTicketsChanged: {"board_id", and "ticket_id" or "column_id"} — placement of
+	// tickets on a board changed.
+	BoardTicketsChanged = "board.tickets_changed"
+	// PresenceChanged: {"ticket_id", "presence": [...]} — an agent opened, left or
+	// started composing on a ticket. Carries the full presence list.
+	PresenceChanged = "presence.changed"
+	// ViewUpdated: {"view_id"} — saved view created, changed or deleted.
+	ViewUpdated = "view.updated"
+	// MacroUpdated: {"macro_id"} — macro created, changed or deleted.
+	MacroUpdated = "macro.updated"
+	// AutomationUpdated: {"rule_id"} — automation rule created, changed or deleted.
+	AutomationUpdated = "automation.updated"
+	// RoutingPolicyUpdated: {"policy_id"} — routing policy created, changed or deleted.
+	RoutingPolicyUpdated = "routing_policy.updated"
+	// AgentRoutingUpdated: {"agent_id"} — an agent's routing settings changed or they were paused or resumed.
+	AgentRoutingUpdated = "agent_routing.updated"
+	// SLAPolicyUpdated: {"policy_id"} — SLA policy created, changed or deleted.
+	SLAPolicyUpdated = "sla_policy.updated"
+	// SLABreached: {"ticket_id", "metric"} — a ticket missed its first_response or
+	// resolution target.
+	SLABreached = "sla.breached"
+	// BusinessHoursUpdated: {} — the org's business hours or holidays changed.
+	BusinessHoursUpdated = "business_hours.updated"
+	// NoteChanged: {"ticket_id", "note_id"} — a ticket note was added, edited or deleted.
+	NoteChanged = "note.changed"
+	// NotificationCreated: {"agent_id", "notification_id"} — a notification was
+	// added to the agent's inbox. Clients show only their own agent's.
+	NotificationCreated = "notification.created"
+	// NotificationsRead: {"agent_id"} — some of the agent's notifications were marked read.
+	NotificationsRead = "notifications.read"
+	// ExportUpdated: {"export_id"} — a ticket export finished or failed.
+	ExportUpdated = "export.updated"
+	// Resync: {} — sent first when a client resumes from a Last-Event-ID whose
+	// following events are no longer retained. Events were missed; clients
+	// refetch everything they display.
+	Resync = "resync"
+)
+
+// retained is the approximate number of events kept per org for Last-Event-ID
+// replay. Older events are trimmed; a client that was away longer is sent
+// Resync instead of a replay.
+const retained = 10000
+
+// Event is a change notification for one org.
+type Event struct {
+	// ID is the Redis stream entry ID. It is sent as the SSE id so clients can
+	// resume with Last-Event-ID.
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Bus publishes and subscribes to per-org change events. Each event is
+// appended to a capped Redis stream (for replay) and announced on a pub/sub
+// channel (for live delivery). A nil *Bus discards published events, so
+// callers that run without Redis need no special casing.
+type Bus struct {
+	rdb *redis.Client
+}
+
+// NewBus returns a Bus backed by rdb, or nil if rdb is nil.
+func NewBus(rdb *redis.Client) *Bus {
+	if rdb == nil {
+		return nil
+	}
+	return &Bus{rdb: rdb}
+}
+
+func streamKey(orgID string) string  { return "events:" + orgID }
+func channelKey(orgID string) string { return "events:" + orgID + ":live" }
+
+// Publish records an event for orgID. It must be called after the change it
+// describes has committed. Failures are logged rather than returned: the
+// change itself succeeded, and clients recover from a missed event on their
+// next reconnect or refresh.
+func (b *Bus) Publish(ctx context.Context, orgID, typ string, data any) {
+	if b == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("events: marshal %s: %v", typ, err)
+		return
+	}
+
+	id, err := b.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: streamKey(orgID),
+		MaxLen: retained,
+		Approx: true,
+		Values: map[string]any{"type": typ, "data": payload},
+	}).Result()
+	if err != nil {
+		log.Printf("events: append %s for org %s: %v", typ, orgID, err)
+		return
+	}
+
+	msg, _ := json.Marshal(Event{ID: id, Type: typ, Data: payload})
+	if err := b.rdb.Publish(ctx, channelKey(orgID), msg).Err(); err != nil {
+		log.Printf("events: publish %s for org %s: %v", typ, orgID, err)
+	}
+}
+
+// Subscribe delivers orgID's events on the returned channel until ctx is
+// done, at which point the channel is closed. If lastID is non-empty, retained
+// events after it are replayed first, or a Resync event is sent if some of
+// them have already been trimmed. Live events are subscribed to before
+// the replay is read, and duplicates across the two are dropped, so nothing
+// published during the handover is missed.
+func (b *Bus) Subscribe(ctx context.Context, orgID, lastID string) (<-chan Event, error) {
+	sub := b.rdb.Subscribe(ctx, channelKey(orgID))
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+
+	var backlog []Event
+	if lastID != "" {
+		lost, newest, err := b.trimmedAfter(ctx, orgID, lastID)
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		if lost {
+			// Resume after the newest event, which the client's refetch covers.
+			backlog = []Event{{ID: newest, Type: Resync, Data: json.RawMessage("{}")}}
+		}
+	}
+	if lastID != "" && len(backlog) == 0 {
+		msgs, err := b.rdb.XRange(ctx, streamKey(orgID), "("+lastID, "+").Result()
+		if err != nil {
+			sub.Close()
+			return nil, fmt.Errorf("replay: %w", err)
+		}
+		for _, m := range msgs {
+			typ, _ := m.Values["type"].(string)
+			data, _ := m.Values["data"].(string)
+			backlog = append(backlog, Event{ID: m.ID, Type: typ, Data: json.RawMessage(data)})
+		}
+	}
+
+	out := make(chan Event, 64)
+	go func() {
+		defer close(out)
+		defer sub.Close()
+
+		last := lastID
+		send := func(e Event) bool {
+			if last != "" && !idAfter(e.ID, last) {
+				return true // already delivered by the replay
+			}
+			last = e.ID
+			select {
+			case out <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for _, e := range backlog {
+			if !send(e) {
+				return
+			}
+		}
+		live := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-live:
+				if !ok {
+					return
+				}
+				var e Event
+				if err := json.Unmarshal([]byte(m.Payload), &e); err != nil {
+					log.Printf("events: decode live event: %v", err)
+					continue
+				}
+				if !send(e) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// trimmedAfter reports whether any event after lastID has been trimmed from
+// orgID's stream, and the ID of the newest event published to it.
+func (b *Bus) trimmedAfter(ctx context.Context, orgID, lastID string) (bool, string, error) {
+	info, err := b.rdb.XInfoStream(ctx, streamKey(orgID)).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return false, "", nil // nothing published yet
+		}
+		return false, "", err
+	}
+	// max-deleted-entry-id is "0-0" until the stream is first trimmed, and
+	// missing before Redis 7.
+	if !ValidID(info.MaxDeletedEntryID) {
+		return false, "", nil
+	}
+	return idAfter(info.MaxDeletedEntryID, lastID), info.LastGeneratedID, nil
+}
+
+// ValidID reports whether s looks like a Redis stream ID ("<ms>-<seq>").
+func ValidID(s string) bool {
+	_, _, ok := parseID(s)
+	return ok
+}
+
+// idAfter reports whether stream ID a sorts after b.
+func idAfter(a, b string) bool {
+	am, as, aok := parseID(a)
+	bm, bs, bok := parseID(b)
+	if !aok || !bok {
+		return true
+	}
+	return am > bm || (am == bm && as > bs)
+}
+
+func parseID(s string) (ms, seq uint64, ok bool) {
+	msPart, seqPart, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false
+	}
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err = strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return ms, seq, true
+}
@@ -4,50 +4,188 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// script atomically records a request within a sliding window and reports whether it is
-// within the configured limit. Returns {1, 0} if allowed; {0, retry_after_ms} if exceeded.
-var script = redis.NewScript(`
-local key = KEYS[1]
+// Every script takes KEYS = {state, plan, block}:
+//   - state holds the algorithm's own bookkeeping (a sorted set or a hash);
+//   - plan, if set by Observe, overrides the configured per-window limit;
+//   - block, if set by Observe from a Retry-After header, rejects all requests until it expires.
+//
+// and returns {allowed, wait_ms, remaining, reset_ms, limit}, limit being the per-window
+// limit in effect. When reserve is "1" the request is always recorded and wait_ms is
+// how long the caller must wait before using it.
+
+// windowScript implements a sliding window: one sorted-set member per request, scored
+// by the time it may proceed. reset_ms is the time until the oldest request in the
+// window expires and frees a slot.
+var windowScript = redis.NewScript(`
+local key, plan_key, block_key = KEYS[1], KEYS[2], KEYS[3]
 local now_ms = tonumber(ARGV[1])
 local window_ms = tonumber(ARGV[2])
 local max = tonumber(ARGV[3])
 local member = ARGV[4]
+local reserve = ARGV[5] == '1'
+
+local plan = tonumber(redis.call('GET', plan_key))
+if plan and plan > 0 then max = plan end
+local blocked_ms = math.max(redis.call('PTTL', block_key), 0)
+if blocked_ms > 0 and not reserve then
+    return {0, blocked_ms, 0, blocked_ms, max}
+end
 
 redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms - window_ms)
 local count = redis.call('ZCARD', key)
-if count < max then
-    redis.call('ZADD', key, now_ms, member)
-    redis.call('PEXPIRE', key, window_ms + 1000)
-    return {1, 0}
+if count < max or reserve then
+    local at = now_ms
+    if count >= max then
+        -- The slot this request takes frees up when the request (count - max)
+        -- places ahead of it leaves the window.
+        local ahead = redis.call('ZRANGE', key, count - max, count - max, 'WITHSCORES')
+        at = tonumber(ahead[2]) + window_ms
+    end
+    at = math.max(at, now_ms + blocked_ms)
+    redis.call('ZADD', key, at, member)
+    redis.call('PEXPIRE', key, (at - now_ms) + window_ms + 1000)
+    local first = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local reset_ms = math.ceil((tonumber(first[2]) + window_ms) - now_ms)
+    return {1, at - now_ms, math.max(max - count - 1, 0), reset_ms, max}
 end
 local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
 if #oldest > 0 then
     local wait_ms = math.ceil((tonumber(oldest[2]) + window_ms) - now_ms)
     if wait_ms < 1 then wait_ms = 1 end
-    return {0, wait_ms}
+    return {0, wait_ms, 0, wait_ms, max}
+end
+return {0, window_ms, 0, window_ms, max}
+`)
+
+// bucketScript implements a token bucket stored as a hash of {tokens, ts}. Tokens
+// refill continuously at max per window up to burst. A reservation may drive the
+// balance negative; wait_ms is then the time until it is repaid. reset_ms is the
+// time until the bucket is full again.
+var bucketScript = redis.NewScript(`
+local key, plan_key, block_key = KEYS[1], KEYS[2], KEYS[3]
+local now_ms = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local burst = tonumber(ARGV[4])
+local reserve = ARGV[5] == '1'
+
+local plan = tonumber(redis.call('GET', plan_key))
+if plan and plan > 0 then
+    max = plan
+    burst = math.min(burst, plan)
+end
+local rate = max / window_ms
+
+local state = redis.call('HMGET', key, 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now_ms
+tokens = math.min(burst, tokens + math.max(now_ms - ts, 0) * rate)
+
+local blocked_ms = math.max(redis.call('PTTL', block_key), 0)
+local allowed, wait_ms = 0, 0
+if blocked_ms > 0 and not reserve then
+    wait_ms = blocked_ms
+elseif tokens >= 1 or reserve then
+    tokens = tokens - 1
+    allowed = 1
+    if tokens < 0 then wait_ms = math.ceil(-tokens / rate) end
+    wait_ms = math.max(wait_ms, blocked_ms)
+else
+    wait_ms = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now_ms)
+local reset_ms = math.ceil((burst - tokens) / rate)
+redis.call('PEXPIRE', key, reset_ms + 1000)
+return {allowed, wait_ms, math.max(math.floor(tokens), 0), reset_ms, max}
+`)
+
+// observeScript records what the upstream told us about our real budget. A lower
+// remaining count than ours also uses up the local budget to match: a token bucket's
+// balance is drained, and a sliding window is padded with requests made now.
+var observeScript = redis.NewScript(`
+local key, plan_key, block_key = KEYS[1], KEYS[2], KEYS[3]
+local now_ms = tonumber(ARGV[1])
+local window_ms = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local remaining = tonumber(ARGV[4])
+local retry_ms = tonumber(ARGV[5])
+local is_bucket = ARGV[6] == '1'
+local burst = tonumber(ARGV[7])
+local max = tonumber(ARGV[8])
+
+if limit > 0 then
+    redis.call('SET', plan_key, limit, 'PX', 3600000)
+    max = limit
+    burst = math.min(burst, limit)
+end
+if retry_ms > 0 then
+    redis.call('SET', block_key, 1, 'PX', retry_ms)
 end
-return {0, window_ms}
+if is_bucket and remaining >= 0 then
+    local rate = max / window_ms
+    local state = redis.call('HMGET', key, 'tokens', 'ts')
+    local tokens = tonumber(state[1]) or burst
+    local ts = tonumber(state[2]) or now_ms
+    tokens = math.min(burst, tokens + math.max(now_ms - ts, 0) * rate)
+    if remaining < tokens then
+        redis.call('HSET', key, 'tokens', tostring(remaining), 'ts', now_ms)
+        redis.call('PEXPIRE', key, math.ceil((burst - remaining) / rate) + 1000)
+    end
+elseif remaining >= 0 then
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms - window_ms)
+    local count = redis.call('ZCARD', key)
+    local used = max - remaining
+    if used > count then
+        for i = count + 1, used do
+            redis.call('ZADD', key, now_ms, 'observed-' .. now_ms .. '-' .. i)
+        end
+        redis.call('PEXPIRE', key, window_ms + 1000)
+    end
+end
+return 1
 `)
 
-// Limiter is a Redis-backed sliding-window rate limiter.
+type algorithm int
+
+const (
+	slidingWindow algorithm = iota
+	tokenBucket
+)
+
+// Limiter is a Redis-backed rate limiter using either a sliding window or a
+// token bucket.
 type Limiter struct {
 	rdb    *redis.Client
 	name   string
 	max    int64
 	window time.Duration
+	burst  int64
+	algo   algorithm
 }
 
 var seq atomic.Int64
 
-// New creates a Limiter for the named resource, allowing at most max requests per window.
+// New creates a sliding-window Limiter for the named resource, allowing at most max
+// requests per window.
 func New(rdb *redis.Client, name string, max int64, window time.Duration) *Limiter {
-	return &Limiter{rdb: rdb, name: name, max: max, window: window}
+	return &Limiter{rdb: rdb, name: name, max: max, window: window, burst: max, algo: slidingWindow}
+}
+
+// NewTokenBucket creates a token-bucket Limiter for the named resource. Tokens refill
+// at rate per window and accumulate up to burst, so idle callers may spend a burst at
+// once. Unlike the sliding window it stores a fixed two-field hash per key rather
+// than one entry per request.
+func NewTokenBucket(rdb *redis.Client, name string, rate int64, window time.Duration, burst int64) *Limiter {
+	return &Limiter{rdb: rdb, name: name, max: rate, window: window, burst: max(burst, 1), algo: tokenBucket}
 }
 
 // Wait blocks until the rate limit allows a request for the given key, then records it.
@@ -73,23 +211,141 @@ func (l *Limiter) Wait(ctx context.Context, key string) error {
 	}
 }
 
-// tryAcquire attempts to consume one slot in the sliding window.
+// Result describes the outcome of a non-blocking Allow call.
+type Result struct {
+	Allowed bool
+	// Limit is the maximum number of requests per window: the configured limit,
+	// or the upstream's if Observe has seen one.
+	Limit int64
+	// Remaining is how many more requests would be accepted right now.
+	Remaining int64
+	// RetryAfter is how long to wait before retrying; zero when Allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the budget is fully available again: for a sliding
+	// window, until the oldest request expires; for a token bucket, until it refills.
+	Reset time.Duration
+}
+
+// Allow records a request for key if the limit permits it and reports the
+// outcome without blocking. Pass key="" for a global (keyless) limit.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	res, err := l.run(ctx, key, false)
+	if err != nil {
+		return Result{}, err
+	}
+	allowed := res[0] == 1
+	r := Result{
+		Allowed:   allowed,
+		Limit:     res[4],
+		Remaining: max(res[2], 0),
+		Reset:     time.Duration(res[3]) * time.Millisecond,
+	}
+	if !allowed {
+		r.RetryAfter = time.Duration(res[1]) * time.Millisecond
+	}
+	return r, nil
+}
+
+// Reserve unconditionally claims the next available slot for key and returns how
+// long the caller must wait before using it (zero if it may proceed now). Unlike
+// Wait it makes a single round trip, so callers can schedule work or decide to
+// give up instead of sleeping; a reservation that is not used still counts.
+func (l *Limiter) Reserve(ctx context.Context, key string) (time.Duration, error) {
+	res, err := l.run(ctx, key, true)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// Observe adapts the limiter for key to rate-limit headers returned by the
+// upstream API, so it tracks the account's real plan rather than the configured
+// guess:
+//   - X-Rate-Limit replaces the configured per-window limit for the next hour;
+//   - X-Rate-Limit-Remaining uses up the local budget down to the upstream's count;
+//   - Retry-After (seconds) blocks all requests for key until it elapses.
+//
+// X-Rate-Limit is taken to be per the limiter's window, which for Zendesk is one
+// minute. Missing or malformed headers are ignored. Errors are logged, not
+// returned: observing is best-effort and must never fail the caller's request.
+func (l *Limiter) Observe(ctx context.Context, key string, h http.Header) {
+	limit := headerInt(h, "X-Rate-Limit", 0)
+	remaining := headerInt(h, "X-Rate-Limit-Remaining", -1)
+	retryMs := headerInt(h, "Retry-After", 0) * 1000
+	if limit <= 0 && remaining < 0 && retryMs <= 0 {
+		return
+	}
+
+	isBucket := "0"
+	if l.algo == tokenBucket {
+		isBucket = "1"
+	}
+	err := observeScript.Run(ctx, l.rdb, l.keys(key),
+		time.Now().UnixMilli(), l.window.Milliseconds(), limit, remaining, retryMs, isBucket, l.burst, l.max,
+	).Err()
+	if err != nil {
+		log.Printf("rate limit %s: observe: %v", l.name, err)
+	}
+}
+
+func headerInt(h http.Header, name string, fallback int64) int64 {
+	n, err := strconv.ParseInt(h.Get(name), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// tryAcquire attempts to consume one slot.
 // Returns (true, 0, nil) on success, or (false, retryAfter, nil) if the limit is exceeded.
 func (l *Limiter) tryAcquire(ctx context.Context, key string) (bool, time.Duration, error) {
+	res, err := l.run(ctx, key, false)
+	if err != nil {
+		return false, 0, err
+	}
+	if res[0] == 1 {
+		return true, 0, nil
+	}
+	return false, time.Duration(res[1]) * time.Millisecond, nil
+}
+
+// run executes the limiter's script and returns its five integer results.
+func (l *Limiter) run(ctx context.Context, key string, reserve bool) ([5]int64, error) {
 	nowMs := time.Now().UnixMilli()
-	member := fmt.Sprintf("%d-%d", nowMs, seq.Add(1))
+	reserveArg := "0"
+	if reserve {
+		reserveArg = "1"
+	}
 
-	res, err := script.Run(ctx, l.rdb,
-		[]string{l.redisKey(key)},
-		nowMs, l.window.Milliseconds(), l.max, member,
-	).Slice()
+	var cmd *redis.Cmd
+	switch l.algo {
+	case tokenBucket:
+		cmd = bucketScript.Run(ctx, l.rdb, l.keys(key),
+			nowMs, l.window.Milliseconds(), l.max, l.burst, reserveArg)
+	default:
+		member := fmt.Sprintf("%d-%d", nowMs, seq.Add(1))
+		cmd = windowScript.Run(ctx, l.rdb, l.keys(key),
+			nowMs, l.window.Milliseconds(), l.max, member, reserveArg)
+	}
+
+	var out [5]int64
+	res, err := cmd.Int64Slice()
 	if err != nil {
-		return false, 0, fmt.Errorf("rate limit script: %w", err)
+		return out, fmt.Errorf("rate limit script: %w", err)
 	}
+	copy(out[:], res)
+	return out, nil
+}
 
-	allowed := res[0].(int64) == 1
-	retryMs := res[1].(int64)
-	return allowed, time.Duration(retryMs) * time.Millisecond, nil
+// keys returns the state, plan and block keys for key. The sliding window and the
+// token bucket keep state under different suffixes since their Redis types differ.
+func (l *Limiter) keys(key string) []string {
+	base := l.redisKey(key)
+	state := base
+	if l.algo == tokenBucket {
+		state = base + ":bucket"
+	}
+	return []string{state, base + ":plan", base + ":block"}
 }
 
 func (l *Limiter) redisKey(key string) string {
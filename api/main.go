@@ -9,12 +9,15 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose/v3"
 	"github.com/redis/go-redis/v9"
 	_ "purl/api/docs"
 	"purl/api/internal/app"
+	"purl/api/internal/diskcache"
 )
 
 //go:embed migrations/*.sql
@@ -24,13 +27,30 @@ type config struct {
 	DatabaseURL string
 	RedisURL    string
 	Port        string
+	// RecordingCacheDir is where proxied call recordings are cached on disk.
+	RecordingCacheDir string
+	// RecordingCacheMaxMB caps the recording cache size; 0 disables caching.
+	RecordingCacheMaxMB int64
+	// Inbound request budgets per minute; 0 disables each.
+	RateLimitOrgPerMin     int64
+	RateLimitKeyPerMin     int64
+	RateLimitWebhookPerMin int64
+	// ZendeskRateLimit caps outbound Zendesk requests per minute, shared with the workers.
+	ZendeskRateLimit int64
 }
 
 func loadConfig() config {
 	return config{
-		DatabaseURL: requireEnv("DATABASE_URL"),
-		RedisURL:    requireEnv("REDIS_URL"),
-		Port:        getEnv("PORT", "9090"),
+		DatabaseURL:         requireEnv("DATABASE_URL"),
+		RedisURL:            requireEnv("REDIS_URL"),
+		Port:                getEnv("PORT", "9090"),
+		RecordingCacheDir:   getEnv("RECORDING_CACHE_DIR", filepath.Join(os.TempDir(), "purl-recordings")),
+		RecordingCacheMaxMB: getEnvInt("RECORDING_CACHE_MAX_MB", 1024),
+
+		RateLimitOrgPerMin:     getEnvInt("RATE_LIMIT_ORG_PER_MIN", 1200),
+		RateLimitKeyPerMin:     getEnvInt("RATE_LIMIT_KEY_PER_MIN", 600),
+		RateLimitWebhookPerMin: getEnvInt("RATE_LIMIT_WEBHOOK_PER_MIN", 1200),
+		ZendeskRateLimit:       getEnvInt("ZENDESK_RATE_LIMIT", 100),
 	}
 }
 
@@ -49,6 +69,18 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvInt(key string, fallback int64) int64 {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return n
+}
+
 // @title           Purl API
 // @version         1.0
 // @description     API for Purl.
@@ -94,7 +126,24 @@ func main() {
 	}
 	log.Println("connected to redis")
 
-	a := app.New(db, rdb)
+	appCfg := app.Config{
+		RateLimits: app.RateLimits{
+			OrgPerMinute:     cfg.RateLimitOrgPerMin,
+			KeyPerMinute:     cfg.RateLimitKeyPerMin,
+			WebhookPerMinute: cfg.RateLimitWebhookPerMin,
+		},
+		ZendeskRateLimit: cfg.ZendeskRateLimit,
+	}
+	if cfg.RecordingCacheMaxMB > 0 {
+		recordings, err := diskcache.New(cfg.RecordingCacheDir, cfg.RecordingCacheMaxMB<<20)
+		if err != nil {
+			log.Fatalf("open recording cache: %v", err)
+		}
+		appCfg.RecordingCache = recordings
+		log.Printf("recording cache: %s (max %d MB)", cfg.RecordingCacheDir, cfg.RecordingCacheMaxMB)
+	}
+
+	a := app.New(db, rdb, appCfg)
 
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	log.Printf("listening on %s", addr)
@@ -0,0 +1,49 @@
+-- +goose Up
+
+-- Append-only record of every mutating API action. actor_id deliberately has no
+-- foreign key: agents are deleted and re-created by Zendesk re-imports, but their
+-- history must survive.
+CREATE TABLE audit_events (
+    id          UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id      UUID        NOT NULL REFERENCES organizations(id),
+    actor_type  TEXT        NOT NULL CHECK (actor_type IN ('agent', 'api_key')),
+    actor_id    UUID,
+    actor_name  TEXT        NOT NULL,
+    action      TEXT        NOT NULL,
+    target_type TEXT        NOT NULL,
+    target_id   TEXT        NOT NULL,
+    before      JSONB,
+    after       JSONB,
+    diff        JSONB,
+    ip          TEXT,
+    user_agent  TEXT
+);
+
+-- Keyset pagination walks (created_at, id) newest first within an org.
+CREATE INDEX audit_events_org_created ON audit_events (org_id, created_at DESC, id DESC);
+CREATE INDEX audit_events_org_target ON audit_events (org_id, target_type, target_id);
+
+-- Rows can never be updated. Deletes are only allowed when the transaction has
+-- explicitly opted in (used by reset-orgs to wipe an org entirely).
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION audit_events_append_only()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('purl.allow_audit_purge', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,131 @@
+-- +goose Up
+
+-- purl_app is the unprivileged role API requests run as. The API connects as the
+-- owning (privileged) user and switches to purl_app with SET ROLE for each
+-- request-scoped connection after setting app.current_org_id. Background workers
+-- stay on the owning role, which bypasses RLS because policies are enabled but
+-- not forced.
+-- +goose StatementBegin
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'purl_app') THEN
+        CREATE ROLE purl_app NOLOGIN;
+    END IF;
+END
+$$;
+-- +goose StatementEnd
+
+GRANT purl_app TO CURRENT_USER;
+
+GRANT USAGE ON SCHEMA public TO purl_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO purl_app;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO purl_app;
+-- Tables created by later migrations get the same grants automatically. Each new
+-- org-scoped table must still enable RLS and add an org_isolation policy.
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO purl_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO purl_app;
+
+REVOKE ALL ON goose_db_version FROM purl_app;
+-- The audit log is append-only for the API.
+REVOKE UPDATE, DELETE ON audit_events FROM purl_app;
+
+-- Returns the org the current request is scoped to, or NULL when unset. NULL
+-- never equals any org_id, so an unscoped purl_app session sees no rows.
+CREATE FUNCTION current_org_id() RETURNS UUID AS $$
+    SELECT NULLIF(current_setting('app.current_org_id', true), '')::uuid
+$$ LANGUAGE sql STABLE;
+
+-- Tables with their own org_id column.
+ALTER TABLE organizations ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON organizations
+    USING (id = current_org_id()) WITH CHECK (id = current_org_id());
+
+ALTER TABLE customers ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON customers
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE agents ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON agents
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE tickets ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON tickets
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE boards ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON boards
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE zendesk_webhook_events ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON zendesk_webhook_events
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE audit_events ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON audit_events
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Child tables inherit isolation through their parent. The parent lookups are
+-- themselves filtered by the parent's policy.
+ALTER TABLE customer_emails ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON customer_emails
+    USING (EXISTS (SELECT 1 FROM customers c WHERE c.id = customer_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM customers c WHERE c.id = customer_id));
+
+ALTER TABLE customer_phones ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON customer_phones
+    USING (EXISTS (SELECT 1 FROM customers c WHERE c.id = customer_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM customers c WHERE c.id = customer_id));
+
+ALTER TABLE ticket_comments ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_comments
+    USING (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id));
+
+ALTER TABLE board_columns ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON board_columns
+    USING (EXISTS (SELECT 1 FROM boards b WHERE b.id = board_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM boards b WHERE b.id = board_id));
+
+-- board_tickets checks both sides so a ticket can never be placed on (or read
+-- through) another org's board.
+ALTER TABLE board_tickets ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON board_tickets
+    USING (EXISTS (SELECT 1 FROM boards b WHERE b.id = board_id)
+           AND EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM boards b WHERE b.id = board_id)
+                AND EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON board_tickets;
+DROP POLICY IF EXISTS org_isolation ON board_columns;
+DROP POLICY IF EXISTS org_isolation ON ticket_comments;
+DROP POLICY IF EXISTS org_isolation ON customer_phones;
+DROP POLICY IF EXISTS org_isolation ON customer_emails;
+DROP POLICY IF EXISTS org_isolation ON audit_events;
+DROP POLICY IF EXISTS org_isolation ON zendesk_webhook_events;
+DROP POLICY IF EXISTS org_isolation ON boards;
+DROP POLICY IF EXISTS org_isolation ON tickets;
+DROP POLICY IF EXISTS org_isolation ON agents;
+DROP POLICY IF EXISTS org_isolation ON customers;
+DROP POLICY IF EXISTS org_isolation ON organizations;
+
+ALTER TABLE board_tickets          DISABLE ROW LEVEL SECURITY;
+ALTER TABLE board_columns          DISABLE ROW LEVEL SECURITY;
+ALTER TABLE ticket_comments        DISABLE ROW LEVEL SECURITY;
+ALTER TABLE customer_phones        DISABLE ROW LEVEL SECURITY;
+ALTER TABLE customer_emails        DISABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_events           DISABLE ROW LEVEL SECURITY;
+ALTER TABLE zendesk_webhook_events DISABLE ROW LEVEL SECURITY;
+ALTER TABLE boards                 DISABLE ROW LEVEL SECURITY;
+ALTER TABLE tickets                DISABLE ROW LEVEL SECURITY;
+ALTER TABLE agents                 DISABLE ROW LEVEL SECURITY;
+ALTER TABLE customers              DISABLE ROW LEVEL SECURITY;
+ALTER TABLE organizations          DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS current_org_id();
+
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM purl_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE USAGE, SELECT ON SEQUENCES FROM purl_app;
+DROP OWNED BY purl_app;
+DROP ROLE IF EXISTS purl_app;
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- Full-text search vectors, maintained by Postgres as stored generated columns.
+-- Weights rank title matches above the AI summary, and both above the body text.
+ALTER TABLE tickets ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(ai_title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(ai_summary, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+) STORED;
+CREATE INDEX tickets_search_vector_idx ON tickets USING GIN (search_vector);
+
+ALTER TABLE ticket_comments ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(body, '')), 'C') ||
+    setweight(to_tsvector('english', COALESCE(transcription_text, '')), 'D')
+) STORED;
+CREATE INDEX ticket_comments_search_vector_idx ON ticket_comments USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX IF EXISTS ticket_comments_search_vector_idx;
+ALTER TABLE ticket_comments DROP COLUMN IF EXISTS search_vector;
+DROP INDEX IF EXISTS tickets_search_vector_idx;
+ALTER TABLE tickets DROP COLUMN IF EXISTS search_vector;
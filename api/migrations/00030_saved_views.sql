@@ -0,0 +1,36 @@
+-- +goose Up
+
+CREATE TYPE saved_view_visibility AS ENUM ('shared', 'personal');
+
+-- A saved ticket filter shown in the sidebar. filter holds a ticketFilter JSON
+-- document (see internal/app/ticket_filter.go); sort names one of its sorts.
+-- Personal views belong to, and are only visible to, owner_agent_id.
+CREATE TABLE saved_views (
+    id             UUID                  PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at     TIMESTAMPTZ           NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ           NOT NULL DEFAULT now(),
+    org_id         UUID                  NOT NULL REFERENCES organizations(id),
+    owner_agent_id UUID                  REFERENCES agents(id) ON DELETE CASCADE,
+    name           TEXT                  NOT NULL,
+    visibility     saved_view_visibility NOT NULL,
+    filter         JSONB                 NOT NULL DEFAULT '{}',
+    sort           TEXT                  NOT NULL,
+    position       INTEGER               NOT NULL DEFAULT 0 CHECK (position >= 0),
+    CHECK (visibility = 'shared' OR owner_agent_id IS NOT NULL)
+);
+
+CREATE INDEX saved_views_org ON saved_views (org_id, position);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON saved_views
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE saved_views ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON saved_views
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON saved_views;
+DROP TRIGGER IF EXISTS set_updated_at ON saved_views;
+DROP TABLE IF EXISTS saved_views;
+DROP TYPE IF EXISTS saved_view_visibility;
@@ -0,0 +1,67 @@
+-- +goose Up
+
+CREATE TYPE bulk_job_status AS ENUM ('pending', 'running', 'completed', 'failed');
+CREATE TYPE bulk_item_status AS ENUM ('pending', 'succeeded', 'failed');
+
+-- A bulk ticket operation submitted through POST /tickets/bulk and carried out
+-- by the process-bulk-jobs worker. params holds the action's arguments. The
+-- submitting actor is kept so the worker can attribute per-ticket audit events.
+-- A worker claims a job until claimed_until; a job whose claim lapses without
+-- finishing is claimed again, and fails after too many attempts.
+CREATE TABLE bulk_jobs (
+    id             UUID            PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at     TIMESTAMPTZ     NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ     NOT NULL DEFAULT now(),
+    org_id         UUID            NOT NULL REFERENCES organizations(id),
+    actor_agent_id UUID,
+    ip             TEXT,
+    user_agent     TEXT,
+    action         TEXT            NOT NULL,
+    params         JSONB           NOT NULL DEFAULT '{}',
+    status         bulk_job_status NOT NULL DEFAULT 'pending',
+    started_at     TIMESTAMPTZ,
+    finished_at    TIMESTAMPTZ,
+    attempts       INTEGER         NOT NULL DEFAULT 0,
+    claimed_until  TIMESTAMPTZ,
+    error          TEXT
+);
+
+CREATE INDEX bulk_jobs_pending ON bulk_jobs (created_at) WHERE status IN ('pending', 'running');
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON bulk_jobs
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE bulk_job_items (
+    id         UUID             PRIMARY KEY DEFAULT gen_random_uuid(),
+    updated_at TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    job_id     UUID             NOT NULL REFERENCES bulk_jobs(id) ON DELETE CASCADE,
+    ticket_id  UUID             NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    status     bulk_item_status NOT NULL DEFAULT 'pending',
+    error      TEXT,
+    UNIQUE (job_id, ticket_id)
+);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON bulk_job_items
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE bulk_jobs ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON bulk_jobs
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE bulk_job_items ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON bulk_job_items
+    USING (EXISTS (SELECT 1 FROM bulk_jobs j WHERE j.id = job_id)
+           AND EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM bulk_jobs j WHERE j.id = job_id)
+                AND EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON bulk_job_items;
+DROP POLICY IF EXISTS org_isolation ON bulk_jobs;
+DROP TRIGGER IF EXISTS set_updated_at ON bulk_job_items;
+DROP TRIGGER IF EXISTS set_updated_at ON bulk_jobs;
+DROP TABLE IF EXISTS bulk_job_items;
+DROP TABLE IF EXISTS bulk_jobs;
+DROP TYPE IF EXISTS bulk_item_status;
+DROP TYPE IF EXISTS bulk_job_status;
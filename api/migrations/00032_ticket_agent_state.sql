@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- Per-agent view state of a ticket. A ticket is unread for an agent with no
+-- row, or whose last_read_at is NULL; a new customer comment clears
+-- last_read_at for every agent.
+CREATE TABLE ticket_agent_state (
+    ticket_id    UUID        NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    agent_id     UUID        NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_read_at TIMESTAMPTZ,
+    starred      BOOLEAN     NOT NULL DEFAULT false,
+    PRIMARY KEY (ticket_id, agent_id)
+);
+
+CREATE INDEX ticket_agent_state_starred ON ticket_agent_state (agent_id) WHERE starred;
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON ticket_agent_state
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE ticket_agent_state ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_agent_state
+    USING (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id)
+           AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id)
+                AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id));
+
+-- The agent named by x-agent-id on the current request, set alongside
+-- app.current_org_id by the API. NULL when the request names no agent.
+CREATE FUNCTION current_agent_id() RETURNS UUID AS $$
+    SELECT NULLIF(current_setting('app.current_agent_id', true), '')::uuid
+$$ LANGUAGE sql STABLE;
+
+-- +goose Down
+
+DROP FUNCTION IF EXISTS current_agent_id();
+DROP POLICY IF EXISTS org_isolation ON ticket_agent_state;
+DROP TRIGGER IF EXISTS set_updated_at ON ticket_agent_state;
+DROP TABLE IF EXISTS ticket_agent_state;
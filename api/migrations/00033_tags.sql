@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- Tags mirror Zendesk ticket tags: lowercase, no whitespace, unique per org.
+CREATE TABLE tags (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id     UUID        NOT NULL REFERENCES organizations(id),
+    name       TEXT        NOT NULL,
+    UNIQUE (org_id, name)
+);
+
+CREATE TABLE ticket_tags (
+    ticket_id  UUID        NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    tag_id     UUID        NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticket_id, tag_id)
+);
+
+CREATE INDEX ticket_tags_tag ON ticket_tags (tag_id);
+
+ALTER TABLE tags ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON tags
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE ticket_tags ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_tags
+    USING (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id)
+           AND EXISTS (SELECT 1 FROM tags tg WHERE tg.id = tag_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id)
+                AND EXISTS (SELECT 1 FROM tags tg WHERE tg.id = tag_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON ticket_tags;
+DROP POLICY IF EXISTS org_isolation ON tags;
+DROP TABLE IF EXISTS ticket_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,64 @@
+-- +goose Up
+
+-- Purl-native notes agents keep on a ticket. Unlike Zendesk internal comments
+-- they are never written to or synced from Zendesk. body is the current text;
+-- every version, including the first, is kept in ticket_note_versions.
+CREATE TABLE ticket_notes (
+    id              UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ticket_id       UUID        NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    author_agent_id UUID        REFERENCES agents(id) ON DELETE SET NULL,
+    body            TEXT        NOT NULL,
+    version         INTEGER     NOT NULL DEFAULT 1
+);
+
+CREATE INDEX ticket_notes_ticket ON ticket_notes (ticket_id, created_at);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON ticket_notes
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE ticket_note_versions (
+    note_id         UUID        NOT NULL REFERENCES ticket_notes(id) ON DELETE CASCADE,
+    version         INTEGER     NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    editor_agent_id UUID        REFERENCES agents(id) ON DELETE SET NULL,
+    body            TEXT        NOT NULL,
+    PRIMARY KEY (note_id, version)
+);
+
+-- Agents @mentioned by the current version of a note.
+CREATE TABLE ticket_note_mentions (
+    note_id  UUID NOT NULL REFERENCES ticket_notes(id) ON DELETE CASCADE,
+    agent_id UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    PRIMARY KEY (note_id, agent_id)
+);
+
+CREATE INDEX ticket_note_mentions_agent ON ticket_note_mentions (agent_id);
+
+ALTER TABLE ticket_notes ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_notes
+    USING (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM tickets t WHERE t.id = ticket_id));
+
+ALTER TABLE ticket_note_versions ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_note_versions
+    USING (EXISTS (SELECT 1 FROM ticket_notes n WHERE n.id = note_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM ticket_notes n WHERE n.id = note_id));
+
+ALTER TABLE ticket_note_mentions ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON ticket_note_mentions
+    USING (EXISTS (SELECT 1 FROM ticket_notes n WHERE n.id = note_id)
+           AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM ticket_notes n WHERE n.id = note_id)
+                AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON ticket_note_mentions;
+DROP POLICY IF EXISTS org_isolation ON ticket_note_versions;
+DROP POLICY IF EXISTS org_isolation ON ticket_notes;
+DROP TABLE IF EXISTS ticket_note_mentions;
+DROP TABLE IF EXISTS ticket_note_versions;
+DROP TRIGGER IF EXISTS set_updated_at ON ticket_notes;
+DROP TABLE IF EXISTS ticket_notes;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- Agents follow tickets to be notified of their status changes.
+ALTER TABLE ticket_agent_state ADD COLUMN following BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX ticket_agent_state_following ON ticket_agent_state (ticket_id) WHERE following;
+
+CREATE TYPE notification_kind AS ENUM ('mention', 'customer_reply', 'status_change');
+
+-- An agent's inbox. data carries kind-specific detail: {"from", "to"} for
+-- status_change; empty otherwise.
+CREATE TABLE notifications (
+    id             UUID              PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at     TIMESTAMPTZ       NOT NULL DEFAULT now(),
+    org_id         UUID              NOT NULL REFERENCES organizations(id),
+    agent_id       UUID              NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    kind           notification_kind NOT NULL,
+    ticket_id      UUID              NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    note_id        UUID              REFERENCES ticket_notes(id) ON DELETE CASCADE,
+    actor_agent_id UUID              REFERENCES agents(id) ON DELETE SET NULL,
+    data           JSONB             NOT NULL DEFAULT '{}',
+    read_at        TIMESTAMPTZ
+);
+
+CREATE INDEX notifications_agent ON notifications (agent_id, created_at DESC, id DESC);
+CREATE INDEX notifications_agent_unread ON notifications (agent_id) WHERE read_at IS NULL;
+
+ALTER TABLE notifications ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON notifications
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON notifications;
+DROP TABLE IF EXISTS notifications;
+DROP TYPE IF EXISTS notification_kind;
+DROP INDEX IF EXISTS ticket_agent_state_following;
+ALTER TABLE ticket_agent_state DROP COLUMN IF EXISTS following;
@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- A ticket is snoozed while snoozed_at is set. It wakes at snoozed_until, or
+-- when the customer next writes; a NULL snoozed_until waits for the customer
+-- only.
+ALTER TABLE tickets
+    ADD COLUMN snoozed_at    TIMESTAMPTZ,
+    ADD COLUMN snoozed_until TIMESTAMPTZ,
+    ADD COLUMN snoozed_by    UUID REFERENCES agents(id) ON DELETE SET NULL,
+    ADD CONSTRAINT tickets_snooze_check CHECK (snoozed_at IS NOT NULL OR snoozed_until IS NULL);
+
+CREATE INDEX tickets_snoozed_until ON tickets (snoozed_until) WHERE snoozed_until IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS tickets_snoozed_until;
+ALTER TABLE tickets
+    DROP CONSTRAINT IF EXISTS tickets_snooze_check,
+    DROP COLUMN IF EXISTS snoozed_by,
+    DROP COLUMN IF EXISTS snoozed_until,
+    DROP COLUMN IF EXISTS snoozed_at;
@@ -0,0 +1,35 @@
+-- +goose Up
+
+-- Zendesk ticket custom field values keyed by field ID, e.g. {"360001": "gold"}.
+ALTER TABLE tickets ADD COLUMN custom_fields JSONB NOT NULL DEFAULT '{}';
+
+-- A canned reply and/or set of ticket changes agents apply in one step. body is
+-- a template (see internal/app/macro_template.go); actions holds
+-- {"status", "add_tags", "assignee_id"}, all optional.
+CREATE TABLE macros (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id     UUID        NOT NULL REFERENCES organizations(id),
+    name       TEXT        NOT NULL,
+    body       TEXT        NOT NULL DEFAULT '',
+    public     BOOLEAN     NOT NULL DEFAULT true,
+    actions    JSONB       NOT NULL DEFAULT '{}',
+    position   INTEGER     NOT NULL DEFAULT 0 CHECK (position >= 0)
+);
+
+CREATE INDEX macros_org ON macros (org_id, position);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON macros
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE macros ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON macros
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON macros;
+DROP TRIGGER IF EXISTS set_updated_at ON macros;
+DROP TABLE IF EXISTS macros;
+ALTER TABLE tickets DROP COLUMN IF EXISTS custom_fields;
@@ -0,0 +1,72 @@
+-- +goose Up
+
+CREATE TYPE automation_trigger AS ENUM ('ticket_created', 'comment_added', 'status_changed', 'temperature_crossed');
+
+-- Org-defined "when <trigger>, if <conditions>, then <actions>" rules, run by
+-- the webhook processor (and the AI summary worker, for temperature_crossed)
+-- in position order. conditions and actions are documented on
+-- automationConditions and automationAction in internal/app/automations.go.
+CREATE TABLE automation_rules (
+    id                    UUID               PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at            TIMESTAMPTZ        NOT NULL DEFAULT now(),
+    updated_at            TIMESTAMPTZ        NOT NULL DEFAULT now(),
+    org_id                UUID               NOT NULL REFERENCES organizations(id),
+    name                  TEXT               NOT NULL,
+    enabled               BOOLEAN            NOT NULL DEFAULT true,
+    position              INTEGER            NOT NULL DEFAULT 0 CHECK (position >= 0),
+    trigger               automation_trigger NOT NULL,
+    -- The AI temperature (1-10) a temperature_crossed rule fires on reaching.
+    temperature_threshold SMALLINT           CHECK (temperature_threshold BETWEEN 1 AND 10),
+    conditions            JSONB              NOT NULL DEFAULT '{}',
+    actions               JSONB              NOT NULL DEFAULT '[]',
+    CHECK ((trigger = 'temperature_crossed') = (temperature_threshold IS NOT NULL))
+);
+
+CREATE INDEX automation_rules_org_trigger ON automation_rules (org_id, trigger, position) WHERE enabled;
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON automation_rules
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE automation_rules ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON automation_rules
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Execution trace: one row per evaluation of a rule against a ticket, whether
+-- or not it matched. conditions holds each condition's outcome and actions
+-- each action's; error is set when the run failed as a whole.
+CREATE TABLE automation_runs (
+    id         UUID               PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ        NOT NULL DEFAULT now(),
+    org_id     UUID               NOT NULL REFERENCES organizations(id),
+    rule_id    UUID               NOT NULL REFERENCES automation_rules(id) ON DELETE CASCADE,
+    ticket_id  UUID               NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    trigger    automation_trigger NOT NULL,
+    matched    BOOLEAN            NOT NULL,
+    conditions JSONB              NOT NULL DEFAULT '[]',
+    actions    JSONB              NOT NULL DEFAULT '[]',
+    error      TEXT
+);
+
+CREATE INDEX automation_runs_rule ON automation_runs (rule_id, created_at DESC, id DESC);
+CREATE INDEX automation_runs_ticket ON automation_runs (ticket_id, created_at DESC, id DESC);
+
+ALTER TABLE automation_runs ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON automation_runs
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Notes posted by a rule's add_note action have no author agent.
+ALTER TABLE ticket_notes ADD COLUMN automation_rule_id UUID REFERENCES automation_rules(id) ON DELETE SET NULL;
+
+ALTER TYPE notification_kind ADD VALUE IF NOT EXISTS 'automation';
+
+-- +goose Down
+
+-- notification_kind keeps its 'automation' value: enum values can't be dropped.
+DELETE FROM notifications WHERE kind = 'automation';
+ALTER TABLE ticket_notes DROP COLUMN IF EXISTS automation_rule_id;
+DROP POLICY IF EXISTS org_isolation ON automation_runs;
+DROP TABLE IF EXISTS automation_runs;
+DROP POLICY IF EXISTS org_isolation ON automation_rules;
+DROP TRIGGER IF EXISTS set_updated_at ON automation_rules;
+DROP TABLE IF EXISTS automation_rules;
+DROP TYPE IF EXISTS automation_trigger;
@@ -0,0 +1,81 @@
+-- +goose Up
+
+CREATE TYPE routing_strategy AS ENUM ('round_robin', 'least_open', 'skills');
+
+-- How new, unassigned tickets are assigned. The first enabled policy in
+-- position order whose match_tags the ticket has any of (or that has none)
+-- routes the ticket.
+CREATE TABLE routing_policies (
+    id            UUID             PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at    TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    org_id        UUID             NOT NULL REFERENCES organizations(id),
+    name          TEXT             NOT NULL,
+    enabled       BOOLEAN          NOT NULL DEFAULT true,
+    position      INTEGER          NOT NULL DEFAULT 0 CHECK (position >= 0),
+    strategy      routing_strategy NOT NULL,
+    match_tags    TEXT[]           NOT NULL DEFAULT '{}',
+    -- Round-robin cursor: the agent this policy assigned last.
+    last_agent_id UUID             REFERENCES agents(id) ON DELETE SET NULL
+);
+
+CREATE INDEX routing_policies_org ON routing_policies (org_id, position) WHERE enabled;
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON routing_policies
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- The agents a policy assigns to. A policy with none assigns to any agent.
+CREATE TABLE routing_policy_agents (
+    policy_id UUID NOT NULL REFERENCES routing_policies(id) ON DELETE CASCADE,
+    agent_id  UUID NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    PRIMARY KEY (policy_id, agent_id)
+);
+
+-- Per-agent routing settings. An agent without a row is available, has no
+-- capacity limit and no skills.
+CREATE TABLE agent_routing (
+    agent_id         UUID        PRIMARY KEY REFERENCES agents(id) ON DELETE CASCADE,
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    -- false pauses the agent: routing skips them.
+    available        BOOLEAN     NOT NULL DEFAULT true,
+    -- Most new, open or pending tickets the agent may hold before routing skips them.
+    max_open_tickets INTEGER     CHECK (max_open_tickets >= 0),
+    -- Tags the agent handles, for the skills strategy.
+    skills           TEXT[]      NOT NULL DEFAULT '{}'
+);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON agent_routing
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- Open-ticket counts per assignee, for capacity and least_open.
+CREATE INDEX tickets_assignee_open ON tickets (assignee_id)
+    WHERE zendesk_status IN ('new', 'open', 'pending');
+
+ALTER TABLE routing_policies ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON routing_policies
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE routing_policy_agents ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON routing_policy_agents
+    USING (EXISTS (SELECT 1 FROM routing_policies p WHERE p.id = policy_id)
+           AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM routing_policies p WHERE p.id = policy_id)
+                AND EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id));
+
+ALTER TABLE agent_routing ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON agent_routing
+    USING (EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM agents a WHERE a.id = agent_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON agent_routing;
+DROP POLICY IF EXISTS org_isolation ON routing_policy_agents;
+DROP POLICY IF EXISTS org_isolation ON routing_policies;
+DROP INDEX IF EXISTS tickets_assignee_open;
+DROP TRIGGER IF EXISTS set_updated_at ON agent_routing;
+DROP TABLE IF EXISTS agent_routing;
+DROP TABLE IF EXISTS routing_policy_agents;
+DROP TRIGGER IF EXISTS set_updated_at ON routing_policies;
+DROP TABLE IF EXISTS routing_policies;
+DROP TYPE IF EXISTS routing_strategy;
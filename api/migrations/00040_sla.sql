@@ -0,0 +1,98 @@
+-- +goose Up
+
+-- Zendesk's ticket priority: low, normal, high or urgent. Null when unset.
+ALTER TABLE tickets ADD COLUMN zendesk_priority TEXT
+    CHECK (zendesk_priority IN ('low', 'normal', 'high', 'urgent'));
+
+-- First-response and resolution targets. The first enabled policy in position
+-- order whose priorities include the ticket's (or that has none) and whose
+-- match_tags the ticket has any of (or that has none) applies to the ticket.
+CREATE TABLE sla_policies (
+    id                     UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at             TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id                 UUID        NOT NULL REFERENCES organizations(id),
+    name                   TEXT        NOT NULL,
+    enabled                BOOLEAN     NOT NULL DEFAULT true,
+    position               INTEGER     NOT NULL DEFAULT 0 CHECK (position >= 0),
+    priorities             TEXT[]      NOT NULL DEFAULT '{}',
+    match_tags             TEXT[]      NOT NULL DEFAULT '{}',
+    first_response_minutes INTEGER     CHECK (first_response_minutes > 0),
+    resolution_minutes     INTEGER     CHECK (resolution_minutes > 0),
+    -- businesstime.Hours the targets are measured in; null for around the clock.
+    business_hours         JSONB,
+    CHECK (first_response_minutes IS NOT NULL OR resolution_minutes IS NOT NULL)
+);
+
+CREATE INDEX sla_policies_org ON sla_policies (org_id, position) WHERE enabled;
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON sla_policies
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE sla_policies ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON sla_policies
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- The policy applied to the ticket and its computed targets. Recomputed from
+-- received_at whenever the ticket or its comments change, and for unresolved
+-- tickets when the org's policies change.
+ALTER TABLE tickets ADD COLUMN sla_policy_id      UUID REFERENCES sla_policies(id) ON DELETE SET NULL;
+ALTER TABLE tickets ADD COLUMN first_response_due TIMESTAMPTZ;
+-- First public reply by a (non-system) agent.
+ALTER TABLE tickets ADD COLUMN first_responded_at TIMESTAMPTZ;
+ALTER TABLE tickets ADD COLUMN resolution_due     TIMESTAMPTZ;
+
+CREATE INDEX tickets_first_response_due ON tickets (first_response_due)
+    WHERE first_response_due IS NOT NULL AND first_responded_at IS NULL AND resolved_at IS NULL;
+CREATE INDEX tickets_resolution_due ON tickets (resolution_due)
+    WHERE resolution_due IS NOT NULL AND resolved_at IS NULL;
+
+CREATE TYPE sla_metric AS ENUM ('first_response', 'resolution');
+
+-- One row per target a ticket missed, recorded when the target passed (or,
+-- for a target recomputed into the past, when that was noticed).
+CREATE TABLE sla_breaches (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id     UUID        NOT NULL REFERENCES organizations(id),
+    ticket_id  UUID        NOT NULL REFERENCES tickets(id) ON DELETE CASCADE,
+    policy_id  UUID        REFERENCES sla_policies(id) ON DELETE SET NULL,
+    metric     sla_metric  NOT NULL,
+    due_at     TIMESTAMPTZ NOT NULL,
+    UNIQUE (ticket_id, metric)
+);
+
+CREATE INDEX sla_breaches_org ON sla_breaches (org_id, created_at);
+
+ALTER TABLE sla_breaches ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON sla_breaches
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Orgs whose policies changed since the record-sla-breaches worker last
+-- recomputed their unresolved tickets' targets.
+CREATE TABLE sla_refresh_pending (
+    org_id       UUID        PRIMARY KEY REFERENCES organizations(id),
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE sla_refresh_pending ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON sla_refresh_pending
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON sla_refresh_pending;
+DROP TABLE IF EXISTS sla_refresh_pending;
+DROP POLICY IF EXISTS org_isolation ON sla_breaches;
+DROP TABLE IF EXISTS sla_breaches;
+DROP TYPE IF EXISTS sla_metric;
+DROP INDEX IF EXISTS tickets_resolution_due;
+DROP INDEX IF EXISTS tickets_first_response_due;
+ALTER TABLE tickets DROP COLUMN IF EXISTS resolution_due;
+ALTER TABLE tickets DROP COLUMN IF EXISTS first_responded_at;
+ALTER TABLE tickets DROP COLUMN IF EXISTS first_response_due;
+ALTER TABLE tickets DROP COLUMN IF EXISTS sla_policy_id;
+DROP POLICY IF EXISTS org_isolation ON sla_policies;
+DROP TRIGGER IF EXISTS set_updated_at ON sla_policies;
+DROP TABLE IF EXISTS sla_policies;
+ALTER TABLE tickets DROP COLUMN IF EXISTS zendesk_priority;
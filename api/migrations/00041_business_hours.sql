@@ -0,0 +1,47 @@
+-- +goose Up
+
+-- The org's weekly opening hours. Business-hours waiting times, and SLA
+-- policies with use_org_hours, use them. An org without a row is open around
+-- the clock.
+CREATE TABLE org_business_hours (
+    org_id     UUID        PRIMARY KEY REFERENCES organizations(id),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    time_zone  TEXT        NOT NULL,
+    -- businesstime.Hours weekly: day name -> [{"start": "HH:MM", "end": "HH:MM"}].
+    weekly     JSONB       NOT NULL
+);
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON org_business_hours
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+ALTER TABLE org_business_hours ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON org_business_hours
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Days the org is closed, as dates in its business-hours time zone.
+CREATE TABLE org_holidays (
+    id         UUID        PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    org_id     UUID        NOT NULL REFERENCES organizations(id),
+    date       DATE        NOT NULL,
+    name       TEXT        NOT NULL,
+    UNIQUE (org_id, date)
+);
+
+ALTER TABLE org_holidays ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON org_holidays
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- SLA policies measured in the org's business hours rather than their own
+-- (business_hours) or around the clock (neither).
+ALTER TABLE sla_policies ADD COLUMN use_org_hours BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+
+ALTER TABLE sla_policies DROP COLUMN IF EXISTS use_org_hours;
+
+DROP POLICY IF EXISTS org_isolation ON org_holidays;
+DROP TABLE IF EXISTS org_holidays;
+DROP POLICY IF EXISTS org_isolation ON org_business_hours;
+DROP TRIGGER IF EXISTS set_updated_at ON org_business_hours;
+DROP TABLE IF EXISTS org_business_hours;
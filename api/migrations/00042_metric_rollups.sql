@@ -0,0 +1,214 @@
+-- +goose Up
+
+-- Daily report metrics, rebuilt by the rollup-metrics worker. Days are dates
+-- in the time zone recorded in metric_rollup_state.
+
+-- Ticket metrics by the ticket's assignee and channel (the channel of its
+-- first public comment; null before it has one). Durations are per-ticket
+-- seconds so that medians can be taken over any range.
+CREATE TABLE daily_ticket_metrics (
+    org_id                          UUID     NOT NULL REFERENCES organizations(id),
+    day                             DATE     NOT NULL,
+    assignee_id                     UUID,
+    channel                         TEXT,
+    -- Tickets received on the day.
+    created                         INTEGER  NOT NULL DEFAULT 0,
+    -- Tickets solved on the day, and of those, solved with one public reply.
+    solved                          INTEGER  NOT NULL DEFAULT 0,
+    one_touch                       INTEGER  NOT NULL DEFAULT 0,
+    -- Received to first public reply, for tickets first replied to on the day.
+    first_response_seconds          BIGINT[] NOT NULL DEFAULT '{}',
+    first_response_business_seconds BIGINT[] NOT NULL DEFAULT '{}',
+    -- Received to solved, for tickets solved on the day.
+    resolution_seconds              BIGINT[] NOT NULL DEFAULT '{}',
+    resolution_business_seconds     BIGINT[] NOT NULL DEFAULT '{}',
+    -- AI temperatures of the tickets solved on the day that have one.
+    temperature_sum                 INTEGER  NOT NULL DEFAULT 0,
+    temperature_count               INTEGER  NOT NULL DEFAULT 0
+);
+
+-- One row per grain; a null assignee or channel is a value of its own.
+CREATE UNIQUE INDEX daily_ticket_metrics_key
+    ON daily_ticket_metrics (org_id, day, assignee_id, channel) NULLS NOT DISTINCT;
+
+ALTER TABLE daily_ticket_metrics ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON daily_ticket_metrics
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Metrics credited to the agent who wrote the comments.
+CREATE TABLE daily_agent_metrics (
+    org_id                          UUID     NOT NULL REFERENCES organizations(id),
+    day                             DATE     NOT NULL,
+    agent_id                        UUID     NOT NULL REFERENCES agents(id) ON DELETE CASCADE,
+    replies                         INTEGER  NOT NULL DEFAULT 0,
+    calls                           INTEGER  NOT NULL DEFAULT 0,
+    call_seconds                    BIGINT   NOT NULL DEFAULT 0,
+    -- Received to first public reply, for tickets the agent first replied to
+    -- on the day.
+    first_response_seconds          BIGINT[] NOT NULL DEFAULT '{}',
+    first_response_business_seconds BIGINT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (org_id, day, agent_id)
+);
+
+ALTER TABLE daily_agent_metrics ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON daily_agent_metrics
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- How far each org's rollups are built. A change of time zone or business
+-- hours makes the worker rebuild them all.
+CREATE TABLE metric_rollup_state (
+    org_id       UUID        PRIMARY KEY REFERENCES organizations(id),
+    time_zone    TEXT        NOT NULL,
+    -- The businesstime.Hours the business durations were computed with;
+    -- null for around the clock.
+    hours        JSONB,
+    -- Every change committed before this is reflected in the rollups.
+    refreshed_at TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE metric_rollup_state ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON metric_rollup_state
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- Hours whose metrics changed since the worker last ran.
+CREATE TABLE metric_rollup_dirty (
+    org_id UUID        NOT NULL REFERENCES organizations(id),
+    hour   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (org_id, hour)
+);
+
+ALTER TABLE metric_rollup_dirty ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON metric_rollup_dirty
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+-- mark_ticket_metrics_dirty marks the hours a ticket's metrics fall in: when
+-- it was received, solved and first replied to, plus extra (may be null).
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION mark_ticket_metrics_dirty(p_org_id UUID, p_ticket_id UUID,
+    p_received TIMESTAMPTZ, p_resolved TIMESTAMPTZ, p_extra TIMESTAMPTZ)
+RETURNS VOID AS $$
+BEGIN
+    INSERT INTO metric_rollup_dirty (org_id, hour)
+    SELECT DISTINCT p_org_id, date_trunc('hour', at)
+    FROM unnest(ARRAY[p_received, p_resolved, p_extra,
+        (SELECT MIN(COALESCE(tc.received_at, tc.created_at)) FROM ticket_comments tc
+         WHERE tc.ticket_id = p_ticket_id AND tc.role = 'agent' AND tc.channel <> 'internal'
+           AND COALESCE(tc.received_at, tc.created_at) >= p_received)]) AS at
+    WHERE at IS NOT NULL
+    ON CONFLICT DO NOTHING;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION tickets_mark_metrics_dirty()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        PERFORM mark_ticket_metrics_dirty(OLD.org_id, OLD.id,
+            COALESCE(OLD.received_at, OLD.created_at), OLD.resolved_at, NULL);
+    END IF;
+    PERFORM mark_ticket_metrics_dirty(NEW.org_id, NEW.id,
+        COALESCE(NEW.received_at, NEW.created_at), NEW.resolved_at, NULL);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER mark_metrics_dirty_insert AFTER INSERT ON tickets
+FOR EACH ROW EXECUTE FUNCTION tickets_mark_metrics_dirty();
+
+CREATE TRIGGER mark_metrics_dirty_update AFTER UPDATE ON tickets
+FOR EACH ROW
+WHEN (OLD.received_at IS DISTINCT FROM NEW.received_at
+   OR OLD.resolved_at IS DISTINCT FROM NEW.resolved_at
+   OR OLD.assignee_id IS DISTINCT FROM NEW.assignee_id
+   OR OLD.ai_temperature IS DISTINCT FROM NEW.ai_temperature)
+EXECUTE FUNCTION tickets_mark_metrics_dirty();
+
+-- A deleted ticket takes its comments with it, so the hours of their replies
+-- and calls are marked too.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION tickets_deleted_mark_metrics_dirty()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM mark_ticket_metrics_dirty(OLD.org_id, OLD.id,
+        COALESCE(OLD.received_at, OLD.created_at), OLD.resolved_at, NULL);
+    INSERT INTO metric_rollup_dirty (org_id, hour)
+    SELECT DISTINCT OLD.org_id, date_trunc('hour', at)
+    FROM ticket_comments tc,
+         unnest(ARRAY[CASE WHEN tc.role = 'agent' THEN COALESCE(tc.received_at, tc.created_at) END,
+                      tc.call_started_at]) AS at
+    WHERE tc.ticket_id = OLD.id AND at IS NOT NULL
+    ON CONFLICT DO NOTHING;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- BEFORE, while the ticket's comments are still there.
+CREATE TRIGGER mark_metrics_dirty_delete BEFORE DELETE ON tickets
+FOR EACH ROW EXECUTE FUNCTION tickets_deleted_mark_metrics_dirty();
+
+-- A new or deleted comment changes its hour's replies and calls, and may
+-- change its ticket's channel, first reply and one-touch status. Comments
+-- deleted along with their ticket find no ticket here; its own trigger has
+-- marked their hours.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION ticket_comments_mark_metrics_dirty()
+RETURNS TRIGGER AS $$
+DECLARE
+    c ticket_comments;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        c := OLD;
+    ELSE
+        c := NEW;
+    END IF;
+    PERFORM mark_ticket_metrics_dirty(t.org_id, t.id,
+        COALESCE(t.received_at, t.created_at), t.resolved_at,
+        COALESCE(c.received_at, c.created_at))
+    FROM tickets t WHERE t.id = c.ticket_id;
+    IF c.call_started_at IS NOT NULL THEN
+        INSERT INTO metric_rollup_dirty (org_id, hour)
+        SELECT t.org_id, date_trunc('hour', c.call_started_at) FROM tickets t WHERE t.id = c.ticket_id
+        ON CONFLICT DO NOTHING;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- BEFORE, so that the ticket's previous (or, on delete, current) first reply
+-- is marked too.
+CREATE TRIGGER mark_metrics_dirty BEFORE INSERT OR DELETE ON ticket_comments
+FOR EACH ROW EXECUTE FUNCTION ticket_comments_mark_metrics_dirty();
+
+CREATE INDEX ticket_comments_at ON ticket_comments ((COALESCE(received_at, created_at)));
+CREATE INDEX tickets_org_received ON tickets (org_id, (COALESCE(received_at, created_at)));
+CREATE INDEX tickets_org_resolved ON tickets (org_id, resolved_at) WHERE resolved_at IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS tickets_org_resolved;
+DROP INDEX IF EXISTS tickets_org_received;
+DROP INDEX IF EXISTS ticket_comments_at;
+DROP TRIGGER IF EXISTS mark_metrics_dirty ON ticket_comments;
+DROP FUNCTION IF EXISTS ticket_comments_mark_metrics_dirty();
+DROP TRIGGER IF EXISTS mark_metrics_dirty_delete ON tickets;
+DROP FUNCTION IF EXISTS tickets_deleted_mark_metrics_dirty();
+DROP TRIGGER IF EXISTS mark_metrics_dirty_update ON tickets;
+DROP TRIGGER IF EXISTS mark_metrics_dirty_insert ON tickets;
+DROP FUNCTION IF EXISTS tickets_mark_metrics_dirty();
+DROP FUNCTION IF EXISTS mark_ticket_metrics_dirty(UUID, UUID, TIMESTAMPTZ, TIMESTAMPTZ, TIMESTAMPTZ);
+DROP POLICY IF EXISTS org_isolation ON metric_rollup_dirty;
+DROP TABLE IF EXISTS metric_rollup_dirty;
+DROP POLICY IF EXISTS org_isolation ON metric_rollup_state;
+DROP TABLE IF EXISTS metric_rollup_state;
+DROP POLICY IF EXISTS org_isolation ON daily_agent_metrics;
+DROP TABLE IF EXISTS daily_agent_metrics;
+DROP POLICY IF EXISTS org_isolation ON daily_ticket_metrics;
+DROP TABLE IF EXISTS daily_ticket_metrics;
@@ -0,0 +1,63 @@
+-- +goose Up
+
+CREATE TYPE export_job_status AS ENUM ('pending', 'running', 'completed', 'failed', 'expired');
+
+-- A ticket export submitted through POST /exports and written by the
+-- process-export-jobs worker. filter is a ticketFilter, evaluated when the
+-- job runs as the submitting agent. The finished file is stored in
+-- export_job_chunks and downloaded with download_token until expires_at.
+-- A worker claims a job until claimed_until, renewing the claim as it writes;
+-- a job whose claim lapses is started again, and fails after too many attempts.
+CREATE TABLE export_jobs (
+    id             UUID              PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at     TIMESTAMPTZ       NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ       NOT NULL DEFAULT now(),
+    org_id         UUID              NOT NULL REFERENCES organizations(id),
+    actor_agent_id UUID,
+    ip             TEXT,
+    user_agent     TEXT,
+    format         TEXT              NOT NULL CHECK (format IN ('csv', 'ndjson', 'zip')),
+    filter         JSONB             NOT NULL DEFAULT '{}',
+    status         export_job_status NOT NULL DEFAULT 'pending',
+    started_at     TIMESTAMPTZ,
+    finished_at    TIMESTAMPTZ,
+    error          TEXT,
+    ticket_count   INTEGER,
+    size_bytes     BIGINT,
+    download_token TEXT              UNIQUE,
+    expires_at     TIMESTAMPTZ,
+    attempts       INTEGER           NOT NULL DEFAULT 0,
+    claimed_until  TIMESTAMPTZ
+);
+
+CREATE INDEX export_jobs_org_created ON export_jobs (org_id, created_at DESC);
+CREATE INDEX export_jobs_pending ON export_jobs (created_at) WHERE status IN ('pending', 'running');
+
+CREATE TRIGGER set_updated_at BEFORE UPDATE ON export_jobs
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+-- The export file, in order of seq.
+CREATE TABLE export_job_chunks (
+    job_id UUID    NOT NULL REFERENCES export_jobs(id) ON DELETE CASCADE,
+    seq    INTEGER NOT NULL,
+    data   BYTEA   NOT NULL,
+    PRIMARY KEY (job_id, seq)
+);
+
+ALTER TABLE export_jobs ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON export_jobs
+    USING (org_id = current_org_id()) WITH CHECK (org_id = current_org_id());
+
+ALTER TABLE export_job_chunks ENABLE ROW LEVEL SECURITY;
+CREATE POLICY org_isolation ON export_job_chunks
+    USING (EXISTS (SELECT 1 FROM export_jobs j WHERE j.id = job_id))
+    WITH CHECK (EXISTS (SELECT 1 FROM export_jobs j WHERE j.id = job_id));
+
+-- +goose Down
+
+DROP POLICY IF EXISTS org_isolation ON export_job_chunks;
+DROP POLICY IF EXISTS org_isolation ON export_jobs;
+DROP TABLE IF EXISTS export_job_chunks;
+DROP TRIGGER IF EXISTS set_updated_at ON export_jobs;
+DROP TABLE IF EXISTS export_jobs;
+DROP TYPE IF EXISTS export_job_status;